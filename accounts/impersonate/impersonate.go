@@ -0,0 +1,167 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package impersonate
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+const URLScheme = "impersonate"
+
+type Backend struct {
+	wallet *Wallet
+}
+
+func NewBackend() *Backend {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		panic("can't generate key: " + err.Error())
+	}
+	return &Backend{
+		wallet: &Wallet{
+			key:      key,
+			accounts: make(map[common.Address]struct{}),
+			senders:  make(map[common.Hash]common.Address),
+		},
+	}
+}
+
+func (b *Backend) Wallets() []accounts.Wallet {
+	return []accounts.Wallet{b.wallet}
+}
+
+func (b *Backend) Subscribe(sink chan<- accounts.WalletEvent) event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
+func (b *Backend) Impersonate(address common.Address) {
+	b.wallet.lock.Lock()
+	defer b.wallet.lock.Unlock()
+
+	b.wallet.accounts[address] = struct{}{}
+}
+
+func (b *Backend) Stop(address common.Address) bool {
+	b.wallet.lock.Lock()
+	defer b.wallet.lock.Unlock()
+
+	if _, ok := b.wallet.accounts[address]; !ok {
+		return false
+	}
+	delete(b.wallet.accounts, address)
+	return true
+}
+
+func (b *Backend) Sender(tx *types.Transaction) (common.Address, bool) {
+	b.wallet.lock.Lock()
+	defer b.wallet.lock.Unlock()
+
+	from, ok := b.wallet.senders[tx.Hash()]
+	delete(b.wallet.senders, tx.Hash())
+	return from, ok
+}
+
+type Wallet struct {
+	key      *ecdsa.PrivateKey
+	accounts map[common.Address]struct{}
+	senders  map[common.Hash]common.Address
+	lock     sync.RWMutex
+}
+
+func (w *Wallet) URL() accounts.URL {
+	return accounts.URL{Scheme: URLScheme, Path: "dev"}
+}
+
+func (w *Wallet) Status() (string, error) {
+	return "ok", nil
+}
+
+func (w *Wallet) Open(passphrase string) error { return nil }
+
+func (w *Wallet) Close() error { return nil }
+
+func (w *Wallet) Accounts() []accounts.Account {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	accs := make([]accounts.Account, 0, len(w.accounts))
+	for address := range w.accounts {
+		accs = append(accs, accounts.Account{Address: address, URL: w.URL()})
+	}
+	return accs
+}
+
+func (w *Wallet) Contains(account accounts.Account) bool {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	_, ok := w.accounts[account.Address]
+	return ok
+}
+
+func (w *Wallet) Derive(path accounts.DerivationPath, pin bool) (accounts.Account, error) {
+	return accounts.Account{}, accounts.ErrNotSupported
+}
+
+func (w *Wallet) SelfDerive(bases []accounts.DerivationPath, chain ethereum.ChainStateReader) {}
+
+func (w *Wallet) SignData(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+	return nil, accounts.ErrNotSupported
+}
+
+func (w *Wallet) SignDataWithPassphrase(account accounts.Account, passphrase, mimeType string, data []byte) ([]byte, error) {
+	return nil, accounts.ErrNotSupported
+}
+
+func (w *Wallet) SignText(account accounts.Account, text []byte) ([]byte, error) {
+	return nil, accounts.ErrNotSupported
+}
+
+func (w *Wallet) SignTextWithPassphrase(account accounts.Account, passphrase string, hash []byte) ([]byte, error) {
+	return nil, accounts.ErrNotSupported
+}
+
+func (w *Wallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	if !w.Contains(account) {
+		return nil, accounts.ErrUnknownAccount
+	}
+	signed, err := types.SignTx(tx, types.NewEIP155Signer(chainID), w.key)
+	if err != nil {
+		return nil, err
+	}
+	w.lock.Lock()
+	w.senders[signed.Hash()] = account.Address
+	w.lock.Unlock()
+
+	return signed, nil
+}
+
+func (w *Wallet) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return w.SignTx(account, tx, chainID)
+}
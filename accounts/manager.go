@@ -132,7 +132,22 @@ func (am *Manager) update() {
 }
 
 
+func (am *Manager) AddBackend(backend Backend) {
+	am.lock.Lock()
+	defer am.lock.Unlock()
+
+	am.wallets = merge(am.wallets, backend.Wallets()...)
+	am.updaters = append(am.updaters, backend.Subscribe(am.updates))
+
+	kind := reflect.TypeOf(backend)
+	am.backends[kind] = append(am.backends[kind], backend)
+}
+
+
 func (am *Manager) Backends(kind reflect.Type) []Backend {
+	am.lock.RLock()
+	defer am.lock.RUnlock()
+
 	return am.backends[kind]
 }
 
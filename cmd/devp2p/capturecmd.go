@@ -0,0 +1,432 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/devp2p/internal/ethtest"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/p2p/rlpx"
+	"github.com/ethereum/go-ethereum/rlp"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	captureCommand = cli.Command{
+		Name:  "capture",
+		Usage: "Inspect devp2p message captures",
+		Subcommands: []cli.Command{
+			capturePrintCommand,
+		},
+	}
+	capturePrintCommand = cli.Command{
+		Name:      "print",
+		Usage:     "Pretty-prints captured messages",
+		ArgsUsage: "<capture-file>",
+		Action:    capturePrint,
+		Flags: []cli.Flag{
+			capturePeerFlag,
+			captureProtoFlag,
+			captureCodeFlag,
+			captureDirectionFlag,
+			captureDecodeFlag,
+			captureJSONFlag,
+		},
+	}
+)
+
+var (
+	capturePeerFlag = cli.StringFlag{
+		Name:  "peer",
+		Usage: "Only show messages of peers whose ID starts with this hex prefix",
+	}
+	captureProtoFlag = cli.StringFlag{
+		Name:  "proto",
+		Usage: "Only show messages of this protocol (p2p, eth, les, ...)",
+	}
+	captureCodeFlag = cli.StringFlag{
+		Name:  "code",
+		Usage: "Only show messages with this protocol-relative message code",
+	}
+	captureDirectionFlag = cli.StringFlag{
+		Name:  "direction",
+		Usage: "Only show messages in this direction (in, out)",
+	}
+	captureDecodeFlag = cli.BoolFlag{
+		Name:  "decode",
+		Usage: "Decode message payloads",
+	}
+	captureJSONFlag = cli.BoolFlag{
+		Name:  "json",
+		Usage: "Print one JSON object per message (implies --decode)",
+	}
+)
+
+
+type captureFilter struct {
+	peer      string
+	proto     string
+	code      *uint64
+	direction string
+}
+
+func (f *captureFilter) match(rec *rlpx.CaptureRecord) bool {
+	if f.peer != "" && !strings.HasPrefix(hex.EncodeToString(rec.Peer), f.peer) {
+		return false
+	}
+	if f.proto != "" && rec.Protocol != f.proto {
+		return false
+	}
+	if f.code != nil && rec.Code != *f.code {
+		return false
+	}
+	if f.direction != "" && f.direction != captureDirection(rec) {
+		return false
+	}
+	return true
+}
+
+func captureDirection(rec *rlpx.CaptureRecord) string {
+	if rec.Egress {
+		return "out"
+	}
+	return "in"
+}
+
+func capturePrint(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("need capture file as argument")
+	}
+	filter := &captureFilter{
+		peer:      strings.ToLower(strings.TrimPrefix(ctx.String(capturePeerFlag.Name), "0x")),
+		proto:     ctx.String(captureProtoFlag.Name),
+		direction: ctx.String(captureDirectionFlag.Name),
+	}
+	if filter.direction != "" && filter.direction != "in" && filter.direction != "out" {
+		return fmt.Errorf("invalid direction %q, want \"in\" or \"out\"", filter.direction)
+	}
+	if ctx.IsSet(captureCodeFlag.Name) {
+		code, err := strconv.ParseUint(ctx.String(captureCodeFlag.Name), 0, 64)
+		if err != nil {
+			return fmt.Errorf("invalid message code: %v", err)
+		}
+		filter.code = &code
+	}
+	file, err := os.Open(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var (
+		asJSON = ctx.Bool(captureJSONFlag.Name)
+		decode = asJSON || ctx.Bool(captureDecodeFlag.Name)
+		enc    = json.NewEncoder(os.Stdout)
+		r      = rlpx.NewCaptureReader(file)
+	)
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("invalid capture record: %v", err)
+		}
+		if !filter.match(rec) {
+			continue
+		}
+		name, payload := decodeCapturedMsg(rec, decode)
+		if asJSON {
+			err = enc.Encode(capturedMsgJSON{
+				Time:      rec.Timestamp().UTC(),
+				Direction: captureDirection(rec),
+				Peer:      hex.EncodeToString(rec.Peer),
+				Protocol:  rec.Protocol,
+				Version:   rec.Version,
+				Code:      rec.Code,
+				Name:      name,
+				Size:      len(rec.Payload),
+				Payload:   payload,
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Printf("%s %-3s %x %s/%d %#02x %s (%d bytes)\n", rec.Timestamp().UTC().Format("2006-01-02T15:04:05.000000Z"),
+			captureDirection(rec), rec.Peer[:8], rec.Protocol, rec.Version, rec.Code, name, len(rec.Payload))
+		if decode {
+			out, err := json.MarshalIndent(payload, "    ", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Printf("    %s\n", out)
+		}
+	}
+}
+
+type capturedMsgJSON struct {
+	Time      time.Time   `json:"time"`
+	Direction string      `json:"direction"`
+	Peer      string      `json:"peer"`
+	Protocol  string      `json:"protocol"`
+	Version   uint        `json:"version"`
+	Code      uint64      `json:"code"`
+	Name      string      `json:"name"`
+	Size      int         `json:"size"`
+	Payload   interface{} `json:"payload,omitempty"`
+}
+
+
+
+
+func decodeCapturedMsg(rec *rlpx.CaptureRecord, decode bool) (string, interface{}) {
+	mt, ok := capturedMsgTypes[rec.Protocol][rec.Code]
+	if !ok {
+		mt.name = "unknown"
+	}
+	if !decode {
+		return mt.name, nil
+	}
+	if mt.new == nil {
+		return mt.name, decodeAnyRLP(rec.Payload)
+	}
+	if mt.tagged && rec.Protocol == "eth" && rec.Version >= 66 {
+		var packet struct {
+			RequestId uint64
+			Data      rlp.RawValue
+		}
+		if err := rlp.DecodeBytes(rec.Payload, &packet); err != nil {
+			return mt.name, decodeAnyRLP(rec.Payload)
+		}
+		v := mt.new()
+		if err := rlp.DecodeBytes(packet.Data, v); err != nil {
+			return mt.name, decodeAnyRLP(rec.Payload)
+		}
+		return mt.name, map[string]interface{}{"requestId": packet.RequestId, "data": v}
+	}
+	v := mt.new()
+	if err := rlp.DecodeBytes(rec.Payload, v); err != nil {
+		return mt.name, decodeAnyRLP(rec.Payload)
+	}
+	return mt.name, v
+}
+
+
+
+func decodeAnyRLP(data []byte) interface{} {
+	var v anyRLP
+	if err := rlp.DecodeBytes(data, &v); err != nil {
+		return hexutil.Bytes(data)
+	}
+	return v.value
+}
+
+
+type anyRLP struct {
+	value interface{}
+}
+
+func (a *anyRLP) DecodeRLP(s *rlp.Stream) error {
+	kind, _, err := s.Kind()
+	if err != nil {
+		return err
+	}
+	if kind != rlp.List {
+		b, err := s.Bytes()
+		a.value = hexutil.Bytes(b)
+		return err
+	}
+	if _, err := s.List(); err != nil {
+		return err
+	}
+	items := make([]interface{}, 0)
+	for {
+		var item anyRLP
+		if err := item.DecodeRLP(s); err == rlp.EOL {
+			break
+		} else if err != nil {
+			return err
+		}
+		items = append(items, item.value)
+	}
+	a.value = items
+	return s.ListEnd()
+}
+
+func (a anyRLP) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.value)
+}
+
+
+type capturedMsgType struct {
+	name   string
+	new    func() interface{}
+	tagged bool
+}
+
+type capturedKeyValue struct {
+	Key   string
+	Value anyRLP
+}
+
+type capturedBlock struct {
+	Block struct {
+		Header *types.Header
+		Txs    []*types.Transaction
+		Uncles []*types.Header
+	}
+	TD *big.Int
+}
+
+var capturedMsgTypes = map[string]map[uint64]capturedMsgType{
+	"p2p": {
+		0x00: {name: "Hello", new: func() interface{} { return new(ethtest.Hello) }},
+		0x01: {name: "Disconnect"},
+		0x02: {name: "Ping"},
+		0x03: {name: "Pong"},
+	},
+	"eth": {
+		0x00: {name: "Status", new: func() interface{} { return new(ethtest.Status) }},
+		0x01: {name: "NewBlockHashes", new: func() interface{} { return new(ethtest.NewBlockHashes) }},
+		0x02: {name: "Transactions", new: func() interface{} { return new([]*types.Transaction) }},
+		0x03: {name: "GetBlockHeaders", new: func() interface{} { return new(ethtest.GetBlockHeaders) }, tagged: true},
+		0x04: {name: "BlockHeaders", new: func() interface{} { return new([]*types.Header) }, tagged: true},
+		0x05: {name: "GetBlockBodies", new: func() interface{} { return new([]common.Hash) }, tagged: true},
+		0x06: {name: "BlockBodies", new: func() interface{} { return new([]*types.Body) }, tagged: true},
+		0x07: {name: "NewBlock", new: func() interface{} { return new(capturedBlock) }},
+		0x08: {name: "NewPooledTransactionHashes", new: func() interface{} { return new([]common.Hash) }},
+		0x09: {name: "GetPooledTransactions", new: func() interface{} { return new([]common.Hash) }, tagged: true},
+		0x0a: {name: "PooledTransactions", new: func() interface{} { return new([]*types.Transaction) }, tagged: true},
+		0x0d: {name: "GetNodeData", new: func() interface{} { return new([]common.Hash) }, tagged: true},
+		0x0e: {name: "NodeData", new: func() interface{} { return new([]hexutil.Bytes) }, tagged: true},
+		0x0f: {name: "GetReceipts", new: func() interface{} { return new([]common.Hash) }, tagged: true},
+		0x10: {name: "Receipts", new: func() interface{} { return new([][]*types.Receipt) }, tagged: true},
+	},
+	"les": {
+		0x00: {name: "Status", new: func() interface{} { return new([]capturedKeyValue) }},
+		0x01: {name: "Announce", new: func() interface{} {
+			return new(struct {
+				Hash       common.Hash
+				Number     uint64
+				Td         *big.Int
+				ReorgDepth uint64
+				Update     []capturedKeyValue
+			})
+		}},
+		0x02: {name: "GetBlockHeaders", new: func() interface{} {
+			return new(struct {
+				ReqID uint64
+				Query ethtest.GetBlockHeaders
+			})
+		}},
+		0x03: {name: "BlockHeaders", new: func() interface{} {
+			return new(struct {
+				ReqID, BV uint64
+				Headers   []*types.Header
+			})
+		}},
+		0x04: {name: "GetBlockBodies", new: func() interface{} {
+			return new(struct {
+				ReqID  uint64
+				Hashes []common.Hash
+			})
+		}},
+		0x05: {name: "BlockBodies", new: func() interface{} {
+			return new(struct {
+				ReqID, BV uint64
+				Bodies    []*types.Body
+			})
+		}},
+		0x06: {name: "GetReceipts", new: func() interface{} {
+			return new(struct {
+				ReqID  uint64
+				Hashes []common.Hash
+			})
+		}},
+		0x07: {name: "Receipts", new: func() interface{} {
+			return new(struct {
+				ReqID, BV uint64
+				Receipts  [][]*types.Receipt
+			})
+		}},
+		0x0a: {name: "GetCode", new: func() interface{} {
+			return new(struct {
+				ReqID uint64
+				Reqs  []struct {
+					BHash  common.Hash
+					AccKey hexutil.Bytes
+				}
+			})
+		}},
+		0x0b: {name: "Code", new: func() interface{} {
+			return new(struct {
+				ReqID, BV uint64
+				Data      []hexutil.Bytes
+			})
+		}},
+		0x0f: {name: "GetProofsV2", new: func() interface{} {
+			return new(struct {
+				ReqID uint64
+				Reqs  []struct {
+					BHash     common.Hash
+					AccKey    hexutil.Bytes
+					Key       hexutil.Bytes
+					FromLevel uint
+				}
+			})
+		}},
+		0x10: {name: "ProofsV2", new: func() interface{} {
+			return new(struct {
+				ReqID, BV uint64
+				Nodes     []anyRLP
+			})
+		}},
+		0x11: {name: "GetHelperTrieProofs"},
+		0x12: {name: "HelperTrieProofs"},
+		0x13: {name: "SendTxV2", new: func() interface{} {
+			return new(struct {
+				ReqID uint64
+				Txs   []*types.Transaction
+			})
+		}},
+		0x14: {name: "GetTxStatus", new: func() interface{} {
+			return new(struct {
+				ReqID  uint64
+				Hashes []common.Hash
+			})
+		}},
+		0x15: {name: "TxStatus", new: func() interface{} {
+			return new(struct {
+				ReqID, BV uint64
+				Status    []anyRLP
+			})
+		}},
+		0x16: {name: "StopMsg"},
+		0x17: {name: "ResumeMsg"},
+	},
+}
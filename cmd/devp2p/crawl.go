@@ -17,12 +17,17 @@
 package main
 
 import (
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 )
 
+const crawlFlushInterval = 5 * time.Minute
+
 type crawler struct {
 	input     nodeSet
 	output    nodeSet
@@ -34,6 +39,10 @@ type crawler struct {
 
 	
 	revalidateInterval time.Duration
+
+	
+	tracker *crawlTracker
+	flush   func(nodeSet)
 }
 
 type resolver interface {
@@ -70,6 +79,11 @@ func (c *crawler) run(timeout time.Duration) nodeSet {
 	for _, it := range c.iters {
 		go c.runIterator(doneCh, it)
 	}
+	flushTicker := time.NewTicker(crawlFlushInterval)
+	defer flushTicker.Stop()
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigc)
 
 loop:
 	for {
@@ -89,6 +103,13 @@ loop:
 			}
 		case <-timeoutCh:
 			break loop
+		case <-flushTicker.C:
+			if c.flush != nil {
+				c.flush(c.output)
+			}
+		case <-sigc:
+			log.Info("Got interrupt, stopping crawl")
+			break loop
 		}
 	}
 
@@ -139,6 +160,9 @@ func (c *crawler) updateNode(n *enode.Node) {
 			node.FirstResponse = node.LastCheck
 		}
 		node.LastResponse = node.LastCheck
+		if c.tracker != nil {
+			c.tracker.nodeSeen(nn)
+		}
 	}
 
 	
@@ -0,0 +1,243 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/forkid"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/metrics/prometheus"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+const statsWindow = 24 * time.Hour
+
+type crawlStats struct {
+	Nodes      int              `json:"nodes"`
+	Reachable  int              `json:"reachable"`
+	Clients    map[string]int   `json:"clients"`
+	Versions   map[string]int   `json:"versions"`
+	Caps       map[string]int   `json:"caps"`
+	Networks   map[uint64]int   `json:"networks"`
+	ForkIDs    map[string]int   `json:"forkIds"`
+	Compatible int              `json:"compatible"`
+	Forks      []*forkReadiness `json:"forks"`
+	Prefixes   map[string]int   `json:"prefixes"`
+	Updated    time.Time        `json:"updated"`
+}
+
+type forkReadiness struct {
+	Block uint64 `json:"block"`
+	Ready int    `json:"ready"`
+}
+
+func computeCrawlStats(network *crawlNetwork, nodes []*crawledNode) *crawlStats {
+	var (
+		now    = time.Now()
+		filter = forkid.NewStaticFilter(network.Config, network.Genesis)
+		stats  = &crawlStats{
+			Clients:  make(map[string]int),
+			Versions: make(map[string]int),
+			Caps:     make(map[string]int),
+			Networks: make(map[uint64]int),
+			ForkIDs:  make(map[string]int),
+			Prefixes: make(map[string]int),
+			Updated:  now.UTC(),
+		}
+		aware = make(map[string]uint64)
+	)
+	for _, fork := range forkid.Forks(network.Config) {
+		stats.Forks = append(stats.Forks, &forkReadiness{Block: fork})
+		id := forkid.NewID(network.Config, network.Genesis, fork)
+		aware[fmt.Sprintf("%x", id.Hash)] = fork
+	}
+	for _, n := range nodes {
+		if now.Sub(n.LastProbe) > statsWindow {
+			continue
+		}
+		stats.Nodes++
+		if n.LastSeen.IsZero() || now.Sub(n.LastSeen) > statsWindow {
+			continue
+		}
+		stats.Reachable++
+		client, version := parseClientName(n.Client)
+		stats.Clients[client]++
+		if version != "" {
+			stats.Versions[client+"/"+version]++
+		}
+		for _, cap := range n.Caps {
+			stats.Caps[cap]++
+		}
+		if prefix := ipPrefix(n.IP); prefix != "" {
+			stats.Prefixes[prefix]++
+		}
+		id, ok := n.forkID()
+		if !ok {
+			continue
+		}
+		stats.Networks[n.NetworkID]++
+		if n.NetworkID != network.NetworkID {
+			continue
+		}
+		stats.ForkIDs[fmt.Sprintf("%x/%d", id.Hash, id.Next)]++
+		if filter(id) == nil {
+			stats.Compatible++
+		}
+		passed := aware[fmt.Sprintf("%x", id.Hash)]
+		for _, fork := range stats.Forks {
+			if fork.Block <= passed || fork.Block == id.Next {
+				fork.Ready++
+			}
+		}
+	}
+	return stats
+}
+
+func parseClientName(name string) (client, version string) {
+	if name == "" {
+		return "unknown", ""
+	}
+	parts := strings.Split(name, "/")
+	client = strings.ToLower(parts[0])
+	for _, part := range parts[1:] {
+		if strings.HasPrefix(part, "v") && len(part) > 1 && part[1] >= '0' && part[1] <= '9' {
+			if i := strings.IndexAny(part, "-+"); i > 0 {
+				part = part[:i]
+			}
+			return client, part
+		}
+	}
+	return client, ""
+}
+
+func ipPrefix(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return (&net.IPNet{IP: ip4.Mask(net.CIDRMask(16, 32)), Mask: net.CIDRMask(16, 32)}).String()
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(32, 128)), Mask: net.CIDRMask(32, 128)}).String()
+}
+
+type crawlServer struct {
+	network  *crawlNetwork
+	tracker  *crawlTracker
+	registry metrics.Registry
+	lock     sync.Mutex
+}
+
+func newCrawlServer(network *crawlNetwork, tracker *crawlTracker) *crawlServer {
+	return &crawlServer{network: network, tracker: tracker, registry: metrics.NewRegistry()}
+}
+
+func (s *crawlServer) stats() *crawlStats {
+	return computeCrawlStats(s.network, s.tracker.snapshot())
+}
+
+func (s *crawlServer) serve(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSONResponse(w, s.stats())
+	})
+	mux.HandleFunc("/history", func(w http.ResponseWriter, r *http.Request) {
+		var id enode.ID
+		if err := id.UnmarshalText([]byte(r.URL.Query().Get("id"))); err != nil {
+			http.Error(w, fmt.Sprintf("invalid node ID: %v", err), http.StatusBadRequest)
+			return
+		}
+		if s.tracker.db == nil {
+			http.Error(w, "crawler database disabled", http.StatusNotFound)
+			return
+		}
+		history, err := s.tracker.db.history(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSONResponse(w, history)
+	})
+	metricsHandler := prometheus.Handler(s.registry)
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		s.updateMetrics()
+		metricsHandler.ServeHTTP(w, r)
+	})
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Info("Crawler HTTP server started", "addr", listener.Addr())
+	go http.Serve(listener, mux)
+	return nil
+}
+
+func writeJSONResponse(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", jsonIndent)
+	enc.Encode(v)
+}
+
+func (s *crawlServer) updateMetrics() {
+	stats := s.stats()
+	s.registry.UnregisterAll()
+
+	gauge := func(name string, value int) {
+		metrics.GetOrRegisterGauge(name, s.registry).Update(int64(value))
+	}
+	gauge("crawler/nodes", stats.Nodes)
+	gauge("crawler/reachable", stats.Reachable)
+	gauge("crawler/compatible", stats.Compatible)
+	for client, count := range stats.Clients {
+		gauge("crawler/clients/"+metricName(client), count)
+	}
+	for version, count := range stats.Versions {
+		gauge("crawler/versions/"+metricName(version), count)
+	}
+	for id, count := range stats.ForkIDs {
+		gauge("crawler/forkids/"+metricName(id), count)
+	}
+	for _, fork := range stats.Forks {
+		gauge(fmt.Sprintf("crawler/forks/%d/ready", fork.Block), fork.Ready)
+	}
+	for prefix, count := range stats.Prefixes {
+		gauge("crawler/prefixes/"+metricName(prefix), count)
+	}
+}
+
+func metricName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
@@ -0,0 +1,470 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/devp2p/internal/ethtest"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/forkid"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/leveldb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/rlpx"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"gopkg.in/urfave/cli.v1"
+)
+
+const (
+	probeTimeout    = 10 * time.Second
+	probeInterval   = 30 * time.Minute
+	probeWorkers    = 16
+	probeQueueLimit = 1024
+
+	baseProtocolVersion = 5
+	ethProtocolOffset   = 16
+)
+
+const (
+	helloMsg = 0x00
+	discMsg  = 0x01
+	pingMsg  = 0x02
+	pongMsg  = 0x03
+)
+
+var (
+	crawlNodePrefix    = []byte("n:")
+	crawlHistoryPrefix = []byte("h:")
+
+	errNoEthProtocol = errors.New("no matching eth protocol version")
+)
+
+var probeEthVersions = []uint{64, 65, 66}
+
+type crawledNode struct {
+	ID        enode.ID    `json:"id"`
+	URL       string      `json:"enode"`
+	IP        net.IP      `json:"ip,omitempty"`
+	Client    string      `json:"client,omitempty"`
+	Caps      []string    `json:"caps,omitempty"`
+	NetworkID uint64      `json:"networkId,omitempty"`
+	ForkHash  string      `json:"forkHash,omitempty"`
+	ForkNext  uint64      `json:"forkNext,omitempty"`
+	Head      common.Hash `json:"head,omitempty"`
+	TD        *big.Int    `json:"td,omitempty"`
+	FirstSeen time.Time   `json:"firstSeen,omitempty"`
+	LastSeen  time.Time   `json:"lastSeen,omitempty"`
+	LastProbe time.Time   `json:"lastProbe"`
+	Error     string      `json:"error,omitempty"`
+}
+
+func (n *crawledNode) forkID() (forkid.ID, bool) {
+	if n.ForkHash == "" {
+		return forkid.ID{}, false
+	}
+	hash, err := hexutil.Decode(n.ForkHash)
+	if err != nil || len(hash) != 4 {
+		return forkid.ID{}, false
+	}
+	id := forkid.ID{Next: n.ForkNext}
+	copy(id.Hash[:], hash)
+	return id, true
+}
+
+type crawlNetwork struct {
+	Name      string
+	NetworkID uint64
+	Config    *params.ChainConfig
+	Genesis   common.Hash
+	TD        *big.Int
+}
+
+func makeCrawlNetwork(name string) (*crawlNetwork, error) {
+	var (
+		genesis   *core.Genesis
+		networkID uint64
+	)
+	switch name {
+	case "mainnet":
+		genesis, networkID = core.DefaultGenesisBlock(), 1
+	case "ropsten":
+		genesis, networkID = core.DefaultRopstenGenesisBlock(), 3
+	case "rinkeby":
+		genesis, networkID = core.DefaultRinkebyGenesisBlock(), 4
+	case "goerli":
+		genesis, networkID = core.DefaultGoerliGenesisBlock(), 5
+	default:
+		return nil, fmt.Errorf("unknown network %q", name)
+	}
+	block := genesis.ToBlock(nil)
+	return &crawlNetwork{
+		Name:      name,
+		NetworkID: networkID,
+		Config:    genesis.Config,
+		Genesis:   block.Hash(),
+		TD:        block.Difficulty(),
+	}, nil
+}
+
+type crawlDB struct {
+	db ethdb.KeyValueStore
+}
+
+func openCrawlDB(file string) (*crawlDB, error) {
+	db, err := leveldb.New(file, 16, 16, "devp2p/crawldb")
+	if err != nil {
+		return nil, err
+	}
+	return &crawlDB{db: db}, nil
+}
+
+func (db *crawlDB) close() error {
+	return db.db.Close()
+}
+
+func (db *crawlDB) nodeKey(id enode.ID) []byte {
+	return append(common.CopyBytes(crawlNodePrefix), id[:]...)
+}
+
+func (db *crawlDB) historyKey(id enode.ID, t time.Time) []byte {
+	key := append(common.CopyBytes(crawlHistoryPrefix), id[:]...)
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(t.UnixNano()))
+	return append(key, ts[:]...)
+}
+
+func (db *crawlDB) store(n *crawledNode) error {
+	blob, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	batch := db.db.NewBatch()
+	batch.Put(db.nodeKey(n.ID), blob)
+	batch.Put(db.historyKey(n.ID, n.LastProbe), blob)
+	return batch.Write()
+}
+
+func (db *crawlDB) nodes() (map[enode.ID]*crawledNode, error) {
+	it := db.db.NewIterator(crawlNodePrefix, nil)
+	defer it.Release()
+
+	nodes := make(map[enode.ID]*crawledNode)
+	for it.Next() {
+		n := new(crawledNode)
+		if err := json.Unmarshal(it.Value(), n); err != nil {
+			log.Warn("Skipping invalid crawler record", "key", hexutil.Encode(it.Key()), "err", err)
+			continue
+		}
+		nodes[n.ID] = n
+	}
+	return nodes, it.Error()
+}
+
+func (db *crawlDB) history(id enode.ID) ([]*crawledNode, error) {
+	it := db.db.NewIterator(append(common.CopyBytes(crawlHistoryPrefix), id[:]...), nil)
+	defer it.Release()
+
+	var history []*crawledNode
+	for it.Next() {
+		n := new(crawledNode)
+		if err := json.Unmarshal(it.Value(), n); err != nil {
+			return nil, err
+		}
+		history = append(history, n)
+	}
+	return history, it.Error()
+}
+
+type probeResult struct {
+	hello  ethtest.Hello
+	status *ethtest.Status
+}
+
+type rlpxProber struct {
+	key     *ecdsa.PrivateKey
+	network *crawlNetwork
+}
+
+func (p *rlpxProber) probe(n *enode.Node) (*probeResult, error) {
+	addr := &net.TCPAddr{IP: n.IP(), Port: n.TCP()}
+	fd, err := net.DialTimeout("tcp", addr.String(), probeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := rlpx.NewConn(fd, n.Pubkey())
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(probeTimeout))
+	if _, err := conn.Handshake(p.key); err != nil {
+		return nil, err
+	}
+	ours := ethtest.Hello{
+		Version: baseProtocolVersion,
+		Name:    "devp2p-crawler",
+		ID:      crypto.FromECDSAPub(&p.key.PublicKey)[1:],
+	}
+	for _, v := range probeEthVersions {
+		ours.Caps = append(ours.Caps, p2p.Cap{Name: "eth", Version: v})
+	}
+	if err := p.write(conn, helloMsg, &ours); err != nil {
+		return nil, err
+	}
+	res := new(probeResult)
+	if err := p.read(conn, helloMsg, &res.hello); err != nil {
+		return nil, err
+	}
+	conn.SetSnappy(res.hello.Version >= baseProtocolVersion)
+	defer p.write(conn, discMsg, []p2p.DiscReason{p2p.DiscQuitting})
+
+	var version uint
+	for _, cap := range res.hello.Caps {
+		for _, v := range probeEthVersions {
+			if cap.Name == "eth" && cap.Version == v && v > version {
+				version = v
+			}
+		}
+	}
+	if version == 0 {
+		return res, errNoEthProtocol
+	}
+	status := &ethtest.Status{
+		ProtocolVersion: uint32(version),
+		NetworkID:       p.network.NetworkID,
+		TD:              p.network.TD,
+		Head:            p.network.Genesis,
+		Genesis:         p.network.Genesis,
+		ForkID:          forkid.NewID(p.network.Config, p.network.Genesis, 0),
+	}
+	if err := p.write(conn, ethProtocolOffset, status); err != nil {
+		return res, err
+	}
+	res.status = new(ethtest.Status)
+	if err := p.read(conn, ethProtocolOffset, res.status); err != nil {
+		res.status = nil
+		return res, err
+	}
+	return res, nil
+}
+
+func (p *rlpxProber) write(conn *rlpx.Conn, code uint64, msg interface{}) error {
+	data, err := rlp.EncodeToBytes(msg)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write(code, data)
+	return err
+}
+
+func (p *rlpxProber) read(conn *rlpx.Conn, want uint64, msg interface{}) error {
+	for {
+		code, data, _, err := conn.Read()
+		if err != nil {
+			return err
+		}
+		switch code {
+		case want:
+			return rlp.DecodeBytes(data, msg)
+		case discMsg:
+			var reason []p2p.DiscReason
+			rlp.DecodeBytes(data, &reason)
+			if len(reason) > 0 {
+				return reason[0]
+			}
+			return p2p.DiscRequested
+		case pingMsg:
+			if err := p.write(conn, pongMsg, []interface{}{}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func startCrawlTracker(ctx *cli.Context) *crawlTracker {
+	if !ctx.IsSet(crawlDBFlag.Name) && !ctx.IsSet(crawlStatsAddrFlag.Name) {
+		return nil
+	}
+	network, err := makeCrawlNetwork(ctx.String(crawlNetworkFlag.Name))
+	if err != nil {
+		exit(err)
+	}
+	var db *crawlDB
+	if ctx.IsSet(crawlDBFlag.Name) {
+		if db, err = openCrawlDB(ctx.String(crawlDBFlag.Name)); err != nil {
+			exit(err)
+		}
+	}
+	key, _ := crypto.GenerateKey()
+	tracker, err := newCrawlTracker(db, &rlpxProber{key: key, network: network})
+	if err != nil {
+		exit(err)
+	}
+	if ctx.IsSet(crawlStatsAddrFlag.Name) {
+		metrics.Enabled = true
+		if err := newCrawlServer(network, tracker).serve(ctx.String(crawlStatsAddrFlag.Name)); err != nil {
+			exit(err)
+		}
+	}
+	return tracker
+}
+
+type crawlTracker struct {
+	db     *crawlDB
+	prober *rlpxProber
+	queue  chan *enode.Node
+	closed chan struct{}
+	wg     sync.WaitGroup
+
+	lock    sync.Mutex
+	nodes   map[enode.ID]*crawledNode
+	pending map[enode.ID]struct{}
+}
+
+func newCrawlTracker(db *crawlDB, prober *rlpxProber) (*crawlTracker, error) {
+	t := &crawlTracker{
+		db:      db,
+		prober:  prober,
+		queue:   make(chan *enode.Node, probeQueueLimit),
+		closed:  make(chan struct{}),
+		nodes:   make(map[enode.ID]*crawledNode),
+		pending: make(map[enode.ID]struct{}),
+	}
+	if db != nil {
+		nodes, err := db.nodes()
+		if err != nil {
+			return nil, err
+		}
+		t.nodes = nodes
+	}
+	t.wg.Add(probeWorkers)
+	for i := 0; i < probeWorkers; i++ {
+		go t.probeLoop()
+	}
+	return t, nil
+}
+
+func (t *crawlTracker) close() {
+	close(t.closed)
+	t.wg.Wait()
+	if t.db != nil {
+		t.db.close()
+	}
+}
+
+func (t *crawlTracker) nodeSeen(n *enode.Node) {
+	if n.IP() == nil || n.TCP() == 0 {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if prev := t.nodes[n.ID()]; prev != nil && time.Since(prev.LastProbe) < probeInterval {
+		return
+	}
+	if _, ok := t.pending[n.ID()]; ok {
+		return
+	}
+	select {
+	case t.queue <- n:
+		t.pending[n.ID()] = struct{}{}
+	default:
+		log.Debug("Crawler probe queue full, skipping node", "id", n.ID())
+	}
+}
+
+func (t *crawlTracker) probeLoop() {
+	defer t.wg.Done()
+	for {
+		select {
+		case n := <-t.queue:
+			res, err := t.prober.probe(n)
+			t.update(n, res, err)
+		case <-t.closed:
+			return
+		}
+	}
+}
+
+func (t *crawlTracker) update(n *enode.Node, res *probeResult, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.pending, n.ID())
+	rec := &crawledNode{ID: n.ID()}
+	if prev := t.nodes[n.ID()]; prev != nil {
+		*rec = *prev
+	}
+	rec.URL = n.URLv4()
+	rec.IP = n.IP()
+	rec.LastProbe = truncNow()
+	rec.Error = ""
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	if res != nil {
+		rec.Client = res.hello.Name
+		rec.Caps = nil
+		for _, cap := range res.hello.Caps {
+			rec.Caps = append(rec.Caps, cap.String())
+		}
+		rec.LastSeen = rec.LastProbe
+		if rec.FirstSeen.IsZero() {
+			rec.FirstSeen = rec.LastProbe
+		}
+	}
+	if res != nil && res.status != nil {
+		rec.NetworkID = res.status.NetworkID
+		rec.ForkHash = hexutil.Encode(res.status.ForkID.Hash[:])
+		rec.ForkNext = res.status.ForkID.Next
+		rec.Head = res.status.Head
+		rec.TD = res.status.TD
+	}
+	log.Debug("Probed node", "id", n.ID(), "client", rec.Client, "err", err)
+	t.nodes[n.ID()] = rec
+	if t.db != nil {
+		if err := t.db.store(rec); err != nil {
+			log.Warn("Failed to store crawler record", "id", n.ID(), "err", err)
+		}
+	}
+}
+
+func (t *crawlTracker) snapshot() []*crawledNode {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	nodes := make([]*crawledNode, 0, len(t.nodes))
+	for _, n := range t.nodes {
+		cpy := *n
+		nodes = append(nodes, &cpy)
+	}
+	return nodes
+}
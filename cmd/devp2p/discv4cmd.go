@@ -19,14 +19,12 @@ package main
 import (
 	"fmt"
 	"net"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum/cmd/devp2p/internal/v4test"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/internal/utesting"
 	"github.com/ethereum/go-ethereum/p2p/discover"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/params"
@@ -76,13 +74,13 @@ var (
 		Name:   "crawl",
 		Usage:  "Updates a nodes.json file with random nodes found in the DHT",
 		Action: discv4Crawl,
-		Flags:  []cli.Flag{bootnodesFlag, crawlTimeoutFlag},
+		Flags:  []cli.Flag{bootnodesFlag, crawlTimeoutFlag, crawlDBFlag, crawlStatsAddrFlag, crawlNetworkFlag},
 	}
 	discv4TestCommand = cli.Command{
 		Name:   "test",
 		Usage:  "Runs tests against a node",
 		Action: discv4Test,
-		Flags:  []cli.Flag{remoteEnodeFlag, testPatternFlag, testListen1Flag, testListen2Flag},
+		Flags:  []cli.Flag{remoteEnodeFlag, testPatternFlag, testTAPFlag, testJSONFlag, testListen1Flag, testListen2Flag},
 	}
 )
 
@@ -105,18 +103,27 @@ var (
 	}
 	crawlTimeoutFlag = cli.DurationFlag{
 		Name:  "timeout",
-		Usage: "Time limit for the crawl.",
+		Usage: "Time limit for the crawl (0 = run until interrupted).",
 		Value: 30 * time.Minute,
 	}
+	crawlDBFlag = cli.StringFlag{
+		Name:  "crawldb",
+		Usage: "Database for RLPx probe history (enables RLPx probing)",
+	}
+	crawlStatsAddrFlag = cli.StringFlag{
+		Name:  "stats.addr",
+		Usage: "Listening address of the crawler statistics HTTP server (enables RLPx probing)",
+	}
+	crawlNetworkFlag = cli.StringFlag{
+		Name:  "network",
+		Usage: "Network used for eth status exchange and fork readiness (mainnet, ropsten, rinkeby, goerli)",
+		Value: "mainnet",
+	}
 	remoteEnodeFlag = cli.StringFlag{
 		Name:   "remote",
 		Usage:  "Enode of the remote node under test",
 		EnvVar: "REMOTE_ENODE",
 	}
-	testPatternFlag = cli.StringFlag{
-		Name:  "run",
-		Usage: "Pattern of test suite(s) to run",
-	}
 	testListen1Flag = cli.StringFlag{
 		Name:  "listen1",
 		Usage: "IP address of the first tester",
@@ -204,10 +211,16 @@ func discv4Crawl(ctx *cli.Context) error {
 		inputSet = loadNodesJSON(nodesFile)
 	}
 
+	tracker := startCrawlTracker(ctx)
+	if tracker != nil {
+		defer tracker.close()
+	}
 	disc := startV4(ctx)
 	defer disc.Close()
 	c := newCrawler(inputSet, disc, disc.RandomNodes())
 	c.revalidateInterval = 10 * time.Minute
+	c.tracker = tracker
+	c.flush = func(nodes nodeSet) { writeNodesJSON(nodesFile, nodes) }
 	output := c.run(ctx.Duration(crawlTimeoutFlag.Name))
 	writeNodesJSON(nodesFile, output)
 	return nil
@@ -223,16 +236,7 @@ func discv4Test(ctx *cli.Context) error {
 	v4test.Listen2 = ctx.String(testListen2Flag.Name)
 
 	
-	tests := v4test.AllTests
-	if ctx.IsSet(testPatternFlag.Name) {
-		tests = utesting.MatchTests(tests, ctx.String(testPatternFlag.Name))
-	}
-	results := utesting.RunTests(tests, os.Stdout)
-	if fails := utesting.CountFailures(results); fails > 0 {
-		return fmt.Errorf("%v/%v tests passed.", len(tests)-fails, len(tests))
-	}
-	fmt.Printf("%v/%v passed\n", len(tests), len(tests))
-	return nil
+	return runTests(ctx, v4test.AllTests)
 }
 
 
@@ -0,0 +1,794 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/dnsdisc"
+	"golang.org/x/net/dns/dnsmessage"
+	"gopkg.in/urfave/cli.v1"
+)
+
+const (
+	rfc2136UpdateSizeLimit = 32000
+	rfc2136DefaultTimeout  = 10 * time.Second
+	tsigFudge              = 300
+	tsigMaxUnsigned        = 99
+
+	dnsTypeSOA  = 6
+	dnsTypeTXT  = 16
+	dnsTypeTSIG = 250
+	dnsTypeAXFR = 252
+	dnsClassIN  = 1
+	dnsClassANY = 255
+	dnsOpUpdate = 5
+)
+
+var (
+	rfc2136ServerFlag = cli.StringFlag{
+		Name:   "server",
+		Usage:  "Address of the authoritative DNS server (host:port)",
+		EnvVar: "RFC2136_SERVER",
+	}
+	rfc2136ZoneFlag = cli.StringFlag{
+		Name:  "zone",
+		Usage: "DNS zone containing the tree (optional)",
+	}
+	rfc2136KeyNameFlag = cli.StringFlag{
+		Name:   "tsig-key",
+		Usage:  "Name of the TSIG key used to sign updates",
+		EnvVar: "RFC2136_TSIG_KEY",
+	}
+	rfc2136KeySecretFlag = cli.StringFlag{
+		Name:   "tsig-secret",
+		Usage:  "TSIG key secret (base64)",
+		EnvVar: "RFC2136_TSIG_SECRET",
+	}
+	rfc2136KeyAlgFlag = cli.StringFlag{
+		Name:  "tsig-algorithm",
+		Usage: "TSIG algorithm (hmac-sha1, hmac-sha256, hmac-sha384, hmac-sha512)",
+		Value: "hmac-sha256",
+	}
+)
+
+var (
+	errDNSResponseID = errors.New("DNS response ID mismatch")
+	errDNSMalformed  = errors.New("malformed DNS message")
+	errTSIGUnsigned  = errors.New("DNS response is not signed")
+	errTSIGKey       = errors.New("DNS response signed with unexpected TSIG key")
+	errTSIGMAC       = errors.New("DNS response has invalid TSIG signature")
+	errTSIGTime      = errors.New("DNS response TSIG time outside of fudge window")
+)
+
+var tsigAlgorithms = map[string]func() hash.Hash{
+	"hmac-sha1":   sha1.New,
+	"hmac-sha256": sha256.New,
+	"hmac-sha384": sha512.New384,
+	"hmac-sha512": sha512.New,
+}
+
+var dnsRCodeNames = map[dnsmessage.RCode]string{
+	1:  "FORMERR",
+	2:  "SERVFAIL",
+	3:  "NXDOMAIN",
+	4:  "NOTIMP",
+	5:  "REFUSED",
+	6:  "YXDOMAIN",
+	7:  "YXRRSET",
+	8:  "NXRRSET",
+	9:  "NOTAUTH",
+	10: "NOTZONE",
+	16: "BADSIG",
+	17: "BADKEY",
+	18: "BADTIME",
+}
+
+type rfc2136Client struct {
+	server  string
+	zone    string
+	key     *tsigKey
+	timeout time.Duration
+}
+
+type tsigKey struct {
+	name      string
+	algorithm string
+	secret    []byte
+}
+
+type dnsRequest struct {
+	msg []byte
+	mac []byte
+}
+
+type tsigVerifier struct {
+	key      *tsigKey
+	mac      []byte
+	unsigned []byte
+	count    int
+	signed   bool
+}
+
+type tsigRecord struct {
+	name      []byte
+	algorithm []byte
+	signed    uint64
+	fudge     uint16
+	mac       []byte
+	origID    uint16
+	err       uint16
+	other     []byte
+}
+
+
+func newRFC2136Client(ctx *cli.Context) *rfc2136Client {
+	server := ctx.String(rfc2136ServerFlag.Name)
+	if server == "" {
+		exit(fmt.Errorf("need DNS server address to proceed"))
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	c := &rfc2136Client{
+		server:  server,
+		zone:    ctx.String(rfc2136ZoneFlag.Name),
+		timeout: rfc2136DefaultTimeout,
+	}
+	if timeout := ctx.Duration(dnsTimeoutFlag.Name); timeout > 0 {
+		c.timeout = timeout
+	}
+	if name := ctx.String(rfc2136KeyNameFlag.Name); name != "" {
+		alg := strings.ToLower(strings.TrimSuffix(ctx.String(rfc2136KeyAlgFlag.Name), "."))
+		if tsigAlgorithms[alg] == nil {
+			exit(fmt.Errorf("unsupported TSIG algorithm %q", alg))
+		}
+		secret, err := base64.StdEncoding.DecodeString(ctx.String(rfc2136KeySecretFlag.Name))
+		if err != nil || len(secret) == 0 {
+			exit(fmt.Errorf("need valid base64 TSIG secret for key %q", name))
+		}
+		c.key = &tsigKey{name: name, algorithm: alg, secret: secret}
+	}
+	return c
+}
+
+
+func (c *rfc2136Client) deploy(name string, t *dnsdisc.Tree) error {
+	if err := c.checkZone(name); err != nil {
+		return err
+	}
+	existing, err := c.collectRecords(name)
+	if err != nil {
+		return err
+	}
+	log.Info(fmt.Sprintf("Found %d TXT records", len(existing)))
+
+	records := t.ToTXT(name)
+	changes := computeTXTChanges(name, records, existing, func(v string) string { return v })
+	if len(changes) == 0 {
+		log.Info("No DNS changes needed")
+		return nil
+	}
+
+	updates, err := c.makeUpdates(changes)
+	if err != nil {
+		return err
+	}
+	for i, req := range updates {
+		log.Info(fmt.Sprintf("Submitting update %d/%d to %s", i+1, len(updates), c.server))
+		if err := c.update(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+
+func (c *rfc2136Client) checkZone(name string) error {
+	if c.zone == "" {
+		log.Info(fmt.Sprintf("Finding DNS zone for %s", name))
+		zone, err := c.findZone(name)
+		if err != nil {
+			return err
+		}
+		c.zone = zone
+	}
+	c.zone = strings.ToLower(strings.TrimSuffix(c.zone, "."))
+	if !isSubdomain(name, c.zone) {
+		return fmt.Errorf("DNS zone %q does not contain name %q", c.zone, name)
+	}
+	return nil
+}
+
+
+func (c *rfc2136Client) findZone(name string) (string, error) {
+	var zone string
+	err := c.exchange(dnsRequest{msg: newDNSQuery(name, dnsTypeSOA)}, func(resp []byte) (bool, error) {
+		var p dnsmessage.Parser
+		h, err := p.Start(resp)
+		if err != nil {
+			return true, err
+		}
+		if h.RCode != dnsmessage.RCodeSuccess && h.RCode != dnsmessage.RCodeNameError {
+			return true, dnsRCodeError(h.RCode)
+		}
+		if err := p.SkipAllQuestions(); err != nil {
+			return true, err
+		}
+		sections := []struct {
+			header func() (dnsmessage.ResourceHeader, error)
+			skip   func() error
+		}{
+			{p.AnswerHeader, p.SkipAnswer},
+			{p.AuthorityHeader, p.SkipAuthority},
+		}
+		for _, s := range sections {
+			for {
+				rh, err := s.header()
+				if err == dnsmessage.ErrSectionDone {
+					break
+				} else if err != nil {
+					return true, err
+				}
+				if rh.Type == dnsmessage.TypeSOA && zone == "" {
+					zone = rh.Name.String()
+				}
+				if err := s.skip(); err != nil {
+					return true, err
+				}
+			}
+		}
+		return true, nil
+	})
+	if err == nil && zone == "" {
+		err = fmt.Errorf("no SOA record found for %s", name)
+	}
+	return zone, err
+}
+
+
+
+func (c *rfc2136Client) collectRecords(name string) (map[string]recordSet, error) {
+	log.Info(fmt.Sprintf("Retrieving existing TXT records on %s (zone %s)", name, c.zone))
+	req, err := c.sign(newDNSQuery(c.zone, dnsTypeAXFR))
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		existing = make(map[string]recordSet)
+		soaCount int
+	)
+	err = c.exchange(req, func(resp []byte) (bool, error) {
+		var p dnsmessage.Parser
+		h, err := p.Start(resp)
+		if err != nil {
+			return true, err
+		}
+		if h.RCode != dnsmessage.RCodeSuccess {
+			return true, dnsRCodeError(h.RCode)
+		}
+		if err := p.SkipAllQuestions(); err != nil {
+			return true, err
+		}
+		for {
+			rh, err := p.AnswerHeader()
+			if err == dnsmessage.ErrSectionDone {
+				break
+			} else if err != nil {
+				return true, err
+			}
+			switch rh.Type {
+			case dnsmessage.TypeSOA:
+				soaCount++
+				err = p.SkipAnswer()
+			case dnsmessage.TypeTXT:
+				var txt dnsmessage.TXTResource
+				if txt, err = p.TXTResource(); err != nil {
+					break
+				}
+				path := strings.ToLower(strings.TrimSuffix(rh.Name.String(), "."))
+				if !isSubdomain(path, name) {
+					break
+				}
+				set := existing[path]
+				set.ttl = int64(rh.TTL)
+				set.values = append(set.values, strings.Join(txt.TXT, ""))
+				existing[path] = set
+			default:
+				err = p.SkipAnswer()
+			}
+			if err != nil {
+				return true, err
+			}
+		}
+
+		return soaCount >= 2, nil
+	})
+	return existing, err
+}
+
+
+
+func (c *rfc2136Client) makeUpdates(changes []*txtChange) ([]dnsRequest, error) {
+	var (
+		updates []dnsRequest
+		rrs     []byte
+		count   int
+	)
+	flush := func() error {
+		req, err := c.sign(newDNSUpdate(c.zone, rrs, count))
+		if err != nil {
+			return err
+		}
+		updates = append(updates, req)
+		rrs, count = nil, 0
+		return nil
+	}
+	for _, ch := range changes {
+		var b dnsBuilder
+		n := 1
+		switch ch.action {
+		case "CREATE":
+			b.rr(ch.name, dnsTypeTXT, dnsClassIN, uint32(ch.ttl), txtRData(ch.values[0]))
+		case "UPSERT":
+			b.rr(ch.name, dnsTypeTXT, dnsClassANY, 0, nil)
+			b.rr(ch.name, dnsTypeTXT, dnsClassIN, uint32(ch.ttl), txtRData(ch.values[0]))
+			n = 2
+		case "DELETE":
+			b.rr(ch.name, dnsTypeTXT, dnsClassANY, 0, nil)
+		default:
+			return nil, fmt.Errorf("invalid change action %q", ch.action)
+		}
+		if b.err != nil {
+			return nil, b.err
+		}
+		if count > 0 && len(rrs)+len(b.buf) > rfc2136UpdateSizeLimit {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+		rrs = append(rrs, b.buf...)
+		count += n
+	}
+	if count > 0 {
+		if err := flush(); err != nil {
+			return nil, err
+		}
+	}
+	return updates, nil
+}
+
+
+func (c *rfc2136Client) update(req dnsRequest) error {
+	return c.exchange(req, func(resp []byte) (bool, error) {
+		var p dnsmessage.Parser
+		h, err := p.Start(resp)
+		if err != nil {
+			return true, err
+		}
+		if h.RCode != dnsmessage.RCodeSuccess {
+			return true, fmt.Errorf("DNS update failed: %v", dnsRCodeError(h.RCode))
+		}
+		return true, nil
+	})
+}
+
+
+
+func (c *rfc2136Client) exchange(req dnsRequest, handle func([]byte) (bool, error)) error {
+	conn, err := net.DialTimeout("tcp", c.server, c.timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var (
+		msg = req.msg
+		v   *tsigVerifier
+	)
+	if c.key != nil && req.mac != nil {
+		v = &tsigVerifier{key: c.key, mac: req.mac}
+	}
+
+	frame := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(frame, uint16(len(msg)))
+	copy(frame[2:], msg)
+	conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := conn.Write(frame); err != nil {
+		return err
+	}
+	for {
+		conn.SetDeadline(time.Now().Add(c.timeout))
+		var size [2]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return err
+		}
+		resp := make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return err
+		}
+		if len(resp) < 2 || resp[0] != msg[0] || resp[1] != msg[1] {
+			return errDNSResponseID
+		}
+		if v != nil {
+			if err := v.verify(resp, time.Now()); err != nil {
+				return err
+			}
+		}
+		done, err := handle(resp)
+		if err != nil {
+			return err
+		}
+		if done {
+			if v != nil && (!v.signed || v.count > 0) {
+				return errTSIGUnsigned
+			}
+			return nil
+		}
+	}
+}
+
+
+func (c *rfc2136Client) sign(msg []byte) (dnsRequest, error) {
+	if c.key == nil {
+		return dnsRequest{msg: msg}, nil
+	}
+	signed, mac, err := c.key.sign(msg, time.Now())
+	return dnsRequest{msg: signed, mac: mac}, err
+}
+
+
+func (k *tsigKey) sign(msg []byte, now time.Time) ([]byte, []byte, error) {
+	signed := uint64(now.Unix())
+
+	var vars dnsBuilder
+	k.variables(&vars, signed, tsigFudge, 0, nil)
+	if vars.err != nil {
+		return nil, nil, vars.err
+	}
+	h := hmac.New(tsigAlgorithms[k.algorithm], k.secret)
+	h.Write(msg)
+	h.Write(vars.buf)
+	mac := h.Sum(nil)
+
+	var rdata dnsBuilder
+	rdata.name(k.algorithm)
+	rdata.uint48(signed)
+	rdata.uint16(tsigFudge)
+	rdata.uint16(uint16(len(mac)))
+	rdata.buf = append(rdata.buf, mac...)
+	rdata.buf = append(rdata.buf, msg[0], msg[1])
+	rdata.uint16(0)
+	rdata.uint16(0)
+
+	out := dnsBuilder{buf: append([]byte(nil), msg...)}
+	out.rr(k.name, dnsTypeTSIG, dnsClassANY, 0, rdata.buf)
+	if out.err != nil {
+		return nil, nil, out.err
+	}
+	binary.BigEndian.PutUint16(out.buf[10:], binary.BigEndian.Uint16(out.buf[10:])+1)
+	return out.buf, mac, nil
+}
+
+func (k *tsigKey) variables(b *dnsBuilder, signed uint64, fudge, rcode uint16, other []byte) {
+	b.name(strings.ToLower(k.name))
+	b.uint16(dnsClassANY)
+	b.uint32(0)
+	b.name(k.algorithm)
+	b.uint48(signed)
+	b.uint16(fudge)
+	b.uint16(rcode)
+	b.uint16(uint16(len(other)))
+	b.buf = append(b.buf, other...)
+}
+
+
+
+
+
+func (v *tsigVerifier) verify(resp []byte, now time.Time) error {
+	msg, rec, err := splitTSIG(resp)
+	if err != nil {
+		return err
+	}
+	if rec == nil {
+		if v.count++; v.count > tsigMaxUnsigned {
+			return errTSIGUnsigned
+		}
+		v.unsigned = append(v.unsigned, resp...)
+		return nil
+	}
+	if !v.signed && v.count > 0 {
+		return errTSIGUnsigned
+	}
+	var name, alg dnsBuilder
+	name.name(v.key.name)
+	alg.name(v.key.algorithm)
+	if !bytes.EqualFold(rec.name, name.buf) || !bytes.EqualFold(rec.algorithm, alg.buf) {
+		return errTSIGKey
+	}
+	if rec.err != 0 {
+		return fmt.Errorf("DNS server rejected TSIG: %v", dnsRCodeError(dnsmessage.RCode(rec.err)))
+	}
+
+	var vars dnsBuilder
+	vars.uint16(uint16(len(v.mac)))
+	vars.buf = append(vars.buf, v.mac...)
+	vars.buf = append(vars.buf, v.unsigned...)
+	vars.buf = append(vars.buf, msg...)
+	if v.signed {
+		vars.uint48(rec.signed)
+		vars.uint16(rec.fudge)
+	} else {
+		v.key.variables(&vars, rec.signed, rec.fudge, rec.err, rec.other)
+	}
+	h := hmac.New(tsigAlgorithms[v.key.algorithm], v.key.secret)
+	h.Write(vars.buf)
+	if !hmac.Equal(h.Sum(nil), rec.mac) {
+		return errTSIGMAC
+	}
+	if d := now.Unix() - int64(rec.signed); d > int64(rec.fudge) || d < -int64(rec.fudge) {
+		return errTSIGTime
+	}
+	v.mac, v.unsigned, v.count, v.signed = rec.mac, nil, 0, true
+	return nil
+}
+
+
+
+func splitTSIG(msg []byte) ([]byte, *tsigRecord, error) {
+	r := dnsReader{buf: msg}
+	r.bytes(4)
+	qdcount := int(r.uint16())
+	rrcount := int(r.uint16()) + int(r.uint16())
+	arcount := r.uint16()
+	if arcount == 0 || r.err != nil {
+		return msg, nil, r.err
+	}
+	for i := 0; i < qdcount; i++ {
+		r.name()
+		r.bytes(4)
+	}
+	var start int
+	for i := 0; i < rrcount+int(arcount); i++ {
+		start = r.off
+		r.name()
+		r.bytes(8)
+		r.bytes(int(r.uint16()))
+	}
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+
+	r.off = start
+	rec := new(tsigRecord)
+	rec.name = r.name()
+	typ := r.uint16()
+	r.bytes(6)
+	rdlen := int(r.uint16())
+	if r.err != nil || typ != dnsTypeTSIG {
+		return msg, nil, r.err
+	}
+	end := r.off + rdlen
+	rec.algorithm = r.name()
+	rec.signed = r.uint48()
+	rec.fudge = r.uint16()
+	rec.mac = r.bytes(int(r.uint16()))
+	rec.origID = r.uint16()
+	rec.err = r.uint16()
+	rec.other = r.bytes(int(r.uint16()))
+	if r.err != nil || r.off != end {
+		return nil, nil, errDNSMalformed
+	}
+
+	stripped := append([]byte(nil), msg[:start]...)
+	binary.BigEndian.PutUint16(stripped, rec.origID)
+	binary.BigEndian.PutUint16(stripped[10:], arcount-1)
+	return stripped, rec, nil
+}
+
+
+func newDNSQuery(name string, qtype uint16) []byte {
+	var b dnsBuilder
+	b.header(0, 1, 0, 0, 0)
+	b.name(name)
+	b.uint16(qtype)
+	b.uint16(dnsClassIN)
+	return b.buf
+}
+
+
+
+func newDNSUpdate(zone string, rrs []byte, count int) []byte {
+	var b dnsBuilder
+	b.header(dnsOpUpdate<<11, 1, 0, uint16(count), 0)
+	b.name(zone)
+	b.uint16(dnsTypeSOA)
+	b.uint16(dnsClassIN)
+	b.buf = append(b.buf, rrs...)
+	return b.buf
+}
+
+
+func txtRData(value string) []byte {
+	var rdata []byte
+	for {
+		n := len(value)
+		if n > 255 {
+			n = 255
+		}
+		rdata = append(rdata, byte(n))
+		rdata = append(rdata, value[:n]...)
+		if value = value[n:]; len(value) == 0 {
+			return rdata
+		}
+	}
+}
+
+func dnsRCodeError(rcode dnsmessage.RCode) error {
+	if name, ok := dnsRCodeNames[rcode]; ok {
+		return fmt.Errorf("DNS server returned %s", name)
+	}
+	return fmt.Errorf("DNS server returned rcode %d", rcode)
+}
+
+
+type dnsBuilder struct {
+	buf []byte
+	err error
+}
+
+func (b *dnsBuilder) header(flags, qdcount, ancount, nscount, arcount uint16) {
+	var id [2]byte
+	crand.Read(id[:])
+	b.buf = append(b.buf, id[:]...)
+	b.uint16(flags)
+	b.uint16(qdcount)
+	b.uint16(ancount)
+	b.uint16(nscount)
+	b.uint16(arcount)
+}
+
+func (b *dnsBuilder) rr(name string, typ, class uint16, ttl uint32, rdata []byte) {
+	b.name(name)
+	b.uint16(typ)
+	b.uint16(class)
+	b.uint32(ttl)
+	b.uint16(uint16(len(rdata)))
+	b.buf = append(b.buf, rdata...)
+}
+
+
+func (b *dnsBuilder) name(name string) {
+	if name = strings.TrimSuffix(name, "."); name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if len(label) == 0 || len(label) > 63 {
+				b.err = fmt.Errorf("invalid DNS name %q", name)
+				return
+			}
+			b.buf = append(b.buf, byte(len(label)))
+			b.buf = append(b.buf, label...)
+		}
+	}
+	b.buf = append(b.buf, 0)
+}
+
+func (b *dnsBuilder) uint16(v uint16) {
+	b.buf = append(b.buf, byte(v>>8), byte(v))
+}
+
+func (b *dnsBuilder) uint32(v uint32) {
+	b.buf = append(b.buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (b *dnsBuilder) uint48(v uint64) {
+	b.buf = append(b.buf, byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+
+type dnsReader struct {
+	buf []byte
+	off int
+	err error
+}
+
+func (r *dnsReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.off+n > len(r.buf) {
+		r.err = errDNSMalformed
+		return nil
+	}
+	b := r.buf[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+
+
+func (r *dnsReader) name() []byte {
+	var (
+		name   []byte
+		off    = r.off
+		jumped bool
+	)
+	for r.err == nil {
+		if off >= len(r.buf) {
+			r.err = errDNSMalformed
+			break
+		}
+		n := int(r.buf[off])
+		switch {
+		case n == 0:
+			if !jumped {
+				r.off = off + 1
+			}
+			return append(name, 0)
+		case n&0xC0 == 0xC0:
+			if off+1 >= len(r.buf) {
+				r.err = errDNSMalformed
+				break
+			}
+			ptr := (n&0x3F)<<8 | int(r.buf[off+1])
+			if ptr >= off {
+				r.err = errDNSMalformed
+				break
+			}
+			if !jumped {
+				r.off, jumped = off+2, true
+			}
+			off = ptr
+		case n > 63 || off+1+n > len(r.buf):
+			r.err = errDNSMalformed
+		default:
+			name = append(name, r.buf[off:off+1+n]...)
+			off += 1 + n
+		}
+	}
+	return nil
+}
+
+func (r *dnsReader) uint16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *dnsReader) uint48() uint64 {
+	if b := r.bytes(6); b != nil {
+		return uint64(binary.BigEndian.Uint16(b))<<32 | uint64(binary.BigEndian.Uint32(b[2:]))
+	}
+	return 0
+}
@@ -0,0 +1,499 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/dnsdisc"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	testTSIGName = "key.example"
+	testTSIGAlg  = "hmac-sha256"
+)
+
+var testTSIGSecret = []byte("0123456789abcdef0123456789abcdef")
+
+type testDNSRecord struct {
+	ttl uint32
+	val []string
+}
+
+
+type testDNSServer struct {
+	t        *testing.T
+	l        net.Listener
+	zone     string
+	badMAC   bool
+	unsigned bool
+
+	mu      sync.Mutex
+	records map[string]*testDNSRecord
+	updates int
+}
+
+func newTestDNSServer(t *testing.T, zone string, records map[string]*testDNSRecord) *testDNSServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testDNSServer{t: t, l: l, zone: zone, records: records}
+	go s.serve()
+	return s
+}
+
+func (s *testDNSServer) client(key *tsigKey) *rfc2136Client {
+	return &rfc2136Client{server: s.l.Addr().String(), timeout: 5 * time.Second, key: key}
+}
+
+func (s *testDNSServer) serve() {
+	for {
+		c, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(c)
+	}
+}
+
+
+
+func (s *testDNSServer) checkRequest(msg []byte) ([]byte, []byte, bool) {
+	raw, rec, err := splitTSIG(msg)
+	if err != nil || rec == nil {
+		return raw, nil, false
+	}
+	var name, alg dnsBuilder
+	name.name(testTSIGName)
+	alg.name(testTSIGAlg)
+	if string(rec.name) != string(name.buf) || string(rec.algorithm) != string(alg.buf) {
+		return raw, nil, false
+	}
+	var d dnsBuilder
+	d.buf = append(d.buf, raw...)
+	d.name(testTSIGName)
+	d.uint16(dnsClassANY)
+	d.uint32(0)
+	d.name(testTSIGAlg)
+	d.uint48(rec.signed)
+	d.uint16(rec.fudge)
+	d.uint16(0)
+	d.uint16(0)
+	h := hmac.New(sha256.New, testTSIGSecret)
+	h.Write(d.buf)
+	return raw, rec.mac, hmac.Equal(h.Sum(nil), rec.mac)
+}
+
+
+
+func (s *testDNSServer) signResponse(resp, prior, pending []byte, first bool) ([]byte, []byte) {
+	now := uint64(time.Now().Unix())
+
+	var d dnsBuilder
+	d.uint16(uint16(len(prior)))
+	d.buf = append(d.buf, prior...)
+	d.buf = append(d.buf, pending...)
+	d.buf = append(d.buf, resp...)
+	if first {
+		d.name(testTSIGName)
+		d.uint16(dnsClassANY)
+		d.uint32(0)
+		d.name(testTSIGAlg)
+	}
+	d.uint48(now)
+	d.uint16(tsigFudge)
+	if first {
+		d.uint16(0)
+		d.uint16(0)
+	}
+	h := hmac.New(sha256.New, testTSIGSecret)
+	h.Write(d.buf)
+	mac := h.Sum(nil)
+	if s.badMAC {
+		mac[0]++
+	}
+
+	var rdata dnsBuilder
+	rdata.name(testTSIGAlg)
+	rdata.uint48(now)
+	rdata.uint16(tsigFudge)
+	rdata.uint16(uint16(len(mac)))
+	rdata.buf = append(rdata.buf, mac...)
+	rdata.buf = append(rdata.buf, resp[0], resp[1])
+	rdata.uint16(0)
+	rdata.uint16(0)
+	out := dnsBuilder{buf: append([]byte(nil), resp...)}
+	out.rr(testTSIGName, dnsTypeTSIG, dnsClassANY, 0, rdata.buf)
+	binary.BigEndian.PutUint16(out.buf[10:], binary.BigEndian.Uint16(out.buf[10:])+1)
+	return out.buf, mac
+}
+
+func writeDNSFrame(c net.Conn, msg []byte) {
+	frame := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(frame, uint16(len(msg)))
+	copy(frame[2:], msg)
+	c.Write(frame)
+}
+
+func (s *testDNSServer) handle(c net.Conn) {
+	defer c.Close()
+
+	var size [2]byte
+	if _, err := io.ReadFull(c, size[:]); err != nil {
+		return
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(c, msg); err != nil {
+		return
+	}
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	if err != nil {
+		s.t.Error(err)
+		return
+	}
+	q, err := p.Question()
+	if err != nil {
+		s.t.Error(err)
+		return
+	}
+	opcode := (binary.BigEndian.Uint16(msg[2:]) >> 11) & 0xf
+	zone := dnsmessage.MustNewName(s.zone + ".")
+	soa := dnsmessage.SOAResource{
+		NS:     dnsmessage.MustNewName("ns." + s.zone + "."),
+		MBox:   dnsmessage.MustNewName("hostmaster." + s.zone + "."),
+		Serial: 1, Refresh: 1, Retry: 1, Expire: 1, MinTTL: 1,
+	}
+	soaHeader := dnsmessage.ResourceHeader{Name: zone, Class: dnsmessage.ClassINET, TTL: 10}
+	newResponse := func() *dnsmessage.Builder {
+		b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: h.ID, Response: true, Authoritative: true, OpCode: dnsmessage.OpCode(opcode)})
+		b.StartQuestions()
+		b.Question(q)
+		return &b
+	}
+	finish := func(b *dnsmessage.Builder) []byte {
+		out, err := b.Finish()
+		if err != nil {
+			s.t.Error(err)
+		}
+		return out
+	}
+	reject := func(rcode dnsmessage.RCode) {
+		b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: h.ID, Response: true, OpCode: dnsmessage.OpCode(opcode), RCode: rcode})
+		writeDNSFrame(c, finish(&b))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case opcode == 0 && q.Type == dnsmessage.TypeSOA:
+		b := newResponse()
+		if strings.EqualFold(q.Name.String(), zone.String()) {
+			b.StartAnswers()
+		} else {
+			b.StartAuthorities()
+		}
+		b.SOAResource(soaHeader, soa)
+		writeDNSFrame(c, finish(b))
+
+	case opcode == 0 && q.Type == dnsmessage.TypeAXFR:
+		_, reqMAC, ok := s.checkRequest(msg)
+		if !ok {
+			reject(dnsmessage.RCode(9))
+			return
+		}
+		var names []string
+		for n := range s.records {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+
+
+		parts := [][]string{names[:len(names)/2], names[len(names)/2:], nil}
+		var (
+			prior   = reqMAC
+			pending []byte
+		)
+		for i, part := range parts {
+			b := newResponse()
+			b.StartAnswers()
+			if i == 0 {
+				b.SOAResource(soaHeader, soa)
+				b.AResource(soaHeader, dnsmessage.AResource{A: [4]byte{1, 2, 3, 4}})
+			}
+			for _, n := range part {
+				r := s.records[n]
+				hdr := dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(n + "."), Class: dnsmessage.ClassINET, TTL: r.ttl}
+				b.TXTResource(hdr, dnsmessage.TXTResource{TXT: r.val})
+			}
+			if i == len(parts)-1 {
+				b.SOAResource(soaHeader, soa)
+			}
+			out := finish(b)
+			if i == 1 || s.unsigned {
+				pending = append(pending, out...)
+				writeDNSFrame(c, out)
+				continue
+			}
+			out, prior = s.signResponse(out, prior, pending, i == 0)
+			pending = nil
+			writeDNSFrame(c, out)
+		}
+
+	case opcode == dnsOpUpdate:
+		raw, reqMAC, ok := s.checkRequest(msg)
+		if !ok {
+			reject(dnsmessage.RCode(9))
+			return
+		}
+		if !strings.EqualFold(q.Name.String(), zone.String()) || q.Type != dnsmessage.TypeSOA {
+			reject(dnsmessage.RCode(10))
+			return
+		}
+		s.applyUpdate(raw)
+		out := finish(newResponse())
+		if !s.unsigned {
+			out, _ = s.signResponse(out, reqMAC, nil, true)
+		}
+		writeDNSFrame(c, out)
+
+	default:
+		reject(dnsmessage.RCodeNotImplemented)
+	}
+}
+
+func (s *testDNSServer) applyUpdate(msg []byte) {
+	var p dnsmessage.Parser
+	if _, err := p.Start(msg); err != nil {
+		s.t.Error(err)
+		return
+	}
+	p.SkipAllQuestions()
+	p.SkipAllAnswers()
+	s.updates++
+	for {
+		rh, err := p.AuthorityHeader()
+		if err == dnsmessage.ErrSectionDone {
+			return
+		} else if err != nil {
+			s.t.Error(err)
+			return
+		}
+		name := strings.ToLower(strings.TrimSuffix(rh.Name.String(), "."))
+		if rh.Type != dnsmessage.TypeTXT {
+			s.t.Errorf("update for %s has type %v", name, rh.Type)
+		}
+		switch rh.Class {
+		case dnsClassANY:
+			if rh.Length != 0 || rh.TTL != 0 {
+				s.t.Errorf("invalid delete for %s", name)
+			}
+			p.SkipAuthority()
+			delete(s.records, name)
+		case dnsmessage.ClassINET:
+			txt, err := p.TXTResource()
+			if err != nil {
+				s.t.Error(err)
+				return
+			}
+			if s.records[name] != nil {
+				s.t.Errorf("record added to existing name %s", name)
+			}
+			s.records[name] = &testDNSRecord{rh.TTL, txt.TXT}
+		default:
+			s.t.Errorf("update for %s has class %v", name, rh.Class)
+			p.SkipAuthority()
+		}
+	}
+}
+
+func (s *testDNSServer) checkTree(t *testing.T, name string, tree *dnsdisc.Tree) {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	want := make(map[string]string)
+	for n, value := range tree.ToTXT(name) {
+		want[strings.ToLower(n)] = value
+	}
+	for n, r := range s.records {
+		if !isSubdomain(n, name) {
+			continue
+		}
+		value, ok := want[n]
+		if !ok {
+			t.Errorf("unexpected record %s", n)
+			continue
+		}
+		if strings.Join(r.val, "") != value {
+			t.Errorf("wrong value for %s", n)
+		}
+		ttl := uint32(treeNodeTTL)
+		if n == name {
+			ttl = rootTTL
+		}
+		if r.ttl != ttl {
+			t.Errorf("wrong TTL for %s: %d", n, r.ttl)
+		}
+	}
+	for n := range want {
+		if s.records[n] == nil {
+			t.Errorf("missing record %s", n)
+		}
+	}
+}
+
+func testDNSTree(t *testing.T, seq uint, n int) *dnsdisc.Tree {
+	var nodes []*enode.Node
+	for i := 0; i < n; i++ {
+		nodeKey, _ := crypto.GenerateKey()
+		var r enr.Record
+		r.Set(enr.IP(net.IP{10, 0, byte(i >> 8), byte(i)}))
+		r.Set(enr.TCP(30303))
+		enode.SignV4(&r, nodeKey)
+		node, err := enode.New(enode.ValidSchemes, &r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes = append(nodes, node)
+	}
+	tree, err := dnsdisc.MakeTree(seq, nodes, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestRFC2136Deploy(t *testing.T) {
+	const name = "nodes.example.org"
+	srv := newTestDNSServer(t, "example.org", map[string]*testDNSRecord{
+		"other.example.org":       {60, []string{"keep"}},
+		"stale.nodes.example.org": {60, []string{"enrtree-branch:"}},
+	})
+	defer srv.l.Close()
+
+	signer, _ := crypto.GenerateKey()
+	makeTree := func(seq uint, n int) *dnsdisc.Tree {
+		tree := testDNSTree(t, seq, n)
+		if _, err := tree.Sign(signer, name); err != nil {
+			t.Fatal(err)
+		}
+		return tree
+	}
+	c := srv.client(&tsigKey{name: testTSIGName, algorithm: testTSIGAlg, secret: testTSIGSecret})
+
+
+	tree := makeTree(1, 300)
+	if err := c.deploy(name, tree); err != nil {
+		t.Fatal("initial deploy failed:", err)
+	}
+	if c.zone != "example.org" {
+		t.Fatalf("wrong zone %q", c.zone)
+	}
+	if srv.updates < 2 {
+		t.Errorf("large change set sent in %d update(s)", srv.updates)
+	}
+	srv.checkTree(t, name, tree)
+	if srv.records["other.example.org"] == nil {
+		t.Fatal("record outside of tree removed")
+	}
+
+
+	srv.updates = 0
+	if err := c.deploy(name, tree); err != nil {
+		t.Fatal("repeated deploy failed:", err)
+	}
+	if srv.updates != 0 {
+		t.Fatalf("repeated deploy sent %d updates", srv.updates)
+	}
+
+
+	tree = makeTree(2, 5)
+	if err := c.deploy(name, tree); err != nil {
+		t.Fatal("shrinking deploy failed:", err)
+	}
+	srv.checkTree(t, name, tree)
+}
+
+func TestRFC2136Auth(t *testing.T) {
+	const name = "nodes.example.org"
+	signer, _ := crypto.GenerateKey()
+	tree := testDNSTree(t, 1, 3)
+	if _, err := tree.Sign(signer, name); err != nil {
+		t.Fatal(err)
+	}
+	key := &tsigKey{name: testTSIGName, algorithm: testTSIGAlg, secret: testTSIGSecret}
+
+	tests := []struct {
+		name      string
+		key       *tsigKey
+		zone      string
+		badMAC    bool
+		unsigned  bool
+		wantError string
+	}{
+		{
+			name:      "wrong key",
+			key:       &tsigKey{name: testTSIGName, algorithm: testTSIGAlg, secret: []byte("wrong")},
+			wantError: "NOTAUTH",
+		},
+		{
+			name:      "unknown zone",
+			key:       key,
+			zone:      "foo.org",
+			wantError: "does not contain",
+		},
+		{
+			name:      "bad response MAC",
+			key:       key,
+			badMAC:    true,
+			wantError: errTSIGMAC.Error(),
+		},
+		{
+			name:      "unsigned response",
+			key:       key,
+			unsigned:  true,
+			wantError: errTSIGUnsigned.Error(),
+		},
+	}
+	for _, test := range tests {
+		srv := newTestDNSServer(t, "example.org", map[string]*testDNSRecord{})
+		srv.badMAC, srv.unsigned = test.badMAC, test.unsigned
+		c := srv.client(test.key)
+		c.zone = test.zone
+		err := c.deploy(name, tree)
+		srv.l.Close()
+		if err == nil || !strings.Contains(err.Error(), test.wantError) {
+			t.Errorf("%s: wrong error %v, want %q", test.name, err, test.wantError)
+		}
+	}
+}
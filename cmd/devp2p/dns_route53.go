@@ -19,7 +19,6 @@ package main
 import (
 	"errors"
 	"fmt"
-	"sort"
 	"strconv"
 	"strings"
 
@@ -62,11 +61,6 @@ type route53Client struct {
 	zoneID string
 }
 
-type recordSet struct {
-	values []string
-	ttl    int64
-}
-
 
 func newRoute53Client(ctx *cli.Context) *route53Client {
 	akey := ctx.String(route53AccessKeyFlag.Name)
@@ -160,61 +154,14 @@ func (c *route53Client) findZoneID(name string) (string, error) {
 
 
 func (c *route53Client) computeChanges(name string, records map[string]string, existing map[string]recordSet) []*route53.Change {
-	
-	lrecords := make(map[string]string, len(records))
-	for name, r := range records {
-		lrecords[strings.ToLower(name)] = r
-	}
-	records = lrecords
-
 	var changes []*route53.Change
-	for path, val := range records {
-		ttl := int64(rootTTL)
-		if path != name {
-			ttl = int64(treeNodeTTL)
-		}
-
-		prevRecords, exists := existing[path]
-		prevValue := strings.Join(prevRecords.values, "")
-		if !exists {
-			
-			log.Info(fmt.Sprintf("Creating %s = %q", path, val))
-			changes = append(changes, newTXTChange("CREATE", path, ttl, splitTXT(val)))
-		} else if prevValue != val || prevRecords.ttl != ttl {
-			
-			log.Info(fmt.Sprintf("Updating %s from %q to %q", path, prevValue, val))
-			changes = append(changes, newTXTChange("UPSERT", path, ttl, splitTXT(val)))
-		} else {
-			log.Info(fmt.Sprintf("Skipping %s = %q", path, val))
-		}
+	for _, ch := range computeTXTChanges(name, records, existing, splitTXT) {
+		changes = append(changes, newTXTChange(ch.action, ch.name, ch.ttl, ch.values...))
 	}
-
-	
-	for path, set := range existing {
-		if _, ok := records[path]; ok {
-			continue
-		}
-		
-		log.Info(fmt.Sprintf("Deleting %s = %q", path, strings.Join(set.values, "")))
-		changes = append(changes, newTXTChange("DELETE", path, set.ttl, set.values...))
-	}
-
-	sortChanges(changes)
 	return changes
 }
 
 
-func sortChanges(changes []*route53.Change) {
-	score := map[string]int{"CREATE": 1, "UPSERT": 2, "DELETE": 3}
-	sort.Slice(changes, func(i, j int) bool {
-		if *changes[i].Action == *changes[j].Action {
-			return *changes[i].ResourceRecordSet.Name < *changes[j].ResourceRecordSet.Name
-		}
-		return score[*changes[i].Action] < score[*changes[j].Action]
-	})
-}
-
-
 
 func splitChanges(changes []*route53.Change, sizeLimit, countLimit int) [][]*route53.Change {
 	var (
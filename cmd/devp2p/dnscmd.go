@@ -23,11 +23,14 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/console/prompt"
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p/dnsdisc"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	cli "gopkg.in/urfave/cli.v1"
@@ -43,6 +46,7 @@ var (
 			dnsTXTCommand,
 			dnsCloudflareCommand,
 			dnsRoute53Command,
+			dnsRFC2136Command,
 		},
 	}
 	dnsSyncCommand = cli.Command{
@@ -79,6 +83,20 @@ var (
 		Action:    dnsToRoute53,
 		Flags:     []cli.Flag{route53AccessKeyFlag, route53AccessSecretFlag, route53ZoneIDFlag},
 	}
+	dnsRFC2136Command = cli.Command{
+		Name:      "to-rfc2136",
+		Usage:     "Deploy DNS TXT records to an RFC 2136 dynamic DNS server",
+		ArgsUsage: "<tree-directory>",
+		Action:    dnsToRFC2136,
+		Flags: []cli.Flag{
+			rfc2136ServerFlag,
+			rfc2136ZoneFlag,
+			rfc2136KeyNameFlag,
+			rfc2136KeySecretFlag,
+			rfc2136KeyAlgFlag,
+			dnsTimeoutFlag,
+		},
+	}
 )
 
 var (
@@ -102,6 +120,81 @@ const (
 )
 
 
+type recordSet struct {
+	values []string
+	ttl    int64
+}
+
+
+type txtChange struct {
+	action string
+	name   string
+	ttl    int64
+	values []string
+}
+
+
+
+
+
+
+func computeTXTChanges(name string, records map[string]string, existing map[string]recordSet, encode func(string) string) []*txtChange {
+	
+	lrecords := make(map[string]string, len(records))
+	for name, r := range records {
+		lrecords[strings.ToLower(name)] = r
+	}
+	records = lrecords
+
+	var changes []*txtChange
+	for path, val := range records {
+		ttl := int64(rootTTL)
+		if path != name {
+			ttl = int64(treeNodeTTL)
+		}
+
+		prevRecords, exists := existing[path]
+		prevValue := strings.Join(prevRecords.values, "")
+		newValue := encode(val)
+		if !exists {
+			
+			log.Info(fmt.Sprintf("Creating %s = %q", path, val))
+			changes = append(changes, &txtChange{"CREATE", path, ttl, []string{newValue}})
+		} else if prevValue != newValue || prevRecords.ttl != ttl {
+			
+			log.Info(fmt.Sprintf("Updating %s from %q to %q", path, prevValue, val))
+			changes = append(changes, &txtChange{"UPSERT", path, ttl, []string{newValue}})
+		} else {
+			log.Info(fmt.Sprintf("Skipping %s = %q", path, val))
+		}
+	}
+
+	
+	for path, set := range existing {
+		if _, ok := records[path]; ok {
+			continue
+		}
+		
+		log.Info(fmt.Sprintf("Deleting %s = %q", path, strings.Join(set.values, "")))
+		changes = append(changes, &txtChange{"DELETE", path, set.ttl, set.values})
+	}
+
+	sortTXTChanges(changes)
+	return changes
+}
+
+
+func sortTXTChanges(changes []*txtChange) {
+	score := map[string]int{"CREATE": 1, "UPSERT": 2, "DELETE": 3}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].action == changes[j].action {
+			return changes[i].name < changes[j].name
+		}
+		return score[changes[i].action] < score[changes[j].action]
+	})
+}
+
+
 func dnsSync(ctx *cli.Context) error {
 	var (
 		c      = dnsClient(ctx)
@@ -221,6 +314,19 @@ func dnsToRoute53(ctx *cli.Context) error {
 }
 
 
+func dnsToRFC2136(ctx *cli.Context) error {
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("need tree definition directory as argument")
+	}
+	domain, t, err := loadTreeDefinitionForExport(ctx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	client := newRFC2136Client(ctx)
+	return client.deploy(domain, t)
+}
+
+
 func loadSigningKey(keyfile string) *ecdsa.PrivateKey {
 	keyjson, err := ioutil.ReadFile(keyfile)
 	if err != nil {
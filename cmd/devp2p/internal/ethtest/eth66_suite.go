@@ -0,0 +1,556 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package ethtest
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/internal/utesting"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/rlpx"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/stretchr/testify/assert"
+)
+
+const timeout = 20 * time.Second
+
+
+
+func (s *Suite) TestStatus_66(t *utesting.T) {
+	conn := s.dial66(t)
+	defer conn.Close()
+
+	conn.handshake(t)
+
+	switch msg := conn.statusExchange66(t, s.chain).(type) {
+	case *Status:
+		status := *msg
+		if status.ProtocolVersion != uint32(66) {
+			t.Fatalf("mismatch in version: wanted 66, got %d", status.ProtocolVersion)
+		}
+		t.Logf("%+v\n", msg)
+	default:
+		t.Fatalf("unexpected: %#v", msg)
+	}
+}
+
+
+
+func (s *Suite) TestGetBlockHeaders_66(t *utesting.T) {
+	conn := s.setupConnection66(t)
+	defer conn.Close()
+
+	req := &GetBlockHeaders66{
+		RequestId: 3,
+		GetBlockHeaders: &GetBlockHeaders{
+			Origin: hashOrNumber{
+				Hash: s.chain.blocks[1].Hash(),
+			},
+			Amount:  2,
+			Skip:    1,
+			Reverse: false,
+		},
+	}
+
+	headers := s.getBlockHeaders66(t, conn, req)
+
+	expected, err := s.chain.GetHeaders(*req.GetBlockHeaders)
+	if err != nil {
+		t.Fatalf("failed to get headers for given request: %v", err)
+	}
+	if !headersMatch(t, expected, headers) {
+		t.Fatal("header mismatch")
+	}
+}
+
+
+
+
+func (s *Suite) TestSimultaneousRequests_66(t *utesting.T) {
+	conn := s.setupConnection66(t)
+	defer conn.Close()
+
+	req1 := &GetBlockHeaders66{
+		RequestId: 111,
+		GetBlockHeaders: &GetBlockHeaders{
+			Origin: hashOrNumber{
+				Hash: s.chain.blocks[1].Hash(),
+			},
+			Amount:  2,
+			Skip:    1,
+			Reverse: false,
+		},
+	}
+	req2 := &GetBlockHeaders66{
+		RequestId: 222,
+		GetBlockHeaders: &GetBlockHeaders{
+			Origin: hashOrNumber{
+				Hash: s.chain.blocks[1].Hash(),
+			},
+			Amount:  4,
+			Skip:    1,
+			Reverse: false,
+		},
+	}
+
+	if err := conn.Write(req1); err != nil {
+		t.Fatalf("failed to write to connection: %v", err)
+	}
+	if err := conn.Write(req2); err != nil {
+		t.Fatalf("failed to write to connection: %v", err)
+	}
+
+	responses := make(map[uint64]BlockHeaders)
+	for len(responses) < 2 {
+		id, msg := conn.readAndServe66(s.chain, timeout)
+		headers, ok := msg.(*BlockHeaders)
+		if !ok {
+			t.Fatalf("unexpected: %#v", msg)
+		}
+		if id != req1.RequestId && id != req2.RequestId {
+			t.Fatalf("response carries unknown request ID %d", id)
+		}
+		if _, dup := responses[id]; dup {
+			t.Fatalf("duplicate response for request ID %d", id)
+		}
+		responses[id] = *headers
+	}
+
+	for _, req := range []*GetBlockHeaders66{req1, req2} {
+		expected, err := s.chain.GetHeaders(*req.GetBlockHeaders)
+		if err != nil {
+			t.Fatalf("failed to get expected headers for request %d: %v", req.RequestId, err)
+		}
+		if !headersMatch(t, expected, responses[req.RequestId]) {
+			t.Fatalf("header mismatch for request ID %d", req.RequestId)
+		}
+	}
+}
+
+
+
+func (s *Suite) TestBroadcast_66(t *utesting.T) {
+	sendConn := s.setupConnection66(t)
+	defer sendConn.Close()
+	receiveConn := s.setupConnection66(t)
+	defer receiveConn.Close()
+
+	nextBlock := s.chain.Len()
+	blockAnnouncement := &NewBlock{
+		Block: s.fullChain.blocks[nextBlock],
+		TD:    s.fullChain.TD(nextBlock + 1),
+	}
+	if err := sendConn.Write(blockAnnouncement); err != nil {
+		t.Fatalf("could not write to connection: %v", err)
+	}
+
+	_, msg := receiveConn.readAndServe66(s.chain, timeout)
+	switch msg := msg.(type) {
+	case *NewBlock:
+		assert.Equal(t, blockAnnouncement.Block.Header(), msg.Block.Header(),
+			"wrong block header in announcement")
+		assert.Equal(t, blockAnnouncement.TD, msg.TD,
+			"wrong TD in announcement")
+	case *NewBlockHashes:
+		hashes := *msg
+		assert.Equal(t, blockAnnouncement.Block.Hash(), hashes[0].Hash,
+			"wrong block hash in announcement")
+	default:
+		t.Fatalf("unexpected: %#v", msg)
+	}
+
+	s.chain.blocks = append(s.chain.blocks, s.fullChain.blocks[nextBlock])
+
+	if err := receiveConn.waitForBlock66(s.chain.Head()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+
+
+func (s *Suite) TestGetBlockBodies_66(t *utesting.T) {
+	conn := s.setupConnection66(t)
+	defer conn.Close()
+
+	blocks := []*types.Block{s.chain.blocks[54], s.chain.blocks[75]}
+	req := &GetBlockBodies66{
+		RequestId: 55,
+		GetBlockBodies: GetBlockBodies{
+			blocks[0].Hash(),
+			blocks[1].Hash(),
+		},
+	}
+	if err := conn.Write(req); err != nil {
+		t.Fatalf("could not write to connection: %v", err)
+	}
+
+	id, msg := conn.readAndServe66(s.chain, timeout)
+	switch msg := msg.(type) {
+	case *BlockBodies:
+		if id != req.RequestId {
+			t.Fatalf("request ID mismatch: wanted %d, got %d", req.RequestId, id)
+		}
+		if len(*msg) != len(req.GetBlockBodies) {
+			t.Fatalf("wrong number of bodies: wanted %d, got %d", len(req.GetBlockBodies), len(*msg))
+		}
+		for i, block := range blocks {
+			want := block.Transactions()
+			have := (*msg)[i].Transactions
+			if len(have) != len(want) {
+				t.Fatalf("body %d: wrong transaction count: wanted %d, got %d", i, len(want), len(have))
+			}
+			for j, tx := range have {
+				if tx.Hash() != want[j].Hash() {
+					t.Fatalf("body %d: transaction %d mismatch", i, j)
+				}
+			}
+		}
+	default:
+		t.Fatalf("unexpected: %#v", msg)
+	}
+}
+
+
+
+func (s *Suite) TestGetNodeData_66(t *utesting.T) {
+	conn := s.setupConnection66(t)
+	defer conn.Close()
+
+	root := s.chain.Head().Root()
+	req := &GetNodeData66{
+		RequestId:   44,
+		GetNodeData: GetNodeData{root, randomHash()},
+	}
+	if err := conn.Write(req); err != nil {
+		t.Fatalf("could not write to connection: %v", err)
+	}
+	id, msg := conn.readAndServe66(s.chain, timeout)
+	switch msg := msg.(type) {
+	case *NodeData:
+		if id != req.RequestId {
+			t.Fatalf("request ID mismatch: wanted %d, got %d", req.RequestId, id)
+		}
+		checkNodeData(t, *msg, root)
+	default:
+		t.Fatalf("unexpected: %#v", msg)
+	}
+}
+
+
+
+func (s *Suite) TestGetReceipts_66(t *utesting.T) {
+	conn := s.setupConnection66(t)
+	defer conn.Close()
+
+	blocks := []*types.Block{s.chain.blocks[54], s.chain.blocks[75]}
+	req := &GetReceipts66{
+		RequestId:   66,
+		GetReceipts: GetReceipts{blocks[0].Hash(), blocks[1].Hash()},
+	}
+	if err := conn.Write(req); err != nil {
+		t.Fatalf("could not write to connection: %v", err)
+	}
+	id, msg := conn.readAndServe66(s.chain, timeout)
+	switch msg := msg.(type) {
+	case *Receipts:
+		if id != req.RequestId {
+			t.Fatalf("request ID mismatch: wanted %d, got %d", req.RequestId, id)
+		}
+		checkReceipts(t, *msg, blocks)
+	default:
+		t.Fatalf("unexpected: %#v", msg)
+	}
+}
+
+
+
+func (s *Suite) TestTransaction_66(t *utesting.T) {
+	sendConn := s.setupConnection66(t)
+	defer sendConn.Close()
+	recvConn := s.setupConnection66(t)
+	defer recvConn.Close()
+
+	s.sendSuccessfulTx(t, sendConn, recvConn, s.nextTx())
+}
+
+
+
+func (s *Suite) TestNewPooledTxs_66(t *utesting.T) {
+	conn := s.setupConnection66(t)
+	defer conn.Close()
+
+	s.testNewPooledTxs(t, conn)
+}
+
+
+
+func (s *Suite) TestGetPooledTransactions_66(t *utesting.T) {
+	sendConn := s.setupConnection66(t)
+	defer sendConn.Close()
+	recvConn := s.setupConnection66(t)
+	defer recvConn.Close()
+
+	tx := s.nextTx()
+	s.sendSuccessfulTx(t, sendConn, recvConn, tx)
+
+	req := &GetPooledTransactions66{
+		RequestId:             77,
+		GetPooledTransactions: append(randomHashes(pooledTxUnknowns), tx.Hash()),
+	}
+	if err := recvConn.Write(req); err != nil {
+		t.Fatalf("could not write to connection: %v", err)
+	}
+	id, msg := recvConn.readAndServe66(s.chain, timeout)
+	switch msg := msg.(type) {
+	case *PooledTransactions:
+		if id != req.RequestId {
+			t.Fatalf("request ID mismatch: wanted %d, got %d", req.RequestId, id)
+		}
+		checkPooledTxs(t, *msg, tx)
+	default:
+		t.Fatalf("unexpected: %#v", msg)
+	}
+}
+
+
+
+func (s *Suite) dial66(t *utesting.T) *Conn {
+	var conn Conn
+
+	fd, err := net.Dial("tcp", fmt.Sprintf("%v:%d", s.Dest.IP(), s.Dest.TCP()))
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	conn.Conn = rlpx.NewConn(fd, s.Dest.Pubkey())
+
+
+	conn.ourKey, _ = crypto.GenerateKey()
+	if _, err := conn.Handshake(conn.ourKey); err != nil {
+		t.Fatalf("could not perform RLPx handshake: %v", err)
+	}
+	conn.caps = []p2p.Cap{
+		{Name: "eth", Version: 66},
+	}
+	conn.ourHighestProtoVersion = 66
+	return &conn
+}
+
+func (s *Suite) setupConnection66(t *utesting.T) *Conn {
+	conn := s.dial66(t)
+	conn.handshake(t)
+	conn.statusExchange66(t, s.chain)
+	return conn
+}
+
+func (c *Conn) statusExchange66(t *utesting.T, chain *Chain) Message {
+	status := c.statusExchange(t, chain, nil)
+	if c.ethProtocolVersion != 66 {
+		t.Fatalf("remote node did not negotiate eth/66, got eth/%d", c.ethProtocolVersion)
+	}
+	return status
+}
+
+
+
+func (s *Suite) getBlockHeaders66(t *utesting.T, conn *Conn, req *GetBlockHeaders66) BlockHeaders {
+	expectedID := req.RequestId
+	if err := conn.Write(req); err != nil {
+		t.Fatalf("could not write to connection: %v", err)
+	}
+	id, msg := conn.readAndServe66(s.chain, timeout)
+	headers, ok := msg.(*BlockHeaders)
+	if !ok {
+		t.Fatalf("unexpected: %#v", msg)
+	}
+	if id != expectedID {
+		t.Fatalf("request ID mismatch: wanted %d, got %d", expectedID, id)
+	}
+	return *headers
+}
+
+
+
+func (c *Conn) read66() (uint64, Message) {
+	code, rawData, _, err := c.Conn.Read()
+	if err != nil {
+		return 0, &Error{fmt.Errorf("could not read from connection: %v", err)}
+	}
+
+	var msg Message
+	switch int(code) {
+	case (GetBlockHeaders{}).Code():
+		req := new(GetBlockHeaders66)
+		if err := rlp.DecodeBytes(rawData, req); err != nil {
+			return 0, &Error{fmt.Errorf("could not rlp decode message: %v", err)}
+		}
+		return req.RequestId, req.GetBlockHeaders
+	case (BlockHeaders{}).Code():
+		res := new(BlockHeaders66)
+		if err := rlp.DecodeBytes(rawData, res); err != nil {
+			return 0, &Error{fmt.Errorf("could not rlp decode message: %v", err)}
+		}
+		return res.RequestId, &res.BlockHeaders
+	case (GetBlockBodies{}).Code():
+		req := new(GetBlockBodies66)
+		if err := rlp.DecodeBytes(rawData, req); err != nil {
+			return 0, &Error{fmt.Errorf("could not rlp decode message: %v", err)}
+		}
+		return req.RequestId, &req.GetBlockBodies
+	case (BlockBodies{}).Code():
+		res := new(BlockBodies66)
+		if err := rlp.DecodeBytes(rawData, res); err != nil {
+			return 0, &Error{fmt.Errorf("could not rlp decode message: %v", err)}
+		}
+		return res.RequestId, &res.BlockBodies
+	case (GetPooledTransactions{}).Code():
+		req := new(GetPooledTransactions66)
+		if err := rlp.DecodeBytes(rawData, req); err != nil {
+			return 0, &Error{fmt.Errorf("could not rlp decode message: %v", err)}
+		}
+		return req.RequestId, &req.GetPooledTransactions
+	case (PooledTransactions{}).Code():
+		res := new(PooledTransactions66)
+		if err := rlp.DecodeBytes(rawData, res); err != nil {
+			return 0, &Error{fmt.Errorf("could not rlp decode message: %v", err)}
+		}
+		return res.RequestId, &res.PooledTransactions
+	case (GetNodeData{}).Code():
+		req := new(GetNodeData66)
+		if err := rlp.DecodeBytes(rawData, req); err != nil {
+			return 0, &Error{fmt.Errorf("could not rlp decode message: %v", err)}
+		}
+		return req.RequestId, &req.GetNodeData
+	case (NodeData{}).Code():
+		res := new(NodeData66)
+		if err := rlp.DecodeBytes(rawData, res); err != nil {
+			return 0, &Error{fmt.Errorf("could not rlp decode message: %v", err)}
+		}
+		return res.RequestId, &res.NodeData
+	case (GetReceipts{}).Code():
+		req := new(GetReceipts66)
+		if err := rlp.DecodeBytes(rawData, req); err != nil {
+			return 0, &Error{fmt.Errorf("could not rlp decode message: %v", err)}
+		}
+		return req.RequestId, &req.GetReceipts
+	case (Receipts{}).Code():
+		res := new(Receipts66)
+		if err := rlp.DecodeBytes(rawData, res); err != nil {
+			return 0, &Error{fmt.Errorf("could not rlp decode message: %v", err)}
+		}
+		return res.RequestId, &res.Receipts
+	case (Hello{}).Code():
+		msg = new(Hello)
+	case (Ping{}).Code():
+		msg = new(Ping)
+	case (Pong{}).Code():
+		msg = new(Pong)
+	case (Disconnect{}).Code():
+		msg = new(Disconnect)
+	case (Status{}).Code():
+		msg = new(Status)
+	case (NewBlock{}).Code():
+		msg = new(NewBlock)
+	case (NewBlockHashes{}).Code():
+		msg = new(NewBlockHashes)
+	case (Transactions{}).Code():
+		msg = new(Transactions)
+	case (NewPooledTransactionHashes{}).Code():
+		msg = new(NewPooledTransactionHashes)
+	default:
+		return 0, &Error{fmt.Errorf("invalid message code: %d", code)}
+	}
+	if err := rlp.DecodeBytes(rawData, msg); err != nil {
+		return 0, &Error{fmt.Errorf("could not rlp decode message: %v", err)}
+	}
+	return 0, msg
+}
+
+
+
+func (c *Conn) readAndServe66(chain *Chain, timeout time.Duration) (uint64, Message) {
+	c.SetReadDeadline(time.Now().Add(timeout))
+	defer c.SetReadDeadline(time.Time{})
+
+	for {
+		id, msg := c.read66()
+		switch msg := msg.(type) {
+		case *Ping:
+			c.Write(&Pong{})
+		case *Transactions, *NewPooledTransactionHashes:
+			
+		case *GetBlockHeaders:
+			headers, err := chain.GetHeaders(*msg)
+			if err != nil {
+				return 0, &Error{fmt.Errorf("could not get headers for inbound header request: %v", err)}
+			}
+			res := &BlockHeaders66{RequestId: id, BlockHeaders: headers}
+			if err := c.Write(res); err != nil {
+				return 0, &Error{fmt.Errorf("could not write to connection: %v", err)}
+			}
+		default:
+			return id, msg
+		}
+	}
+}
+
+
+
+func (c *Conn) waitForBlock66(block *types.Block) error {
+	for id := uint64(1); ; id++ {
+		req := &GetBlockHeaders66{
+			RequestId:       id,
+			GetBlockHeaders: &GetBlockHeaders{Origin: hashOrNumber{Hash: block.Hash()}, Amount: 1},
+		}
+		if err := c.Write(req); err != nil {
+			return err
+		}
+		rid, msg := c.read66()
+		for isTxGossip(msg) {
+			rid, msg = c.read66()
+		}
+		switch msg := msg.(type) {
+		case *BlockHeaders:
+			if rid != id {
+				return fmt.Errorf("request ID mismatch: wanted %d, got %d", id, rid)
+			}
+			if len(*msg) > 0 {
+				return nil
+			}
+			time.Sleep(100 * time.Millisecond)
+		default:
+			return fmt.Errorf("invalid message: %v", msg)
+		}
+	}
+}
+
+func headersMatch(t *utesting.T, expected BlockHeaders, headers BlockHeaders) bool {
+	if len(expected) != len(headers) {
+		t.Logf("header count mismatch: wanted %d, got %d", len(expected), len(headers))
+		return false
+	}
+	for i, header := range headers {
+		if header.Hash() != expected[i].Hash() {
+			t.Logf("header %d mismatch: wanted %v, got %v", i, expected[i].Hash(), header.Hash())
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package ethtest
+
+import (
+	"crypto/rand"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+
+func largeNumber(megabytes int) *big.Int {
+	return new(big.Int).SetBytes(largeBuffer(megabytes))
+}
+
+
+func largeBuffer(megabytes int) []byte {
+	buf := make([]byte, megabytes*1024*1024)
+	rand.Read(buf)
+	return buf
+}
+
+
+func largeString(megabytes int) string {
+	buf := make([]byte, megabytes*1024*1024)
+	for i := range buf {
+		buf[i] = 'a'
+	}
+	return string(buf)
+}
+
+
+
+func largeBlock() *types.Block {
+	return types.NewBlockWithHeader(largeHeader())
+}
+
+func largeHeader() *types.Header {
+	return &types.Header{
+		ParentHash:  randomHash(),
+		UncleHash:   types.EmptyUncleHash,
+		Root:        randomHash(),
+		TxHash:      types.EmptyRootHash,
+		ReceiptHash: types.EmptyRootHash,
+		Difficulty:  largeNumber(2),
+		Number:      largeNumber(2),
+		GasLimit:    8,
+		GasUsed:     8,
+		Time:        8,
+		Extra:       []byte{},
+	}
+}
+
+func randomHash() common.Hash {
+	var h common.Hash
+	rand.Read(h[:])
+	return h
+}
+
+func randomHashes(n int) []common.Hash {
+	hashes := make([]common.Hash, n)
+	for i := range hashes {
+		hashes[i] = randomHash()
+	}
+	return hashes
+}
@@ -0,0 +1,323 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package ethtest
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/forkid"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/internal/utesting"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/golang/snappy"
+)
+
+const (
+	announceStormBatches   = 64
+	announceStormBatchSize = 256
+	oversizedMessageMB     = 11
+)
+
+var (
+	errNotClosed = errors.New("connection was not closed by remote node")
+
+	
+	
+	
+	misbehaviorReasons = []p2p.DiscReason{p2p.DiscSubprotocolError, p2p.DiscUselessPeer}
+)
+
+
+
+func (s *Suite) TestLargeAnnounce(t *utesting.T) {
+	nextBlock := s.chain.Len()
+	announcements := []*NewBlock{
+		{Block: largeBlock(), TD: s.fullChain.TD(nextBlock + 1)},
+		{Block: s.fullChain.blocks[nextBlock], TD: largeNumber(2)},
+		{Block: largeBlock(), TD: largeNumber(2)},
+	}
+	for i, announcement := range announcements {
+		conn := s.setupConnection(t)
+		if err := conn.Write(announcement); err != nil {
+			t.Fatalf("could not write announcement %d: %v", i, err)
+		}
+		t.Logf("announcement %d", i)
+		s.expectDisconnect(t, conn, misbehaviorReasons...)
+		conn.Close()
+	}
+}
+
+
+
+
+func (s *Suite) TestAnnounceStorm(t *utesting.T) {
+	sendConn := s.setupConnection(t)
+	defer sendConn.Close()
+
+	number := uint64(s.chain.Len())
+	for i := 0; i < announceStormBatches; i++ {
+		announces := make(NewBlockHashes, announceStormBatchSize)
+		for j, hash := range randomHashes(announceStormBatchSize) {
+			announces[j].Hash = hash
+			announces[j].Number = number
+		}
+		if err := sendConn.Write(announces); err != nil {
+			t.Logf("node dropped connection after %d announcements: %v", i*announceStormBatchSize, err)
+			break
+		}
+	}
+
+
+	conn := s.setupConnection(t)
+	defer conn.Close()
+
+	head := s.chain.Head()
+	if err := conn.Write(&GetBlockHeaders{Origin: hashOrNumber{Hash: head.Hash()}, Amount: 1}); err != nil {
+		t.Fatalf("could not write to connection: %v", err)
+	}
+	switch msg := conn.ReadAndServe(s.chain, timeout).(type) {
+	case *BlockHeaders:
+		if len(*msg) != 1 || (*msg)[0].Hash() != head.Hash() {
+			t.Fatalf("wrong headers after announce storm: %v", *msg)
+		}
+	default:
+		t.Fatalf("unexpected: %#v", msg)
+	}
+}
+
+
+
+func (s *Suite) TestMaliciousHandshake(t *utesting.T) {
+	otherKey, _ := crypto.GenerateKey()
+	tests := []struct {
+		name   string
+		modify func(*Hello)
+		reason p2p.DiscReason
+	}{
+		{
+			name:   "foreign identity",
+			modify: func(h *Hello) { h.ID = crypto.FromECDSAPub(&otherKey.PublicKey)[1:] },
+			reason: p2p.DiscUnexpectedIdentity,
+		},
+		{
+			name:   "invalid identity",
+			modify: func(h *Hello) { h.ID = h.ID[:32] },
+			reason: p2p.DiscInvalidIdentity,
+		},
+		{
+			name:   "no matching capabilities",
+			modify: func(h *Hello) { h.Caps = []p2p.Cap{{Name: "bogus", Version: 1}} },
+			reason: p2p.DiscUselessPeer,
+		},
+	}
+	for _, test := range tests {
+		conn, err := s.dial()
+		if err != nil {
+			t.Fatalf("could not dial: %v", err)
+		}
+		if err := conn.Write(conn.modifiedHello(test.modify)); err != nil {
+			t.Fatalf("%s: could not write to connection: %v", test.name, err)
+		}
+		reason, err := conn.readHandshakeDisconnect(timeout)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if reason != test.reason {
+			t.Fatalf("%s: wrong disconnect reason: wanted %q, got %q", test.name, test.reason, reason)
+		}
+		conn.Close()
+	}
+
+
+	conn, err := s.dial()
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.Write(conn.modifiedHello(func(h *Hello) { h.Name = largeString(1) })); err != nil {
+		t.Fatalf("oversized hello: could not write to connection: %v", err)
+	}
+	if err := conn.waitForClose(timeout); err != nil {
+		t.Fatalf("oversized hello: %v", err)
+	}
+}
+
+
+
+func (s *Suite) TestMaliciousStatus(t *utesting.T) {
+	tests := []struct {
+		name   string
+		modify func(*Status)
+	}{
+		{"wrong network ID", func(st *Status) { st.NetworkID++ }},
+		{"wrong genesis", func(st *Status) { st.Genesis = randomHash() }},
+		{"wrong fork ID", func(st *Status) { st.ForkID = forkid.ID{Hash: [4]byte{0xde, 0xad, 0xbe, 0xef}} }},
+		{"wrong protocol version", func(st *Status) { st.ProtocolVersion = 1 }},
+	}
+	for _, test := range tests {
+		conn, err := s.dial()
+		if err != nil {
+			t.Fatalf("could not dial: %v", err)
+		}
+		conn.handshake(t)
+		status := conn.ourStatus(s.chain)
+		test.modify(status)
+		conn.statusExchange(t, s.chain, status)
+		t.Logf("%s", test.name)
+		s.expectDisconnect(t, conn, p2p.DiscSubprotocolError)
+		conn.Close()
+	}
+}
+
+
+
+func (s *Suite) TestOversizedMessage(t *utesting.T) {
+	conn := s.setupConnection(t)
+	defer conn.Close()
+
+	if _, err := conn.Conn.Write(uint64((Transactions{}).Code()), largeBuffer(oversizedMessageMB)); err != nil {
+		t.Fatalf("could not write to connection: %v", err)
+	}
+	s.expectDisconnect(t, conn, misbehaviorReasons...)
+}
+
+
+
+
+func (s *Suite) TestDisconnectReasons(t *utesting.T) {
+	conn, err := s.dial()
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	if err := conn.Write(&Disconnect{Reason: p2p.DiscRequested}); err != nil {
+		t.Fatalf("could not write to connection: %v", err)
+	}
+	if err := conn.waitForClose(timeout); err != nil {
+		t.Fatalf("disconnect before handshake: %v", err)
+	}
+	conn.Close()
+
+	reasons := []p2p.DiscReason{
+		p2p.DiscRequested,
+		p2p.DiscTooManyPeers,
+		p2p.DiscUselessPeer,
+		p2p.DiscSubprotocolError,
+	}
+	for _, reason := range reasons {
+		conn := s.setupConnection(t)
+		if err := conn.Write(&Disconnect{Reason: reason}); err != nil {
+			t.Fatalf("could not write to connection: %v", err)
+		}
+		if err := conn.waitForClose(timeout); err != nil {
+			t.Fatalf("disconnect %q: %v", reason, err)
+		}
+		conn.Close()
+	}
+
+
+	conn = s.setupConnection(t)
+	conn.Close()
+}
+
+
+func (s *Suite) expectDisconnect(t *utesting.T, conn *Conn, want ...p2p.DiscReason) {
+	var msg Message
+	if conn.ethProtocolVersion >= 66 {
+		_, msg = conn.readAndServe66(s.chain, timeout)
+	} else {
+		msg = conn.ReadAndServe(s.chain, timeout)
+	}
+	switch msg := msg.(type) {
+	case *Disconnect:
+		for _, reason := range want {
+			if msg.Reason == reason {
+				return
+			}
+		}
+		t.Fatalf("wrong disconnect reason: wanted one of %v, got %q", want, msg.Reason)
+	default:
+		t.Fatalf("expected disconnect (%v), got: %#v", want, msg)
+	}
+}
+
+func (c *Conn) modifiedHello(modify func(*Hello)) *Hello {
+	hello := &Hello{
+		Version: 5,
+		Caps:    c.caps,
+		ID:      crypto.FromECDSAPub(&c.ourKey.PublicKey)[1:],
+	}
+	modify(hello)
+	return hello
+}
+
+
+
+
+
+func (c *Conn) readHandshakeDisconnect(timeout time.Duration) (p2p.DiscReason, error) {
+	c.SetReadDeadline(time.Now().Add(timeout))
+	defer c.SetReadDeadline(time.Time{})
+
+	for {
+		code, data, _, err := c.Conn.Read()
+		if err != nil {
+			return 0, err
+		}
+		if code == uint64((Disconnect{}).Code()) {
+			return decodeDisconnect(data)
+		}
+	}
+}
+
+func decodeDisconnect(data []byte) (p2p.DiscReason, error) {
+	var reason []p2p.DiscReason
+	if err := rlp.DecodeBytes(data, &reason); err != nil {
+		plain, serr := snappy.Decode(nil, data)
+		if serr != nil {
+			return 0, err
+		}
+		if err := rlp.DecodeBytes(plain, &reason); err != nil {
+			return 0, err
+		}
+	}
+	if len(reason) == 0 {
+		return 0, errors.New("empty disconnect message")
+	}
+	return reason[0], nil
+}
+
+
+
+func (c *Conn) waitForClose(timeout time.Duration) error {
+	c.SetReadDeadline(time.Now().Add(timeout))
+	defer c.SetReadDeadline(time.Time{})
+
+	for {
+		_, _, _, err := c.Conn.Read()
+		if err == nil {
+			continue
+		}
+		var nerr net.Error
+		if errors.As(err, &nerr) && nerr.Timeout() {
+			return errNotClosed
+		}
+		return nil
+	}
+}
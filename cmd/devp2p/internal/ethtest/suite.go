@@ -20,10 +20,14 @@ import (
 	"fmt"
 	"net"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/internal/utesting"
+	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/p2p/rlpx"
+	"github.com/ethereum/go-ethereum/trie"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -34,6 +38,7 @@ type Suite struct {
 
 	chain     *Chain
 	fullChain *Chain
+	txNonce   uint64
 }
 
 
@@ -57,6 +62,28 @@ func (s *Suite) AllTests() []utesting.Test {
 		{Name: "GetBlockHeaders", Fn: s.TestGetBlockHeaders},
 		{Name: "Broadcast", Fn: s.TestBroadcast},
 		{Name: "GetBlockBodies", Fn: s.TestGetBlockBodies},
+		{Name: "GetNodeData", Fn: s.TestGetNodeData},
+		{Name: "GetReceipts", Fn: s.TestGetReceipts},
+		{Name: "Transaction", Fn: s.TestTransaction},
+		{Name: "MaliciousTx", Fn: s.TestMaliciousTx},
+		{Name: "NewPooledTxs", Fn: s.TestNewPooledTxs},
+		{Name: "GetPooledTransactions", Fn: s.TestGetPooledTransactions},
+		{Name: "Status_66", Fn: s.TestStatus_66},
+		{Name: "GetBlockHeaders_66", Fn: s.TestGetBlockHeaders_66},
+		{Name: "SimultaneousRequests_66", Fn: s.TestSimultaneousRequests_66},
+		{Name: "Broadcast_66", Fn: s.TestBroadcast_66},
+		{Name: "GetBlockBodies_66", Fn: s.TestGetBlockBodies_66},
+		{Name: "GetNodeData_66", Fn: s.TestGetNodeData_66},
+		{Name: "GetReceipts_66", Fn: s.TestGetReceipts_66},
+		{Name: "Transaction_66", Fn: s.TestTransaction_66},
+		{Name: "NewPooledTxs_66", Fn: s.TestNewPooledTxs_66},
+		{Name: "GetPooledTransactions_66", Fn: s.TestGetPooledTransactions_66},
+		{Name: "LargeAnnounce", Fn: s.TestLargeAnnounce},
+		{Name: "AnnounceStorm", Fn: s.TestAnnounceStorm},
+		{Name: "MaliciousHandshake", Fn: s.TestMaliciousHandshake},
+		{Name: "MaliciousStatus", Fn: s.TestMaliciousStatus},
+		{Name: "OversizedMessage", Fn: s.TestOversizedMessage},
+		{Name: "DisconnectReasons", Fn: s.TestDisconnectReasons},
 	}
 }
 
@@ -68,10 +95,11 @@ func (s *Suite) TestStatus(t *utesting.T) {
 	if err != nil {
 		t.Fatalf("could not dial: %v", err)
 	}
+	defer conn.Close()
 	
 	conn.handshake(t)
 	
-	switch msg := conn.statusExchange(t, s.chain).(type) {
+	switch msg := conn.statusExchange(t, s.chain, nil).(type) {
 	case *Status:
 		t.Logf("%+v\n", msg)
 	default:
@@ -86,9 +114,10 @@ func (s *Suite) TestGetBlockHeaders(t *utesting.T) {
 	if err != nil {
 		t.Fatalf("could not dial: %v", err)
 	}
+	defer conn.Close()
 
 	conn.handshake(t)
-	conn.statusExchange(t, s.chain)
+	conn.statusExchange(t, s.chain, nil)
 
 	
 	req := &GetBlockHeaders{
@@ -104,7 +133,7 @@ func (s *Suite) TestGetBlockHeaders(t *utesting.T) {
 		t.Fatalf("could not write to connection: %v", err)
 	}
 
-	switch msg := conn.ReadAndServe(s.chain).(type) {
+	switch msg := conn.ReadAndServe(s.chain, timeout).(type) {
 	case *BlockHeaders:
 		headers := msg
 		for _, header := range *headers {
@@ -124,16 +153,17 @@ func (s *Suite) TestGetBlockBodies(t *utesting.T) {
 	if err != nil {
 		t.Fatalf("could not dial: %v", err)
 	}
+	defer conn.Close()
 
 	conn.handshake(t)
-	conn.statusExchange(t, s.chain)
+	conn.statusExchange(t, s.chain, nil)
 	
 	req := &GetBlockBodies{s.chain.blocks[54].Hash(), s.chain.blocks[75].Hash()}
 	if err := conn.Write(req); err != nil {
 		t.Fatalf("could not write to connection: %v", err)
 	}
 
-	switch msg := conn.ReadAndServe(s.chain).(type) {
+	switch msg := conn.ReadAndServe(s.chain, timeout).(type) {
 	case *BlockBodies:
 		bodies := msg
 		for _, body := range *bodies {
@@ -152,28 +182,31 @@ func (s *Suite) TestBroadcast(t *utesting.T) {
 	if err != nil {
 		t.Fatalf("could not dial: %v", err)
 	}
+	defer sendConn.Close()
 	
 	receiveConn, err := s.dial()
 	if err != nil {
 		t.Fatalf("could not dial: %v", err)
 	}
+	defer receiveConn.Close()
 
 	sendConn.handshake(t)
 	receiveConn.handshake(t)
 
-	sendConn.statusExchange(t, s.chain)
-	receiveConn.statusExchange(t, s.chain)
+	sendConn.statusExchange(t, s.chain, nil)
+	receiveConn.statusExchange(t, s.chain, nil)
 
 	
+	nextBlock := s.chain.Len()
 	blockAnnouncement := &NewBlock{
-		Block: s.fullChain.blocks[1000],
-		TD:    s.fullChain.TD(1001),
+		Block: s.fullChain.blocks[nextBlock],
+		TD:    s.fullChain.TD(nextBlock + 1),
 	}
 	if err := sendConn.Write(blockAnnouncement); err != nil {
 		t.Fatalf("could not write to connection: %v", err)
 	}
 
-	switch msg := receiveConn.ReadAndServe(s.chain).(type) {
+	switch msg := receiveConn.ReadAndServe(s.chain, timeout).(type) {
 	case *NewBlock:
 		assert.Equal(t, blockAnnouncement.Block.Header(), msg.Block.Header(),
 			"wrong block header in announcement")
@@ -187,7 +220,7 @@ func (s *Suite) TestBroadcast(t *utesting.T) {
 		t.Fatalf("unexpected: %#v", msg)
 	}
 	
-	s.chain.blocks = append(s.chain.blocks, s.fullChain.blocks[1000])
+	s.chain.blocks = append(s.chain.blocks, s.fullChain.blocks[nextBlock])
 	
 	if err := receiveConn.waitForBlock(s.chain.Head()); err != nil {
 		t.Fatal(err)
@@ -196,6 +229,64 @@ func (s *Suite) TestBroadcast(t *utesting.T) {
 
 
 
+func (s *Suite) TestGetNodeData(t *utesting.T) {
+	conn := s.setupConnection(t)
+	defer conn.Close()
+
+	root := s.chain.Head().Root()
+	if err := conn.Write(GetNodeData{root, randomHash()}); err != nil {
+		t.Fatalf("could not write to connection: %v", err)
+	}
+	switch msg := conn.ReadAndServe(s.chain, timeout).(type) {
+	case *NodeData:
+		checkNodeData(t, *msg, root)
+	default:
+		t.Fatalf("unexpected: %#v", msg)
+	}
+}
+
+
+
+func (s *Suite) TestGetReceipts(t *utesting.T) {
+	conn := s.setupConnection(t)
+	defer conn.Close()
+
+	blocks := []*types.Block{s.chain.blocks[54], s.chain.blocks[75]}
+	if err := conn.Write(GetReceipts{blocks[0].Hash(), blocks[1].Hash()}); err != nil {
+		t.Fatalf("could not write to connection: %v", err)
+	}
+	switch msg := conn.ReadAndServe(s.chain, timeout).(type) {
+	case *Receipts:
+		checkReceipts(t, *msg, blocks)
+	default:
+		t.Fatalf("unexpected: %#v", msg)
+	}
+}
+
+func checkNodeData(t *utesting.T, data NodeData, want ...common.Hash) {
+	if len(data) != len(want) {
+		t.Fatalf("wrong number of trie nodes: wanted %d, got %d", len(want), len(data))
+	}
+	for i, node := range data {
+		if hash := crypto.Keccak256Hash(node); hash != want[i] {
+			t.Fatalf("trie node %d mismatch: wanted %v, got %v", i, want[i], hash)
+		}
+	}
+}
+
+func checkReceipts(t *utesting.T, receipts Receipts, blocks []*types.Block) {
+	if len(receipts) != len(blocks) {
+		t.Fatalf("wrong number of receipt lists: wanted %d, got %d", len(blocks), len(receipts))
+	}
+	for i, block := range blocks {
+		if hash := types.DeriveSha(types.Receipts(receipts[i]), trie.NewStackTrie(nil)); hash != block.ReceiptHash() {
+			t.Fatalf("receipts %d: root mismatch: wanted %v, got %v", i, block.ReceiptHash(), hash)
+		}
+	}
+}
+
+
+
 func (s *Suite) dial() (*Conn, error) {
 	var conn Conn
 
@@ -207,6 +298,11 @@ func (s *Suite) dial() (*Conn, error) {
 
 	
 	conn.ourKey, _ = crypto.GenerateKey()
+	conn.caps = []p2p.Cap{
+		{Name: "eth", Version: 64},
+		{Name: "eth", Version: 65},
+	}
+	conn.ourHighestProtoVersion = 65
 	_, err = conn.Handshake(conn.ourKey)
 	if err != nil {
 		return nil, err
@@ -214,3 +310,13 @@ func (s *Suite) dial() (*Conn, error) {
 
 	return &conn, nil
 }
+
+func (s *Suite) setupConnection(t *utesting.T) *Conn {
+	conn, err := s.dial()
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	conn.handshake(t)
+	conn.statusExchange(t, s.chain, nil)
+	return conn
+}
@@ -0,0 +1,278 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package ethtest
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/internal/utesting"
+)
+
+const (
+	txGas             = 21000
+	pooledTxAnnounces = 64
+	pooledTxUnknowns  = 1024
+)
+
+var (
+	faucetKey, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+
+	txRecipient = common.HexToAddress("0x000000000000000000000000000000000000dead")
+	txGasPrice  = big.NewInt(1)
+
+	errTxNotPropagated = errors.New("transaction not propagated (does the node accept a gas price of 1 wei?)")
+)
+
+
+
+func (s *Suite) TestTransaction(t *utesting.T) {
+	sendConn := s.setupConnection(t)
+	defer sendConn.Close()
+	recvConn := s.setupConnection(t)
+	defer recvConn.Close()
+
+	s.sendSuccessfulTx(t, sendConn, recvConn, s.nextTx())
+}
+
+
+
+func (s *Suite) TestMaliciousTx(t *utesting.T) {
+	sendConn := s.setupConnection(t)
+	defer sendConn.Close()
+	recvConn := s.setupConnection(t)
+	defer recvConn.Close()
+
+	bad := s.maliciousTxs()
+	if err := sendConn.Write(Transactions(bad)); err != nil {
+		t.Fatalf("could not write to connection: %v", err)
+	}
+
+
+	sentinel := s.nextTx()
+	if err := sendConn.Write(&Transactions{sentinel}); err != nil {
+		t.Fatalf("could not write to connection: %v", err)
+	}
+	seen, err := recvConn.waitForTxs([]common.Hash{sentinel.Hash()}, timeout)
+	if err != nil {
+		t.Fatalf("sentinel %v", err)
+	}
+	for i, tx := range bad {
+		if seen[tx.Hash()] {
+			t.Errorf("malicious transaction %d (%v) was propagated", i, tx.Hash())
+		}
+	}
+}
+
+
+
+func (s *Suite) TestNewPooledTxs(t *utesting.T) {
+	conn := s.setupConnection(t)
+	defer conn.Close()
+
+	s.testNewPooledTxs(t, conn)
+}
+
+
+
+func (s *Suite) TestGetPooledTransactions(t *utesting.T) {
+	sendConn := s.setupConnection(t)
+	defer sendConn.Close()
+	recvConn := s.setupConnection(t)
+	defer recvConn.Close()
+
+	tx := s.nextTx()
+	s.sendSuccessfulTx(t, sendConn, recvConn, tx)
+
+	req := GetPooledTransactions(append(randomHashes(pooledTxUnknowns), tx.Hash()))
+	if err := recvConn.Write(req); err != nil {
+		t.Fatalf("could not write to connection: %v", err)
+	}
+	switch msg := recvConn.ReadAndServe(s.chain, timeout).(type) {
+	case *PooledTransactions:
+		checkPooledTxs(t, *msg, tx)
+	default:
+		t.Fatalf("unexpected: %#v", msg)
+	}
+}
+
+func (s *Suite) testNewPooledTxs(t *utesting.T, conn *Conn) {
+	hashes := randomHashes(pooledTxAnnounces)
+	if err := conn.Write(NewPooledTransactionHashes(hashes)); err != nil {
+		t.Fatalf("could not write to connection: %v", err)
+	}
+	if err := conn.waitForTxRequests(hashes, timeout); err != nil {
+		t.Fatal(err)
+	}
+}
+
+
+
+func (s *Suite) sendSuccessfulTx(t *utesting.T, sendConn, recvConn *Conn, tx *types.Transaction) {
+	if err := sendConn.Write(&Transactions{tx}); err != nil {
+		t.Fatalf("could not write to connection: %v", err)
+	}
+	if _, err := recvConn.waitForTxs([]common.Hash{tx.Hash()}, timeout); err != nil {
+		t.Fatal(err)
+	}
+}
+
+
+func (s *Suite) nextTx() *types.Transaction {
+	tx := types.NewTransaction(s.txNonce, txRecipient, big.NewInt(1), txGas, txGasPrice, nil)
+	s.txNonce++
+	return s.signTx(tx, s.chain.chainConfig.ChainID)
+}
+
+
+
+func (s *Suite) maliciousTxs() []*types.Transaction {
+	var (
+		nonce    = s.txNonce
+		chainID  = s.chain.chainConfig.ChainID
+		gasLimit = s.chain.Head().GasLimit()
+	)
+	return []*types.Transaction{
+		s.signTx(types.NewTransaction(nonce, txRecipient, big.NewInt(1), txGas-1, txGasPrice, nil), chainID),
+		s.signTx(types.NewTransaction(nonce, txRecipient, new(big.Int).Lsh(common.Big1, 128), txGas, txGasPrice, nil), chainID),
+		s.signTx(types.NewTransaction(nonce, txRecipient, big.NewInt(1), gasLimit+1, txGasPrice, nil), chainID),
+		s.signTx(types.NewTransaction(nonce, txRecipient, big.NewInt(1), txGas, txGasPrice, nil), new(big.Int).Add(chainID, common.Big1)),
+		s.signTx(types.NewTransaction(nonce, txRecipient, big.NewInt(1), txGas, txGasPrice, largeBuffer(1)), chainID),
+	}
+}
+
+func (s *Suite) signTx(tx *types.Transaction, chainID *big.Int) *types.Transaction {
+	signed, err := types.SignTx(tx, types.NewEIP155Signer(chainID), faucetKey)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+func checkPooledTxs(t *utesting.T, txs PooledTransactions, want ...*types.Transaction) {
+	if len(txs) != len(want) {
+		t.Fatalf("wrong number of pooled transactions: wanted %d, got %d", len(want), len(txs))
+	}
+	for i, tx := range txs {
+		if tx.Hash() != want[i].Hash() {
+			t.Fatalf("pooled transaction %d mismatch: wanted %v, got %v", i, want[i].Hash(), tx.Hash())
+		}
+	}
+}
+
+
+
+
+func (c *Conn) waitForTxs(hashes []common.Hash, timeout time.Duration) (map[common.Hash]bool, error) {
+	c.SetReadDeadline(time.Now().Add(timeout))
+	defer c.SetReadDeadline(time.Time{})
+
+	var (
+		seen    = make(map[common.Hash]bool)
+		pending = make(map[common.Hash]bool)
+	)
+	for _, hash := range hashes {
+		pending[hash] = true
+	}
+	for len(pending) > 0 {
+		var announced []common.Hash
+		switch msg := c.readMsg().(type) {
+		case *Transactions:
+			for _, tx := range *msg {
+				announced = append(announced, tx.Hash())
+			}
+		case *NewPooledTransactionHashes:
+			announced = *msg
+		case *Ping:
+			c.Write(&Pong{})
+		case *Disconnect:
+			return seen, fmt.Errorf("disconnect received: %v", msg.Reason)
+		case *Error:
+			return seen, fmt.Errorf("%v: %v", errTxNotPropagated, msg)
+		}
+		for _, hash := range announced {
+			seen[hash] = true
+			delete(pending, hash)
+		}
+	}
+	return seen, nil
+}
+
+
+
+
+func (c *Conn) waitForTxRequests(hashes []common.Hash, timeout time.Duration) error {
+	c.SetReadDeadline(time.Now().Add(timeout))
+	defer c.SetReadDeadline(time.Time{})
+
+	pending := make(map[common.Hash]bool)
+	for _, hash := range hashes {
+		pending[hash] = true
+	}
+	for len(pending) > 0 {
+		id, msg := c.readMsg66()
+		switch msg := msg.(type) {
+		case *GetPooledTransactions:
+			for _, hash := range *msg {
+				delete(pending, hash)
+			}
+			var err error
+			if c.ethProtocolVersion >= 66 {
+				err = c.Write(&PooledTransactions66{RequestId: id})
+			} else {
+				err = c.Write(&PooledTransactions{})
+			}
+			if err != nil {
+				return fmt.Errorf("could not write to connection: %v", err)
+			}
+		case *Ping:
+			c.Write(&Pong{})
+		case *Disconnect:
+			return fmt.Errorf("disconnect received: %v", msg.Reason)
+		case *Error:
+			return fmt.Errorf("%d of %d announced transactions not requested: %v", len(pending), len(hashes), msg)
+		}
+	}
+	return nil
+}
+
+
+func isTxGossip(msg Message) bool {
+	switch msg.(type) {
+	case *Transactions, *NewPooledTransactionHashes:
+		return true
+	}
+	return false
+}
+
+
+func (c *Conn) readMsg() Message {
+	_, msg := c.readMsg66()
+	return msg
+}
+
+func (c *Conn) readMsg66() (uint64, Message) {
+	if c.ethProtocolVersion >= 66 {
+		return c.read66()
+	}
+	return 0, c.Read()
+}
@@ -165,10 +165,132 @@ type BlockBodies []*types.Body
 func (bb BlockBodies) Code() int { return 22 }
 
 
+type Transactions []*types.Transaction
+
+func (t Transactions) Code() int { return 18 }
+
+
+type NewPooledTransactionHashes []common.Hash
+
+func (nptp NewPooledTransactionHashes) Code() int { return 24 }
+
+
+type GetPooledTransactions []common.Hash
+
+func (gpt GetPooledTransactions) Code() int { return 25 }
+
+
+type PooledTransactions []*types.Transaction
+
+func (pt PooledTransactions) Code() int { return 26 }
+
+
+type GetNodeData []common.Hash
+
+func (gnd GetNodeData) Code() int { return 29 }
+
+
+type NodeData [][]byte
+
+func (nd NodeData) Code() int { return 30 }
+
+
+type GetReceipts []common.Hash
+
+func (gr GetReceipts) Code() int { return 31 }
+
+
+type Receipts [][]*types.Receipt
+
+func (r Receipts) Code() int { return 32 }
+
+
+type GetBlockHeaders66 struct {
+	RequestId uint64
+	*GetBlockHeaders
+}
+
+func (g GetBlockHeaders66) Code() int { return 19 }
+
+
+type BlockHeaders66 struct {
+	RequestId uint64
+	BlockHeaders
+}
+
+func (bh BlockHeaders66) Code() int { return 20 }
+
+
+type GetBlockBodies66 struct {
+	RequestId uint64
+	GetBlockBodies
+}
+
+func (gbb GetBlockBodies66) Code() int { return 21 }
+
+
+type BlockBodies66 struct {
+	RequestId uint64
+	BlockBodies
+}
+
+func (bb BlockBodies66) Code() int { return 22 }
+
+
+type GetPooledTransactions66 struct {
+	RequestId uint64
+	GetPooledTransactions
+}
+
+func (gpt GetPooledTransactions66) Code() int { return 25 }
+
+
+type PooledTransactions66 struct {
+	RequestId uint64
+	PooledTransactions
+}
+
+func (pt PooledTransactions66) Code() int { return 26 }
+
+
+type GetNodeData66 struct {
+	RequestId uint64
+	GetNodeData
+}
+
+func (gnd GetNodeData66) Code() int { return 29 }
+
+
+type NodeData66 struct {
+	RequestId uint64
+	NodeData
+}
+
+func (nd NodeData66) Code() int { return 30 }
+
+
+type GetReceipts66 struct {
+	RequestId uint64
+	GetReceipts
+}
+
+func (gr GetReceipts66) Code() int { return 31 }
+
+
+type Receipts66 struct {
+	RequestId uint64
+	Receipts
+}
+
+func (r Receipts66) Code() int { return 32 }
+
+
 type Conn struct {
 	*rlpx.Conn
-	ourKey             *ecdsa.PrivateKey
-	ethProtocolVersion uint
+	ourKey                 *ecdsa.PrivateKey
+	ethProtocolVersion     uint
+	caps                   []p2p.Cap
+	ourHighestProtoVersion uint
 }
 
 func (c *Conn) Read() Message {
@@ -201,6 +323,22 @@ func (c *Conn) Read() Message {
 		msg = new(NewBlock)
 	case (NewBlockHashes{}).Code():
 		msg = new(NewBlockHashes)
+	case (Transactions{}).Code():
+		msg = new(Transactions)
+	case (NewPooledTransactionHashes{}).Code():
+		msg = new(NewPooledTransactionHashes)
+	case (GetPooledTransactions{}).Code():
+		msg = new(GetPooledTransactions)
+	case (PooledTransactions{}).Code():
+		msg = new(PooledTransactions)
+	case (GetNodeData{}).Code():
+		msg = new(GetNodeData)
+	case (NodeData{}).Code():
+		msg = new(NodeData)
+	case (GetReceipts{}).Code():
+		msg = new(GetReceipts)
+	case (Receipts{}).Code():
+		msg = new(Receipts)
 	default:
 		return &Error{fmt.Errorf("invalid message code: %d", code)}
 	}
@@ -214,11 +352,16 @@ func (c *Conn) Read() Message {
 
 
 
-func (c *Conn) ReadAndServe(chain *Chain) Message {
+func (c *Conn) ReadAndServe(chain *Chain, timeout time.Duration) Message {
+	c.SetReadDeadline(time.Now().Add(timeout))
+	defer c.SetReadDeadline(time.Time{})
+
 	for {
 		switch msg := c.Read().(type) {
 		case *Ping:
 			c.Write(&Pong{})
+		case *Transactions, *NewPooledTransactionHashes:
+			
 		case *GetBlockHeaders:
 			req := *msg
 			headers, err := chain.GetHeaders(req)
@@ -251,11 +394,8 @@ func (c *Conn) handshake(t *utesting.T) Message {
 	pub0 := crypto.FromECDSAPub(&c.ourKey.PublicKey)[1:]
 	ourHandshake := &Hello{
 		Version: 5,
-		Caps: []p2p.Cap{
-			{Name: "eth", Version: 64},
-			{Name: "eth", Version: 65},
-		},
-		ID: pub0,
+		Caps:    c.caps,
+		ID:      pub0,
 	}
 	if err := c.Write(ourHandshake); err != nil {
 		t.Fatalf("could not write to connection: %v", err)
@@ -287,7 +427,7 @@ func (c *Conn) negotiateEthProtocol(caps []p2p.Cap) {
 		if capability.Name != "eth" {
 			continue
 		}
-		if capability.Version > highestEthVersion && capability.Version <= 65 {
+		if capability.Version > highestEthVersion && capability.Version <= c.ourHighestProtoVersion {
 			highestEthVersion = capability.Version
 		}
 	}
@@ -296,7 +436,7 @@ func (c *Conn) negotiateEthProtocol(caps []p2p.Cap) {
 
 
 
-func (c *Conn) statusExchange(t *utesting.T, chain *Chain) Message {
+func (c *Conn) statusExchange(t *utesting.T, chain *Chain, status *Status) Message {
 	
 	var message Message
 
@@ -329,7 +469,19 @@ loop:
 		t.Fatalf("eth protocol version must be set in Conn")
 	}
 	
-	status := Status{
+	if status == nil {
+		status = c.ourStatus(chain)
+	}
+	if err := c.Write(status); err != nil {
+		t.Fatalf("could not write to connection: %v", err)
+	}
+
+	return message
+}
+
+
+func (c *Conn) ourStatus(chain *Chain) *Status {
+	return &Status{
 		ProtocolVersion: uint32(c.ethProtocolVersion),
 		NetworkID:       1,
 		TD:              chain.TD(chain.Len()),
@@ -337,11 +489,6 @@ loop:
 		Genesis:         chain.blocks[0].Hash(),
 		ForkID:          chain.ForkID(),
 	}
-	if err := c.Write(status); err != nil {
-		t.Fatalf("could not write to connection: %v", err)
-	}
-
-	return message
 }
 
 
@@ -353,7 +500,11 @@ func (c *Conn) waitForBlock(block *types.Block) error {
 			return err
 		}
 
-		switch msg := c.Read().(type) {
+		msg := c.Read()
+		for isTxGossip(msg) {
+			msg = c.Read()
+		}
+		switch msg := msg.(type) {
 		case *BlockHeaders:
 			if len(*msg) > 0 {
 				return nil
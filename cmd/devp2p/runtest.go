@@ -0,0 +1,93 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ethereum/go-ethereum/internal/utesting"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	testPatternFlag = cli.StringFlag{
+		Name:  "run",
+		Usage: "Pattern of test suite(s) to run",
+	}
+	testTAPFlag = cli.BoolFlag{
+		Name:  "tap",
+		Usage: "Output test results in TAP format",
+	}
+	testJSONFlag = cli.StringFlag{
+		Name:  "json",
+		Usage: "Write test results as JSON to the given file ('-' for stdout)",
+	}
+)
+
+
+
+func runTests(ctx *cli.Context, tests []utesting.Test) error {
+	if ctx.IsSet(testPatternFlag.Name) {
+		tests = utesting.MatchTests(tests, ctx.String(testPatternFlag.Name))
+	}
+	var (
+		jsonFile           = ctx.String(testJSONFlag.Name)
+		tap                = ctx.Bool(testTAPFlag.Name)
+		report   io.Writer = os.Stdout
+	)
+	if jsonFile == "-" {
+		report = nil
+	}
+
+	var results []utesting.Result
+	if tap && report != nil {
+		results = utesting.RunTAP(tests, report)
+	} else {
+		results = utesting.RunTests(tests, report)
+	}
+	if jsonFile != "" {
+		if err := writeTestResults(jsonFile, results); err != nil {
+			return err
+		}
+	}
+
+	fails := utesting.CountFailures(results)
+	if fails > 0 {
+		return fmt.Errorf("%v/%v tests passed.", len(tests)-fails, len(tests))
+	}
+	if report != nil && !tap {
+		fmt.Printf("%v/%v passed\n", len(tests), len(tests))
+	}
+	return nil
+}
+
+func writeTestResults(file string, results []utesting.Result) error {
+	if file == "-" {
+		return utesting.WriteJSON(os.Stdout, results)
+	}
+	fd, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := utesting.WriteJSON(fd, results); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
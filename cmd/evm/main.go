@@ -192,6 +192,7 @@ func init() {
 		runCommand,
 		stateTestCommand,
 		stateTransitionCommand,
+		witnessCommand,
 	}
 	cli.CommandHelpTemplate = flags.OriginCommandHelpTemplate
 }
@@ -0,0 +1,106 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/params"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var witnessCommand = cli.Command{
+	Action:    witnessCmd,
+	Name:      "witness",
+	Usage:     "executes a block against its stateless witness and validates the result",
+	ArgsUsage: "<file>",
+}
+
+type WitnessResult struct {
+	Block   common.Hash        `json:"block"`
+	Number  uint64             `json:"number"`
+	Pass    bool               `json:"pass"`
+	Error   string             `json:"error,omitempty"`
+	Headers int                `json:"headers"`
+	Codes   int                `json:"codes"`
+	Nodes   int                `json:"nodes"`
+	Size    common.StorageSize `json:"size"`
+}
+
+func witnessCmd(ctx *cli.Context) error {
+	if len(ctx.Args().First()) == 0 {
+		return errors.New("path-to-witness argument required")
+	}
+	data, err := ioutil.ReadFile(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	if text := strings.TrimSpace(string(data)); strings.HasPrefix(text, "0x") {
+		if data, err = hexutil.Decode(text); err != nil {
+			return fmt.Errorf("invalid hex witness: %v", err)
+		}
+	}
+	block, witness, err := core.DecodeBlockWitness(data)
+	if err != nil {
+		return fmt.Errorf("invalid witness: %v", err)
+	}
+	config := params.MainnetChainConfig
+	if path := ctx.GlobalString(GenesisFlag.Name); path != "" {
+		genesis := readGenesis(path)
+		if genesis.Config != nil {
+			config = genesis.Config
+		}
+	}
+	var engine consensus.Engine
+	if config.Clique != nil {
+		engine = clique.New(config.Clique, rawdb.NewMemoryDatabase())
+	} else {
+		engine = ethash.NewFaker()
+	}
+	headers, codes, nodes, size := witness.Stats()
+	result := &WitnessResult{
+		Block:   block.Hash(),
+		Number:  block.NumberU64(),
+		Pass:    true,
+		Headers: headers,
+		Codes:   codes,
+		Nodes:   nodes,
+		Size:    size,
+	}
+	if err := core.VerifyStateless(config, engine, block, witness); err != nil {
+		result.Pass, result.Error = false, err.Error()
+	}
+	out, _ := json.MarshalIndent(result, "", "  ")
+	fmt.Println(string(out))
+	if !result.Pass {
+		os.Exit(1)
+	}
+	return nil
+}
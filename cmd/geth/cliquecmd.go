@@ -0,0 +1,142 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package main
+
+import (
+	"errors"
+	"os"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var (
+	cliqueCommand = cli.Command{
+		Name:        "clique",
+		Usage:       "Manage the clique signer's double-sign protection database",
+		Category:    "MISCELLANEOUS COMMANDS",
+		Description: "",
+		Subcommands: []cli.Command{
+			{
+				Name:      "export-history",
+				Usage:     "Export the clique signing history into a JSON interchange file",
+				ArgsUsage: "<filename>",
+				Action:    utils.MigrateFlags(exportSigningHistory),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags:     snapshotFlags,
+				Description: `
+geth clique export-history <filename>
+will write every block number and seal hash signed by the local clique
+signers to the given JSON file, tagged with the genesis hash of the chain.
+Use it together with import-history to move a signer to another machine
+without losing its double-sign protection.
+`,
+			},
+			{
+				Name:      "import-history",
+				Usage:     "Merge a JSON interchange file into the clique signing history",
+				ArgsUsage: "<filename>",
+				Action:    utils.MigrateFlags(importSigningHistory),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags:     snapshotFlags,
+				Description: `
+geth clique import-history <filename>
+will merge the signing history exported by another node into the local
+database. The import is rejected as a whole if the file belongs to another
+network, or if any entry conflicts with a block already signed locally.
+`,
+			},
+		},
+	}
+)
+
+func openSigningHistory(ctx *cli.Context, stack *node.Node) (*clique.SigningHistory, common.Hash, error) {
+	chaindb := utils.MakeChainDatabase(ctx, stack)
+	genesis := rawdb.ReadCanonicalHash(chaindb, 0)
+	chaindb.Close()
+
+	if genesis == (common.Hash{}) {
+		return nil, common.Hash{}, errors.New("genesis block missing, run geth init first")
+	}
+	db, err := stack.OpenDatabase("cliquehistory", 0, 0, "")
+	if err != nil {
+		return nil, common.Hash{}, err
+	}
+	return clique.NewSigningHistory(db), genesis, nil
+}
+
+func exportSigningHistory(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	history, genesis, err := openSigningHistory(ctx, stack)
+	if err != nil {
+		utils.Fatalf("Failed to open signing history: %v", err)
+	}
+	defer history.Close()
+
+	blocks, err := history.Blocks(nil)
+	if err != nil {
+		utils.Fatalf("Failed to read signing history: %v", err)
+	}
+	out, err := os.Create(ctx.Args().First())
+	if err != nil {
+		utils.Fatalf("Failed to create export file: %v", err)
+	}
+	defer out.Close()
+
+	if err := history.Export(out, genesis); err != nil {
+		utils.Fatalf("Export error: %v", err)
+	}
+	log.Info("Exported signing history", "file", ctx.Args().First(), "blocks", len(blocks), "genesis", genesis)
+	return nil
+}
+
+func importSigningHistory(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	history, genesis, err := openSigningHistory(ctx, stack)
+	if err != nil {
+		utils.Fatalf("Failed to open signing history: %v", err)
+	}
+	defer history.Close()
+
+	in, err := os.Open(ctx.Args().First())
+	if err != nil {
+		utils.Fatalf("Failed to open import file: %v", err)
+	}
+	defer in.Close()
+
+	imported, err := history.Import(in, genesis)
+	if err != nil {
+		utils.Fatalf("Import error: %v", err)
+	}
+	log.Info("Imported signing history", "file", ctx.Args().First(), "blocks", imported)
+	return nil
+}
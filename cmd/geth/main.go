@@ -92,7 +92,13 @@ var (
 		utils.ExitWhenSyncedFlag,
 		utils.GCModeFlag,
 		utils.SnapshotFlag,
+		utils.StateSchemeFlag,
+		utils.StateGCFlag,
 		utils.TxLookupLimitFlag,
+		utils.StateDiffsFlag,
+		utils.BlockWitnessesFlag,
+		utils.ParallelWorkersFlag,
+		utils.HistoryDirFlag,
 		utils.LightServeFlag,
 		utils.LegacyLightServFlag,
 		utils.LightIngressFlag,
@@ -114,12 +120,14 @@ var (
 		utils.CacheSnapshotFlag,
 		utils.CacheNoPrefetchFlag,
 		utils.ListenPortFlag,
+		utils.IPv6Flag,
 		utils.MaxPeersFlag,
 		utils.MaxPendingPeersFlag,
 		utils.MiningEnabledFlag,
 		utils.MinerThreadsFlag,
 		utils.LegacyMinerThreadsFlag,
 		utils.MinerNotifyFlag,
+		utils.MinerStratumFlag,
 		utils.MinerGasTargetFlag,
 		utils.LegacyMinerGasTargetFlag,
 		utils.MinerGasLimitFlag,
@@ -230,6 +238,10 @@ func init() {
 		dumpCommand,
 		dumpGenesisCommand,
 		inspectCommand,
+		diffexecCommand,
+		exportHistoryCommand,
+		importHistoryCommand,
+		verifyHistoryCommand,
 		
 		accountCommand,
 		walletCommand,
@@ -245,6 +257,9 @@ func init() {
 		
 		dumpConfigCommand,
 		
+		snapshotCommand,
+		cliqueCommand,
+		
 		retestethCommand,
 		
 		utils.ShowDeprecated,
@@ -0,0 +1,478 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/olekukonko/tablewriter"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var (
+	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+	emptyCode = crypto.Keccak256(nil)
+)
+
+var (
+	snapshotFlags = []cli.Flag{
+		utils.DataDirFlag,
+		utils.AncientFlag,
+		utils.RopstenFlag,
+		utils.RinkebyFlag,
+		utils.GoerliFlag,
+		utils.YoloV1Flag,
+		utils.LegacyTestnetFlag,
+	}
+
+	snapshotCommand = cli.Command{
+		Name:        "snapshot",
+		Usage:       "A set of commands based on the snapshot",
+		Category:    "MISCELLANEOUS COMMANDS",
+		Description: "",
+		Subcommands: []cli.Command{
+			{
+				Name:      "verify-state",
+				Usage:     "Recalculate state hash based on the snapshot for verification",
+				ArgsUsage: "<root>",
+				Action:    utils.MigrateFlags(verifyState),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags:     snapshotFlags,
+				Description: `
+geth snapshot verify-state <state-root>
+will traverse the whole accounts and storages set based on the specified
+snapshot and recalculate the root hash of state for verification.
+In other words, this command does the snapshot to trie conversion.
+
+If no root is specified, the state root of the head block is used.
+`,
+			},
+			{
+				Name:      "traverse-state",
+				Usage:     "Traverse the state trie and check that every node and code is present",
+				ArgsUsage: "<root>",
+				Action:    utils.MigrateFlags(traverseState),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags:     snapshotFlags,
+				Description: `
+geth snapshot traverse-state <state-root>
+will traverse the whole state from the given state root, resolving every
+account and storage trie node and every contract code from the database,
+and will abort with an error if any of them is missing.
+
+If no root is specified, the state root of the head block is used.
+`,
+			},
+			{
+				Name:      "inspect",
+				Usage:     "Print the status of the snapshot disk layer, journal and diff layers",
+				ArgsUsage: "",
+				Action:    utils.MigrateFlags(inspectSnapshot),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags:     snapshotFlags,
+				Description: `
+geth snapshot inspect
+will decode the persisted snapshot journal without loading or regenerating
+the snapshot, and print the disk layer root, the generation progress and
+every journalled diff layer, checking them against the head block.
+`,
+			},
+			{
+				Name:      "dump",
+				Usage:     "Stream accounts and storage of a state as JSON lines from the snapshot",
+				ArgsUsage: "<root>",
+				Action:    utils.MigrateFlags(dumpSnapshot),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags: append([]cli.Flag{
+					utils.ExcludeCodeFlag,
+					utils.ExcludeStorageFlag,
+				}, snapshotFlags...),
+				Description: `
+geth snapshot dump <state-root>
+will iterate the flat snapshot of the given state and write one JSON object
+per line to stdout: an "account" line for each account, followed by a
+"storage" line for each of its storage slots. Accounts and slots are ordered
+by their hashes and the trie is never touched, making this considerably
+faster than "geth dump".
+
+If no root is specified, the state root of the head block is used.
+`,
+			},
+		},
+	}
+)
+
+func headBlock(db ethdb.Database) (*types.Block, error) {
+	hash := rawdb.ReadHeadBlockHash(db)
+	if hash == (common.Hash{}) {
+		return nil, errors.New("head block hash missing")
+	}
+	number := rawdb.ReadHeaderNumber(db, hash)
+	if number == nil {
+		return nil, errors.New("head block number missing")
+	}
+	block := rawdb.ReadBlock(db, hash, *number)
+	if block == nil {
+		return nil, errors.New("head block missing")
+	}
+	return block, nil
+}
+
+func parseRoot(ctx *cli.Context, db ethdb.Database) (common.Hash, error) {
+	if ctx.NArg() > 1 {
+		return common.Hash{}, errors.New("too many arguments given")
+	}
+	if ctx.NArg() == 1 {
+		blob, err := hexutil.Decode(ctx.Args()[0])
+		if err != nil || len(blob) != common.HashLength {
+			return common.Hash{}, fmt.Errorf("invalid state root %q", ctx.Args()[0])
+		}
+		return common.BytesToHash(blob), nil
+	}
+	block, err := headBlock(db)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return block.Root(), nil
+}
+
+func loadSnapshot(db ethdb.Database, root common.Hash) (*snapshot.Tree, error) {
+	status, err := snapshot.ReadJournal(db)
+	if err != nil {
+		return nil, err
+	}
+	if !status.Done {
+		return nil, errors.New("snapshot is not fully generated yet")
+	}
+	block, err := headBlock(db)
+	if err != nil {
+		return nil, err
+	}
+	snaptree, err := snapshot.Load(db, trie.NewDatabase(db), 256, block.Root())
+	if err != nil {
+		return nil, err
+	}
+	if snaptree.Snapshot(root) == nil {
+		return nil, fmt.Errorf("no snapshot layer for state root %x", root)
+	}
+	return snaptree, nil
+}
+
+func verifyState(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chaindb := utils.MakeChainDatabase(ctx, stack)
+	defer chaindb.Close()
+
+	root, err := parseRoot(ctx, chaindb)
+	if err != nil {
+		log.Error("Failed to resolve state root", "err", err)
+		return err
+	}
+	snaptree, err := loadSnapshot(chaindb, root)
+	if err != nil {
+		log.Error("Failed to open snapshot tree", "err", err)
+		return err
+	}
+	if err := snapshot.VerifyState(snaptree, root); err != nil {
+		log.Error("Failed to verify state", "root", root, "err", err)
+		return err
+	}
+	log.Info("Verified the state", "root", root)
+	return nil
+}
+
+func traverseState(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chaindb := utils.MakeChainDatabase(ctx, stack)
+	defer chaindb.Close()
+
+	root, err := parseRoot(ctx, chaindb)
+	if err != nil {
+		log.Error("Failed to resolve state root", "err", err)
+		return err
+	}
+	triedb := trie.NewDatabase(chaindb)
+	t, err := trie.NewSecure(root, triedb)
+	if err != nil {
+		log.Error("Failed to open trie", "root", root, "err", err)
+		return err
+	}
+	var (
+		nodes      int
+		accounts   int
+		slots      int
+		codes      int
+		lastReport time.Time
+		start      = time.Now()
+	)
+	checkNode := func(hash common.Hash) error {
+		if triedb.Scheme() == rawdb.PathScheme {
+			return nil
+		}
+		if hash != (common.Hash{}) && len(rawdb.ReadTrieNode(chaindb, hash)) == 0 {
+			return fmt.Errorf("missing trie node %x", hash)
+		}
+		return nil
+	}
+	accIter := t.NodeIterator(nil)
+	for accIter.Next(true) {
+		nodes++
+		if err := checkNode(accIter.Hash()); err != nil {
+			log.Error("Missing account trie node", "hash", accIter.Hash())
+			return err
+		}
+		if !accIter.Leaf() {
+			continue
+		}
+		accounts++
+
+		var acc state.Account
+		if err := rlp.DecodeBytes(accIter.LeafBlob(), &acc); err != nil {
+			log.Error("Invalid account encountered during traversal", "err", err)
+			return err
+		}
+		if acc.Root != emptyRoot {
+			storageTrie, err := trie.NewSecureWithOwner(common.BytesToHash(accIter.LeafKey()), acc.Root, triedb)
+			if err != nil {
+				log.Error("Failed to open storage trie", "root", acc.Root, "err", err)
+				return err
+			}
+			storageIter := storageTrie.NodeIterator(nil)
+			for storageIter.Next(true) {
+				nodes++
+				if err := checkNode(storageIter.Hash()); err != nil {
+					log.Error("Missing storage trie node", "hash", storageIter.Hash())
+					return err
+				}
+				if storageIter.Leaf() {
+					slots++
+				}
+			}
+			if storageIter.Error() != nil {
+				log.Error("Failed to traverse storage trie", "root", acc.Root, "err", storageIter.Error())
+				return storageIter.Error()
+			}
+		}
+		if !bytes.Equal(acc.CodeHash, emptyCode) {
+			if len(rawdb.ReadCode(chaindb, common.BytesToHash(acc.CodeHash))) == 0 {
+				log.Error("Code is missing", "hash", common.BytesToHash(acc.CodeHash))
+				return errors.New("missing code")
+			}
+			codes++
+		}
+		if time.Since(lastReport) > time.Second*8 {
+			log.Info("Traversing state", "nodes", nodes, "accounts", accounts, "slots", slots, "codes", codes, "elapsed", common.PrettyDuration(time.Since(start)))
+			lastReport = time.Now()
+		}
+	}
+	if accIter.Error() != nil {
+		log.Error("Failed to traverse state trie", "root", root, "err", accIter.Error())
+		return accIter.Error()
+	}
+	log.Info("State is complete", "nodes", nodes, "accounts", accounts, "slots", slots, "codes", codes, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+func inspectSnapshot(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chaindb := utils.MakeChainDatabase(ctx, stack)
+	defer chaindb.Close()
+
+	status, err := snapshot.ReadJournal(chaindb)
+	if err != nil {
+		log.Error("Failed to read snapshot journal", "err", err)
+		return err
+	}
+	head := status.DiskRoot
+	if len(status.Layers) > 0 {
+		head = status.Layers[len(status.Layers)-1].Root
+	}
+	generation := "done"
+	switch {
+	case status.Wiping:
+		generation = "wiping"
+	case !status.Done:
+		generation = fmt.Sprintf("in progress at %x", status.Marker)
+	}
+	fmt.Printf("Disk layer root:   %x\n", status.DiskRoot)
+	fmt.Printf("Generation:        %s\n", generation)
+	fmt.Printf("Generated:         %d accounts, %d slots, %v\n", status.Accounts, status.Slots, status.Storage)
+	fmt.Printf("Diff layers:       %d\n", len(status.Layers))
+	fmt.Printf("Journal head root: %x\n", head)
+
+	if block, err := headBlock(chaindb); err != nil {
+		fmt.Printf("Head block:        %v\n", err)
+	} else {
+		match := "matches journal head"
+		if block.Root() != head {
+			match = "does NOT match journal head, snapshot will be regenerated on startup"
+		}
+		fmt.Printf("Head block:        #%d, root %x (%s)\n", block.NumberU64(), block.Root(), match)
+	}
+	if len(status.Layers) > 0 {
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Depth", "Root", "Destructs", "Accounts", "Slots"})
+		for i, layer := range status.Layers {
+			table.Append([]string{
+				fmt.Sprint(len(status.Layers) - i),
+				layer.Root.Hex(),
+				fmt.Sprint(layer.Destructs),
+				fmt.Sprint(layer.Accounts),
+				fmt.Sprint(layer.Slots),
+			})
+		}
+		table.Render()
+	}
+	return nil
+}
+
+type dumpAccount struct {
+	Type     string          `json:"type"`
+	Hash     common.Hash     `json:"hash"`
+	Address  *common.Address `json:"address,omitempty"`
+	Nonce    uint64          `json:"nonce"`
+	Balance  *hexutil.Big    `json:"balance"`
+	Root     common.Hash     `json:"root"`
+	CodeHash common.Hash     `json:"codeHash"`
+	Code     hexutil.Bytes   `json:"code,omitempty"`
+}
+
+type dumpSlot struct {
+	Type    string      `json:"type"`
+	Account common.Hash `json:"account"`
+	Hash    common.Hash `json:"hash"`
+	Value   common.Hash `json:"value"`
+}
+
+func dumpSnapshot(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chaindb := utils.MakeChainDatabase(ctx, stack)
+	defer chaindb.Close()
+
+	root, err := parseRoot(ctx, chaindb)
+	if err != nil {
+		log.Error("Failed to resolve state root", "err", err)
+		return err
+	}
+	snaptree, err := loadSnapshot(chaindb, root)
+	if err != nil {
+		log.Error("Failed to open snapshot tree", "err", err)
+		return err
+	}
+	accIt, err := snaptree.AccountIterator(root, common.Hash{})
+	if err != nil {
+		return err
+	}
+	defer accIt.Release()
+
+	var (
+		excludeCode    = ctx.Bool(utils.ExcludeCodeFlag.Name)
+		excludeStorage = ctx.Bool(utils.ExcludeStorageFlag.Name)
+		out            = bufio.NewWriterSize(os.Stdout, 1024*1024)
+		enc            = json.NewEncoder(out)
+		accounts       int
+		slots          int
+		lastReport     time.Time
+		start          = time.Now()
+	)
+	defer out.Flush()
+
+	for accIt.Next() {
+		acc, err := snapshot.FullAccount(accIt.Account())
+		if err != nil {
+			return err
+		}
+		entry := &dumpAccount{
+			Type:     "account",
+			Hash:     accIt.Hash(),
+			Nonce:    acc.Nonce,
+			Balance:  (*hexutil.Big)(acc.Balance),
+			Root:     common.BytesToHash(acc.Root),
+			CodeHash: common.BytesToHash(acc.CodeHash),
+		}
+		if preimage := rawdb.ReadPreimage(chaindb, accIt.Hash()); len(preimage) == common.AddressLength {
+			addr := common.BytesToAddress(preimage)
+			entry.Address = &addr
+		}
+		if !excludeCode && !bytes.Equal(acc.CodeHash, emptyCode) {
+			entry.Code = rawdb.ReadCode(chaindb, entry.CodeHash)
+		}
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+		accounts++
+
+		if !excludeStorage && entry.Root != emptyRoot {
+			stIt, err := snaptree.StorageIterator(root, accIt.Hash(), common.Hash{})
+			if err != nil {
+				return err
+			}
+			for stIt.Next() {
+				_, content, _, err := rlp.Split(stIt.Slot())
+				if err != nil {
+					stIt.Release()
+					return err
+				}
+				if err := enc.Encode(&dumpSlot{Type: "storage", Account: accIt.Hash(), Hash: stIt.Hash(), Value: common.BytesToHash(content)}); err != nil {
+					stIt.Release()
+					return err
+				}
+				slots++
+			}
+			err = stIt.Error()
+			stIt.Release()
+			if err != nil {
+				return err
+			}
+		}
+		if time.Since(lastReport) > time.Second*8 {
+			log.Info("Dumping snapshot", "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+			lastReport = time.Now()
+		}
+	}
+	if err := accIt.Error(); err != nil {
+		return err
+	}
+	log.Info("Dumped snapshot", "root", root, "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
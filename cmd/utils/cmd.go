@@ -18,11 +18,14 @@
 package utils
 
 import (
+	"bufio"
 	"compress/gzip"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"syscall"
@@ -34,6 +37,7 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/internal/debug"
+	"github.com/ethereum/go-ethereum/internal/era"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/rlp"
@@ -312,3 +316,210 @@ func ExportPreimages(db ethdb.Database, fn string) error {
 	log.Info("Exported preimages", "file", fn)
 	return nil
 }
+
+
+func ExportHistory(blockchain *core.BlockChain, dir string, first, last uint64) error {
+	log.Info("Exporting history", "dir", dir, "first", first, "last", last)
+	if head := blockchain.CurrentBlock().NumberU64(); last > head {
+		return fmt.Errorf("export range exceeds chain head %d", head)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	network := era.NetworkName(blockchain.Genesis().Hash())
+	for start := first; start <= last; start = (start/era.MaxSize + 1) * era.MaxSize {
+		end := (start/era.MaxSize+1)*era.MaxSize - 1
+		if end > last {
+			end = last
+		}
+		if err := exportEpoch(blockchain, dir, network, start, end); err != nil {
+			return err
+		}
+	}
+	log.Info("Exported history", "dir", dir)
+	return nil
+}
+
+func exportEpoch(blockchain *core.BlockChain, dir, network string, first, last uint64) error {
+	fh, err := ioutil.TempFile(dir, "era1-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(fh.Name())
+	defer fh.Close()
+
+	writer := bufio.NewWriter(fh)
+	builder := era.NewBuilder(writer)
+	for number := first; number <= last; number++ {
+		block := blockchain.GetBlockByNumber(number)
+		if block == nil {
+			return fmt.Errorf("export failed on #%d: not found", number)
+		}
+		receipts := blockchain.GetReceiptsByHash(block.Hash())
+		if receipts == nil {
+			return fmt.Errorf("export failed on #%d: receipts not found", number)
+		}
+		td := blockchain.GetTd(block.Hash(), number)
+		if td == nil {
+			return fmt.Errorf("export failed on #%d: total difficulty not found", number)
+		}
+		if err := builder.Add(block, receipts, td); err != nil {
+			return fmt.Errorf("export failed on #%d: %v", number, err)
+		}
+	}
+	root, err := builder.Finalize()
+	if err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if err := fh.Close(); err != nil {
+		return err
+	}
+	name := era.Filename(network, int(first/era.MaxSize), root)
+	if err := os.Rename(fh.Name(), filepath.Join(dir, name)); err != nil {
+		return err
+	}
+	log.Info("Exported epoch", "file", name, "first", first, "last", last, "root", root)
+	return nil
+}
+
+
+func ImportHistory(chain *core.BlockChain, dir string) error {
+	interrupt := make(chan os.Signal, 1)
+	stop := make(chan struct{})
+	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	defer close(interrupt)
+	go func() {
+		if _, ok := <-interrupt; ok {
+			log.Info("Interrupted during import, stopping at next batch")
+		}
+		close(stop)
+	}()
+	checkInterrupt := func() bool {
+		select {
+		case <-stop:
+			return true
+		default:
+			return false
+		}
+	}
+	log.Info("Importing history", "dir", dir)
+
+	files, err := era.ReadDir(dir, era.NetworkName(chain.Genesis().Hash()))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no history files found in %s", dir)
+	}
+	for _, file := range files {
+		if checkInterrupt() {
+			return fmt.Errorf("interrupted")
+		}
+		if err := importEpoch(chain, filepath.Join(dir, file)); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+	}
+	log.Info("Imported history", "dir", dir)
+	return nil
+}
+
+func importEpoch(chain *core.BlockChain, path string) error {
+	e, err := era.Open(path)
+	if err != nil {
+		return err
+	}
+	defer e.Close()
+
+	if err := e.Verify(); err != nil {
+		return err
+	}
+	var (
+		headers  []*types.Header
+		blocks   types.Blocks
+		receipts []types.Receipts
+	)
+	flush := func() error {
+		if len(blocks) == 0 {
+			return nil
+		}
+		if _, err := chain.InsertHeaderChain(headers, 100); err != nil {
+			return err
+		}
+		if _, err := chain.InsertReceiptChain(blocks, receipts, 0); err != nil {
+			return err
+		}
+		headers, blocks, receipts = nil, nil, nil
+		return nil
+	}
+	for number := e.Start(); number < e.Start()+e.Count(); number++ {
+		block, err := e.GetBlockByNumber(number)
+		if err != nil {
+			return err
+		}
+		if number == 0 {
+			if block.Hash() != chain.Genesis().Hash() {
+				return fmt.Errorf("genesis mismatch: have %x, want %x", block.Hash(), chain.Genesis().Hash())
+			}
+			continue
+		}
+		if chain.HasBlock(block.Hash(), number) {
+			continue
+		}
+		blockReceipts, err := e.GetReceiptsByNumber(number)
+		if err != nil {
+			return err
+		}
+		headers = append(headers, block.Header())
+		blocks = append(blocks, block)
+		receipts = append(receipts, blockReceipts)
+
+		if len(blocks) == importBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	log.Info("Imported epoch", "file", filepath.Base(path), "first", e.Start(), "last", e.Start()+e.Count()-1)
+	return nil
+}
+
+
+func VerifyHistory(dir, network string) error {
+	files, err := era.ReadDir(dir, network)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no history files found in %s", dir)
+	}
+	var prev *types.Header
+	for _, file := range files {
+		e, err := era.Open(filepath.Join(dir, file))
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		err = e.Verify()
+		if err == nil && prev != nil && prev.Number.Uint64()+1 == e.Start() {
+			var first *types.Header
+			if first, err = e.GetHeaderByNumber(e.Start()); err == nil && first.ParentHash != prev.Hash() {
+				err = fmt.Errorf("parent hash mismatch with previous epoch")
+			}
+		}
+		if err == nil {
+			prev, err = e.GetHeaderByNumber(e.Start() + e.Count() - 1)
+		}
+		e.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		log.Info("Verified epoch", "file", file, "first", e.Start(), "last", e.Start()+e.Count()-1)
+	}
+	return nil
+}
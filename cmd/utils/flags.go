@@ -23,6 +23,7 @@ import (
 	"io"
 	"io/ioutil"
 	"math/big"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -36,6 +37,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/fdlimit"
 	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/bft"
 	"github.com/ethereum/go-ethereum/consensus/clique"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
@@ -58,7 +60,6 @@ import (
 	"github.com/ethereum/go-ethereum/miner"
 	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/p2p"
-	"github.com/ethereum/go-ethereum/p2p/discv5"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/p2p/nat"
 	"github.com/ethereum/go-ethereum/p2p/netutil"
@@ -199,11 +200,36 @@ var (
 		Name:  "snapshot",
 		Usage: `Enables snapshot-database mode -- experimental work in progress feature`,
 	}
+	StateSchemeFlag = cli.StringFlag{
+		Name:  "state.scheme",
+		Usage: `Scheme to use for storing state trie nodes ("hash" or "path"), only honoured on database creation`,
+	}
 	TxLookupLimitFlag = cli.Int64Flag{
 		Name:  "txlookuplimit",
 		Usage: "Number of recent blocks to maintain transactions index by-hash for (default = index all blocks)",
 		Value: 0,
 	}
+	StateGCFlag = cli.BoolFlag{
+		Name:  "state.gc",
+		Usage: "Delete unreferenced state trie nodes from disk as newer tries are persisted (experimental)",
+	}
+	StateDiffsFlag = cli.BoolFlag{
+		Name:  "statediffs",
+		Usage: "Persist a per-block state diff (balances, nonces, code and storage) for every imported block",
+	}
+	BlockWitnessesFlag = cli.BoolFlag{
+		Name:  "witnesses",
+		Usage: "Persist a stateless execution witness (touched trie nodes, code and headers) for every imported block",
+	}
+	ParallelWorkersFlag = cli.IntFlag{
+		Name:  "parallel.workers",
+		Usage: "Number of workers for optimistic parallel transaction execution (0 = sequential)",
+		Value: 0,
+	}
+	HistoryDirFlag = DirectoryFlag{
+		Name:  "history.dir",
+		Usage: "Directory of epoch archive files to serve pruned block history from",
+	}
 	LightKDFFlag = cli.BoolFlag{
 		Name:  "lightkdf",
 		Usage: "Reduce key-derivation RAM & CPU usage at some expense of KDF strength",
@@ -397,6 +423,10 @@ var (
 		Name:  "miner.notify",
 		Usage: "Comma separated HTTP URL list to notify of new work packages",
 	}
+	MinerStratumFlag = cli.StringFlag{
+		Name:  "miner.stratum",
+		Usage: "Listening address of the stratum server for remote miners (e.g. 127.0.0.1:8008)",
+	}
 	MinerGasTargetFlag = cli.Uint64Flag{
 		Name:  "miner.gastarget",
 		Usage: "Target gas floor for mined blocks",
@@ -578,6 +608,10 @@ var (
 		Usage: "Network listening port",
 		Value: 30303,
 	}
+	IPv6Flag = cli.BoolFlag{
+		Name:  "ipv6",
+		Usage: "Listen and discover on IPv6 in addition to IPv4 (dual-stack)",
+	}
 	BootnodesFlag = cli.StringFlag{
 		Name:  "bootnodes",
 		Usage: "Comma separated enode URLs for P2P discovery bootstrap",
@@ -845,10 +879,10 @@ func setBootstrapNodesV5(ctx *cli.Context, cfg *p2p.Config) {
 		return 
 	}
 
-	cfg.BootstrapNodesV5 = make([]*discv5.Node, 0, len(urls))
+	cfg.BootstrapNodesV5 = make([]*enode.Node, 0, len(urls))
 	for _, url := range urls {
 		if url != "" {
-			node, err := discv5.ParseNode(url)
+			node, err := enode.Parse(enode.ValidSchemes, url)
 			if err != nil {
 				log.Error("Bootstrap URL invalid", "enode", url, "err", err)
 				continue
@@ -864,6 +898,13 @@ func setListenAddress(ctx *cli.Context, cfg *p2p.Config) {
 	if ctx.GlobalIsSet(ListenPortFlag.Name) {
 		cfg.ListenAddr = fmt.Sprintf(":%d", ctx.GlobalInt(ListenPortFlag.Name))
 	}
+	if ctx.GlobalBool(IPv6Flag.Name) {
+		_, port, err := net.SplitHostPort(cfg.ListenAddr)
+		if err != nil {
+			Fatalf("Option %q: %v", IPv6Flag.Name, err)
+		}
+		cfg.ListenAddr6 = net.JoinHostPort("::", port)
+	}
 }
 
 
@@ -1195,6 +1236,7 @@ func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config) {
 		
 		cfg.MaxPeers = 0
 		cfg.ListenAddr = ":0"
+		cfg.ListenAddr6 = ""
 		cfg.NoDiscovery = true
 		cfg.DiscoveryV5 = false
 	}
@@ -1368,6 +1410,9 @@ func setEthash(ctx *cli.Context, cfg *eth.Config) {
 	if ctx.GlobalIsSet(EthashDatasetsLockMmapFlag.Name) {
 		cfg.Ethash.DatasetsLockMmap = ctx.GlobalBool(EthashDatasetsLockMmapFlag.Name)
 	}
+	if ctx.GlobalIsSet(MinerStratumFlag.Name) {
+		cfg.Ethash.StratumAddr = ctx.GlobalString(MinerStratumFlag.Name)
+	}
 }
 
 func setMiner(ctx *cli.Context, cfg *miner.Config) {
@@ -1523,12 +1568,30 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	if ctx.GlobalIsSet(GCModeFlag.Name) {
 		cfg.NoPruning = ctx.GlobalString(GCModeFlag.Name) == "archive"
 	}
+	if ctx.GlobalIsSet(StateSchemeFlag.Name) {
+		cfg.StateScheme = ctx.GlobalString(StateSchemeFlag.Name)
+	}
 	if ctx.GlobalIsSet(CacheNoPrefetchFlag.Name) {
 		cfg.NoPrefetch = ctx.GlobalBool(CacheNoPrefetchFlag.Name)
 	}
 	if ctx.GlobalIsSet(TxLookupLimitFlag.Name) {
 		cfg.TxLookupLimit = ctx.GlobalUint64(TxLookupLimitFlag.Name)
 	}
+	if ctx.GlobalIsSet(StateGCFlag.Name) {
+		cfg.StateGC = ctx.GlobalBool(StateGCFlag.Name)
+	}
+	if ctx.GlobalIsSet(StateDiffsFlag.Name) {
+		cfg.StateDiffs = ctx.GlobalBool(StateDiffsFlag.Name)
+	}
+	if ctx.GlobalIsSet(BlockWitnessesFlag.Name) {
+		cfg.BlockWitnesses = ctx.GlobalBool(BlockWitnessesFlag.Name)
+	}
+	if ctx.GlobalIsSet(ParallelWorkersFlag.Name) {
+		cfg.ParallelWorkers = ctx.GlobalInt(ParallelWorkersFlag.Name)
+	}
+	if ctx.GlobalIsSet(HistoryDirFlag.Name) {
+		cfg.HistoryDir = ctx.GlobalString(HistoryDirFlag.Name)
+	}
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheTrieFlag.Name) {
 		cfg.TrieCleanCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheTrieFlag.Name) / 100
 	}
@@ -1642,6 +1705,7 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 
 		
 		cfg.Genesis = core.DeveloperGenesisBlock(uint64(ctx.GlobalInt(DeveloperPeriodFlag.Name)), developer.Address)
+		cfg.Developer = true
 		if ctx.GlobalIsSet(DataDirFlag.Name) {
 			
 			
@@ -1803,6 +1867,10 @@ func MakeGenesis(ctx *cli.Context) *core.Genesis {
 func MakeChain(ctx *cli.Context, stack *node.Node, readOnly bool) (chain *core.BlockChain, chainDb ethdb.Database) {
 	var err error
 	chainDb = MakeChainDatabase(ctx, stack)
+	scheme, err := core.SetupStateScheme(chainDb, ctx.GlobalString(StateSchemeFlag.Name))
+	if err != nil {
+		Fatalf("%v", err)
+	}
 	config, _, err := core.SetupGenesisBlock(chainDb, MakeGenesis(ctx))
 	if err != nil {
 		Fatalf("%v", err)
@@ -1810,6 +1878,8 @@ func MakeChain(ctx *cli.Context, stack *node.Node, readOnly bool) (chain *core.B
 	var engine consensus.Engine
 	if config.Clique != nil {
 		engine = clique.New(config.Clique, chainDb)
+	} else if config.BFT != nil {
+		engine = bft.New(config.BFT, chainDb)
 	} else {
 		engine = ethash.NewFaker()
 		if !ctx.GlobalBool(FakePoWFlag.Name) {
@@ -1832,9 +1902,13 @@ func MakeChain(ctx *cli.Context, stack *node.Node, readOnly bool) (chain *core.B
 		TrieCleanLimit:      eth.DefaultConfig.TrieCleanCache,
 		TrieCleanNoPrefetch: ctx.GlobalBool(CacheNoPrefetchFlag.Name),
 		TrieDirtyLimit:      eth.DefaultConfig.TrieDirtyCache,
-		TrieDirtyDisabled:   ctx.GlobalString(GCModeFlag.Name) == "archive",
+		TrieDirtyDisabled:   ctx.GlobalString(GCModeFlag.Name) == "archive" || scheme == rawdb.PathScheme,
 		TrieTimeLimit:       eth.DefaultConfig.TrieTimeout,
 		SnapshotLimit:       eth.DefaultConfig.SnapshotCache,
+		TrieDiskGC:          ctx.GlobalBool(StateGCFlag.Name),
+		StateDiffs:          ctx.GlobalBool(StateDiffsFlag.Name),
+		BlockWitnesses:      ctx.GlobalBool(BlockWitnessesFlag.Name),
+		ParallelWorkers:     ctx.GlobalInt(ParallelWorkersFlag.Name),
 	}
 	if !ctx.GlobalIsSet(SnapshotFlag.Name) {
 		cache.SnapshotLimit = 0 
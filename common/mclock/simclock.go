@@ -34,6 +34,7 @@ import (
 type Simulated struct {
 	now       AbsTime
 	scheduled simTimerHeap
+	seq       uint64
 	mu        sync.RWMutex
 	cond      *sync.Cond
 }
@@ -41,6 +42,7 @@ type Simulated struct {
 
 type simTimer struct {
 	at    AbsTime
+	seq   uint64
 	index int 
 	s     *Simulated
 	do    func()
@@ -81,6 +83,18 @@ func (s *Simulated) ActiveTimers() int {
 }
 
 
+
+func (s *Simulated) NextTimer() (AbsTime, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.scheduled) == 0 {
+		return 0, false
+	}
+	return s.scheduled[0].at, true
+}
+
+
 func (s *Simulated) WaitForTimers(n int) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -135,7 +149,8 @@ func (s *Simulated) schedule(d time.Duration, fn func()) *simTimer {
 	s.init()
 
 	at := s.now + AbsTime(d)
-	ev := &simTimer{do: fn, at: at, s: s}
+	ev := &simTimer{do: fn, at: at, seq: s.seq, s: s}
+	s.seq++
 	heap.Push(&s.scheduled, ev)
 	s.cond.Broadcast()
 	return ev
@@ -162,6 +177,8 @@ func (ev *simTimer) Reset(d time.Duration) {
 	ev.s.mu.Lock()
 	defer ev.s.mu.Unlock()
 	ev.at = ev.s.now.Add(d)
+	ev.seq = ev.s.seq
+	ev.s.seq++
 	if ev.index < 0 {
 		heap.Push(&ev.s.scheduled, ev) 
 	} else {
@@ -184,7 +201,10 @@ func (h *simTimerHeap) Len() int {
 }
 
 func (h *simTimerHeap) Less(i, j int) bool {
-	return (*h)[i].at < (*h)[j].at
+	if (*h)[i].at != (*h)[j].at {
+		return (*h)[i].at < (*h)[j].at
+	}
+	return (*h)[i].seq < (*h)[j].seq
 }
 
 func (h *simTimerHeap) Swap(i, j int) {
@@ -0,0 +1,548 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package bft
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	checkpointInterval = 1024
+	inmemorySnapshots  = 128
+	inmemorySignatures = 4096
+	inmemoryMessages   = 8192
+)
+
+var (
+	epochLength    = uint64(30000)
+	requestTimeout = uint64(10000)
+
+	nonceAuthVote = hexutil.MustDecode("0xffffffffffffffff")
+	nonceDropVote = hexutil.MustDecode("0x0000000000000000")
+
+	uncleHash = types.CalcUncleHash(nil)
+
+	defaultDifficulty = big.NewInt(1)
+)
+
+var (
+	errUnknownBlock = errors.New("unknown block")
+
+	errInvalidCheckpointBeneficiary = errors.New("beneficiary in checkpoint block non-zero")
+
+	errInvalidVote = errors.New("vote nonce not 0x00..0 or 0xff..f")
+
+	errInvalidCheckpointVote = errors.New("vote nonce in checkpoint block non-zero")
+
+	errExtraValidators = errors.New("non-checkpoint block contains extra validator list")
+
+	errMismatchingCheckpointValidators = errors.New("mismatching validator list on checkpoint block")
+
+	errInvalidMixDigest = errors.New("mix digest is not the BFT digest")
+
+	errInvalidUncleHash = errors.New("non empty uncle hash")
+
+	errInvalidDifficulty = errors.New("invalid difficulty")
+
+	errInvalidTimestamp = errors.New("invalid timestamp")
+
+	errInvalidVotingChain = errors.New("invalid voting chain")
+
+	errUnauthorizedValidator = errors.New("unauthorized validator")
+
+	errMissingSignature = errors.New("extra-data seal missing")
+
+	errInvalidCommittedSeals = errors.New("invalid committed seals")
+
+	errInsufficientCommittedSeals = errors.New("insufficient committed seals")
+)
+
+type SignerFn func(signer accounts.Account, mimeType string, message []byte) ([]byte, error)
+
+func ecrecover(header *types.Header, sigcache *lru.ARCCache) (common.Address, error) {
+	hash := header.Hash()
+	if address, known := sigcache.Get(hash); known {
+		return address.(common.Address), nil
+	}
+	extra, err := ExtractExtra(header)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if len(extra.Seal) == 0 {
+		return common.Address{}, errMissingSignature
+	}
+	signer, err := ecrecoverHash(SealHash(header), extra.Seal)
+	if err != nil {
+		return common.Address{}, err
+	}
+	sigcache.Add(hash, signer)
+	return signer, nil
+}
+
+type BFT struct {
+	config *params.BFTConfig
+	db     ethdb.Database
+
+	recents    *lru.ARCCache
+	signatures *lru.ARCCache
+
+	proposals map[common.Address]bool
+
+	signer common.Address
+	signFn SignerFn
+	lock   sync.RWMutex
+
+	rounds   *roundManager
+	peers    *peerSet
+	messages *lru.ARCCache
+}
+
+func New(config *params.BFTConfig, db ethdb.Database) *BFT {
+	conf := *config
+	if conf.Epoch == 0 {
+		conf.Epoch = epochLength
+	}
+	if conf.Period == 0 {
+		conf.Period = 1
+	}
+	if conf.RequestTimeout == 0 {
+		conf.RequestTimeout = requestTimeout
+	}
+	recents, _ := lru.NewARC(inmemorySnapshots)
+	signatures, _ := lru.NewARC(inmemorySignatures)
+	messages, _ := lru.NewARC(inmemoryMessages)
+
+	b := &BFT{
+		config:     &conf,
+		db:         db,
+		recents:    recents,
+		signatures: signatures,
+		proposals:  make(map[common.Address]bool),
+		peers:      newPeerSet(),
+		messages:   messages,
+	}
+	b.rounds = newRoundManager(b)
+	return b
+}
+
+func (b *BFT) Author(header *types.Header) (common.Address, error) {
+	return ecrecover(header, b.signatures)
+}
+
+func (b *BFT) VerifyHeader(chain consensus.ChainHeaderReader, header *types.Header, seal bool) error {
+	return b.verifyHeader(chain, header, nil, true)
+}
+
+
+
+
+func (b *BFT) verifyProposal(chain consensus.ChainHeaderReader, header *types.Header) error {
+	return b.verifyHeader(chain, header, nil, false)
+}
+
+func (b *BFT) VerifyHeaders(chain consensus.ChainHeaderReader, headers []*types.Header, seals []bool) (chan<- struct{}, <-chan error) {
+	abort := make(chan struct{})
+	results := make(chan error, len(headers))
+
+	go func() {
+		for i, header := range headers {
+			err := b.verifyHeader(chain, header, headers[:i], true)
+
+			select {
+			case <-abort:
+				return
+			case results <- err:
+			}
+		}
+	}()
+	return abort, results
+}
+
+func (b *BFT) verifyHeader(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header, committed bool) error {
+	if header.Number == nil {
+		return errUnknownBlock
+	}
+	number := header.Number.Uint64()
+
+	if header.Time > uint64(time.Now().Unix()) {
+		return consensus.ErrFutureBlock
+	}
+	checkpoint := (number % b.config.Epoch) == 0
+	if checkpoint && header.Coinbase != (common.Address{}) {
+		return errInvalidCheckpointBeneficiary
+	}
+	if !bytes.Equal(header.Nonce[:], nonceAuthVote) && !bytes.Equal(header.Nonce[:], nonceDropVote) {
+		return errInvalidVote
+	}
+	if checkpoint && !bytes.Equal(header.Nonce[:], nonceDropVote) {
+		return errInvalidCheckpointVote
+	}
+	extra, err := ExtractExtra(header)
+	if err != nil {
+		return err
+	}
+	if !checkpoint && len(extra.Validators) != 0 {
+		return errExtraValidators
+	}
+	if number > 0 && header.MixDigest != types.BFTDigest {
+		return errInvalidMixDigest
+	}
+	if header.UncleHash != uncleHash {
+		return errInvalidUncleHash
+	}
+	if number > 0 && (header.Difficulty == nil || header.Difficulty.Cmp(defaultDifficulty) != 0) {
+		return errInvalidDifficulty
+	}
+	if err := misc.VerifyForkHashes(chain.Config(), header, false); err != nil {
+		return err
+	}
+	return b.verifyCascadingFields(chain, header, extra, parents, committed)
+}
+
+func (b *BFT) verifyCascadingFields(chain consensus.ChainHeaderReader, header *types.Header, extra *Extra, parents []*types.Header, committed bool) error {
+	number := header.Number.Uint64()
+	if number == 0 {
+		return nil
+	}
+	var parent *types.Header
+	if len(parents) > 0 {
+		parent = parents[len(parents)-1]
+	} else {
+		parent = chain.GetHeader(header.ParentHash, number-1)
+	}
+	if parent == nil || parent.Number.Uint64() != number-1 || parent.Hash() != header.ParentHash {
+		return consensus.ErrUnknownAncestor
+	}
+	if parent.Time+b.config.Period > header.Time {
+		return errInvalidTimestamp
+	}
+	snap, err := b.snapshot(chain, number-1, header.ParentHash, parents)
+	if err != nil {
+		return err
+	}
+	if number%b.config.Epoch == 0 {
+		validators := snap.validators()
+		if len(validators) != len(extra.Validators) {
+			return errMismatchingCheckpointValidators
+		}
+		for i, validator := range validators {
+			if extra.Validators[i] != validator {
+				return errMismatchingCheckpointValidators
+			}
+		}
+	}
+	return b.verifySeal(chain, header, extra, parents, committed)
+}
+
+
+
+
+func verifyCommittedSeals(snap *Snapshot, header *types.Header, seals [][]byte) error {
+	hash := CommitHash(header.Hash())
+	signers := make(map[common.Address]struct{})
+	for _, seal := range seals {
+		signer, err := ecrecoverHash(hash, seal)
+		if err != nil {
+			return errInvalidCommittedSeals
+		}
+		if _, ok := snap.Validators[signer]; !ok {
+			return errInvalidCommittedSeals
+		}
+		if _, ok := signers[signer]; ok {
+			return errInvalidCommittedSeals
+		}
+		signers[signer] = struct{}{}
+	}
+	if len(signers) < snap.quorum() {
+		return errInsufficientCommittedSeals
+	}
+	return nil
+}
+
+func (b *BFT) snapshot(chain consensus.ChainHeaderReader, number uint64, hash common.Hash, parents []*types.Header) (*Snapshot, error) {
+	var (
+		headers []*types.Header
+		snap    *Snapshot
+	)
+	for snap == nil {
+		if s, ok := b.recents.Get(hash); ok {
+			snap = s.(*Snapshot)
+			break
+		}
+		if number%checkpointInterval == 0 {
+			if s, err := loadSnapshot(b.config, b.signatures, b.db, hash); err == nil {
+				log.Trace("Loaded validator snapshot from disk", "number", number, "hash", hash)
+				snap = s
+				break
+			}
+		}
+		if number == 0 || (number%b.config.Epoch == 0 && (len(headers) > params.FullImmutabilityThreshold || chain.GetHeaderByNumber(number-1) == nil)) {
+			checkpoint := chain.GetHeaderByNumber(number)
+			if checkpoint != nil {
+				hash := checkpoint.Hash()
+
+				extra, err := ExtractExtra(checkpoint)
+				if err != nil {
+					return nil, err
+				}
+				snap = newSnapshot(b.config, b.signatures, number, hash, extra.Validators)
+				if err := snap.store(b.db); err != nil {
+					return nil, err
+				}
+				log.Info("Stored checkpoint snapshot to disk", "number", number, "hash", hash)
+				break
+			}
+		}
+		var header *types.Header
+		if len(parents) > 0 {
+			header = parents[len(parents)-1]
+			if header.Hash() != hash || header.Number.Uint64() != number {
+				return nil, consensus.ErrUnknownAncestor
+			}
+			parents = parents[:len(parents)-1]
+		} else {
+			header = chain.GetHeader(hash, number)
+			if header == nil {
+				return nil, consensus.ErrUnknownAncestor
+			}
+		}
+		headers = append(headers, header)
+		number, hash = number-1, header.ParentHash
+	}
+	for i := 0; i < len(headers)/2; i++ {
+		headers[i], headers[len(headers)-1-i] = headers[len(headers)-1-i], headers[i]
+	}
+	snap, err := snap.apply(headers)
+	if err != nil {
+		return nil, err
+	}
+	b.recents.Add(snap.Hash, snap)
+
+	if snap.Number%checkpointInterval == 0 && len(headers) > 0 {
+		if err = snap.store(b.db); err != nil {
+			return nil, err
+		}
+		log.Trace("Stored validator snapshot to disk", "number", snap.Number, "hash", snap.Hash)
+	}
+	return snap, err
+}
+
+func (b *BFT) VerifyUncles(chain consensus.ChainReader, block *types.Block) error {
+	if len(block.Uncles()) > 0 {
+		return errors.New("uncles not allowed")
+	}
+	return nil
+}
+
+func (b *BFT) VerifySeal(chain consensus.ChainHeaderReader, header *types.Header) error {
+	extra, err := ExtractExtra(header)
+	if err != nil {
+		return err
+	}
+	return b.verifySeal(chain, header, extra, nil, true)
+}
+
+func (b *BFT) verifySeal(chain consensus.ChainHeaderReader, header *types.Header, extra *Extra, parents []*types.Header, committed bool) error {
+	number := header.Number.Uint64()
+	if number == 0 {
+		return errUnknownBlock
+	}
+	snap, err := b.snapshot(chain, number-1, header.ParentHash, parents)
+	if err != nil {
+		return err
+	}
+	signer, err := ecrecover(header, b.signatures)
+	if err != nil {
+		return err
+	}
+	if _, ok := snap.Validators[signer]; !ok {
+		return errUnauthorizedValidator
+	}
+	if !committed {
+		return nil
+	}
+	return verifyCommittedSeals(snap, header, extra.CommittedSeals)
+}
+
+func (b *BFT) Prepare(chain consensus.ChainHeaderReader, header *types.Header) error {
+	header.Coinbase = common.Address{}
+	header.Nonce = types.BlockNonce{}
+
+	number := header.Number.Uint64()
+	snap, err := b.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return err
+	}
+	if number%b.config.Epoch != 0 {
+		b.lock.RLock()
+
+		addresses := make([]common.Address, 0, len(b.proposals))
+		for address, authorize := range b.proposals {
+			if snap.validVote(address, authorize) {
+				addresses = append(addresses, address)
+			}
+		}
+		if len(addresses) > 0 {
+			header.Coinbase = addresses[rand.Intn(len(addresses))]
+			if b.proposals[header.Coinbase] {
+				copy(header.Nonce[:], nonceAuthVote)
+			} else {
+				copy(header.Nonce[:], nonceDropVote)
+			}
+		}
+		b.lock.RUnlock()
+	}
+	header.Difficulty = new(big.Int).Set(defaultDifficulty)
+
+	extra := new(Extra)
+	if number%b.config.Epoch == 0 {
+		extra.Validators = snap.validators()
+	}
+	if header.Extra, err = EncodeExtra(header.Extra, extra); err != nil {
+		return err
+	}
+	header.MixDigest = types.BFTDigest
+
+	parent := chain.GetHeader(header.ParentHash, number-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	header.Time = parent.Time + b.config.Period
+	if header.Time < uint64(time.Now().Unix()) {
+		header.Time = uint64(time.Now().Unix())
+	}
+	return nil
+}
+
+func (b *BFT) Finalize(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header) {
+	header.Root = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
+	header.UncleHash = types.CalcUncleHash(nil)
+}
+
+func (b *BFT) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
+	header.Root = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
+	header.UncleHash = types.CalcUncleHash(nil)
+
+	return types.NewBlock(header, txs, nil, receipts, new(trie.Trie)), nil
+}
+
+func (b *BFT) Authorize(signer common.Address, signFn SignerFn) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.signer = signer
+	b.signFn = signFn
+}
+
+func (b *BFT) Seal(chain consensus.ChainHeaderReader, block *types.Block, results chan<- *types.Block, stop <-chan struct{}) error {
+	header := block.Header()
+
+	number := header.Number.Uint64()
+	if number == 0 {
+		return errUnknownBlock
+	}
+	b.lock.RLock()
+	signer, signFn := b.signer, b.signFn
+	b.lock.RUnlock()
+
+	snap, err := b.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return err
+	}
+	if _, authorized := snap.Validators[signer]; !authorized {
+		return errUnauthorizedValidator
+	}
+	extra, err := ExtractExtra(header)
+	if err != nil {
+		return err
+	}
+	if extra.Seal, err = signFn(accounts.Account{Address: signer}, accounts.MimetypeBFT, BFTRLP(header)); err != nil {
+		return err
+	}
+	if header.Extra, err = EncodeExtra(header.Extra, extra); err != nil {
+		return err
+	}
+	delay := time.Unix(int64(header.Time), 0).Sub(time.Now())
+
+	log.Trace("Waiting for slot to propose", "delay", common.PrettyDuration(delay))
+	go func() {
+		select {
+		case <-stop:
+			return
+		case <-time.After(delay):
+		}
+		b.rounds.request(&request{block: block.WithSeal(header), results: results, stop: stop})
+	}()
+	return nil
+}
+
+func (b *BFT) CalcDifficulty(chain consensus.ChainHeaderReader, time uint64, parent *types.Header) *big.Int {
+	return new(big.Int).Set(defaultDifficulty)
+}
+
+func (b *BFT) SealHash(header *types.Header) common.Hash {
+	return SealHash(header)
+}
+
+func (b *BFT) Close() error {
+	b.rounds.stop()
+	return nil
+}
+
+func (b *BFT) APIs(chain consensus.ChainHeaderReader) []rpc.API {
+	return []rpc.API{{
+		Namespace: "bft",
+		Version:   "1.0",
+		Service:   &API{chain: chain, bft: b},
+		Public:    false,
+	}}
+}
+
+func (b *BFT) Start(chain Chain) {
+	b.rounds.start(chain)
+}
+
+func (b *BFT) sign(data []byte) ([]byte, common.Address, error) {
+	b.lock.RLock()
+	signer, signFn := b.signer, b.signFn
+	b.lock.RUnlock()
+
+	if signFn == nil {
+		return nil, common.Address{}, errUnauthorizedValidator
+	}
+	sig, err := signFn(accounts.Account{Address: signer}, accounts.MimetypeBFT, data)
+	return sig, signer, err
+}
@@ -0,0 +1,260 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package bft
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"sort"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+type testerValidator struct {
+	key  *ecdsa.PrivateKey
+	addr common.Address
+}
+
+
+func newTesterValidators(n int) []*testerValidator {
+	vals := make([]*testerValidator, n)
+	for i := range vals {
+		key, _ := crypto.GenerateKey()
+		vals[i] = &testerValidator{key: key, addr: crypto.PubkeyToAddress(key.PublicKey)}
+	}
+	sort.Slice(vals, func(i, j int) bool {
+		return validatorsAscending{vals[i].addr, vals[j].addr}.Less(0, 1)
+	})
+	return vals
+}
+
+func newTestConfig(period uint64) *params.ChainConfig {
+	config := *params.AllCliqueProtocolChanges
+	config.Clique = nil
+	config.BFT = &params.BFTConfig{Period: period, Epoch: 30000, RequestTimeout: 1000}
+	return &config
+}
+
+func newTestGenesis(config *params.ChainConfig, vals []*testerValidator) *core.Genesis {
+	addrs := make([]common.Address, len(vals))
+	for i, val := range vals {
+		addrs[i] = val.addr
+	}
+	return &core.Genesis{
+		Config:     config,
+		ExtraData:  GenesisExtra(addrs),
+		GasLimit:   8000000,
+		Difficulty: big.NewInt(1),
+	}
+}
+
+
+
+func sealTestHeader(header *types.Header, proposer *testerValidator, committers []*testerValidator) *types.Header {
+	header = types.CopyHeader(header)
+	header.MixDigest = types.BFTDigest
+
+	extra := new(Extra)
+	header.Extra, _ = EncodeExtra(nil, extra)
+	extra.Seal, _ = crypto.Sign(SealHash(header).Bytes(), proposer.key)
+	header.Extra, _ = EncodeExtra(nil, extra)
+
+	commit := CommitHash(header.Hash())
+	for _, val := range committers {
+		seal, _ := crypto.Sign(commit.Bytes(), val.key)
+		extra.CommittedSeals = append(extra.CommittedSeals, seal)
+	}
+	header.Extra, _ = EncodeExtra(nil, extra)
+	return header
+}
+
+
+
+func makeTestChain(genesis *core.Genesis, vals []*testerValidator, n int, committers func(int) []*testerValidator) []*types.Block {
+	db := rawdb.NewMemoryDatabase()
+	parent := genesis.MustCommit(db)
+	engine := New(genesis.Config.BFT, db)
+
+	blocks, _ := core.GenerateChain(genesis.Config, parent, engine, db, n, nil)
+	for i, block := range blocks {
+		header := block.Header()
+		if i > 0 {
+			header.ParentHash = blocks[i-1].Hash()
+		}
+		blocks[i] = block.WithSeal(sealTestHeader(header, vals[i%len(vals)], committers(i)))
+	}
+	return blocks
+}
+
+func newTestChain(t *testing.T, genesis *core.Genesis) (*core.BlockChain, *BFT) {
+	db := rawdb.NewMemoryDatabase()
+	genesis.MustCommit(db)
+	engine := New(genesis.Config.BFT, db)
+	chain, err := core.NewBlockChain(db, nil, genesis.Config, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	return chain, engine
+}
+
+func TestCommittedChainImport(t *testing.T) {
+	vals := newTesterValidators(4)
+	genesis := newTestGenesis(newTestConfig(1), vals)
+	blocks := makeTestChain(genesis, vals, 10, func(i int) []*testerValidator { return vals[:3] })
+
+	chain, engine := newTestChain(t, genesis)
+	defer chain.Stop()
+
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+	head := chain.CurrentBlock()
+	if head.Hash() != blocks[len(blocks)-1].Hash() {
+		t.Fatalf("head mismatch: have %x, want %x", head.Hash(), blocks[len(blocks)-1].Hash())
+	}
+	api := &API{chain: chain, bft: engine}
+	signers, err := api.GetCommittedSeals(head.Hash())
+	if err != nil {
+		t.Fatalf("failed to retrieve committed seals: %v", err)
+	}
+	if len(signers) != 3 {
+		t.Fatalf("committed seal count mismatch: have %d, want 3", len(signers))
+	}
+	for i, signer := range signers {
+		if signer != vals[i].addr {
+			t.Errorf("committed seal %d: signer mismatch: have %x, want %x", i, signer, vals[i].addr)
+		}
+	}
+}
+
+func TestHeadRequiresQuorum(t *testing.T) {
+	vals := newTesterValidators(4)
+	genesis := newTestGenesis(newTestConfig(1), vals)
+
+	tests := []struct {
+		committers []*testerValidator
+		err        error
+	}{
+		{nil, errInsufficientCommittedSeals},
+		{vals[:1], errInsufficientCommittedSeals},
+		{vals[:2], errInsufficientCommittedSeals},
+		{[]*testerValidator{vals[0], vals[0], vals[1]}, errInvalidCommittedSeals},
+		{append(newTesterValidators(1), vals[:3]...), errInvalidCommittedSeals},
+		{vals[:3], nil},
+		{vals, nil},
+	}
+	for i, tt := range tests {
+		blocks := makeTestChain(genesis, vals, 5, func(n int) []*testerValidator {
+			if n == 4 {
+				return tt.committers
+			}
+			return vals
+		})
+		chain, _ := newTestChain(t, genesis)
+		_, err := chain.InsertChain(blocks)
+		if err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+		if tt.err != nil && chain.CurrentBlock().NumberU64() != 4 {
+			t.Errorf("test %d: head mismatch: have %d, want 4", i, chain.CurrentBlock().NumberU64())
+		}
+		chain.Stop()
+	}
+}
+
+func TestConflictingProposals(t *testing.T) {
+	vals := newTesterValidators(4)
+	genesis := newTestGenesis(newTestConfig(1), vals)
+	parent := genesis.ToBlock(nil)
+
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     big.NewInt(1),
+		GasLimit:   parent.GasLimit(),
+		Time:       parent.Time() + 1,
+		Difficulty: big.NewInt(1),
+		Root:       parent.Root(),
+		UncleHash:  types.EmptyUncleHash,
+	}
+	other := types.CopyHeader(header)
+	other.Time++
+
+	chain, engine := newTestChain(t, genesis)
+	defer chain.Stop()
+
+
+	for _, proposal := range []*types.Header{header, other} {
+		sealed := sealTestHeader(proposal, vals[1], vals[1:2])
+		if err := engine.VerifyHeader(chain, sealed, true); err != errInsufficientCommittedSeals {
+			t.Errorf("proposal %x: error mismatch: have %v, want %v", sealed.Hash(), err, errInsufficientCommittedSeals)
+		}
+	}
+
+
+	one := sealTestHeader(header, vals[1], vals[:3])
+	two := sealTestHeader(header, vals[1], vals[1:])
+	if one.Hash() != two.Hash() {
+		t.Fatalf("committed seals affect block hash: %x != %x", one.Hash(), two.Hash())
+	}
+	if SealHash(one) != SealHash(two) {
+		t.Fatalf("committed seals affect seal hash: %x != %x", SealHash(one), SealHash(two))
+	}
+	for _, sealed := range []*types.Header{one, two} {
+		if err := engine.VerifyHeader(chain, sealed, true); err != nil {
+			t.Errorf("failed to verify committed header: %v", err)
+		}
+	}
+}
+
+func TestPrepareWithoutLocalRounds(t *testing.T) {
+	vals := newTesterValidators(4)
+	genesis := newTestGenesis(newTestConfig(1), vals)
+	blocks := makeTestChain(genesis, vals, 3, func(i int) []*testerValidator { return vals[1:] })
+
+	chain, engine := newTestChain(t, genesis)
+	defer chain.Stop()
+
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+	head := chain.CurrentBlock()
+	header := &types.Header{
+		ParentHash: head.Hash(),
+		Number:     new(big.Int).Add(head.Number(), common.Big1),
+		GasLimit:   head.GasLimit(),
+	}
+	if err := engine.Prepare(chain, header); err != nil {
+		t.Fatalf("failed to prepare header: %v", err)
+	}
+	if header.MixDigest != types.BFTDigest {
+		t.Errorf("mix digest mismatch: have %x, want %x", header.MixDigest, types.BFTDigest)
+	}
+	extra, err := ExtractExtra(header)
+	if err != nil {
+		t.Fatalf("failed to decode extra-data: %v", err)
+	}
+	if len(extra.Seal) != 0 || len(extra.CommittedSeals) != 0 {
+		t.Errorf("prepared header carries seals")
+	}
+}
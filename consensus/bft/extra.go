@@ -0,0 +1,129 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package bft
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"golang.org/x/crypto/sha3"
+)
+
+const extraVanity = types.BFTExtraVanity
+
+var (
+	errMissingVanity = errors.New("extra-data 32 byte vanity prefix missing")
+
+	errInvalidExtra = errors.New("invalid extra-data")
+)
+
+type Extra = types.BFTExtra
+
+func ExtractExtra(header *types.Header) (*Extra, error) {
+	if len(header.Extra) < extraVanity {
+		return nil, errMissingVanity
+	}
+	extra := new(Extra)
+	if err := rlp.DecodeBytes(header.Extra[extraVanity:], extra); err != nil {
+		return nil, errInvalidExtra
+	}
+	return extra, nil
+}
+
+func EncodeExtra(vanity []byte, extra *Extra) ([]byte, error) {
+	if len(vanity) < extraVanity {
+		vanity = append(vanity, bytes.Repeat([]byte{0x00}, extraVanity-len(vanity))...)
+	}
+	enc, err := rlp.EncodeToBytes(extra)
+	if err != nil {
+		return nil, err
+	}
+	return append(common.CopyBytes(vanity[:extraVanity]), enc...), nil
+}
+
+func GenesisExtra(validators []common.Address) []byte {
+	extra, err := EncodeExtra(nil, &Extra{Validators: validators})
+	if err != nil {
+		panic("can't encode: " + err.Error())
+	}
+	return extra
+}
+
+func SealHash(header *types.Header) (hash common.Hash) {
+	hasher := sha3.NewLegacyKeccak256()
+	encodeSigHeader(hasher, header)
+	hasher.Sum(hash[:0])
+	return hash
+}
+
+func BFTRLP(header *types.Header) []byte {
+	b := new(bytes.Buffer)
+	encodeSigHeader(b, header)
+	return b.Bytes()
+}
+
+func encodeSigHeader(w io.Writer, header *types.Header) {
+	extra, err := ExtractExtra(header)
+	if err != nil {
+		panic("can't decode: " + err.Error())
+	}
+	unsealed, err := EncodeExtra(header.Extra[:extraVanity], &Extra{Validators: extra.Validators})
+	if err != nil {
+		panic("can't encode: " + err.Error())
+	}
+	err = rlp.Encode(w, []interface{}{
+		header.ParentHash,
+		header.UncleHash,
+		header.Coinbase,
+		header.Root,
+		header.TxHash,
+		header.ReceiptHash,
+		header.Bloom,
+		header.Difficulty,
+		header.Number,
+		header.GasLimit,
+		header.GasUsed,
+		header.Time,
+		unsealed,
+		header.MixDigest,
+		header.Nonce,
+	})
+	if err != nil {
+		panic("can't encode: " + err.Error())
+	}
+}
+
+func commitData(hash common.Hash) []byte {
+	return append(hash.Bytes(), byte(msgCommit))
+}
+
+func CommitHash(hash common.Hash) common.Hash {
+	return crypto.Keccak256Hash(commitData(hash))
+}
+
+func ecrecoverHash(hash common.Hash, sig []byte) (common.Address, error) {
+	pubkey, err := crypto.SigToPub(hash.Bytes(), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pubkey), nil
+}
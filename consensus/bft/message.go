@@ -0,0 +1,129 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package bft
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	msgPreprepare uint64 = iota
+	msgPrepare
+	msgCommit
+	msgRoundChange
+)
+
+var errInvalidMessage = errors.New("invalid consensus message")
+
+type message struct {
+	Code          uint64
+	Sequence      uint64
+	Round         uint64
+	Digest        common.Hash
+	Block         []byte
+	PreparedRound uint64
+	Seal          []byte
+	Justification [][]byte
+	Signature     []byte
+
+	source common.Address
+	block  *types.Block
+	raw    []byte
+}
+
+func (m *message) String() string {
+	var code string
+	switch m.Code {
+	case msgPreprepare:
+		code = "preprepare"
+	case msgPrepare:
+		code = "prepare"
+	case msgCommit:
+		code = "commit"
+	case msgRoundChange:
+		code = "roundchange"
+	default:
+		code = fmt.Sprintf("unknown(%d)", m.Code)
+	}
+	return fmt.Sprintf("{%s seq: %d round: %d digest: %x source: %x}", code, m.Sequence, m.Round, m.Digest[:4], m.source[:4])
+}
+
+func (m *message) payload() []byte {
+	enc, err := rlp.EncodeToBytes([]interface{}{
+		m.Code,
+		m.Sequence,
+		m.Round,
+		m.Digest,
+		m.Block,
+		m.PreparedRound,
+		m.Seal,
+		m.Justification,
+	})
+	if err != nil {
+		panic("can't encode: " + err.Error())
+	}
+	return enc
+}
+
+func (m *message) encode() []byte {
+	if m.raw == nil {
+		enc, err := rlp.EncodeToBytes(m)
+		if err != nil {
+			panic("can't encode: " + err.Error())
+		}
+		m.raw = enc
+	}
+	return m.raw
+}
+
+func (m *message) hash() common.Hash {
+	return crypto.Keccak256Hash(m.encode())
+}
+
+func decodeMessage(raw []byte) (*message, error) {
+	m := new(message)
+	if err := rlp.DecodeBytes(raw, m); err != nil {
+		return nil, err
+	}
+	if m.Code > msgRoundChange {
+		return nil, errInvalidMessage
+	}
+	source, err := ecrecoverHash(crypto.Keccak256Hash(m.payload()), m.Signature)
+	if err != nil {
+		return nil, err
+	}
+	m.source = source
+	m.raw = common.CopyBytes(raw)
+
+	if len(m.Block) > 0 {
+		block := new(types.Block)
+		if err := rlp.DecodeBytes(m.Block, block); err != nil {
+			return nil, err
+		}
+		if block.Hash() != m.Digest {
+			return nil, errInvalidMessage
+		}
+		m.block = block
+	}
+	return m, nil
+}
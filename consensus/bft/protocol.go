@@ -0,0 +1,213 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package bft
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	mapset "github.com/deckarep/golang-set"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	ProtocolName    = "bft"
+	ProtocolVersion = 1
+	protocolLength  = 1
+
+	consensusMsg = 0x00
+
+	maxMessageSize    = 10 * 1024 * 1024
+	maxKnownMessages  = 4096
+	maxQueuedMessages = 256
+)
+
+var errMessageTooLarge = errors.New("consensus message too large")
+
+type peer struct {
+	id    string
+	rw    p2p.MsgReadWriter
+	known mapset.Set
+	queue chan []byte
+	term  chan struct{}
+}
+
+func newPeer(id string, rw p2p.MsgReadWriter) *peer {
+	return &peer{
+		id:    id,
+		rw:    rw,
+		known: mapset.NewSet(),
+		queue: make(chan []byte, maxQueuedMessages),
+		term:  make(chan struct{}),
+	}
+}
+
+func (p *peer) markKnown(hash common.Hash) {
+	for p.known.Cardinality() >= maxKnownMessages {
+		p.known.Pop()
+	}
+	p.known.Add(hash)
+}
+
+func (p *peer) send(hash common.Hash, raw []byte) {
+	if p.known.Contains(hash) {
+		return
+	}
+	p.markKnown(hash)
+	select {
+	case p.queue <- raw:
+	default:
+		log.Debug("Dropping consensus message, peer queue full", "peer", p.id)
+	}
+}
+
+func (p *peer) broadcastLoop() {
+	for {
+		select {
+		case raw := <-p.queue:
+			if err := p2p.Send(p.rw, consensusMsg, rlp.RawValue(raw)); err != nil {
+				return
+			}
+		case <-p.term:
+			return
+		}
+	}
+}
+
+type peerSet struct {
+	peers map[string]*peer
+	lock  sync.RWMutex
+}
+
+func newPeerSet() *peerSet {
+	return &peerSet{peers: make(map[string]*peer)}
+}
+
+func (ps *peerSet) register(p *peer) error {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if _, ok := ps.peers[p.id]; ok {
+		return p2p.DiscAlreadyConnected
+	}
+	ps.peers[p.id] = p
+	return nil
+}
+
+func (ps *peerSet) unregister(id string) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if p, ok := ps.peers[id]; ok {
+		close(p.term)
+		delete(ps.peers, id)
+	}
+}
+
+func (ps *peerSet) all() []*peer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	list := make([]*peer, 0, len(ps.peers))
+	for _, p := range ps.peers {
+		list = append(list, p)
+	}
+	return list
+}
+
+func (ps *peerSet) len() int {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	return len(ps.peers)
+}
+
+func (b *BFT) Protocols() []p2p.Protocol {
+	return []p2p.Protocol{{
+		Name:    ProtocolName,
+		Version: ProtocolVersion,
+		Length:  protocolLength,
+		Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+			return b.runPeer(newPeer(p.ID().String(), rw))
+		},
+		NodeInfo: func() interface{} {
+			return b.rounds.roundStatus()
+		},
+	}}
+}
+
+func (b *BFT) runPeer(p *peer) error {
+	if err := b.peers.register(p); err != nil {
+		return err
+	}
+	defer b.peers.unregister(p.id)
+
+	go p.broadcastLoop()
+	for {
+		if err := b.handleMsg(p); err != nil {
+			log.Debug("Consensus peer handling failed", "peer", p.id, "err", err)
+			return err
+		}
+	}
+}
+
+func (b *BFT) handleMsg(p *peer) error {
+	msg, err := p.rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	defer msg.Discard()
+
+	if msg.Size > maxMessageSize {
+		return errMessageTooLarge
+	}
+	switch msg.Code {
+	case consensusMsg:
+		raw, err := ioutil.ReadAll(msg.Payload)
+		if err != nil {
+			return err
+		}
+		hash := crypto.Keccak256Hash(raw)
+		p.markKnown(hash)
+		if b.messages.Contains(hash) {
+			return nil
+		}
+		b.messages.Add(hash, struct{}{})
+
+		m, err := decodeMessage(raw)
+		if err != nil {
+			return fmt.Errorf("invalid consensus message: %v", err)
+		}
+		b.rounds.deliver(m)
+	default:
+		return fmt.Errorf("invalid message code %d", msg.Code)
+	}
+	return nil
+}
+
+func (b *BFT) gossip(m *message) {
+	hash, raw := m.hash(), m.encode()
+	for _, p := range b.peers.all() {
+		p.send(hash, raw)
+	}
+}
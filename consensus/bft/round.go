@@ -0,0 +1,681 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package bft
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+const (
+	maxBacklog        = 1024
+	maxRoundShift     = 8
+	chainHeadChanSize = 10
+
+	allowedFutureProposalTime = 15 * time.Second
+)
+
+type Chain interface {
+	consensus.ChainReader
+	CurrentBlock() *types.Block
+	InsertChain(chain types.Blocks) (int, error)
+	SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription
+	StateAt(root common.Hash) (*state.StateDB, error)
+	Processor() core.Processor
+	Validator() core.Validator
+	GetVMConfig() *vm.Config
+}
+
+type roundState uint64
+
+const (
+	stateAcceptRequest roundState = iota
+	statePreprepared
+	statePrepared
+	stateCommitted
+)
+
+func (s roundState) String() string {
+	switch s {
+	case stateAcceptRequest:
+		return "accept-request"
+	case statePreprepared:
+		return "preprepared"
+	case statePrepared:
+		return "prepared"
+	case stateCommitted:
+		return "committed"
+	}
+	return "unknown"
+}
+
+type request struct {
+	block   *types.Block
+	results chan<- *types.Block
+	stop    <-chan struct{}
+}
+
+type RoundStatus struct {
+	Sequence uint64         `json:"sequence"`
+	Round    uint64         `json:"round"`
+	State    string         `json:"state"`
+	Proposer common.Address `json:"proposer"`
+	Locked   *common.Hash   `json:"locked"`
+}
+
+type roundManager struct {
+	bft   *BFT
+	chain Chain
+
+	requestCh chan *request
+	messageCh chan *message
+	quit      chan struct{}
+	wg        sync.WaitGroup
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+
+	statusLock sync.RWMutex
+	status     RoundStatus
+
+	head         *types.Header
+	snap         *Snapshot
+	sequence     uint64
+	round        uint64
+	state        roundState
+	requests     map[common.Hash]*request
+	latest       *request
+	proposal     *types.Block
+	proposed     bool
+	prepares     map[common.Address]*message
+	commits      map[common.Address]*message
+	roundChanges map[uint64]map[common.Address]*message
+	prepared     *message
+	backlog      []*message
+	timeout      <-chan time.Time
+}
+
+func newRoundManager(bft *BFT) *roundManager {
+	return &roundManager{
+		bft:       bft,
+		requestCh: make(chan *request),
+		messageCh: make(chan *message, 256),
+		quit:      make(chan struct{}),
+	}
+}
+
+func (r *roundManager) start(chain Chain) {
+	r.startOnce.Do(func() {
+		r.chain = chain
+		r.wg.Add(1)
+		go r.loop()
+	})
+}
+
+func (r *roundManager) stop() {
+	r.stopOnce.Do(func() {
+		close(r.quit)
+		r.wg.Wait()
+	})
+}
+
+func (r *roundManager) request(req *request) {
+	select {
+	case r.requestCh <- req:
+	case <-req.stop:
+	case <-r.quit:
+	}
+}
+
+func (r *roundManager) deliver(m *message) {
+	select {
+	case r.messageCh <- m:
+	case <-r.quit:
+	}
+}
+
+func (r *roundManager) roundStatus() RoundStatus {
+	r.statusLock.RLock()
+	defer r.statusLock.RUnlock()
+
+	return r.status
+}
+
+func (r *roundManager) loop() {
+	defer r.wg.Done()
+
+	headCh := make(chan core.ChainHeadEvent, chainHeadChanSize)
+	sub := r.chain.SubscribeChainHeadEvent(headCh)
+	defer sub.Unsubscribe()
+
+	r.newHeight(r.chain.CurrentBlock().Header())
+	for {
+		select {
+		case ev := <-headCh:
+			if ev.Block.NumberU64() >= r.sequence {
+				r.newHeight(ev.Block.Header())
+			}
+		case req := <-r.requestCh:
+			r.handleRequest(req)
+		case m := <-r.messageCh:
+			r.handleMessage(m)
+		case <-r.timeout:
+			log.Debug("Consensus round timed out", "sequence", r.sequence, "round", r.round)
+			r.moveToRound(r.round + 1)
+		case <-sub.Err():
+			return
+		case <-r.quit:
+			return
+		}
+	}
+}
+
+func (r *roundManager) newHeight(head *types.Header) {
+	snap, err := r.bft.snapshot(r.chain, head.Number.Uint64(), head.Hash(), nil)
+	if err != nil {
+		log.Error("Failed to retrieve validator snapshot", "number", head.Number, "hash", head.Hash(), "err", err)
+		return
+	}
+	r.head, r.snap = head, snap
+	r.sequence = head.Number.Uint64() + 1
+	r.requests = make(map[common.Hash]*request)
+	r.latest = nil
+	r.roundChanges = make(map[uint64]map[common.Address]*message)
+	r.prepared = nil
+
+	r.startRound(0)
+}
+
+func (r *roundManager) startRound(round uint64) {
+	r.round = round
+	r.state = stateAcceptRequest
+	r.proposal = nil
+	r.proposed = false
+	r.prepares = make(map[common.Address]*message)
+	r.commits = make(map[common.Address]*message)
+
+	shift := round
+	if shift > maxRoundShift {
+		shift = maxRoundShift
+	}
+	r.timeout = time.After(time.Duration(r.bft.config.RequestTimeout) * time.Millisecond << shift)
+	r.updateStatus()
+
+	log.Debug("Starting consensus round", "sequence", r.sequence, "round", round, "proposer", r.snap.proposer(round))
+
+	r.tryPropose()
+	r.processBacklog()
+}
+
+func (r *roundManager) moveToRound(round uint64) {
+	r.startRound(round)
+	r.sendRoundChange(round)
+}
+
+func (r *roundManager) updateStatus() {
+	status := RoundStatus{
+		Sequence: r.sequence,
+		Round:    r.round,
+		State:    r.state.String(),
+		Proposer: r.snap.proposer(r.round),
+	}
+	if r.prepared != nil {
+		digest := r.prepared.Digest
+		status.Locked = &digest
+	}
+	r.statusLock.Lock()
+	r.status = status
+	r.statusLock.Unlock()
+}
+
+func (r *roundManager) isValidator() bool {
+	r.bft.lock.RLock()
+	signer, signFn := r.bft.signer, r.bft.signFn
+	r.bft.lock.RUnlock()
+
+	_, ok := r.snap.Validators[signer]
+	return ok && signFn != nil
+}
+
+func (r *roundManager) isProposer() bool {
+	r.bft.lock.RLock()
+	signer := r.bft.signer
+	r.bft.lock.RUnlock()
+
+	return r.isValidator() && r.snap.proposer(r.round) == signer
+}
+
+func (r *roundManager) handleRequest(req *request) {
+	if r.head == nil || req.block.NumberU64() != r.sequence || req.block.ParentHash() != r.head.Hash() {
+		return
+	}
+	r.requests[req.block.Hash()] = req
+	r.latest = req
+	r.tryPropose()
+}
+
+func (r *roundManager) tryPropose() {
+	if r.proposed || r.state != stateAcceptRequest || !r.isProposer() {
+		return
+	}
+	var (
+		block         *types.Block
+		justification [][]byte
+	)
+	if r.round > 0 {
+		changes := r.roundChanges[r.round]
+		if len(changes) < r.snap.quorum() {
+			return
+		}
+		var highest *message
+		for _, m := range changes {
+			justification = append(justification, m.encode())
+			if m.block != nil && (highest == nil || m.PreparedRound > highest.PreparedRound) {
+				highest = m
+			}
+		}
+		if highest != nil {
+			block = highest.block
+		}
+	}
+	if block == nil {
+		if r.latest == nil {
+			return
+		}
+		block = r.latest.block
+	}
+	enc, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		log.Error("Failed to encode proposal", "err", err)
+		return
+	}
+	r.proposed = true
+	log.Info("Proposing block", "number", block.Number(), "hash", block.Hash(), "round", r.round, "txs", len(block.Transactions()))
+
+	r.broadcast(&message{
+		Code:          msgPreprepare,
+		Sequence:      r.sequence,
+		Round:         r.round,
+		Digest:        block.Hash(),
+		Block:         enc,
+		Justification: justification,
+	})
+}
+
+func (r *roundManager) broadcast(m *message) {
+	if !r.isValidator() {
+		return
+	}
+	sig, signer, err := r.bft.sign(m.payload())
+	if err != nil {
+		log.Error("Failed to sign consensus message", "err", err)
+		return
+	}
+	m.Signature, m.source = sig, signer
+	if len(m.Block) > 0 && m.block == nil {
+		block := new(types.Block)
+		if err := rlp.DecodeBytes(m.Block, block); err != nil {
+			log.Error("Failed to decode own proposal", "err", err)
+			return
+		}
+		m.block = block
+	}
+	r.bft.messages.Add(m.hash(), struct{}{})
+	r.handleMessage(m)
+}
+
+func (r *roundManager) handleMessage(m *message) {
+	if r.head == nil || m.Sequence < r.sequence {
+		return
+	}
+	if m.Sequence > r.sequence || (m.Round > r.round && m.Code != msgRoundChange) {
+		r.addBacklog(m)
+		return
+	}
+	if _, ok := r.snap.Validators[m.source]; !ok {
+		log.Trace("Discarded message from non-validator", "msg", m)
+		return
+	}
+	r.bft.gossip(m)
+
+	switch m.Code {
+	case msgPreprepare:
+		r.handlePreprepare(m)
+	case msgPrepare:
+		r.handlePrepare(m)
+	case msgCommit:
+		r.handleCommit(m)
+	case msgRoundChange:
+		r.handleRoundChange(m)
+	}
+}
+
+func (r *roundManager) addBacklog(m *message) {
+	if len(r.backlog) >= maxBacklog {
+		r.backlog = r.backlog[1:]
+	}
+	r.backlog = append(r.backlog, m)
+}
+
+func (r *roundManager) processBacklog() {
+	backlog := r.backlog
+	r.backlog = nil
+	for _, m := range backlog {
+		switch {
+		case m.Sequence < r.sequence:
+		case m.Sequence > r.sequence || (m.Round > r.round && m.Code != msgRoundChange):
+			r.backlog = append(r.backlog, m)
+		case m.Round == r.round || m.Code == msgRoundChange:
+			r.handleMessage(m)
+		}
+	}
+}
+
+func (r *roundManager) handlePreprepare(m *message) {
+	if m.Round != r.round || r.state != stateAcceptRequest || m.block == nil {
+		return
+	}
+	if m.source != r.snap.proposer(m.Round) {
+		log.Debug("Discarded proposal from wrong proposer", "msg", m)
+		return
+	}
+	if m.Round > 0 && !r.verifyJustification(m) {
+		log.Debug("Discarded unjustified proposal", "msg", m)
+		return
+	}
+	block := m.block
+	if block.NumberU64() != r.sequence || block.ParentHash() != r.head.Hash() {
+		return
+	}
+	if err := r.bft.verifyProposal(r.chain, block.Header()); err != nil {
+		if err == consensus.ErrFutureBlock {
+			delay := time.Until(time.Unix(int64(block.Time()), 0))
+			if delay > allowedFutureProposalTime {
+				log.Warn("Discarded proposal too far in the future", "number", block.Number(), "hash", block.Hash(), "delay", common.PrettyDuration(delay))
+				return
+			}
+			time.AfterFunc(delay, func() { r.deliver(m) })
+			return
+		}
+		log.Warn("Discarded invalid proposal", "number", block.Number(), "hash", block.Hash(), "err", err)
+		return
+	}
+	if hash := types.DeriveSha(block.Transactions(), trie.NewStackTrie(nil)); hash != block.TxHash() {
+		log.Warn("Discarded proposal with invalid transaction root", "number", block.Number(), "hash", block.Hash())
+		return
+	}
+	if len(block.Uncles()) > 0 {
+		log.Warn("Discarded proposal with uncles", "number", block.Number(), "hash", block.Hash())
+		return
+	}
+	if err := r.executeProposal(block); err != nil {
+		log.Warn("Discarded proposal with invalid state", "number", block.Number(), "hash", block.Hash(), "err", err)
+		return
+	}
+	r.proposal = block
+	r.state = statePreprepared
+	r.updateStatus()
+
+	r.broadcast(&message{
+		Code:     msgPrepare,
+		Sequence: r.sequence,
+		Round:    r.round,
+		Digest:   block.Hash(),
+	})
+	r.checkPrepared()
+	r.checkCommitted()
+}
+
+
+
+
+func (r *roundManager) executeProposal(block *types.Block) error {
+	statedb, err := r.chain.StateAt(r.head.Root)
+	if err != nil {
+		return err
+	}
+	receipts, _, usedGas, err := r.chain.Processor().Process(block, statedb, *r.chain.GetVMConfig())
+	if err != nil {
+		return err
+	}
+	return r.chain.Validator().ValidateState(block, statedb, receipts, usedGas)
+}
+
+func (r *roundManager) handlePrepare(m *message) {
+	if m.Round != r.round {
+		return
+	}
+	r.prepares[m.source] = m
+	r.checkPrepared()
+}
+
+func (r *roundManager) checkPrepared() {
+	if r.state != statePreprepared {
+		return
+	}
+	digest := r.proposal.Hash()
+
+	var prepares [][]byte
+	for _, m := range r.prepares {
+		if m.Digest == digest {
+			prepares = append(prepares, m.encode())
+		}
+	}
+	if len(prepares) < r.snap.quorum() {
+		return
+	}
+	enc, _ := rlp.EncodeToBytes(r.proposal)
+	r.prepared = &message{
+		Digest:        digest,
+		Block:         enc,
+		PreparedRound: r.round,
+		Justification: prepares,
+		block:         r.proposal,
+	}
+	r.state = statePrepared
+	r.updateStatus()
+
+	seal, _, err := r.bft.sign(commitData(digest))
+	if err != nil {
+		log.Error("Failed to sign commit seal", "err", err)
+		return
+	}
+	r.broadcast(&message{
+		Code:     msgCommit,
+		Sequence: r.sequence,
+		Round:    r.round,
+		Digest:   digest,
+		Seal:     seal,
+	})
+}
+
+func (r *roundManager) handleCommit(m *message) {
+	if m.Round != r.round {
+		return
+	}
+	signer, err := ecrecoverHash(CommitHash(m.Digest), m.Seal)
+	if err != nil || signer != m.source {
+		log.Debug("Discarded commit with invalid seal", "msg", m)
+		return
+	}
+	r.commits[m.source] = m
+	r.checkCommitted()
+}
+
+func (r *roundManager) checkCommitted() {
+	if r.proposal == nil || r.state == stateCommitted {
+		return
+	}
+	digest := r.proposal.Hash()
+
+	var commits []*message
+	for _, m := range r.commits {
+		if m.Digest == digest {
+			commits = append(commits, m)
+		}
+	}
+	if len(commits) < r.snap.quorum() {
+		return
+	}
+	sort.Slice(commits, func(i, j int) bool {
+		return bytes.Compare(commits[i].source[:], commits[j].source[:]) < 0
+	})
+	seals := make([][]byte, len(commits))
+	for i, m := range commits {
+		seals[i] = m.Seal
+	}
+	header := r.proposal.Header()
+	extra, err := ExtractExtra(header)
+	if err != nil {
+		log.Error("Failed to decode proposal extra-data", "err", err)
+		return
+	}
+	extra.CommittedSeals = seals
+	if header.Extra, err = EncodeExtra(header.Extra, extra); err != nil {
+		log.Error("Failed to encode committed seals", "err", err)
+		return
+	}
+	block := r.proposal.WithSeal(header)
+
+	r.state = stateCommitted
+	r.timeout = nil
+	r.updateStatus()
+
+	log.Info("Committed block", "number", block.Number(), "hash", block.Hash(), "round", r.round, "seals", len(seals))
+
+	if req, ok := r.requests[digest]; ok {
+		select {
+		case req.results <- block:
+		default:
+			log.Warn("Sealing result is not read by miner", "sealhash", SealHash(block.Header()))
+		}
+		return
+	}
+	go func() {
+		if _, err := r.chain.InsertChain(types.Blocks{block}); err != nil {
+			log.Error("Failed to import committed block", "number", block.Number(), "hash", block.Hash(), "err", err)
+		}
+	}()
+}
+
+func (r *roundManager) sendRoundChange(round uint64) {
+	m := &message{
+		Code:     msgRoundChange,
+		Sequence: r.sequence,
+		Round:    round,
+	}
+	if r.prepared != nil {
+		m.Digest = r.prepared.Digest
+		m.Block = r.prepared.Block
+		m.PreparedRound = r.prepared.PreparedRound
+		m.Justification = r.prepared.Justification
+		m.block = r.prepared.block
+	}
+	r.broadcast(m)
+}
+
+func (r *roundManager) handleRoundChange(m *message) {
+	if m.Round < r.round || m.Round == 0 {
+		return
+	}
+	if !r.verifyPreparedCertificate(m) {
+		log.Debug("Discarded round change with invalid prepared certificate", "msg", m)
+		return
+	}
+	changes, ok := r.roundChanges[m.Round]
+	if !ok {
+		changes = make(map[common.Address]*message)
+		r.roundChanges[m.Round] = changes
+	}
+	changes[m.source] = m
+
+	if m.Round > r.round && len(changes) > r.snap.faulty() {
+		log.Debug("Catching up with round change", "sequence", r.sequence, "from", r.round, "to", m.Round)
+		r.moveToRound(m.Round)
+		return
+	}
+	if m.Round == r.round {
+		r.tryPropose()
+	}
+}
+
+func (r *roundManager) verifyPreparedCertificate(m *message) bool {
+	if m.Digest == (common.Hash{}) {
+		return m.block == nil && len(m.Justification) == 0
+	}
+	if m.block == nil || m.PreparedRound >= m.Round {
+		return false
+	}
+	prepares := make(map[common.Address]struct{})
+	for _, raw := range m.Justification {
+		prepare, err := decodeMessage(raw)
+		if err != nil {
+			return false
+		}
+		if prepare.Code != msgPrepare || prepare.Sequence != m.Sequence || prepare.Round != m.PreparedRound || prepare.Digest != m.Digest {
+			return false
+		}
+		if _, ok := r.snap.Validators[prepare.source]; !ok {
+			return false
+		}
+		prepares[prepare.source] = struct{}{}
+	}
+	return len(prepares) >= r.snap.quorum()
+}
+
+func (r *roundManager) verifyJustification(m *message) bool {
+	var (
+		changes = make(map[common.Address]struct{})
+		highest *message
+	)
+	for _, raw := range m.Justification {
+		change, err := decodeMessage(raw)
+		if err != nil {
+			return false
+		}
+		if change.Code != msgRoundChange || change.Sequence != m.Sequence || change.Round != m.Round {
+			return false
+		}
+		if _, ok := r.snap.Validators[change.source]; !ok {
+			return false
+		}
+		if !r.verifyPreparedCertificate(change) {
+			return false
+		}
+		changes[change.source] = struct{}{}
+		if change.block != nil && (highest == nil || change.PreparedRound > highest.PreparedRound) {
+			highest = change
+		}
+	}
+	if len(changes) < r.snap.quorum() {
+		return false
+	}
+	return highest == nil || highest.Digest == m.Digest
+}
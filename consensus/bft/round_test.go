@@ -0,0 +1,122 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package bft
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+
+
+func TestPreprepareExecutesProposal(t *testing.T) {
+	vals := newTesterValidators(4)
+	genesis := newTestGenesis(newTestConfig(1), vals)
+	sender, _ := crypto.GenerateKey()
+	genesis.Alloc = core.GenesisAlloc{crypto.PubkeyToAddress(sender.PublicKey): {Balance: big.NewInt(1000000000000000000)}}
+
+	chain, engine := newTestChain(t, genesis)
+	defer chain.Stop()
+
+	r := engine.rounds
+	r.chain = chain
+	r.newHeight(chain.CurrentBlock().Header())
+
+	var self, proposer *testerValidator
+	for _, val := range vals {
+		switch {
+		case val.addr == r.snap.proposer(0):
+			proposer = val
+		case self == nil:
+			self = val
+		}
+	}
+	engine.Authorize(self.addr, func(signer accounts.Account, mimeType string, data []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(data), self.key)
+	})
+
+	propose := func(tamper func(*types.Header)) *message {
+		parent := chain.CurrentBlock()
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     new(big.Int).Add(parent.Number(), common.Big1),
+			GasLimit:   parent.GasLimit(),
+		}
+		if err := engine.Prepare(chain, header); err != nil {
+			t.Fatalf("failed to prepare header: %v", err)
+		}
+		statedb, err := chain.StateAt(parent.Root())
+		if err != nil {
+			t.Fatalf("failed to retrieve parent state: %v", err)
+		}
+		signer := types.NewEIP155Signer(chain.Config().ChainID)
+		tx, _ := types.SignTx(types.NewTransaction(0, common.Address{0xaa}, big.NewInt(1), 21000, big.NewInt(1), nil), signer, sender)
+		receipt, err := core.ApplyTransaction(chain.Config(), chain, &proposer.addr, new(core.GasPool).AddGas(header.GasLimit), statedb, header, tx, &header.GasUsed, vm.Config{})
+		if err != nil {
+			t.Fatalf("failed to apply transaction: %v", err)
+		}
+		block, _ := engine.FinalizeAndAssemble(chain, header, statedb, []*types.Transaction{tx}, nil, []*types.Receipt{receipt})
+
+		header = block.Header()
+		if tamper != nil {
+			tamper(header)
+		}
+		block = block.WithSeal(sealTestHeader(header, proposer, nil))
+		return &message{Code: msgPreprepare, Sequence: r.sequence, Round: 0, Digest: block.Hash(), block: block, source: proposer.addr}
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(*types.Header)
+		accept bool
+	}{
+		{name: "valid", accept: true},
+		{name: "bad state root", tamper: func(h *types.Header) { h.Root = chain.CurrentBlock().Root() }},
+		{name: "bad receipt root", tamper: func(h *types.Header) { h.ReceiptHash = types.EmptyRootHash }},
+		{name: "bad gas used", tamper: func(h *types.Header) { h.GasUsed++ }},
+		{name: "bad bloom", tamper: func(h *types.Header) { h.Bloom[0] = 1 }},
+	}
+	for _, test := range tests {
+		r.startRound(0)
+
+		m := propose(test.tamper)
+		r.handlePreprepare(m)
+
+		if !test.accept {
+			if r.state != stateAcceptRequest || r.proposal != nil {
+				t.Errorf("%s: proposal accepted, state %v", test.name, r.state)
+			}
+			if _, ok := r.prepares[self.addr]; ok {
+				t.Errorf("%s: prepare sent for invalid proposal", test.name)
+			}
+			continue
+		}
+		if r.state != statePreprepared || r.proposal == nil || r.proposal.Hash() != m.block.Hash() {
+			t.Errorf("%s: proposal rejected, state %v", test.name, r.state)
+		}
+		if prepare, ok := r.prepares[self.addr]; !ok || prepare.Digest != m.block.Hash() {
+			t.Errorf("%s: no prepare sent for valid proposal", test.name)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package bft
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/simulations"
+	"github.com/ethereum/go-ethereum/p2p/simulations/adapters"
+)
+
+
+
+type simValidator struct {
+	engine  *BFT
+	chain   *core.BlockChain
+	network *simNetwork
+	imports chan *types.Block
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+
+
+type simNetwork struct {
+	lock       sync.RWMutex
+	validators []*simValidator
+}
+
+func (n *simNetwork) join(v *simValidator) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.validators = append(n.validators, v)
+}
+
+func (n *simNetwork) propagate(from *simValidator, block *types.Block) {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	for _, v := range n.validators {
+		if v == from {
+			continue
+		}
+		select {
+		case v.imports <- block:
+		default:
+		}
+	}
+}
+
+func newSimValidator(genesis *core.Genesis, network *simNetwork) adapters.LifecycleConstructor {
+	return func(ctx *adapters.ServiceContext, stack *node.Node) (node.Lifecycle, error) {
+		db := rawdb.NewMemoryDatabase()
+		genesis.MustCommit(db)
+
+		engine := New(genesis.Config.BFT, db)
+		key := ctx.Config.PrivateKey
+		engine.Authorize(crypto.PubkeyToAddress(key.PublicKey), func(signer accounts.Account, mimeType string, data []byte) ([]byte, error) {
+			return crypto.Sign(crypto.Keccak256(data), key)
+		})
+		chain, err := core.NewBlockChain(db, nil, genesis.Config, engine, vm.Config{}, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		v := &simValidator{engine: engine, chain: chain, network: network, imports: make(chan *types.Block, 64), quit: make(chan struct{})}
+		network.join(v)
+		stack.RegisterProtocols(engine.Protocols())
+		return v, nil
+	}
+}
+
+func (v *simValidator) Start() error {
+	v.engine.Start(v.chain)
+	v.wg.Add(1)
+	go v.loop()
+	return nil
+}
+
+func (v *simValidator) Stop() error {
+	close(v.quit)
+	v.wg.Wait()
+	v.engine.Close()
+	v.chain.Stop()
+	return nil
+}
+
+
+
+func (v *simValidator) loop() {
+	defer v.wg.Done()
+
+	heads := make(chan core.ChainHeadEvent, 10)
+	sub := v.chain.SubscribeChainHeadEvent(heads)
+	defer sub.Unsubscribe()
+
+	var (
+		results = make(chan *types.Block, 10)
+		stop    chan struct{}
+	)
+	defer func() {
+		if stop != nil {
+			close(stop)
+		}
+	}()
+	work := func(parent *types.Block) {
+		if stop != nil {
+			close(stop)
+		}
+		stop = make(chan struct{})
+
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     new(big.Int).Add(parent.Number(), common.Big1),
+			GasLimit:   parent.GasLimit(),
+		}
+		if err := v.engine.Prepare(v.chain, header); err != nil {
+			return
+		}
+		statedb, err := v.chain.StateAt(parent.Root())
+		if err != nil {
+			return
+		}
+		block, err := v.engine.FinalizeAndAssemble(v.chain, header, statedb, nil, nil, nil)
+		if err != nil {
+			return
+		}
+		v.engine.Seal(v.chain, block, results, stop)
+	}
+	work(v.chain.CurrentBlock())
+	for {
+		select {
+		case ev := <-heads:
+			v.network.propagate(v, ev.Block)
+			work(ev.Block)
+		case block := <-results:
+			v.chain.InsertChain(types.Blocks{block})
+		case block := <-v.imports:
+			if v.chain.HasBlock(block.Hash(), block.NumberU64()) {
+				continue
+			}
+			v.chain.InsertChain(types.Blocks{block})
+		case <-sub.Err():
+			return
+		case <-v.quit:
+			return
+		}
+	}
+}
+
+func TestSimulatedNetwork(t *testing.T) {
+	const validators = 4
+
+	var (
+		configs = make([]*adapters.NodeConfig, validators)
+		vals    = make([]*testerValidator, validators)
+	)
+	for i := range configs {
+		configs[i] = adapters.RandomNodeConfig()
+		configs[i].Name = fmt.Sprintf("validator-%d", i)
+		configs[i].Lifecycles = []string{"bft"}
+		vals[i] = &testerValidator{key: configs[i].PrivateKey, addr: crypto.PubkeyToAddress(configs[i].PrivateKey.PublicKey)}
+	}
+	genesis := newTestGenesis(newTestConfig(1), vals)
+	genesis.Timestamp = uint64(time.Now().Unix())
+
+	adapter := adapters.NewSimAdapter(adapters.LifecycleConstructors{"bft": newSimValidator(genesis, new(simNetwork))})
+	network := simulations.NewNetwork(adapter, &simulations.NetworkConfig{DefaultService: "bft"})
+	defer network.Shutdown()
+
+	ids := make([]enode.ID, validators)
+	for i, config := range configs {
+		n, err := network.NewNodeWithConfig(config)
+		if err != nil {
+			t.Fatalf("failed to create node %d: %v", i, err)
+		}
+		ids[i] = n.ID()
+	}
+	if err := network.StartAll(); err != nil {
+		t.Fatalf("failed to start nodes: %v", err)
+	}
+	if err := network.ConnectNodesFull(ids); err != nil {
+		t.Fatalf("failed to connect nodes: %v", err)
+	}
+	chains := make([]*core.BlockChain, validators)
+	for i, id := range ids {
+		node, _ := adapter.GetNode(id)
+		chains[i] = node.Service("bft").(*simValidator).chain
+	}
+
+
+	waitForHeight(t, chains, 4, 30*time.Second)
+	checkFinalized(t, chains, 4, (2*validators+2)/3)
+
+
+	if err := network.Stop(ids[validators-1]); err != nil {
+		t.Fatalf("failed to stop node: %v", err)
+	}
+	live := chains[:validators-1]
+	target := live[0].CurrentBlock().NumberU64() + 3
+	waitForHeight(t, live, target, 60*time.Second)
+	checkFinalized(t, live, target, (2*validators+2)/3)
+}
+
+func waitForHeight(t *testing.T, chains []*core.BlockChain, height uint64, timeout time.Duration) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for {
+		done := true
+		for _, chain := range chains {
+			if chain.CurrentBlock().NumberU64() < height {
+				done = false
+			}
+		}
+		if done {
+			return
+		}
+		if time.Now().After(deadline) {
+			for i, chain := range chains {
+				t.Logf("node %d: head %d", i, chain.CurrentBlock().NumberU64())
+			}
+			t.Fatalf("timeout waiting for height %d", height)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+
+
+func checkFinalized(t *testing.T, chains []*core.BlockChain, height uint64, quorum int) {
+	t.Helper()
+
+	for number := uint64(1); number <= height; number++ {
+		header := chains[0].GetHeaderByNumber(number)
+		for i, chain := range chains[1:] {
+			if other := chain.GetHeaderByNumber(number); other == nil || other.Hash() != header.Hash() {
+				t.Fatalf("node %d: block %d mismatch", i+1, number)
+			}
+		}
+		extra, err := ExtractExtra(header)
+		if err != nil {
+			t.Fatalf("block %d: %v", number, err)
+		}
+		if len(extra.CommittedSeals) < quorum {
+			t.Fatalf("block %d: committed seal count mismatch: have %d, want >= %d", number, len(extra.CommittedSeals), quorum)
+		}
+	}
+}
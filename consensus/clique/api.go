@@ -17,6 +17,7 @@
 package clique
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -175,3 +176,30 @@ func (api *API) Status() (*status, error) {
 		NumBlocks:     numBlocks,
 	}, nil
 }
+
+var errNoSigningHistory = errors.New("signing history not enabled")
+
+func (api *API) SigningHistory(signer *common.Address, limit *int) ([]SignedBlock, error) {
+	api.clique.lock.RLock()
+	history, local := api.clique.history, api.clique.signer
+	api.clique.lock.RUnlock()
+
+	if history == nil {
+		return nil, errNoSigningHistory
+	}
+	if signer == nil {
+		signer = &local
+	}
+	blocks, err := history.Blocks(signer)
+	if err != nil {
+		return nil, err
+	}
+	count := 128
+	if limit != nil {
+		count = *limit
+	}
+	if count >= 0 && len(blocks) > count {
+		blocks = blocks[len(blocks)-count:]
+	}
+	return blocks, nil
+}
@@ -136,6 +136,8 @@ var (
 	
 	
 	errRecentlySigned = errors.New("recently signed")
+
+	errMissingSigner = errors.New("no signer authorized")
 )
 
 
@@ -177,9 +179,11 @@ type Clique struct {
 
 	proposals map[common.Address]bool 
 
-	signer common.Address 
-	signFn SignerFn       
-	lock   sync.RWMutex   
+	signer  common.Address 
+	signFn  SignerFn       
+	history *SigningHistory
+	offset  time.Duration
+	lock    sync.RWMutex   
 
 	
 	fakeDiff bool 
@@ -249,11 +253,11 @@ func (c *Clique) verifyHeader(chain consensus.ChainHeaderReader, header *types.H
 	number := header.Number.Uint64()
 
 	
-	if header.Time > uint64(time.Now().Unix()) {
+	if header.Time > uint64(c.now().Unix()) {
 		return consensus.ErrFutureBlock
 	}
 	
-	checkpoint := (number % c.config.Epoch) == 0
+	checkpoint := (number % c.config.EpochAt(number)) == 0
 	if checkpoint && header.Coinbase != (common.Address{}) {
 		return errInvalidCheckpointBeneficiary
 	}
@@ -321,7 +325,7 @@ func (c *Clique) verifyCascadingFields(chain consensus.ChainHeaderReader, header
 	if parent == nil || parent.Number.Uint64() != number-1 || parent.Hash() != header.ParentHash {
 		return consensus.ErrUnknownAncestor
 	}
-	if parent.Time+c.config.Period > header.Time {
+	if parent.Time+c.config.PeriodAt(number) > header.Time {
 		return errInvalidTimestamp
 	}
 	
@@ -330,7 +334,7 @@ func (c *Clique) verifyCascadingFields(chain consensus.ChainHeaderReader, header
 		return err
 	}
 	
-	if number%c.config.Epoch == 0 {
+	if number%c.config.EpochAt(number) == 0 {
 		signers := make([]byte, len(snap.Signers)*common.AddressLength)
 		for i, signer := range snap.signers() {
 			copy(signers[i*common.AddressLength:], signer[:])
@@ -369,7 +373,7 @@ func (c *Clique) snapshot(chain consensus.ChainHeaderReader, number uint64, hash
 		
 		
 		
-		if number == 0 || (number%c.config.Epoch == 0 && (len(headers) > params.FullImmutabilityThreshold || chain.GetHeaderByNumber(number-1) == nil)) {
+		if number == 0 || (number%c.config.EpochAt(number) == 0 && (len(headers) > params.FullImmutabilityThreshold || chain.GetHeaderByNumber(number-1) == nil)) {
 			checkpoint := chain.GetHeaderByNumber(number)
 			if checkpoint != nil {
 				hash := checkpoint.Hash()
@@ -379,6 +383,7 @@ func (c *Clique) snapshot(chain consensus.ChainHeaderReader, number uint64, hash
 					copy(signers[i][:], checkpoint.Extra[extraVanity+i*common.AddressLength:])
 				}
 				snap = newSnapshot(c.config, c.signatures, number, hash, signers)
+				snap.transition(number)
 				if err := snap.store(c.db); err != nil {
 					return nil, err
 				}
@@ -498,7 +503,7 @@ func (c *Clique) Prepare(chain consensus.ChainHeaderReader, header *types.Header
 	if err != nil {
 		return err
 	}
-	if number%c.config.Epoch != 0 {
+	if number%c.config.EpochAt(number) != 0 {
 		c.lock.RLock()
 
 		
@@ -528,7 +533,7 @@ func (c *Clique) Prepare(chain consensus.ChainHeaderReader, header *types.Header
 	}
 	header.Extra = header.Extra[:extraVanity]
 
-	if number%c.config.Epoch == 0 {
+	if number%c.config.EpochAt(number) == 0 {
 		for _, signer := range snap.signers() {
 			header.Extra = append(header.Extra, signer[:]...)
 		}
@@ -543,9 +548,9 @@ func (c *Clique) Prepare(chain consensus.ChainHeaderReader, header *types.Header
 	if parent == nil {
 		return consensus.ErrUnknownAncestor
 	}
-	header.Time = parent.Time + c.config.Period
-	if header.Time < uint64(time.Now().Unix()) {
-		header.Time = uint64(time.Now().Unix())
+	header.Time = parent.Time + c.config.PeriodAt(number)
+	if now := uint64(c.now().Unix()); header.Time < now {
+		header.Time = now
 	}
 	return nil
 }
@@ -579,6 +584,70 @@ func (c *Clique) Authorize(signer common.Address, signFn SignerFn) {
 	c.signFn = signFn
 }
 
+func (c *Clique) SetSigningHistory(history *SigningHistory) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.history = history
+}
+
+func (c *Clique) RewindSigningHistory(number uint64) error {
+	c.lock.RLock()
+	signer, history := c.signer, c.history
+	c.lock.RUnlock()
+
+	if history == nil {
+		return nil
+	}
+	return history.Rewind(signer, number)
+}
+
+func (c *Clique) SetTimeOffset(offset time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.offset = offset
+}
+
+func (c *Clique) now() time.Time {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return time.Now().Add(c.offset)
+}
+
+func (c *Clique) SignHeader(chain consensus.ChainHeaderReader, header *types.Header) error {
+	number := header.Number.Uint64()
+	if number == 0 {
+		return errUnknownBlock
+	}
+	c.lock.RLock()
+	signer, signFn, history := c.signer, c.signFn, c.history
+	c.lock.RUnlock()
+
+	if signFn == nil {
+		return errMissingSigner
+	}
+	snap, err := c.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return err
+	}
+	if _, authorized := snap.Signers[signer]; !authorized {
+		return errUnauthorizedSigner
+	}
+	if history != nil {
+		if err := history.Record(signer, number, SealHash(header)); err != nil {
+			return err
+		}
+	}
+	sighash, err := signFn(accounts.Account{Address: signer}, accounts.MimetypeClique, CliqueRLP(header))
+	if err != nil {
+		return err
+	}
+	copy(header.Extra[len(header.Extra)-extraSeal:], sighash)
+	return nil
+}
+
 
 
 func (c *Clique) Seal(chain consensus.ChainHeaderReader, block *types.Block, results chan<- *types.Block, stop <-chan struct{}) error {
@@ -590,13 +659,13 @@ func (c *Clique) Seal(chain consensus.ChainHeaderReader, block *types.Block, res
 		return errUnknownBlock
 	}
 	
-	if c.config.Period == 0 && len(block.Transactions()) == 0 {
+	if c.config.PeriodAt(number) == 0 && len(block.Transactions()) == 0 {
 		log.Info("Sealing paused, waiting for transactions")
 		return nil
 	}
 	
 	c.lock.RLock()
-	signer, signFn := c.signer, c.signFn
+	signer, signFn, history := c.signer, c.signFn, c.history
 	c.lock.RUnlock()
 
 	
@@ -618,7 +687,7 @@ func (c *Clique) Seal(chain consensus.ChainHeaderReader, block *types.Block, res
 		}
 	}
 	
-	delay := time.Unix(int64(header.Time), 0).Sub(time.Now()) 
+	delay := time.Unix(int64(header.Time), 0).Sub(c.now()) 
 	if header.Difficulty.Cmp(diffNoTurn) == 0 {
 		
 		wiggle := time.Duration(len(snap.Signers)/2+1) * wiggleTime
@@ -627,11 +696,15 @@ func (c *Clique) Seal(chain consensus.ChainHeaderReader, block *types.Block, res
 		log.Trace("Out-of-turn signing requested", "wiggle", common.PrettyDuration(wiggle))
 	}
 	
-	sighash, err := signFn(accounts.Account{Address: signer}, accounts.MimetypeClique, CliqueRLP(header))
-	if err != nil {
+	if history == nil {
+		sighash, err := signFn(accounts.Account{Address: signer}, accounts.MimetypeClique, CliqueRLP(header))
+		if err != nil {
+			return err
+		}
+		copy(header.Extra[len(header.Extra)-extraSeal:], sighash)
+	} else if err := history.Check(signer, number, SealHash(header)); err != nil {
 		return err
 	}
-	copy(header.Extra[len(header.Extra)-extraSeal:], sighash)
 	
 	log.Trace("Waiting for slot to sign and propagate", "delay", common.PrettyDuration(delay))
 	go func() {
@@ -640,7 +713,18 @@ func (c *Clique) Seal(chain consensus.ChainHeaderReader, block *types.Block, res
 			return
 		case <-time.After(delay):
 		}
-
+		if history != nil {
+			if err := history.Record(signer, number, SealHash(header)); err != nil {
+				log.Warn("Refusing to sign conflicting block", "number", number, "err", err)
+				return
+			}
+			sighash, err := signFn(accounts.Account{Address: signer}, accounts.MimetypeClique, CliqueRLP(header))
+			if err != nil {
+				log.Warn("Failed to sign block", "number", number, "err", err)
+				return
+			}
+			copy(header.Extra[len(header.Extra)-extraSeal:], sighash)
+		}
 		select {
 		case results <- block.WithSeal(header):
 		default:
@@ -677,6 +761,12 @@ func (c *Clique) SealHash(header *types.Header) common.Hash {
 
 
 func (c *Clique) Close() error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if c.history != nil {
+		return c.history.Close()
+	}
 	return nil
 }
 
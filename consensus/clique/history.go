@@ -0,0 +1,254 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package clique
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const historyVersion = 1
+
+var (
+	historyPrefix = []byte("clique-signed-")
+
+	errDoubleSign = errors.New("conflicting block already signed at this height")
+
+	errHistoryVersion = errors.New("unsupported signing history version")
+
+	errHistoryGenesis = errors.New("signing history belongs to a different network")
+)
+
+type SignedBlock struct {
+	Signer   common.Address `json:"signer"`
+	Number   uint64         `json:"number"`
+	SealHash common.Hash    `json:"sealHash"`
+	Time     uint64         `json:"time"`
+}
+
+type signedEntry struct {
+	SealHash common.Hash
+	Time     uint64
+}
+
+type historyInterchange struct {
+	Version uint64        `json:"version"`
+	Genesis common.Hash   `json:"genesis"`
+	Blocks  []SignedBlock `json:"blocks"`
+}
+
+type SigningHistory struct {
+	db   ethdb.Database
+	lock sync.Mutex
+}
+
+func NewSigningHistory(db ethdb.Database) *SigningHistory {
+	return &SigningHistory{db: db}
+}
+
+func historyKey(signer common.Address, number uint64) []byte {
+	key := make([]byte, len(historyPrefix)+common.AddressLength+8)
+	copy(key, historyPrefix)
+	copy(key[len(historyPrefix):], signer[:])
+	binary.BigEndian.PutUint64(key[len(historyPrefix)+common.AddressLength:], number)
+	return key
+}
+
+func (h *SigningHistory) read(signer common.Address, number uint64) (*signedEntry, error) {
+	key := historyKey(signer, number)
+	if ok, err := h.db.Has(key); err != nil || !ok {
+		return nil, err
+	}
+	blob, err := h.db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	entry := new(signedEntry)
+	if err := rlp.DecodeBytes(blob, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (h *SigningHistory) write(block SignedBlock) error {
+	blob, err := rlp.EncodeToBytes(&signedEntry{SealHash: block.SealHash, Time: block.Time})
+	if err != nil {
+		return err
+	}
+	return h.db.Put(historyKey(block.Signer, block.Number), blob)
+}
+
+func (h *SigningHistory) Check(signer common.Address, number uint64, sealhash common.Hash) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.check(signer, number, sealhash)
+}
+
+func (h *SigningHistory) check(signer common.Address, number uint64, sealhash common.Hash) error {
+	entry, err := h.read(signer, number)
+	if err != nil {
+		return err
+	}
+	if entry != nil && entry.SealHash != sealhash {
+		return fmt.Errorf("%w: number %d, signed %x, requested %x", errDoubleSign, number, entry.SealHash, sealhash)
+	}
+	return nil
+}
+
+func (h *SigningHistory) Record(signer common.Address, number uint64, sealhash common.Hash) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	entry, err := h.read(signer, number)
+	if err != nil {
+		return err
+	}
+	if entry != nil {
+		if entry.SealHash != sealhash {
+			return fmt.Errorf("%w: number %d, signed %x, requested %x", errDoubleSign, number, entry.SealHash, sealhash)
+		}
+		return nil
+	}
+	return h.write(SignedBlock{Signer: signer, Number: number, SealHash: sealhash, Time: uint64(time.Now().Unix())})
+}
+
+func (h *SigningHistory) Rewind(signer common.Address, number uint64) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	start := make([]byte, 8)
+	binary.BigEndian.PutUint64(start, number+1)
+
+	it := h.db.NewIterator(append(common.CopyBytes(historyPrefix), signer[:]...), start)
+	defer it.Release()
+
+	batch := h.db.NewBatch()
+	for it.Next() {
+		if err := batch.Delete(common.CopyBytes(it.Key())); err != nil {
+			return err
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+func (h *SigningHistory) Blocks(signer *common.Address) ([]SignedBlock, error) {
+	prefix := historyPrefix
+	if signer != nil {
+		prefix = append(common.CopyBytes(historyPrefix), signer[:]...)
+	}
+	it := h.db.NewIterator(prefix, nil)
+	defer it.Release()
+
+	var blocks []SignedBlock
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(historyPrefix)+common.AddressLength+8 {
+			continue
+		}
+		entry := new(signedEntry)
+		if err := rlp.DecodeBytes(it.Value(), entry); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, SignedBlock{
+			Signer:   common.BytesToAddress(key[len(historyPrefix) : len(historyPrefix)+common.AddressLength]),
+			Number:   binary.BigEndian.Uint64(key[len(historyPrefix)+common.AddressLength:]),
+			SealHash: entry.SealHash,
+			Time:     entry.Time,
+		})
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return blocks[i].Number < blocks[j].Number
+	})
+	return blocks, nil
+}
+
+func (h *SigningHistory) Export(w io.Writer, genesis common.Hash) error {
+	blocks, err := h.Blocks(nil)
+	if err != nil {
+		return err
+	}
+	if blocks == nil {
+		blocks = []SignedBlock{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(&historyInterchange{Version: historyVersion, Genesis: genesis, Blocks: blocks})
+}
+
+func (h *SigningHistory) Import(r io.Reader, genesis common.Hash) (int, error) {
+	var dump historyInterchange
+	if err := json.NewDecoder(r).Decode(&dump); err != nil {
+		return 0, err
+	}
+	if dump.Version != historyVersion {
+		return 0, fmt.Errorf("%w: %d", errHistoryVersion, dump.Version)
+	}
+	if dump.Genesis != genesis {
+		return 0, fmt.Errorf("%w: have %x, want %x", errHistoryGenesis, dump.Genesis, genesis)
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	seen := make(map[string]common.Hash)
+	for _, block := range dump.Blocks {
+		key := string(historyKey(block.Signer, block.Number))
+		if hash, ok := seen[key]; ok && hash != block.SealHash {
+			return 0, fmt.Errorf("signer %x: %w: number %d, signed %x, requested %x", block.Signer, errDoubleSign, block.Number, hash, block.SealHash)
+		}
+		seen[key] = block.SealHash
+
+		if err := h.check(block.Signer, block.Number, block.SealHash); err != nil {
+			return 0, fmt.Errorf("signer %x: %w", block.Signer, err)
+		}
+	}
+	imported := 0
+	for _, block := range dump.Blocks {
+		entry, err := h.read(block.Signer, block.Number)
+		if err != nil {
+			return imported, err
+		}
+		if entry != nil {
+			continue
+		}
+		if err := h.write(block); err != nil {
+			return imported, err
+		}
+		imported++
+	}
+	return imported, nil
+}
+
+func (h *SigningHistory) Close() error {
+	return h.db.Close()
+}
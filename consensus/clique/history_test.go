@@ -0,0 +1,202 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package clique
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestSigningHistoryRecord(t *testing.T) {
+	var (
+		history = NewSigningHistory(rawdb.NewMemoryDatabase())
+		signer  = common.Address{0x01}
+		other   = common.Address{0x02}
+	)
+	for number := uint64(1); number <= 5; number++ {
+		if err := history.Record(signer, number, common.Hash{byte(number)}); err != nil {
+			t.Fatalf("failed to record block %d: %v", number, err)
+		}
+	}
+	if err := history.Record(signer, 3, common.Hash{0x03}); err != nil {
+		t.Fatalf("re-signing the same block refused: %v", err)
+	}
+	if err := history.Check(signer, 3, common.Hash{0xff}); !errors.Is(err, errDoubleSign) {
+		t.Fatalf("conflicting check: have %v, want %v", err, errDoubleSign)
+	}
+	if err := history.Record(signer, 3, common.Hash{0xff}); !errors.Is(err, errDoubleSign) {
+		t.Fatalf("conflicting record: have %v, want %v", err, errDoubleSign)
+	}
+	if err := history.Record(other, 3, common.Hash{0xff}); err != nil {
+		t.Fatalf("other signer refused: %v", err)
+	}
+	if err := history.Rewind(signer, 3); err != nil {
+		t.Fatalf("failed to rewind: %v", err)
+	}
+	if err := history.Check(signer, 3, common.Hash{0xff}); !errors.Is(err, errDoubleSign) {
+		t.Fatalf("rewind dropped the rewind target: %v", err)
+	}
+	if err := history.Record(signer, 4, common.Hash{0xff}); err != nil {
+		t.Fatalf("rewound block still protected: %v", err)
+	}
+	blocks, err := history.Blocks(&signer)
+	if err != nil {
+		t.Fatalf("failed to list blocks: %v", err)
+	}
+	if len(blocks) != 4 || blocks[3].Number != 4 || blocks[3].SealHash != (common.Hash{0xff}) {
+		t.Fatalf("wrong signing history after rewind: %+v", blocks)
+	}
+	if blocks, _ := history.Blocks(&other); len(blocks) != 1 {
+		t.Fatalf("rewind touched other signer: %+v", blocks)
+	}
+}
+
+func TestSigningHistoryRefusesDoubleSign(t *testing.T) {
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		key, _ = crypto.GenerateKey()
+		addr   = crypto.PubkeyToAddress(key.PublicKey)
+		config = *params.AllCliqueProtocolChanges.Clique
+	)
+	config.Period = 1
+	engine := New(&config, db)
+	engine.SetSigningHistory(NewSigningHistory(rawdb.NewMemoryDatabase()))
+
+	signed := 0
+	engine.Authorize(addr, func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+		signed++
+		return crypto.Sign(crypto.Keccak256(data), key)
+	})
+	genspec := &core.Genesis{ExtraData: make([]byte, extraVanity+common.AddressLength+extraSeal)}
+	copy(genspec.ExtraData[extraVanity:], addr[:])
+	genesis := genspec.MustCommit(db)
+
+	chain, _ := core.NewBlockChain(db, nil, params.AllCliqueProtocolChanges, engine, vm.Config{}, nil, nil)
+	defer chain.Stop()
+
+	makeHeader := func(coinbase common.Address) *types.Header {
+		return &types.Header{
+			ParentHash: genesis.Hash(),
+			Number:     big.NewInt(1),
+			Coinbase:   coinbase,
+			Difficulty: new(big.Int).Set(diffInTurn),
+			GasLimit:   genesis.GasLimit(),
+			Time:       uint64(time.Now().Unix()),
+			Extra:      make([]byte, extraVanity+extraSeal),
+		}
+	}
+	original, conflict := makeHeader(common.Address{0xaa}), makeHeader(common.Address{0xbb})
+
+	results := make(chan *types.Block, 1)
+	if err := engine.Seal(chain, types.NewBlockWithHeader(original), results, nil); err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	select {
+	case block := <-results:
+		if author, err := engine.Author(block.Header()); err != nil || author != addr {
+			t.Fatalf("wrong block author: have %x (%v), want %x", author, err, addr)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("sealed block not delivered")
+	}
+	if err := engine.SignHeader(chain, conflict); !errors.Is(err, errDoubleSign) {
+		t.Fatalf("conflicting header signed: have %v, want %v", err, errDoubleSign)
+	}
+	if err := engine.Seal(chain, types.NewBlockWithHeader(conflict), results, nil); !errors.Is(err, errDoubleSign) {
+		t.Fatalf("conflicting block sealed: have %v, want %v", err, errDoubleSign)
+	}
+	if signed != 1 {
+		t.Fatalf("signer invoked %d times, want 1", signed)
+	}
+	if !bytes.Equal(conflict.Extra, make([]byte, extraVanity+extraSeal)) {
+		t.Fatalf("conflicting header carries a signature")
+	}
+	if err := engine.SignHeader(chain, original); err != nil {
+		t.Fatalf("re-signing the same header refused: %v", err)
+	}
+	if err := engine.RewindSigningHistory(0); err != nil {
+		t.Fatalf("failed to rewind signing history: %v", err)
+	}
+	if err := engine.SignHeader(chain, conflict); err != nil {
+		t.Fatalf("header refused after rewind: %v", err)
+	}
+}
+
+func TestSigningHistoryInterchange(t *testing.T) {
+	var (
+		source  = NewSigningHistory(rawdb.NewMemoryDatabase())
+		genesis = common.Hash{0x01}
+		signers = []common.Address{{0x01}, {0x02}}
+	)
+	for _, signer := range signers {
+		for number := uint64(1); number <= 3; number++ {
+			source.Record(signer, number, common.Hash{signer[0], byte(number)})
+		}
+	}
+	var dump bytes.Buffer
+	if err := source.Export(&dump, genesis); err != nil {
+		t.Fatalf("failed to export signing history: %v", err)
+	}
+	if _, err := NewSigningHistory(rawdb.NewMemoryDatabase()).Import(bytes.NewReader(dump.Bytes()), common.Hash{0x02}); !errors.Is(err, errHistoryGenesis) {
+		t.Fatalf("foreign history imported: have %v, want %v", err, errHistoryGenesis)
+	}
+	if _, err := NewSigningHistory(rawdb.NewMemoryDatabase()).Import(bytes.NewReader(bytes.Replace(dump.Bytes(), []byte(`"version": 1`), []byte(`"version": 2`), 1)), genesis); !errors.Is(err, errHistoryVersion) {
+		t.Fatalf("unknown version imported: have %v, want %v", err, errHistoryVersion)
+	}
+
+	target := NewSigningHistory(rawdb.NewMemoryDatabase())
+	if n, err := target.Import(bytes.NewReader(dump.Bytes()), genesis); err != nil || n != 6 {
+		t.Fatalf("failed to import signing history: imported %d, err %v", n, err)
+	}
+	if n, err := target.Import(bytes.NewReader(dump.Bytes()), genesis); err != nil || n != 0 {
+		t.Fatalf("reimport not idempotent: imported %d, err %v", n, err)
+	}
+	have, _ := target.Blocks(nil)
+	want, _ := source.Blocks(nil)
+	if len(have) != len(want) {
+		t.Fatalf("wrong number of imported blocks: have %d, want %d", len(have), len(want))
+	}
+	for i := range want {
+		if have[i] != want[i] {
+			t.Fatalf("imported block %d mismatch: have %+v, want %+v", i, have[i], want[i])
+		}
+	}
+	if err := target.Check(signers[0], 2, common.Hash{0xff}); !errors.Is(err, errDoubleSign) {
+		t.Fatalf("imported history does not protect: %v", err)
+	}
+
+	conflicting := NewSigningHistory(rawdb.NewMemoryDatabase())
+	conflicting.Record(signers[1], 3, common.Hash{0xff})
+	if _, err := conflicting.Import(bytes.NewReader(dump.Bytes()), genesis); !errors.Is(err, errDoubleSign) {
+		t.Fatalf("conflicting history imported: have %v, want %v", err, errDoubleSign)
+	}
+	if blocks, _ := conflicting.Blocks(nil); len(blocks) != 1 {
+		t.Fatalf("partial import after conflict: %+v", blocks)
+	}
+}
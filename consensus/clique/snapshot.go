@@ -57,6 +57,8 @@ type Snapshot struct {
 	Recents map[uint64]common.Address   `json:"recents"` 
 	Votes   []*Vote                     `json:"votes"`   
 	Tally   map[common.Address]Tally    `json:"tally"`   
+	Period  uint64                      `json:"period"`  
+	Epoch   uint64                      `json:"epoch"`   
 }
 
 
@@ -78,6 +80,8 @@ func newSnapshot(config *params.CliqueConfig, sigcache *lru.ARCCache, number uin
 		Signers:  make(map[common.Address]struct{}),
 		Recents:  make(map[uint64]common.Address),
 		Tally:    make(map[common.Address]Tally),
+		Period:   config.PeriodAt(number + 1),
+		Epoch:    config.EpochAt(number + 1),
 	}
 	for _, signer := range signers {
 		snap.Signers[signer] = struct{}{}
@@ -97,6 +101,8 @@ func loadSnapshot(config *params.CliqueConfig, sigcache *lru.ARCCache, db ethdb.
 	}
 	snap.config = config
 	snap.sigcache = sigcache
+	snap.Period = config.PeriodAt(snap.Number + 1)
+	snap.Epoch = config.EpochAt(snap.Number + 1)
 
 	return snap, nil
 }
@@ -121,6 +127,8 @@ func (s *Snapshot) copy() *Snapshot {
 		Recents:  make(map[uint64]common.Address),
 		Votes:    make([]*Vote, len(s.Votes)),
 		Tally:    make(map[common.Address]Tally),
+		Period:   s.Period,
+		Epoch:    s.Epoch,
 	}
 	for signer := range s.Signers {
 		cpy.Signers[signer] = struct{}{}
@@ -206,7 +214,7 @@ func (s *Snapshot) apply(headers []*types.Header) (*Snapshot, error) {
 	for i, header := range headers {
 		
 		number := header.Number.Uint64()
-		if number%s.config.Epoch == 0 {
+		if number%s.config.EpochAt(number) == 0 {
 			snap.Votes = nil
 			snap.Tally = make(map[common.Address]Tally)
 		}
@@ -291,6 +299,8 @@ func (s *Snapshot) apply(headers []*types.Header) (*Snapshot, error) {
 			}
 			delete(snap.Tally, header.Coinbase)
 		}
+		snap.transition(number)
+
 		
 		if time.Since(logged) > 8*time.Second {
 			log.Info("Reconstructing voting history", "processed", i, "total", len(headers), "elapsed", common.PrettyDuration(time.Since(start)))
@@ -302,11 +312,35 @@ func (s *Snapshot) apply(headers []*types.Header) (*Snapshot, error) {
 	}
 	snap.Number += uint64(len(headers))
 	snap.Hash = headers[len(headers)-1].Hash()
+	snap.Period = s.config.PeriodAt(snap.Number + 1)
+	snap.Epoch = s.config.EpochAt(snap.Number + 1)
 
 	return snap, nil
 }
 
 
+func (s *Snapshot) transition(number uint64) {
+	signers, ok := s.config.SignersAt(number)
+	if !ok {
+		return
+	}
+	s.Signers = make(map[common.Address]struct{})
+	for _, signer := range signers {
+		s.Signers[signer] = struct{}{}
+	}
+	s.Votes = nil
+	s.Tally = make(map[common.Address]Tally)
+
+	limit := uint64(len(s.Signers)/2 + 1)
+	for seen, recent := range s.Recents {
+		if _, ok := s.Signers[recent]; !ok || seen+limit <= number {
+			delete(s.Recents, seen)
+		}
+	}
+}
+
+
+
 func (s *Snapshot) signers() []common.Address {
 	sigs := make([]common.Address, 0, len(s.Signers))
 	for sig := range s.Signers {
@@ -0,0 +1,290 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package clique
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"sort"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+type transitionBlock struct {
+	signer     string
+	gap        uint64
+	checkpoint []string
+}
+
+type transitionTester struct {
+	keys map[string]*ecdsa.PrivateKey
+}
+
+func newTransitionTester() *transitionTester {
+	return &transitionTester{keys: make(map[string]*ecdsa.PrivateKey)}
+}
+
+func (tt *transitionTester) address(name string) common.Address {
+	if tt.keys[name] == nil {
+		tt.keys[name], _ = crypto.GenerateKey()
+	}
+	return crypto.PubkeyToAddress(tt.keys[name].PublicKey)
+}
+
+func (tt *transitionTester) addresses(names ...string) []common.Address {
+	addrs := make([]common.Address, len(names))
+	for i, name := range names {
+		addrs[i] = tt.address(name)
+	}
+	sort.Sort(signersAscending(addrs))
+	return addrs
+}
+
+func (tt *transitionTester) run(config *params.CliqueConfig, signers []string, blocks []transitionBlock) (*core.BlockChain, *Clique, error) {
+	auths := tt.addresses(signers...)
+	genesis := &core.Genesis{
+		ExtraData: make([]byte, extraVanity+common.AddressLength*len(auths)+extraSeal),
+	}
+	for i, auth := range auths {
+		copy(genesis.ExtraData[extraVanity+i*common.AddressLength:], auth[:])
+	}
+	db := rawdb.NewMemoryDatabase()
+	genesis.Commit(db)
+
+	chainConfig := *params.TestChainConfig
+	chainConfig.Clique = config
+	engine := New(config, db)
+	engine.fakeDiff = true
+
+	chain, _ := core.GenerateChain(&chainConfig, genesis.ToBlock(db), engine, db, len(blocks), nil)
+	for i, block := range chain {
+		header := block.Header()
+		parent := genesis.ToBlock(nil).Header()
+		if i > 0 {
+			parent = chain[i-1].Header()
+		}
+		header.ParentHash = parent.Hash()
+		header.Time = parent.Time + 10
+		if blocks[i].gap != 0 {
+			header.Time = parent.Time + blocks[i].gap
+		}
+		header.Extra = make([]byte, extraVanity+extraSeal)
+		if names := blocks[i].checkpoint; names != nil {
+			header.Extra = make([]byte, extraVanity+len(names)*common.AddressLength+extraSeal)
+			for j, auth := range tt.addresses(names...) {
+				copy(header.Extra[extraVanity+j*common.AddressLength:], auth[:])
+			}
+		}
+		header.Difficulty = diffInTurn
+
+		tt.address(blocks[i].signer)
+		sig, _ := crypto.Sign(SealHash(header).Bytes(), tt.keys[blocks[i].signer])
+		copy(header.Extra[len(header.Extra)-extraSeal:], sig)
+		chain[i] = block.WithSeal(header)
+	}
+	bc, err := core.NewBlockChain(db, nil, &chainConfig, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = bc.InsertChain(chain)
+	return bc, engine, err
+}
+
+func (tt *transitionTester) snapshot(t *testing.T, bc *core.BlockChain, engine *Clique) *Snapshot {
+	head := bc.CurrentBlock()
+	snap, err := engine.snapshot(bc, head.NumberU64(), head.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	return snap
+}
+
+func transitionUint64(n uint64) *uint64 {
+	return &n
+}
+
+func TestCliqueTransitionSigners(t *testing.T) {
+	tests := []struct {
+		epoch   uint64
+		block   int64
+		replace []string
+		blocks  []transitionBlock
+		signers []string
+		failure error
+	}{
+
+		{
+			epoch:   30000,
+			block:   2,
+			replace: []string{"C"},
+			blocks:  []transitionBlock{{signer: "A"}, {signer: "B"}, {signer: "C"}, {signer: "C"}, {signer: "C"}},
+			signers: []string{"C"},
+		},
+
+
+		{
+			epoch:   30000,
+			block:   2,
+			replace: []string{"C"},
+			blocks:  []transitionBlock{{signer: "A"}, {signer: "C"}},
+			failure: errUnauthorizedSigner,
+		},
+		{
+			epoch:   30000,
+			block:   2,
+			replace: []string{"C"},
+			blocks:  []transitionBlock{{signer: "A"}, {signer: "B"}, {signer: "A"}},
+			failure: errUnauthorizedSigner,
+		},
+
+
+		{
+			epoch:   4,
+			block:   4,
+			replace: []string{"C", "D"},
+			blocks: []transitionBlock{
+				{signer: "A"}, {signer: "B"}, {signer: "A"}, {signer: "B", checkpoint: []string{"A", "B"}},
+				{signer: "C"}, {signer: "D"}, {signer: "C"}, {signer: "D", checkpoint: []string{"C", "D"}},
+			},
+			signers: []string{"C", "D"},
+		},
+		{
+			epoch:   4,
+			block:   4,
+			replace: []string{"C", "D"},
+			blocks: []transitionBlock{
+				{signer: "A"}, {signer: "B"}, {signer: "A"}, {signer: "B", checkpoint: []string{"C", "D"}},
+			},
+			failure: errMismatchingCheckpointSigners,
+		},
+		{
+			epoch:   4,
+			block:   4,
+			replace: []string{"C", "D"},
+			blocks: []transitionBlock{
+				{signer: "A"}, {signer: "B"}, {signer: "A"}, {signer: "B", checkpoint: []string{"A", "B"}},
+				{signer: "C"}, {signer: "D"}, {signer: "C"}, {signer: "D", checkpoint: []string{"A", "B"}},
+			},
+			failure: errMismatchingCheckpointSigners,
+		},
+	}
+	for i, test := range tests {
+		tt := newTransitionTester()
+		config := &params.CliqueConfig{
+			Period: 1,
+			Epoch:  test.epoch,
+			Transitions: []*params.CliqueTransition{
+				{Block: big.NewInt(test.block), Signers: tt.addresses(test.replace...)},
+			},
+		}
+		bc, engine, err := tt.run(config, []string{"A", "B"}, test.blocks)
+		if !errors.Is(err, test.failure) {
+			t.Errorf("test %d: failure mismatch: have %v, want %v", i, err, test.failure)
+		}
+		if err != nil || bc == nil {
+			if bc != nil {
+				bc.Stop()
+			}
+			continue
+		}
+		snap := tt.snapshot(t, bc, engine)
+		if have, want := snap.signers(), tt.addresses(test.signers...); len(have) != len(want) {
+			t.Errorf("test %d: signers mismatch: have %x, want %x", i, have, want)
+		} else {
+			for j := range have {
+				if have[j] != want[j] {
+					t.Errorf("test %d, signer %d: signer mismatch: have %x, want %x", i, j, have[j], want[j])
+				}
+			}
+		}
+		if len(snap.Votes) != 0 {
+			t.Errorf("test %d: votes survived transition: %v", i, snap.Votes)
+		}
+		bc.Stop()
+	}
+}
+
+func TestCliqueTransitionPeriodEpoch(t *testing.T) {
+	tests := []struct {
+		blocks  []transitionBlock
+		failure error
+	}{
+		{
+			blocks: []transitionBlock{
+				{signer: "A", gap: 1}, {signer: "A", gap: 1}, {signer: "A", gap: 20}, {signer: "A", gap: 20},
+				{signer: "A", gap: 20, checkpoint: []string{"A"}}, {signer: "A", gap: 20},
+			},
+		},
+
+
+		{
+			blocks:  []transitionBlock{{signer: "A", gap: 1}, {signer: "A", gap: 1}, {signer: "A", gap: 19}},
+			failure: errInvalidTimestamp,
+		},
+
+
+		{
+			blocks: []transitionBlock{
+				{signer: "A"}, {signer: "A"}, {signer: "A", gap: 20}, {signer: "A", gap: 20}, {signer: "A", gap: 20},
+			},
+			failure: errMismatchingCheckpointSigners,
+		},
+		{
+			blocks: []transitionBlock{
+				{signer: "A"}, {signer: "A"}, {signer: "A", gap: 20}, {signer: "A", gap: 20, checkpoint: []string{"A"}},
+			},
+			failure: errExtraSigners,
+		},
+	}
+	for i, test := range tests {
+		tt := newTransitionTester()
+		config := &params.CliqueConfig{
+			Period: 1,
+			Epoch:  30000,
+			Transitions: []*params.CliqueTransition{
+				{Block: big.NewInt(3), Period: transitionUint64(20), Epoch: transitionUint64(5)},
+			},
+		}
+		bc, engine, err := tt.run(config, []string{"A"}, test.blocks)
+		if !errors.Is(err, test.failure) {
+			t.Errorf("test %d: failure mismatch: have %v, want %v", i, err, test.failure)
+		}
+		if bc == nil {
+			continue
+		}
+		if err == nil && test.failure == nil {
+			for number, want := range map[uint64][2]uint64{1: {1, 30000}, 2: {20, 5}, 6: {20, 5}} {
+				block := bc.GetBlockByNumber(number)
+				snap, err := engine.snapshot(bc, number, block.Hash(), nil)
+				if err != nil {
+					t.Fatalf("test %d: failed to retrieve snapshot %d: %v", i, number, err)
+				}
+				if snap.Period != want[0] || snap.Epoch != want[1] {
+					t.Errorf("test %d, snapshot %d: period/epoch mismatch: have %d/%d, want %d/%d", i, number, snap.Period, snap.Epoch, want[0], want[1])
+				}
+			}
+		}
+		bc.Stop()
+	}
+}
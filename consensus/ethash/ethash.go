@@ -48,7 +48,7 @@ var (
 	two256 = new(big.Int).Exp(big.NewInt(2), big.NewInt(256), big.NewInt(0))
 
 	
-	sharedEthash = New(Config{"", 3, 0, false, "", 1, 0, false, ModeNormal, nil}, nil, false)
+	sharedEthash = New(Config{"", 3, 0, false, "", 1, 0, false, ModeNormal, nil, ""}, nil, false)
 
 	
 	algorithmRevision = 23
@@ -412,6 +412,8 @@ type Config struct {
 	PowMode          Mode
 
 	Log log.Logger `toml:"-"`
+
+	StratumAddr string
 }
 
 
@@ -545,6 +547,10 @@ func (ethash *Ethash) Close() error {
 		}
 		close(ethash.remote.requestExit)
 		<-ethash.remote.exitCh
+
+		if ethash.remote.stratum != nil {
+			ethash.remote.stratum.close()
+		}
 	})
 	return err
 }
@@ -201,6 +201,7 @@ type remoteSealer struct {
 	ethash       *Ethash
 	noverify     bool
 	notifyURLs   []string
+	stratum      *stratumServer
 	results      chan<- *types.Block
 	workCh       chan *sealTask   
 	fetchWorkCh  chan *sealWork   
@@ -259,6 +260,13 @@ func startRemoteSealer(ethash *Ethash, urls []string, noverify bool) *remoteSeal
 		requestExit:  make(chan struct{}),
 		exitCh:       make(chan struct{}),
 	}
+	if addr := ethash.config.StratumAddr; addr != "" {
+		stratum, err := startStratumServer(s, addr)
+		if err != nil {
+			ethash.config.Log.Error("Failed to start stratum server", "addr", addr, "err", err)
+		}
+		s.stratum = stratum
+	}
 	go s.loop()
 	return s
 }
@@ -282,6 +290,9 @@ func (s *remoteSealer) loop() {
 			s.results = work.results
 			s.makeWork(work.block)
 			s.notifyWork()
+			if s.stratum != nil {
+				s.stratum.notify(s.currentWork, work.block.NumberU64())
+			}
 
 		case work := <-s.fetchWorkCh:
 			
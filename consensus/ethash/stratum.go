@@ -0,0 +1,580 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package ethash
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	stratumVersion = "EthereumStratum/1.0.0"
+
+	stratumWriteTimeout = 10 * time.Second
+	stratumIdleTimeout  = 10 * time.Minute
+	stratumRateInterval = 5 * time.Second
+	stratumMaxLine      = 64 * 1024
+)
+
+const (
+	dialectUnknown = iota
+	dialectStratum
+	dialectProxy
+)
+
+var (
+	errStratumUnauthorized = errors.New("unauthorized worker")
+	errStratumUnknownJob   = errors.New("job not found")
+	errStratumLowShare     = errors.New("low difficulty share")
+	errStratumMalformed    = errors.New("malformed request")
+)
+
+var stratumBaseTarget = new(big.Int).Lsh(big.NewInt(0xffff0000), 192)
+
+type stratumRequest struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Worker string          `json:"worker"`
+}
+
+type stratumResponse struct {
+	ID      json.RawMessage `json:"id"`
+	Version string          `json:"jsonrpc,omitempty"`
+	Result  interface{}     `json:"result"`
+	Error   interface{}     `json:"error"`
+}
+
+type stratumNotification struct {
+	ID     interface{}   `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+type stratumProxyError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type stratumJob struct {
+	number uint64
+	target *big.Int
+}
+
+type stratumServer struct {
+	remote   *remoteSealer
+	listener net.Listener
+
+	lock     sync.Mutex
+	sessions map[*stratumSession]struct{}
+	work     [4]string
+	works    map[common.Hash]*stratumJob
+	extra    uint16
+
+	wg sync.WaitGroup
+}
+
+type stratumSession struct {
+	server *stratumServer
+	conn   net.Conn
+	logger log.Logger
+
+	wlock sync.Mutex
+	enc   *json.Encoder
+
+	lock       sync.Mutex
+	dialect    int
+	authorized bool
+	subscribed bool
+	worker     string
+	extranonce string
+	rateID     common.Hash
+	reported   uint64
+	shares     *big.Int
+	started    time.Time
+
+	push chan [4]string
+	term chan struct{}
+}
+
+func startStratumServer(remote *remoteSealer, addr string) (*stratumServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &stratumServer{
+		remote:   remote,
+		listener: listener,
+		sessions: make(map[*stratumSession]struct{}),
+		works:    make(map[common.Hash]*stratumJob),
+	}
+	s.wg.Add(1)
+	go s.acceptLoop()
+
+	remote.ethash.config.Log.Info("Stratum mining server started", "addr", listener.Addr())
+	return s, nil
+}
+
+func (s *stratumServer) acceptLoop() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return
+		}
+		s.lock.Lock()
+		s.extra++
+		sess := &stratumSession{
+			server:     s,
+			conn:       conn,
+			logger:     s.remote.ethash.config.Log.New("miner", conn.RemoteAddr()),
+			enc:        json.NewEncoder(conn),
+			extranonce: fmt.Sprintf("%04x", s.extra),
+			shares:     new(big.Int),
+			started:    time.Now(),
+			push:       make(chan [4]string, 1),
+			term:       make(chan struct{}),
+		}
+		s.sessions[sess] = struct{}{}
+		s.lock.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			sess.run()
+
+			s.lock.Lock()
+			delete(s.sessions, sess)
+			s.lock.Unlock()
+		}()
+	}
+}
+
+func (s *stratumServer) close() {
+	s.listener.Close()
+
+	s.lock.Lock()
+	for sess := range s.sessions {
+		sess.conn.Close()
+	}
+	s.lock.Unlock()
+
+	s.wg.Wait()
+}
+
+func (s *stratumServer) notify(work [4]string, number uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.work = work
+	s.works[common.HexToHash(work[0])] = &stratumJob{
+		number: number,
+		target: new(big.Int).SetBytes(common.FromHex(work[2])),
+	}
+	for hash, job := range s.works {
+		if job.number+staleThreshold <= number {
+			delete(s.works, hash)
+		}
+	}
+	for sess := range s.sessions {
+		sess.notify(work)
+	}
+}
+
+func (s *stratumServer) currentWork() ([4]string, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.work, s.work[0] != ""
+}
+
+func (s *stratumServer) job(sealhash common.Hash) *stratumJob {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.works[sealhash]
+}
+
+func (s *stratumSession) notify(work [4]string) {
+	select {
+	case <-s.push:
+	default:
+	}
+	select {
+	case s.push <- work:
+	default:
+	}
+}
+
+func (s *stratumSession) run() {
+	defer close(s.term)
+	defer s.conn.Close()
+
+	s.logger.Debug("Stratum miner connected")
+	go s.pushLoop()
+
+	reader := bufio.NewReaderSize(s.conn, stratumMaxLine)
+	for {
+		s.conn.SetReadDeadline(time.Now().Add(stratumIdleTimeout))
+		line, prefix, err := reader.ReadLine()
+		if err != nil {
+			s.logger.Debug("Stratum miner disconnected", "err", err)
+			return
+		}
+		if prefix {
+			s.logger.Debug("Stratum request too large, dropping miner")
+			return
+		}
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		var req stratumRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			s.logger.Debug("Invalid stratum request, dropping miner", "err", err)
+			return
+		}
+		if err := s.handle(&req); err != nil {
+			s.logger.Debug("Failed to reply to stratum miner", "err", err)
+			return
+		}
+	}
+}
+
+func (s *stratumSession) pushLoop() {
+	ticker := time.NewTicker(stratumRateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case work := <-s.push:
+			if err := s.sendWork(work); err != nil {
+				s.conn.Close()
+				return
+			}
+		case <-ticker.C:
+			s.reportRate()
+		case <-s.term:
+			return
+		}
+	}
+}
+
+func (s *stratumSession) write(v interface{}) error {
+	s.wlock.Lock()
+	defer s.wlock.Unlock()
+
+	s.conn.SetWriteDeadline(time.Now().Add(stratumWriteTimeout))
+	return s.enc.Encode(v)
+}
+
+func (s *stratumSession) reply(id json.RawMessage, result interface{}, err error) error {
+	s.lock.Lock()
+	dialect := s.dialect
+	s.lock.Unlock()
+
+	res := &stratumResponse{ID: id, Result: result}
+	if dialect == dialectProxy {
+		res.Version = "2.0"
+	}
+	if err != nil {
+		res.Result = nil
+		if dialect == dialectProxy {
+			res.Error = &stratumProxyError{Code: -1, Message: err.Error()}
+		} else {
+			res.Error = []interface{}{20, err.Error(), nil}
+		}
+	}
+	return s.write(res)
+}
+
+func (s *stratumSession) handle(req *stratumRequest) error {
+	var params []string
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil && req.Method != "mining.subscribe" {
+			return s.reply(req.ID, false, errStratumMalformed)
+		}
+	}
+	switch req.Method {
+	case "mining.subscribe":
+		s.lock.Lock()
+		s.dialect, s.subscribed = dialectStratum, true
+		extranonce := s.extranonce
+		s.lock.Unlock()
+
+		result := []interface{}{
+			[]string{"mining.notify", extranonce, stratumVersion},
+			extranonce,
+		}
+		return s.reply(req.ID, result, nil)
+
+	case "mining.extranonce.subscribe":
+		return s.reply(req.ID, true, nil)
+
+	case "mining.authorize":
+		if len(params) < 1 {
+			return s.reply(req.ID, false, errStratumMalformed)
+		}
+		s.login(dialectStratum, params[0])
+		if err := s.reply(req.ID, true, nil); err != nil {
+			return err
+		}
+		s.sendCurrent()
+		return nil
+
+	case "mining.submit":
+		if len(params) < 3 {
+			return s.reply(req.ID, false, errStratumMalformed)
+		}
+		ok, err := s.submitStratum(params[1], params[2])
+		return s.reply(req.ID, ok, err)
+
+	case "eth_submitLogin":
+		if len(params) < 1 {
+			return s.reply(req.ID, false, errStratumMalformed)
+		}
+		worker := params[0]
+		if req.Worker != "" {
+			worker = params[0] + "." + req.Worker
+		}
+		s.login(dialectProxy, worker)
+		return s.reply(req.ID, true, nil)
+
+	case "eth_getWork":
+		if !s.isAuthorized() {
+			return s.reply(req.ID, nil, errStratumUnauthorized)
+		}
+		work, ok := s.server.currentWork()
+		if !ok {
+			return s.reply(req.ID, nil, errNoMiningWork)
+		}
+		return s.reply(req.ID, work[:], nil)
+
+	case "eth_submitWork":
+		if len(params) < 3 {
+			return s.reply(req.ID, false, errStratumMalformed)
+		}
+		ok, err := s.submitProxy(params[0], params[1], params[2])
+		return s.reply(req.ID, ok, err)
+
+	case "eth_submitHashrate", "mining.hashrate":
+		if len(params) < 1 {
+			return s.reply(req.ID, false, errStratumMalformed)
+		}
+		rate, err := hexutil.DecodeUint64(params[0])
+		if err != nil {
+			return s.reply(req.ID, false, errStratumMalformed)
+		}
+		s.lock.Lock()
+		s.reported = rate
+		if len(params) > 1 {
+			if id, err := hexutil.Decode(params[1]); err == nil && len(id) == common.HashLength {
+				s.rateID = common.BytesToHash(id)
+			}
+		}
+		s.lock.Unlock()
+
+		s.reportRate()
+		return s.reply(req.ID, true, nil)
+
+	default:
+		return s.reply(req.ID, nil, fmt.Errorf("method %q not found", req.Method))
+	}
+}
+
+func (s *stratumSession) login(dialect int, worker string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.dialect, s.authorized, s.worker = dialect, true, worker
+	if s.rateID == (common.Hash{}) {
+		s.rateID = crypto.Keccak256Hash([]byte(s.conn.RemoteAddr().String()), []byte(worker))
+	}
+	s.logger.Info("Stratum miner authorized", "worker", worker, "dialect", map[int]string{dialectStratum: "stratum", dialectProxy: "eth-proxy"}[dialect])
+}
+
+func (s *stratumSession) isAuthorized() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.authorized
+}
+
+func (s *stratumSession) sendCurrent() {
+	if work, ok := s.server.currentWork(); ok {
+		s.notify(work)
+	}
+}
+
+func (s *stratumSession) sendWork(work [4]string) error {
+	s.lock.Lock()
+	dialect, authorized, subscribed := s.dialect, s.authorized, s.subscribed
+	s.lock.Unlock()
+
+	if !authorized {
+		return nil
+	}
+	switch dialect {
+	case dialectStratum:
+		if !subscribed {
+			return nil
+		}
+		target, _ := new(big.Int).SetString(strings.TrimPrefix(work[2], "0x"), 16)
+		difficulty, _ := new(big.Float).Quo(new(big.Float).SetInt(stratumBaseTarget), new(big.Float).SetInt(target)).Float64()
+		if err := s.write(&stratumNotification{Method: "mining.set_difficulty", Params: []interface{}{difficulty}}); err != nil {
+			return err
+		}
+		job := strings.TrimPrefix(work[0], "0x")
+		return s.write(&stratumNotification{
+			Method: "mining.notify",
+			Params: []interface{}{job, strings.TrimPrefix(work[1], "0x"), job, true},
+		})
+	case dialectProxy:
+		return s.write(&stratumResponse{ID: json.RawMessage("0"), Version: "2.0", Result: work[:]})
+	}
+	return nil
+}
+
+func (s *stratumSession) submitStratum(job string, nonce string) (bool, error) {
+	if !s.isAuthorized() {
+		return false, errStratumUnauthorized
+	}
+	sealhash := common.HexToHash(job)
+	nonce = strings.TrimPrefix(nonce, "0x")
+	if len(nonce) < 16 {
+		nonce = s.extranonce + nonce
+	}
+	blob, err := hex.DecodeString(nonce)
+	if err != nil || len(blob) != 8 {
+		return false, errStratumMalformed
+	}
+	return s.submit(binary.BigEndian.Uint64(blob), sealhash, nil)
+}
+
+func (s *stratumSession) submitProxy(nonce, hash, digest string) (bool, error) {
+	if !s.isAuthorized() {
+		return false, errStratumUnauthorized
+	}
+	n, err := hexutil.DecodeUint64(nonce)
+	if err != nil {
+		blob, err := hexutil.Decode(nonce)
+		if err != nil || len(blob) != 8 {
+			return false, errStratumMalformed
+		}
+		n = binary.BigEndian.Uint64(blob)
+	}
+	mix, err := hexutil.Decode(digest)
+	if err != nil || len(mix) != common.HashLength {
+		return false, errStratumMalformed
+	}
+	return s.submit(n, common.HexToHash(hash), mix)
+}
+
+func (s *stratumSession) submit(nonce uint64, sealhash common.Hash, mix []byte) (bool, error) {
+	job := s.server.job(sealhash)
+	if job == nil {
+		return false, errStratumUnknownJob
+	}
+	digest, result := s.server.remote.ethash.lightHash(job.number, sealhash, nonce)
+	if mix != nil && !bytes.Equal(mix, digest) {
+		return false, errInvalidMixDigest
+	}
+	if new(big.Int).SetBytes(result).Cmp(job.target) > 0 {
+		return false, errStratumLowShare
+	}
+	errc := make(chan error, 1)
+	select {
+	case s.server.remote.submitWorkCh <- &mineResult{
+		nonce:     types.EncodeNonce(nonce),
+		mixDigest: common.BytesToHash(digest),
+		hash:      sealhash,
+		errc:      errc,
+	}:
+	case <-s.server.remote.exitCh:
+		return false, errEthashStopped
+	}
+	s.lock.Lock()
+	worker := s.worker
+	s.lock.Unlock()
+
+	if err := <-errc; err != nil {
+		s.logger.Debug("Stratum share rejected", "worker", worker, "sealhash", sealhash, "err", err)
+		return false, err
+	}
+	s.lock.Lock()
+	s.shares.Add(s.shares, new(big.Int).Div(two256, job.target))
+	s.lock.Unlock()
+
+	s.logger.Info("Stratum share accepted", "worker", worker, "number", job.number, "sealhash", sealhash)
+	return true, nil
+}
+
+func (s *stratumSession) reportRate() {
+	s.lock.Lock()
+	rate, id := s.reported, s.rateID
+	if rate == 0 && s.shares.Sign() > 0 {
+		if elapsed := uint64(time.Since(s.started) / time.Second); elapsed > 0 {
+			rate = new(big.Int).Div(s.shares, new(big.Int).SetUint64(elapsed)).Uint64()
+		}
+	}
+	s.lock.Unlock()
+
+	if rate == 0 || id == (common.Hash{}) {
+		return
+	}
+	done := make(chan struct{})
+	select {
+	case s.server.remote.submitRateCh <- &hashrate{done: done, rate: rate, id: id}:
+	case <-s.server.remote.exitCh:
+		return
+	}
+	<-done
+}
+
+func (ethash *Ethash) lightHash(number uint64, sealhash common.Hash, nonce uint64) ([]byte, []byte) {
+	cache := ethash.cache(number)
+
+	size := datasetSize(number)
+	if ethash.config.PowMode == ModeTest {
+		size = 32 * 1024
+	}
+	digest, result := hashimotoLight(size, cache.cache, sealhash.Bytes(), nonce)
+	runtime.KeepAlive(cache)
+
+	return digest, result
+}
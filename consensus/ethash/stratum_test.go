@@ -0,0 +1,334 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package ethash
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/internal/testlog"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+type stratumTestMessage struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+	Result json.RawMessage   `json:"result"`
+	Error  json.RawMessage   `json:"error"`
+}
+
+type stratumTestClient struct {
+	t     *testing.T
+	conn  net.Conn
+	dec   *json.Decoder
+	notes []*stratumTestMessage
+	ids   int
+}
+
+func newStratumTester(t *testing.T) (*Ethash, func() *stratumTestClient) {
+	ethash := New(Config{PowMode: ModeTest, CachesInMem: 1, StratumAddr: "127.0.0.1:0", Log: testlog.Logger(t, log.LvlWarn)}, nil, false)
+	ethash.SetThreads(-1)
+	if ethash.remote.stratum == nil {
+		t.Fatal("stratum server not started")
+	}
+	addr := ethash.remote.stratum.listener.Addr().String()
+
+	return ethash, func() *stratumTestClient {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("failed to dial stratum server: %v", err)
+		}
+		return &stratumTestClient{t: t, conn: conn, dec: json.NewDecoder(conn)}
+	}
+}
+
+func (c *stratumTestClient) send(line string) {
+	c.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.conn.Write([]byte(line + "\n")); err != nil {
+		c.t.Fatalf("failed to send stratum request: %v", err)
+	}
+}
+
+func (c *stratumTestClient) read() *stratumTestMessage {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	msg := new(stratumTestMessage)
+	if err := c.dec.Decode(msg); err != nil {
+		c.t.Fatalf("failed to read stratum message: %v", err)
+	}
+	return msg
+}
+
+func (c *stratumTestClient) call(method string, params ...interface{}) *stratumTestMessage {
+	c.ids++
+	id := c.ids
+
+	req, _ := json.Marshal(map[string]interface{}{"id": id, "method": method, "params": params})
+	c.send(string(req))
+	for {
+		msg := c.read()
+		if string(msg.ID) == fmt.Sprint(id) {
+			return msg
+		}
+		c.notes = append(c.notes, msg)
+	}
+}
+
+func (c *stratumTestClient) notification(method string) *stratumTestMessage {
+	for {
+		for i, msg := range c.notes {
+			if msg.Method == method || (method == "" && msg.Method == "" && string(msg.ID) == "0") {
+				c.notes = append(c.notes[:i], c.notes[i+1:]...)
+				return msg
+			}
+		}
+		c.notes = append(c.notes, c.read())
+	}
+}
+
+func (c *stratumTestClient) closed() bool {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var msg stratumTestMessage
+		if err := c.dec.Decode(&msg); err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return false
+			}
+			return true
+		}
+	}
+}
+
+func checkStratumResult(t *testing.T, msg *stratumTestMessage, want string) {
+	t.Helper()
+
+	if string(msg.Result) != want {
+		t.Fatalf("wrong result: have %s, want %s (error %s)", msg.Result, want, msg.Error)
+	}
+}
+
+func checkStratumError(t *testing.T, msg *stratumTestMessage, want error) {
+	t.Helper()
+
+	if !strings.Contains(string(msg.Error), want.Error()) {
+		t.Fatalf("wrong error: have %s, want %q", msg.Error, want)
+	}
+}
+
+func findStratumNonce(t *testing.T, ethash *Ethash, block *types.Block, prefix uint64, valid bool) (uint64, []byte) {
+	var (
+		sealhash = ethash.SealHash(block.Header())
+		target   = new(big.Int).Div(two256, block.Difficulty())
+	)
+	for i := uint64(0); i < 1<<16; i++ {
+		nonce := prefix<<48 | i
+		digest, result := ethash.lightHash(block.NumberU64(), sealhash, nonce)
+		if (new(big.Int).SetBytes(result).Cmp(target) <= 0) == valid {
+			return nonce, digest
+		}
+	}
+	t.Fatal("no suitable nonce found")
+	return 0, nil
+}
+
+func sealStratumBlock(ethash *Ethash, number int64) (*types.Block, chan *types.Block, chan struct{}) {
+	var (
+		block   = types.NewBlockWithHeader(&types.Header{Number: big.NewInt(number), Difficulty: big.NewInt(100)})
+		results = make(chan *types.Block, 1)
+		stop    = make(chan struct{})
+	)
+	ethash.Seal(nil, block, results, stop)
+	return block, results, stop
+}
+
+func TestStratumSubmit(t *testing.T) {
+	ethash, dial := newStratumTester(t)
+	defer ethash.Close()
+
+	client := dial()
+	defer client.conn.Close()
+
+	sub := client.call("mining.subscribe", "test-miner", "EthereumStratum/1.0.0")
+	var subscription []json.RawMessage
+	if err := json.Unmarshal(sub.Result, &subscription); err != nil || len(subscription) != 2 {
+		t.Fatalf("invalid subscription result: %s", sub.Result)
+	}
+	var extranonce string
+	json.Unmarshal(subscription[1], &extranonce)
+	if extranonce != "0001" {
+		t.Fatalf("wrong extranonce: have %q, want %q", extranonce, "0001")
+	}
+	checkStratumError(t, client.call("mining.submit", "worker", "00", "000000000000"), errStratumUnauthorized)
+	checkStratumResult(t, client.call("mining.authorize", "0x0000000000000000000000000000000000000001.rig", "x"), "true")
+
+	block, results, stop := sealStratumBlock(ethash, 1)
+	defer close(stop)
+
+	var (
+		difficulty = client.notification("mining.set_difficulty")
+		target     = new(big.Int).Div(two256, block.Difficulty())
+		have       float64
+	)
+	want, _ := new(big.Float).Quo(new(big.Float).SetInt(stratumBaseTarget), new(big.Float).SetInt(target)).Float64()
+	if len(difficulty.Params) != 1 || json.Unmarshal(difficulty.Params[0], &have) != nil || math.Abs(have-want) > want*1e-9 {
+		t.Fatalf("wrong share difficulty: have %s, want %v", difficulty.Params, want)
+	}
+	notify := client.notification("mining.notify")
+	sealhash := ethash.SealHash(block.Header())
+	if want := fmt.Sprintf("%q", strings.TrimPrefix(sealhash.Hex(), "0x")); len(notify.Params) != 4 || string(notify.Params[0]) != want {
+		t.Fatalf("wrong job notification: %s", notify.Params)
+	}
+	if want := fmt.Sprintf("%q", strings.TrimPrefix(common.BytesToHash(SeedHash(1)).Hex(), "0x")); string(notify.Params[1]) != want {
+		t.Fatalf("wrong seed hash: have %s, want %s", notify.Params[1], want)
+	}
+	job := strings.TrimPrefix(sealhash.Hex(), "0x")
+
+	checkStratumError(t, client.call("mining.submit", "worker", job, "zz"), errStratumMalformed)
+	checkStratumError(t, client.call("mining.submit", "worker", strings.Repeat("ab", 32), "000000000000"), errStratumUnknownJob)
+
+	low, _ := findStratumNonce(t, ethash, block, 1, false)
+	checkStratumError(t, client.call("mining.submit", "worker", job, fmt.Sprintf("%012x", low&(1<<48-1))), errStratumLowShare)
+
+	nonce, digest := findStratumNonce(t, ethash, block, 1, true)
+	checkStratumResult(t, client.call("mining.submit", "worker", job, fmt.Sprintf("%012x", nonce&(1<<48-1))), "true")
+
+	select {
+	case sealed := <-results:
+		if sealed.Nonce() != nonce || sealed.MixDigest() != common.BytesToHash(digest) {
+			t.Fatalf("wrong seal: have %x/%x, want %x/%x", sealed.Nonce(), sealed.MixDigest(), nonce, digest)
+		}
+		if err := ethash.verifySeal(nil, sealed.Header(), false); err != nil {
+			t.Fatalf("stratum share does not verify: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("sealed block not delivered")
+	}
+}
+
+func TestStratumProxySubmit(t *testing.T) {
+	ethash, dial := newStratumTester(t)
+	defer ethash.Close()
+
+	client := dial()
+	defer client.conn.Close()
+
+	checkStratumError(t, client.call("eth_getWork"), errStratumUnauthorized)
+	checkStratumResult(t, client.call("eth_submitLogin", "0x0000000000000000000000000000000000000001"), "true")
+	checkStratumError(t, client.call("eth_getWork"), errNoMiningWork)
+
+	block, results, stop := sealStratumBlock(ethash, 2)
+	defer close(stop)
+
+	pushed := client.notification("")
+	var work [4]string
+	if err := json.Unmarshal(pushed.Result, &work); err != nil {
+		t.Fatalf("invalid pushed work: %s", pushed.Result)
+	}
+	sealhash := ethash.SealHash(block.Header())
+	if work[0] != sealhash.Hex() {
+		t.Fatalf("wrong pushed work: have %s, want %s", work[0], sealhash.Hex())
+	}
+	fetched := client.call("eth_getWork")
+	if err := json.Unmarshal(fetched.Result, &work); err != nil || work[0] != sealhash.Hex() {
+		t.Fatalf("wrong fetched work: %s", fetched.Result)
+	}
+	nonce, digest := findStratumNonce(t, ethash, block, 0, true)
+
+	var blob [8]byte
+	binary.BigEndian.PutUint64(blob[:], nonce)
+	checkStratumError(t, client.call("eth_submitWork", hexutil.Encode(blob[:]), sealhash.Hex(), common.Hash{}.Hex()), errInvalidMixDigest)
+	checkStratumResult(t, client.call("eth_submitWork", hexutil.Encode(blob[:]), sealhash.Hex(), hexutil.Encode(digest)), "true")
+
+	select {
+	case sealed := <-results:
+		if sealed.Nonce() != nonce {
+			t.Fatalf("wrong nonce: have %x, want %x", sealed.Nonce(), nonce)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("sealed block not delivered")
+	}
+	checkStratumError(t, client.call("eth_submitWork", "0x01", sealhash.Hex(), "0x01"), errStratumMalformed)
+}
+
+func TestStratumHashrate(t *testing.T) {
+	ethash, dial := newStratumTester(t)
+	defer ethash.Close()
+
+	var (
+		proxy   = dial()
+		stratum = dial()
+		id      = common.Hash{0x01}
+	)
+	defer proxy.conn.Close()
+	defer stratum.conn.Close()
+
+	checkStratumResult(t, proxy.call("eth_submitLogin", "0x0000000000000000000000000000000000000001"), "true")
+	checkStratumResult(t, proxy.call("eth_submitHashrate", "0x100", id.Hex()), "true")
+	if rate := ethash.Hashrate(); rate != 0x100 {
+		t.Fatalf("wrong hashrate: have %v, want %v", rate, 0x100)
+	}
+	checkStratumResult(t, stratum.call("mining.authorize", "worker", "x"), "true")
+	checkStratumResult(t, stratum.call("mining.hashrate", "0x50"), "true")
+	if rate := ethash.Hashrate(); rate != 0x150 {
+		t.Fatalf("wrong hashrate: have %v, want %v", rate, 0x150)
+	}
+	checkStratumResult(t, proxy.call("eth_submitHashrate", "0x200", id.Hex()), "true")
+	if rate := ethash.Hashrate(); rate != 0x250 {
+		t.Fatalf("wrong hashrate after update: have %v, want %v", rate, 0x250)
+	}
+	checkStratumError(t, proxy.call("eth_submitHashrate", "rate"), errStratumMalformed)
+}
+
+func TestStratumMalformed(t *testing.T) {
+	ethash, dial := newStratumTester(t)
+	defer ethash.Close()
+
+	client := dial()
+	defer client.conn.Close()
+
+	client.send("")
+	client.send("   ")
+	checkStratumError(t, client.call("mining.authorize"), errStratumMalformed)
+	checkStratumError(t, client.call("mining.submit", 1, 2, 3), errStratumMalformed)
+	if msg := client.call("mining.unknown"); len(msg.Error) == 0 || string(msg.Error) == "null" {
+		t.Fatalf("unknown method accepted: %s", msg.Result)
+	}
+	client.send("{not json")
+	if !client.closed() {
+		t.Fatal("connection kept open after invalid json")
+	}
+
+	client = dial()
+	defer client.conn.Close()
+
+	checkStratumResult(t, client.call("mining.extranonce.subscribe"), "true")
+	go client.conn.Write([]byte(strings.Repeat("a", stratumMaxLine+1) + "\n"))
+	if !client.closed() {
+		t.Fatal("connection kept open after oversized line")
+	}
+}
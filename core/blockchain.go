@@ -80,6 +80,8 @@ var (
 	blockPrefetchInterruptMeter = metrics.NewRegisteredMeter("chain/prefetch/interrupts", nil)
 
 	errInsertionInterrupted = errors.New("insertion is interrupted")
+
+	errPathDirtyCache = errors.New("path state scheme requires the trie dirty cache to be disabled")
 )
 
 const (
@@ -91,6 +93,7 @@ const (
 	maxTimeFutureBlocks = 30
 	badBlockLimit       = 10
 	TriesInMemory       = 128
+	triesRetained       = 16
 
 	
 	
@@ -129,6 +132,10 @@ type CacheConfig struct {
 	TrieDirtyDisabled   bool          
 	TrieTimeLimit       time.Duration 
 	SnapshotLimit       int           
+	TrieDiskGC          bool          
+	StateDiffs          bool
+	BlockWitnesses      bool
+	ParallelWorkers     int
 
 	SnapshotWait bool 
 }
@@ -180,6 +187,7 @@ type BlockChain struct {
 	chainHeadFeed event.Feed
 	logsFeed      event.Feed
 	blockProcFeed event.Feed
+	stateDiffFeed event.Feed
 	scope         event.SubscriptionScope
 	genesisBlock  *types.Block
 
@@ -219,6 +227,9 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 	if cacheConfig == nil {
 		cacheConfig = defaultCacheConfig
 	}
+	if rawdb.ReadStateScheme(db) == rawdb.PathScheme && !cacheConfig.TrieDirtyDisabled {
+		return nil, errPathDirtyCache
+	}
 	bodyCache, _ := lru.New(bodyCacheLimit)
 	bodyRLPCache, _ := lru.New(bodyCacheLimit)
 	receiptsCache, _ := lru.New(receiptsCacheLimit)
@@ -228,11 +239,16 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 	badBlocks, _ := lru.New(badBlockLimit)
 
 	bc := &BlockChain{
-		chainConfig:    chainConfig,
-		cacheConfig:    cacheConfig,
-		db:             db,
-		triegc:         prque.New(nil),
-		stateCache:     state.NewDatabaseWithCache(db, cacheConfig.TrieCleanLimit, cacheConfig.TrieCleanJournal),
+		chainConfig: chainConfig,
+		cacheConfig: cacheConfig,
+		db:          db,
+		triegc:      prque.New(nil),
+		stateCache: state.NewDatabaseWithConfig(db, &trie.Config{
+			Cache:    cacheConfig.TrieCleanLimit,
+			Journal:  cacheConfig.TrieCleanJournal,
+			RefCount: cacheConfig.TrieDiskGC && !cacheConfig.TrieDirtyDisabled,
+			Persist:  true,
+		}),
 		quit:           make(chan struct{}),
 		shouldPreserve: shouldPreserve,
 		bodyCache:      bodyCache,
@@ -248,6 +264,9 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 	bc.validator = NewBlockValidator(chainConfig, bc, engine)
 	bc.prefetcher = newStatePrefetcher(chainConfig, bc, engine)
 	bc.processor = NewStateProcessor(chainConfig, bc, engine)
+	if cacheConfig.ParallelWorkers > 1 {
+		bc.processor = NewParallelStateProcessor(chainConfig, bc, engine, cacheConfig.ParallelWorkers)
+	}
 
 	var err error
 	bc.hc, err = NewHeaderChain(db, chainConfig, engine, bc.insertStopped)
@@ -342,6 +361,8 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 		bc.snaps = snapshot.New(bc.db, bc.stateCache.TrieDB(), bc.cacheConfig.SnapshotLimit, bc.CurrentBlock().Root(), !bc.cacheConfig.SnapshotWait)
 	}
 	
+	bc.stateCache.TrieDB().Sweep()
+
 	go bc.update()
 	if txLookupLimit != nil {
 		bc.txLookupLimit = *txLookupLimit
@@ -531,6 +552,8 @@ func (bc *BlockChain) SetHead(head uint64) error {
 			rawdb.DeleteBody(db, hash, num)
 			rawdb.DeleteReceipts(db, hash, num)
 		}
+		rawdb.DeleteStateDiff(db, hash, num)
+		rawdb.DeleteBlockWitness(db, hash, num)
 		
 	}
 	
@@ -628,6 +651,11 @@ func (bc *BlockChain) StateAt(root common.Hash) (*state.StateDB, error) {
 }
 
 
+func (bc *BlockChain) WitnessStateAt(root common.Hash) (*state.StateDB, error) {
+	return state.New(root, state.NewWitnessDatabase(bc.stateCache, state.NewWitness()), bc.snaps)
+}
+
+
 func (bc *BlockChain) StateCache() state.Database {
 	return bc.stateCache
 }
@@ -869,6 +897,69 @@ func (bc *BlockChain) GetReceiptsByHash(hash common.Hash) types.Receipts {
 }
 
 
+func (bc *BlockChain) StateDiffsEnabled() bool {
+	return bc.cacheConfig.StateDiffs
+}
+
+
+func (bc *BlockChain) BlockWitnessesEnabled() bool {
+	return bc.cacheConfig.BlockWitnesses
+}
+
+
+
+
+func (bc *BlockChain) GetBlockWitness(block *types.Block) (*state.Witness, error) {
+	if data := rawdb.ReadBlockWitnessRLP(bc.db, block.Hash(), block.NumberU64()); len(data) > 0 {
+		witness := state.NewWitness()
+		if err := rlp.DecodeBytes(data, witness); err != nil {
+			return nil, err
+		}
+		return witness, nil
+	}
+	parent := bc.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, consensus.ErrUnknownAncestor
+	}
+	witness := state.NewWitness()
+	statedb, err := state.New(parent.Root(), state.NewWitnessDatabase(bc.stateCache, witness), nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, _, err := bc.processor.Process(block, statedb, bc.vmConfig); err != nil {
+		return nil, err
+	}
+	statedb.IntermediateRoot(bc.chainConfig.IsEIP158(block.Number()))
+	return witness, nil
+}
+
+
+
+
+func (bc *BlockChain) GetStateDiff(block *types.Block) (*types.StateDiff, error) {
+	if diff := rawdb.ReadStateDiff(bc.db, block.Hash(), block.NumberU64()); diff != nil {
+		return diff, nil
+	}
+	parent := bc.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, consensus.ErrUnknownAncestor
+	}
+	statedb, err := state.New(parent.Root(), bc.stateCache, nil)
+	if err != nil {
+		return nil, err
+	}
+	statedb.EnableStateDiff()
+	if _, _, _, err := bc.processor.Process(block, statedb, bc.vmConfig); err != nil {
+		return nil, err
+	}
+	statedb.IntermediateRoot(bc.chainConfig.IsEIP158(block.Number()))
+
+	diff := statedb.StateDiff()
+	diff.BlockHash, diff.BlockNumber, diff.Root = block.Hash(), block.NumberU64(), block.Root()
+	return diff, nil
+}
+
+
 
 func (bc *BlockChain) GetBlocksFromHash(hash common.Hash, n int) (blocks []*types.Block) {
 	number := bc.hc.GetBlockNumber(hash)
@@ -973,6 +1064,7 @@ func (bc *BlockChain) Stop() {
 			log.Error("Dangling trie nodes after full cleanup")
 		}
 	}
+	bc.stateCache.TrieDB().WaitCollection()
 	
 	
 	if bc.cacheConfig.TrieCleanJournal != "" {
@@ -1430,6 +1522,35 @@ func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.
 
 
 
+
+func (bc *BlockChain) releaseTries(keep common.Hash) {
+	var (
+		triedb = bc.stateCache.TrieDB()
+		roots  = triedb.Roots()
+		stale  []common.Hash
+	)
+	if len(roots) <= triesRetained {
+		return
+	}
+	retained := map[common.Hash]bool{
+		keep:                          true,
+		bc.genesisBlock.Root():        true,
+		bc.CurrentBlock().Root():      true,
+		rawdb.ReadSnapshotRoot(bc.db): true,
+	}
+	for _, root := range roots[:len(roots)-triesRetained] {
+		if !retained[root] {
+			stale = append(stale, root)
+		}
+	}
+	if len(stale) > 0 {
+		log.Debug("Releasing persisted state tries", "tries", len(stale), "kept", keep)
+		triedb.Release(stale...)
+	}
+}
+
+
+
 func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.Receipt, logs []*types.Log, state *state.StateDB, emitHeadEvent bool) (status WriteStatus, err error) {
 	bc.wg.Add(1)
 	defer bc.wg.Done()
@@ -1453,6 +1574,21 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 	rawdb.WriteBlock(blockBatch, block)
 	rawdb.WriteReceipts(blockBatch, block.Hash(), block.NumberU64(), receipts)
 	rawdb.WritePreimages(blockBatch, state.Preimages())
+
+	var diff *types.StateDiff
+	if bc.cacheConfig.StateDiffs {
+		if diff = state.StateDiff(); diff != nil {
+			diff.BlockHash, diff.BlockNumber, diff.Root = block.Hash(), block.NumberU64(), block.Root()
+			rawdb.WriteStateDiff(blockBatch, block.Hash(), block.NumberU64(), diff)
+		}
+	}
+	if witness := state.Witness(); witness != nil && bc.cacheConfig.BlockWitnesses {
+		enc, err := rlp.EncodeToBytes(witness)
+		if err != nil {
+			log.Crit("Failed to RLP encode block witness", "err", err)
+		}
+		rawdb.WriteBlockWitnessRLP(blockBatch, block.Hash(), block.NumberU64(), enc)
+	}
 	if err := blockBatch.Write(); err != nil {
 		log.Crit("Failed to write block into disk", "err", err)
 	}
@@ -1484,6 +1620,7 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 			}
 			
 			chosen := current - TriesInMemory
+			var persisted common.Hash
 
 			
 			if bc.gcproc > bc.cacheConfig.TrieTimeLimit {
@@ -1502,6 +1639,7 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 					triedb.Commit(header.Root, true, nil)
 					lastWrite = chosen
 					bc.gcproc = 0
+					persisted = header.Root
 				}
 			}
 			
@@ -1513,6 +1651,9 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 				}
 				triedb.Dereference(root.(common.Hash))
 			}
+			if persisted != (common.Hash{}) {
+				bc.releaseTries(persisted)
+			}
 		}
 	}
 	
@@ -1555,6 +1696,9 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 		if len(logs) > 0 {
 			bc.logsFeed.Send(logs)
 		}
+		if diff != nil {
+			bc.stateDiffFeed.Send(StateDiffEvent{Diff: diff})
+		}
 		
 		
 		
@@ -1753,7 +1897,7 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 		
 		if err == ErrKnownBlock {
 			logger := log.Debug
-			if bc.chainConfig.Clique == nil {
+			if bc.chainConfig.Clique == nil && bc.chainConfig.BFT == nil {
 				logger = log.Warn
 			}
 			logger("Inserted known block", "number", block.Number(), "hash", block.Hash(),
@@ -1791,10 +1935,18 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 		if parent == nil {
 			parent = bc.GetHeader(block.ParentHash(), block.NumberU64()-1)
 		}
-		statedb, err := state.New(parent.Root, bc.stateCache, bc.snaps)
+		var statedb *state.StateDB
+		if bc.cacheConfig.BlockWitnesses {
+			statedb, err = bc.WitnessStateAt(parent.Root)
+		} else {
+			statedb, err = state.New(parent.Root, bc.stateCache, bc.snaps)
+		}
 		if err != nil {
 			return it.index, err
 		}
+		if bc.cacheConfig.StateDiffs {
+			statedb.EnableStateDiff()
+		}
 		
 		
 		var followupInterrupt uint32
@@ -2203,6 +2355,18 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 			bc.chainSideFeed.Send(ChainSideEvent{Block: oldChain[i]})
 		}
 	}
+	if bc.cacheConfig.StateDiffs {
+		for _, block := range oldChain {
+			if diff := rawdb.ReadStateDiff(bc.db, block.Hash(), block.NumberU64()); diff != nil {
+				bc.stateDiffFeed.Send(StateDiffEvent{Diff: diff, Removed: true})
+			}
+		}
+		for i := len(newChain) - 1; i >= 1; i-- {
+			if diff := rawdb.ReadStateDiff(bc.db, newChain[i].Hash(), newChain[i].NumberU64()); diff != nil {
+				bc.stateDiffFeed.Send(StateDiffEvent{Diff: diff})
+			}
+		}
+	}
 	return nil
 }
 
@@ -2478,6 +2642,11 @@ func (bc *BlockChain) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscript
 
 
 
+func (bc *BlockChain) SubscribeStateDiffEvent(ch chan<- StateDiffEvent) event.Subscription {
+	return bc.scope.Track(bc.stateDiffFeed.Subscribe(ch))
+}
+
+
 func (bc *BlockChain) SubscribeBlockProcessingEvent(ch chan<- bool) event.Subscription {
 	return bc.scope.Track(bc.blockProcFeed.Subscribe(ch))
 }
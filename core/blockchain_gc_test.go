@@ -0,0 +1,153 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+
+func countTrieNodes(db ethdb.Database) int {
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+
+	var nodes int
+	for it.Next() {
+		if len(it.Key()) == common.HashLength {
+			nodes++
+		}
+	}
+	return nodes
+}
+
+func newTrieGCTestChain(t *testing.T, blocks int) (*Genesis, []*types.Block) {
+	var (
+		key, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr     = crypto.PubkeyToAddress(key.PublicKey)
+		contract = common.HexToAddress("0xc0de")
+		signer   = types.HomesteadSigner{}
+	)
+	gspec := &Genesis{
+		Config: params.TestChainConfig,
+		Alloc: GenesisAlloc{
+			addr:     {Balance: big.NewInt(1e18)},
+			contract: {Balance: new(big.Int), Code: common.Hex2Bytes("43603243065500")},
+		},
+	}
+	db := rawdb.NewMemoryDatabase()
+	chain, _ := GenerateChain(gspec.Config, gspec.MustCommit(db), ethash.NewFaker(), db, blocks, func(i int, b *BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(addr), common.Address{byte(i % 50), 1}, big.NewInt(1000), params.TxGas, big.NewInt(1), nil), signer, key)
+		b.AddTx(tx)
+		tx, _ = types.SignTx(types.NewTransaction(b.TxNonce(addr), contract, new(big.Int), 100000, big.NewInt(1), nil), signer, key)
+		b.AddTx(tx)
+	})
+	return gspec, chain
+}
+
+
+
+func TestTrieDiskGCBounded(t *testing.T) {
+	const (
+		blocks = 1000
+		chunk  = 100
+	)
+	gspec, chain := newTrieGCTestChain(t, blocks)
+
+	run := func(gc bool) (ethdb.Database, []int) {
+		db := rawdb.NewMemoryDatabase()
+		gspec.MustCommit(db)
+
+		config := &CacheConfig{TrieCleanLimit: 16, TrieDirtyLimit: 1, TrieTimeLimit: time.Nanosecond, TrieDiskGC: gc}
+		bc, err := NewBlockChain(db, config, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+		if err != nil {
+			t.Fatalf("failed to create chain: %v", err)
+		}
+		defer bc.Stop()
+
+		var sizes []int
+		for i := 0; i < len(chain); i += chunk {
+			if n, err := bc.InsertChain(chain[i : i+chunk]); err != nil {
+				t.Fatalf("failed to insert block %d: %v", i+n, err)
+			}
+			bc.stateCache.TrieDB().WaitCollection()
+			sizes = append(sizes, countTrieNodes(db))
+		}
+		if roots := bc.stateCache.TrieDB().Roots(); gc && len(roots) > triesRetained+2 {
+			t.Errorf("persisted roots not released: have %d, want <= %d", len(roots), triesRetained+2)
+		}
+		return db, sizes
+	}
+	_, archive := run(false)
+	_, collected := run(true)
+
+	warm := len(collected) / 2
+	if last := collected[len(collected)-1]; last > collected[warm]*5/4 {
+		t.Errorf("disk usage not bounded: sizes %v", collected)
+	}
+	if last := archive[len(archive)-1]; last < collected[len(collected)-1]*2 {
+		t.Errorf("garbage collection ineffective: have %d nodes, archive %d", collected[len(collected)-1], last)
+	}
+}
+
+
+
+func TestTrieDiskGCRewind(t *testing.T) {
+	const blocks = 400
+
+	gspec, chain := newTrieGCTestChain(t, blocks)
+
+	db := rawdb.NewMemoryDatabase()
+	gspec.MustCommit(db)
+
+	config := &CacheConfig{TrieCleanLimit: 16, TrieDirtyLimit: 1, TrieTimeLimit: time.Nanosecond, TrieDiskGC: true}
+	bc, err := NewBlockChain(db, config, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	if n, err := bc.InsertChain(chain); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+	bc.Stop()
+
+	bc, err = NewBlockChain(db, config, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to reopen chain: %v", err)
+	}
+	defer bc.Stop()
+
+	target := uint64(blocks - TriesInMemory - triesRetained/2)
+	if err := bc.SetHead(target); err != nil {
+		t.Fatalf("failed to rewind chain: %v", err)
+	}
+	if head := bc.CurrentBlock().NumberU64(); head != target {
+		t.Fatalf("rewound past retained state: have %d, want %d", head, target)
+	}
+	if _, err := bc.State(); err != nil {
+		t.Fatalf("failed to open rewound state: %v", err)
+	}
+}
@@ -0,0 +1,203 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package core
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func newStateDiffChain(t *testing.T, gspec *Genesis, diffs bool) *BlockChain {
+	db := rawdb.NewMemoryDatabase()
+	gspec.MustCommit(db)
+
+	cacheConfig := *defaultCacheConfig
+	cacheConfig.SnapshotLimit = 0
+	cacheConfig.StateDiffs = diffs
+	chain, err := NewBlockChain(db, &cacheConfig, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	return chain
+}
+
+func stateDiffRLP(t *testing.T, diff *types.StateDiff) []byte {
+	enc, err := rlp.EncodeToBytes(diff)
+	if err != nil {
+		t.Fatalf("failed to encode state diff: %v", err)
+	}
+	return enc
+}
+
+func TestStateDiffPersistence(t *testing.T) {
+	var (
+		key, _ = crypto.GenerateKey()
+		addr   = crypto.PubkeyToAddress(key.PublicKey)
+		signer = types.NewEIP155Signer(params.TestChainConfig.ChainID)
+		dest   = common.Address{0x01}
+		gspec  = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{addr: {Balance: big.NewInt(params.Ether)}}}
+	)
+	genDb := rawdb.NewMemoryDatabase()
+	blocks, _ := GenerateChain(gspec.Config, gspec.MustCommit(genDb), ethash.NewFaker(), genDb, 3, func(i int, gen *BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(gen.TxNonce(addr), dest, big.NewInt(int64(i+1)), params.TxGas, big.NewInt(1), nil), signer, key)
+		gen.AddTx(tx)
+	})
+	chain := newStateDiffChain(t, gspec, true)
+	defer chain.Stop()
+
+	events := make(chan StateDiffEvent, 10)
+	sub := chain.SubscribeStateDiffEvent(events)
+	defer sub.Unsubscribe()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	for i, block := range blocks {
+		select {
+		case ev := <-events:
+			if ev.Removed || ev.Diff.BlockHash != block.Hash() {
+				t.Fatalf("event %d: wrong diff: block %x, removed %t", i, ev.Diff.BlockHash, ev.Removed)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d: state diff not emitted", i)
+		}
+		diff := rawdb.ReadStateDiff(chain.db, block.Hash(), block.NumberU64())
+		if diff == nil {
+			t.Fatalf("block %d: state diff not persisted", block.NumberU64())
+		}
+		if diff.BlockNumber != block.NumberU64() || diff.Root != block.Root() {
+			t.Fatalf("block %d: wrong diff metadata: number %d, root %x", block.NumberU64(), diff.BlockNumber, diff.Root)
+		}
+		var recipient *types.AccountDiff
+		for _, account := range diff.Accounts {
+			if account.Address == dest {
+				recipient = account
+			}
+		}
+		if recipient == nil || recipient.After.Balance.Int64() != int64((i+1)*(i+2)/2) {
+			t.Fatalf("block %d: wrong recipient diff: %+v", block.NumberU64(), recipient)
+		}
+		if len(diff.Accounts) != 3 {
+			t.Fatalf("block %d: wrong changed accounts: have %d, want 3", block.NumberU64(), len(diff.Accounts))
+		}
+	}
+
+
+	plain := newStateDiffChain(t, gspec, false)
+	defer plain.Stop()
+	if _, err := plain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	for _, block := range blocks {
+		if rawdb.HasStateDiff(plain.db, block.Hash(), block.NumberU64()) {
+			t.Fatalf("block %d: state diff persisted while disabled", block.NumberU64())
+		}
+		have, err := plain.GetStateDiff(block)
+		if err != nil {
+			t.Fatalf("block %d: failed to recompute state diff: %v", block.NumberU64(), err)
+		}
+		want, _ := chain.GetStateDiff(block)
+		if !bytes.Equal(stateDiffRLP(t, have), stateDiffRLP(t, want)) {
+			t.Fatalf("block %d: recomputed state diff mismatch", block.NumberU64())
+		}
+	}
+}
+
+func TestStateDiffReorg(t *testing.T) {
+	var (
+		key, _ = crypto.GenerateKey()
+		addr   = crypto.PubkeyToAddress(key.PublicKey)
+		signer = types.NewEIP155Signer(params.TestChainConfig.ChainID)
+		gspec  = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{addr: {Balance: big.NewInt(params.Ether)}}}
+	)
+	genDb := rawdb.NewMemoryDatabase()
+	genesis := gspec.MustCommit(genDb)
+	transfer := func(dest common.Address) func(int, *BlockGen) {
+		return func(i int, gen *BlockGen) {
+			tx, _ := types.SignTx(types.NewTransaction(gen.TxNonce(addr), dest, big.NewInt(1), params.TxGas, big.NewInt(1), nil), signer, key)
+			gen.AddTx(tx)
+		}
+	}
+	canon, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), genDb, 3, transfer(common.Address{0x01}))
+	fork, _ := GenerateChain(gspec.Config, canon[0], ethash.NewFaker(), genDb, 3, transfer(common.Address{0x02}))
+
+	chain := newStateDiffChain(t, gspec, true)
+	defer chain.Stop()
+	if _, err := chain.InsertChain(canon); err != nil {
+		t.Fatalf("failed to insert canonical chain: %v", err)
+	}
+	events := make(chan StateDiffEvent, 20)
+	sub := chain.SubscribeStateDiffEvent(events)
+	defer sub.Unsubscribe()
+
+	if _, err := chain.InsertChain(fork); err != nil {
+		t.Fatalf("failed to insert fork: %v", err)
+	}
+	if head := chain.CurrentBlock(); head.Hash() != fork[len(fork)-1].Hash() {
+		t.Fatalf("fork did not become canonical")
+	}
+	var (
+		removed = make(map[common.Hash]int)
+		added   = make(map[common.Hash]int)
+		order   []bool
+	)
+	for done := false; !done; {
+		select {
+		case ev := <-events:
+			if ev.Removed {
+				removed[ev.Diff.BlockHash]++
+			} else {
+				added[ev.Diff.BlockHash]++
+			}
+			order = append(order, ev.Removed)
+		case <-time.After(200 * time.Millisecond):
+			done = true
+		}
+	}
+	if len(removed) != 2 || removed[canon[1].Hash()] != 1 || removed[canon[2].Hash()] != 1 {
+		t.Fatalf("wrong removed diffs: %v", removed)
+	}
+	if len(added) != len(fork) {
+		t.Fatalf("wrong added diffs: have %d blocks, want %d", len(added), len(fork))
+	}
+	for _, block := range fork {
+		if added[block.Hash()] != 1 {
+			t.Fatalf("block %d: diff emitted %d times", block.NumberU64(), added[block.Hash()])
+		}
+	}
+	for i := 1; i < len(order); i++ {
+		if order[i] && !order[i-1] {
+			t.Fatalf("removed diff emitted after an added one: %v", order)
+		}
+	}
+	for _, block := range canon[1:] {
+		if !rawdb.HasStateDiff(chain.db, block.Hash(), block.NumberU64()) {
+			t.Fatalf("block %d: side chain diff dropped", block.NumberU64())
+		}
+	}
+}
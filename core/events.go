@@ -41,3 +41,8 @@ type ChainSideEvent struct {
 }
 
 type ChainHeadEvent struct{ Block *types.Block }
+
+type StateDiffEvent struct {
+	Diff    *types.StateDiff
+	Removed bool
+}
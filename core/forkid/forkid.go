@@ -203,6 +203,12 @@ func checksumToBytes(hash uint32) [4]byte {
 }
 
 
+
+func Forks(config *params.ChainConfig) []uint64 {
+	return gatherForks(config)
+}
+
+
 func gatherForks(config *params.ChainConfig) []uint64 {
 	
 	kind := reflect.TypeOf(params.ChainConfig{})
@@ -152,6 +152,30 @@ func (e *GenesisMismatchError) Error() string {
 
 
 
+func SetupStateScheme(db ethdb.Database, scheme string) (string, error) {
+	if scheme != "" && scheme != rawdb.HashScheme && scheme != rawdb.PathScheme {
+		return "", fmt.Errorf("unknown state scheme %q", scheme)
+	}
+	stored := rawdb.ReadStateScheme(db)
+	if stored == "" {
+		if rawdb.ReadCanonicalHash(db, 0) != (common.Hash{}) {
+			stored = rawdb.HashScheme
+		} else {
+			if scheme == "" {
+				scheme = rawdb.HashScheme
+			}
+			rawdb.WriteStateScheme(db, scheme)
+			return scheme, nil
+		}
+	}
+	if scheme != "" && scheme != stored {
+		return stored, fmt.Errorf("incompatible state scheme: database uses %s, requested %s", stored, scheme)
+	}
+	return stored, nil
+}
+
+
+
 func SetupGenesisBlock(db ethdb.Database, genesis *Genesis) (*params.ChainConfig, common.Hash, error) {
 	if genesis != nil && genesis.Config == nil {
 		return params.AllEthashProtocolChanges, common.Hash{}, errGenesisNoConfig
@@ -175,7 +199,8 @@ func SetupGenesisBlock(db ethdb.Database, genesis *Genesis) (*params.ChainConfig
 	
 	
 	header := rawdb.ReadHeader(db, stored, 0)
-	if _, err := state.New(header.Root, state.NewDatabaseWithCache(db, 0, ""), nil); err != nil {
+	retained := rawdb.ReadStateScheme(db) != rawdb.PathScheme || rawdb.ReadHeadBlockHash(db) == stored
+	if _, err := state.New(header.Root, state.NewDatabaseWithCache(db, 0, ""), nil); err != nil && retained {
 		if genesis == nil {
 			genesis = DefaultGenesisBlock()
 		}
@@ -256,7 +281,7 @@ func (g *Genesis) ToBlock(db ethdb.Database) *types.Block {
 	if db == nil {
 		db = rawdb.NewMemoryDatabase()
 	}
-	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db), nil)
+	statedb, _ := state.New(common.Hash{}, state.NewDatabaseWithConfig(db, &trie.Config{Persist: true}), nil)
 	for addr, account := range g.Alloc {
 		statedb.AddBalance(addr, account.Balance)
 		statedb.SetCode(addr, account.Code)
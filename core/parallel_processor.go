@@ -0,0 +1,206 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	parallelTxMeter     = metrics.NewRegisteredMeter("chain/parallel/txs", nil)
+	parallelReexecMeter = metrics.NewRegisteredMeter("chain/parallel/reexecs", nil)
+)
+
+type ParallelStateProcessor struct {
+	*StateProcessor
+	workers int
+}
+
+func NewParallelStateProcessor(config *params.ChainConfig, bc *BlockChain, engine consensus.Engine, workers int) *ParallelStateProcessor {
+	return &ParallelStateProcessor{
+		StateProcessor: NewStateProcessor(config, bc, engine),
+		workers:        workers,
+	}
+}
+
+type speculation struct {
+	state   *state.StateDB
+	receipt *types.Receipt
+	access  *state.AccessSet
+	err     error
+}
+
+func (p *ParallelStateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg vm.Config) (types.Receipts, []*types.Log, uint64, error) {
+	txs := block.Transactions()
+	if p.workers < 2 || len(txs) < 2 || cfg.Debug || !p.config.IsByzantium(block.Number()) {
+		return p.StateProcessor.Process(block, statedb, cfg)
+	}
+	var (
+		receipts types.Receipts
+		usedGas  = new(uint64)
+		header   = block.Header()
+		allLogs  []*types.Log
+		gp       = new(GasPool).AddGas(block.GasLimit())
+	)
+	if witness := statedb.Witness(); witness != nil {
+		if parent := p.bc.GetHeader(block.ParentHash(), block.NumberU64()-1); parent != nil {
+			witness.AddHeader(parent)
+		}
+	}
+	if p.config.DAOForkSupport && p.config.DAOForkBlock != nil && p.config.DAOForkBlock.Cmp(block.Number()) == 0 {
+		misc.ApplyDAOHardFork(statedb)
+	}
+	var (
+		origin = statedb.Copy()
+		specs  = make([]*speculation, len(txs))
+		done   = make([]chan struct{}, len(txs))
+		tasks  = make(chan int, len(txs))
+		abort  int32
+		wg     sync.WaitGroup
+	)
+	for i := range txs {
+		specs[i] = &speculation{state: statedb.Copy()}
+		done[i] = make(chan struct{})
+		tasks <- i
+	}
+	close(tasks)
+
+	for n := 0; n < p.workers && n < len(txs); n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range tasks {
+				if atomic.LoadInt32(&abort) == 0 {
+					p.speculate(block, header, txs[i], i, specs[i], cfg)
+				}
+				close(done[i])
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer atomic.StoreInt32(&abort, 1)
+
+	committed := state.NewAccessSet()
+	for i, tx := range txs {
+		<-done[i]
+		spec := specs[i]
+		specs[i] = nil
+
+		statedb.Prepare(tx.Hash(), block.Hash(), i)
+		if spec.err == nil && !spec.access.Destructive && !spec.access.Conflicts(committed) && gp.Gas() >= tx.Gas() {
+			statedb.ApplyAccessSet(spec.state, origin, spec.access)
+			statedb.Finalise(true)
+
+			gp.SubGas(spec.receipt.GasUsed)
+			*usedGas += spec.receipt.GasUsed
+
+			receipt := spec.receipt
+			receipt.CumulativeGasUsed = *usedGas
+			receipt.Logs = statedb.GetLogs(tx.Hash())
+			receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+
+			committed.Merge(spec.access)
+			receipts = append(receipts, receipt)
+			allLogs = append(allLogs, receipt.Logs...)
+			continue
+		}
+		parallelReexecMeter.Mark(1)
+
+		statedb.StartAccessTracking()
+		receipt, err := ApplyTransaction(p.config, p.bc, nil, gp, statedb, header, tx, usedGas, cfg)
+		access := statedb.StopAccessTracking()
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		committed.Merge(access)
+		receipts = append(receipts, receipt)
+		allLogs = append(allLogs, receipt.Logs...)
+	}
+	parallelTxMeter.Mark(int64(len(txs)))
+
+	p.engine.Finalize(p.bc, header, statedb, txs, block.Uncles())
+
+	return receipts, allLogs, *usedGas, nil
+}
+
+func (p *ParallelStateProcessor) speculate(block *types.Block, header *types.Header, tx *types.Transaction, index int, spec *speculation, cfg vm.Config) {
+	spec.state.StartAccessTracking()
+	spec.state.Prepare(tx.Hash(), block.Hash(), index)
+
+	gp := new(GasPool).AddGas(block.GasLimit())
+	spec.receipt, spec.err = ApplyTransaction(p.config, p.bc, nil, gp, spec.state, header, tx, new(uint64), cfg)
+	spec.access = spec.state.StopAccessTracking()
+}
+
+func CompareParallelProcess(bc *BlockChain, block *types.Block, workers int) error {
+	parent := bc.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	seqdb, err := state.New(parent.Root(), bc.stateCache, nil)
+	if err != nil {
+		return err
+	}
+	pardb, err := state.New(parent.Root(), bc.stateCache, nil)
+	if err != nil {
+		return err
+	}
+	sequential := NewStateProcessor(bc.chainConfig, bc, bc.engine)
+	parallel := NewParallelStateProcessor(bc.chainConfig, bc, bc.engine, workers)
+
+	seqReceipts, seqLogs, seqGas, seqErr := sequential.Process(block, seqdb, bc.vmConfig)
+	parReceipts, parLogs, parGas, parErr := parallel.Process(block, pardb, bc.vmConfig)
+	if seqErr != nil || parErr != nil {
+		if seqErr == nil || parErr == nil || seqErr.Error() != parErr.Error() {
+			return fmt.Errorf("error mismatch: sequential %v, parallel %v", seqErr, parErr)
+		}
+		return nil
+	}
+	if seqGas != parGas {
+		return fmt.Errorf("gas used mismatch: sequential %d, parallel %d", seqGas, parGas)
+	}
+	if len(seqReceipts) != len(parReceipts) {
+		return fmt.Errorf("receipt count mismatch: sequential %d, parallel %d", len(seqReceipts), len(parReceipts))
+	}
+	for i := range seqReceipts {
+		want, _ := json.Marshal(seqReceipts[i])
+		have, _ := json.Marshal(parReceipts[i])
+		if !bytes.Equal(want, have) {
+			return fmt.Errorf("receipt %d mismatch:\nsequential %s\nparallel   %s", i, want, have)
+		}
+	}
+	if len(seqLogs) != len(parLogs) {
+		return fmt.Errorf("log count mismatch: sequential %d, parallel %d", len(seqLogs), len(parLogs))
+	}
+	deleteEmpty := bc.chainConfig.IsEIP158(block.Number())
+	if want, have := seqdb.IntermediateRoot(deleteEmpty), pardb.IntermediateRoot(deleteEmpty); want != have {
+		return fmt.Errorf("state root mismatch: sequential %x, parallel %x", want, have)
+	}
+	return nil
+}
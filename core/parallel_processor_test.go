@@ -0,0 +1,224 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+var (
+	parallelCounter  = common.HexToAddress("0xc001")
+	parallelSlotPer  = common.HexToAddress("0xc002")
+	parallelCoinbase = common.HexToAddress("0xc003")
+	parallelSameSlot = common.HexToAddress("0xc004")
+	parallelDestruct = common.HexToAddress("0xc005")
+)
+
+type parallelTestEnv struct {
+	keys   []*ecdsa.PrivateKey
+	signer types.Signer
+	gspec  *Genesis
+}
+
+func newParallelTestEnv(accounts int) *parallelTestEnv {
+	env := &parallelTestEnv{
+		signer: types.NewEIP155Signer(params.TestChainConfig.ChainID),
+		gspec: &Genesis{
+			Config:   params.TestChainConfig,
+			Alloc:    GenesisAlloc{},
+			GasLimit: 20000000,
+		},
+	}
+	for i := 0; i < accounts; i++ {
+		key, _ := crypto.GenerateKey()
+		env.keys = append(env.keys, key)
+		env.gspec.Alloc[crypto.PubkeyToAddress(key.PublicKey)] = GenesisAccount{Balance: big.NewInt(1e18)}
+	}
+	
+	env.gspec.Alloc[parallelCounter] = GenesisAccount{Balance: new(big.Int), Code: common.Hex2Bytes("60005460010160005560006000a000")}
+	
+	env.gspec.Alloc[parallelSlotPer] = GenesisAccount{Balance: new(big.Int), Code: common.Hex2Bytes("43335500")}
+	
+	env.gspec.Alloc[parallelCoinbase] = GenesisAccount{Balance: new(big.Int), Code: common.Hex2Bytes("413160015500")}
+	
+	env.gspec.Alloc[parallelSameSlot] = GenesisAccount{Balance: new(big.Int), Code: common.Hex2Bytes("3360005500")}
+
+	env.gspec.Alloc[parallelDestruct] = GenesisAccount{
+		Balance: big.NewInt(5),
+		Code:    common.Hex2Bytes("33ff"),
+		Storage: map[common.Hash]common.Hash{{1}: {2}},
+	}
+	return env
+}
+
+func (env *parallelTestEnv) tx(b *BlockGen, key *ecdsa.PrivateKey, to *common.Address, value int64, gas uint64, data []byte) *types.Transaction {
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	var tx *types.Transaction
+	if to == nil {
+		tx = types.NewContractCreation(b.TxNonce(from), big.NewInt(value), gas, big.NewInt(1), data)
+	} else {
+		tx = types.NewTransaction(b.TxNonce(from), *to, big.NewInt(value), gas, big.NewInt(1), data)
+	}
+	tx, err := types.SignTx(tx, env.signer, key)
+	if err != nil {
+		panic(err)
+	}
+	return tx
+}
+
+func (env *parallelTestEnv) address(i int) common.Address {
+	return crypto.PubkeyToAddress(env.keys[i%len(env.keys)].PublicKey)
+}
+
+
+
+func (env *parallelTestEnv) run(t *testing.T, n int, gen func(int, *BlockGen)) {
+	t.Helper()
+
+	db := rawdb.NewMemoryDatabase()
+	genesis := env.gspec.MustCommit(db)
+	blocks, _ := GenerateChain(env.gspec.Config, genesis, ethash.NewFaker(), db, n, gen)
+
+	seqdb := rawdb.NewMemoryDatabase()
+	env.gspec.MustCommit(seqdb)
+	sequential, _ := NewBlockChain(seqdb, nil, env.gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	defer sequential.Stop()
+	if i, err := sequential.InsertChain(blocks); err != nil {
+		t.Fatalf("sequential import of block %d failed: %v", blocks[i].NumberU64(), err)
+	}
+	for _, block := range blocks {
+		if len(block.Transactions()) < 2 {
+			t.Fatalf("block %d has %d transactions, parallel execution not exercised", block.NumberU64(), len(block.Transactions()))
+		}
+		for _, workers := range []int{2, 4, 16} {
+			if err := CompareParallelProcess(sequential, block, workers); err != nil {
+				t.Fatalf("block %d, %d workers: %v", block.NumberU64(), workers, err)
+			}
+		}
+	}
+
+	pardb := rawdb.NewMemoryDatabase()
+	env.gspec.MustCommit(pardb)
+	cache := *defaultCacheConfig
+	cache.ParallelWorkers = 4
+	parallel, _ := NewBlockChain(pardb, &cache, env.gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	defer parallel.Stop()
+	if i, err := parallel.InsertChain(blocks); err != nil {
+		t.Fatalf("parallel import of block %d failed: %v", blocks[i].NumberU64(), err)
+	}
+	for _, block := range blocks {
+		want := sequential.GetReceiptsByHash(block.Hash())
+		have := parallel.GetReceiptsByHash(block.Hash())
+		if types.DeriveSha(want, trie.NewStackTrie(nil)) != types.DeriveSha(have, trie.NewStackTrie(nil)) {
+			t.Fatalf("block %d: stored receipts differ", block.NumberU64())
+		}
+	}
+	if want, have := sequential.CurrentBlock().Root(), parallel.CurrentBlock().Root(); want != have {
+		t.Fatalf("head state root mismatch: sequential %x, parallel %x", want, have)
+	}
+}
+
+func TestParallelProcessIndependent(t *testing.T) {
+	env := newParallelTestEnv(16)
+	env.run(t, 5, func(i int, b *BlockGen) {
+		for j, key := range env.keys {
+			to := common.Address{0xee, byte(i), byte(j)}
+			b.AddTx(env.tx(b, key, &to, 7, params.TxGas, nil))
+		}
+	})
+}
+
+func TestParallelProcessConflicting(t *testing.T) {
+	env := newParallelTestEnv(16)
+	env.run(t, 5, func(i int, b *BlockGen) {
+		for j, key := range env.keys {
+			switch j % 3 {
+			case 0:
+				b.AddTx(env.tx(b, key, &parallelCounter, 0, 100000, nil))
+			case 1:
+				
+				to := env.address(j + 1)
+				b.AddTx(env.tx(b, key, &to, 11, params.TxGas, nil))
+			case 2:
+				
+				b.AddTx(env.tx(b, key, &parallelCounter, 0, 100000, nil))
+				b.AddTx(env.tx(b, key, &parallelCounter, 0, 100000, nil))
+			}
+		}
+	})
+}
+
+func TestParallelProcessCoinbase(t *testing.T) {
+	env := newParallelTestEnv(12)
+	env.run(t, 5, func(i int, b *BlockGen) {
+		coinbase := common.Address{0xcb, byte(i % 2)}
+		b.SetCoinbase(coinbase)
+		for j, key := range env.keys {
+			switch j % 3 {
+			case 0:
+				b.AddTx(env.tx(b, key, &parallelCoinbase, 0, 100000, nil))
+			case 1:
+				b.AddTx(env.tx(b, key, &coinbase, 1000, params.TxGas, nil))
+			case 2:
+				to := common.Address{0xee, byte(i), byte(j)}
+				b.AddTx(env.tx(b, key, &to, 1, params.TxGas, nil))
+			}
+		}
+	})
+}
+
+func TestParallelProcessSelfdestruct(t *testing.T) {
+	env := newParallelTestEnv(8)
+	env.run(t, 3, func(i int, b *BlockGen) {
+		for j, key := range env.keys {
+			switch j % 4 {
+			case 0:
+				b.AddTx(env.tx(b, key, &parallelDestruct, 1, 100000, nil))
+			case 1:
+				
+				b.AddTx(env.tx(b, key, nil, 3, 200000, common.Hex2Bytes("6001600055")))
+			default:
+				to := common.Address{0xee, byte(i), byte(j)}
+				b.AddTx(env.tx(b, key, &to, 1, params.TxGas, nil))
+			}
+		}
+	})
+}
+
+func TestParallelProcessSameSlot(t *testing.T) {
+	env := newParallelTestEnv(16)
+	env.run(t, 5, func(i int, b *BlockGen) {
+		for j, key := range env.keys {
+			if j%2 == 0 {
+				b.AddTx(env.tx(b, key, &parallelSameSlot, 0, 100000, nil))
+			} else {
+				b.AddTx(env.tx(b, key, &parallelSlotPer, 0, 100000, nil))
+			}
+		}
+	})
+}
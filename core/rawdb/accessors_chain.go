@@ -630,6 +630,64 @@ func DeleteReceipts(db ethdb.KeyValueWriter, hash common.Hash, number uint64) {
 	}
 }
 
+func HasStateDiff(db ethdb.KeyValueReader, hash common.Hash, number uint64) bool {
+	if has, err := db.Has(stateDiffKey(number, hash)); !has || err != nil {
+		return false
+	}
+	return true
+}
+
+func ReadStateDiffRLP(db ethdb.KeyValueReader, hash common.Hash, number uint64) rlp.RawValue {
+	data, _ := db.Get(stateDiffKey(number, hash))
+	return data
+}
+
+func ReadStateDiff(db ethdb.KeyValueReader, hash common.Hash, number uint64) *types.StateDiff {
+	data := ReadStateDiffRLP(db, hash, number)
+	if len(data) == 0 {
+		return nil
+	}
+	diff := new(types.StateDiff)
+	if err := rlp.DecodeBytes(data, diff); err != nil {
+		log.Error("Invalid state diff RLP", "hash", hash, "err", err)
+		return nil
+	}
+	return diff
+}
+
+func WriteStateDiff(db ethdb.KeyValueWriter, hash common.Hash, number uint64, diff *types.StateDiff) {
+	data, err := rlp.EncodeToBytes(diff)
+	if err != nil {
+		log.Crit("Failed to RLP encode state diff", "err", err)
+	}
+	if err := db.Put(stateDiffKey(number, hash), data); err != nil {
+		log.Crit("Failed to store state diff", "err", err)
+	}
+}
+
+func DeleteStateDiff(db ethdb.KeyValueWriter, hash common.Hash, number uint64) {
+	if err := db.Delete(stateDiffKey(number, hash)); err != nil {
+		log.Crit("Failed to delete state diff", "err", err)
+	}
+}
+
+func ReadBlockWitnessRLP(db ethdb.KeyValueReader, hash common.Hash, number uint64) rlp.RawValue {
+	data, _ := db.Get(blockWitnessKey(number, hash))
+	return data
+}
+
+func WriteBlockWitnessRLP(db ethdb.KeyValueWriter, hash common.Hash, number uint64, witness rlp.RawValue) {
+	if err := db.Put(blockWitnessKey(number, hash), witness); err != nil {
+		log.Crit("Failed to store block witness", "err", err)
+	}
+}
+
+func DeleteBlockWitness(db ethdb.KeyValueWriter, hash common.Hash, number uint64) {
+	if err := db.Delete(blockWitnessKey(number, hash)); err != nil {
+		log.Crit("Failed to delete block witness", "err", err)
+	}
+}
+
 
 
 
@@ -17,9 +17,12 @@
 package rawdb
 
 import (
+	"encoding/binary"
+
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
 )
 
 
@@ -94,3 +97,135 @@ func DeleteTrieNode(db ethdb.KeyValueWriter, hash common.Hash) {
 		log.Crit("Failed to delete trie node", "err", err)
 	}
 }
+
+
+
+func ReadTrieNodeRefs(db ethdb.KeyValueReader, hash common.Hash) (uint32, []common.Hash, bool) {
+	data, _ := db.Get(trieNodeRefsKey(hash))
+	if len(data) < 4 || (len(data)-4)%common.HashLength != 0 {
+		return 0, nil, false
+	}
+	var extern []common.Hash
+	for i := 4; i < len(data); i += common.HashLength {
+		extern = append(extern, common.BytesToHash(data[i:i+common.HashLength]))
+	}
+	return binary.BigEndian.Uint32(data), extern, true
+}
+
+
+
+
+func WriteTrieNodeRefs(db ethdb.KeyValueWriter, hash common.Hash, refs uint32, extern []common.Hash) {
+	enc := make([]byte, 4, 4+len(extern)*common.HashLength)
+	binary.BigEndian.PutUint32(enc, refs)
+	for _, child := range extern {
+		enc = append(enc, child.Bytes()...)
+	}
+	if err := db.Put(trieNodeRefsKey(hash), enc); err != nil {
+		log.Crit("Failed to store trie node references", "err", err)
+	}
+	if refs == 0 {
+		if err := db.Put(trieNodeUnrefKey(hash), []byte{}); err != nil {
+			log.Crit("Failed to store unreferenced trie node marker", "err", err)
+		}
+	} else {
+		if err := db.Delete(trieNodeUnrefKey(hash)); err != nil {
+			log.Crit("Failed to delete unreferenced trie node marker", "err", err)
+		}
+	}
+}
+
+
+func DeleteTrieNodeRefs(db ethdb.KeyValueWriter, hash common.Hash) {
+	if err := db.Delete(trieNodeRefsKey(hash)); err != nil {
+		log.Crit("Failed to delete trie node references", "err", err)
+	}
+	if err := db.Delete(trieNodeUnrefKey(hash)); err != nil {
+		log.Crit("Failed to delete unreferenced trie node marker", "err", err)
+	}
+}
+
+
+func ReadUnreferencedTrieNodes(db ethdb.Iteratee) []common.Hash {
+	var hashes []common.Hash
+
+	it := db.NewIterator(trieNodeUnrefPrefix, nil)
+	defer it.Release()
+
+	for it.Next() {
+		if key := it.Key(); len(key) == len(trieNodeUnrefPrefix)+common.HashLength {
+			hashes = append(hashes, common.BytesToHash(key[len(trieNodeUnrefPrefix):]))
+		}
+	}
+	return hashes
+}
+
+
+func ReadTrieRoots(db ethdb.KeyValueReader) []common.Hash {
+	data, _ := db.Get(trieRootsKey)
+	if len(data) == 0 {
+		return nil
+	}
+	var roots []common.Hash
+	if err := rlp.DecodeBytes(data, &roots); err != nil {
+		log.Error("Invalid persisted trie root list", "err", err)
+		return nil
+	}
+	return roots
+}
+
+
+func WriteTrieRoots(db ethdb.KeyValueWriter, roots []common.Hash) {
+	data, err := rlp.EncodeToBytes(roots)
+	if err != nil {
+		log.Crit("Failed to encode persisted trie root list", "err", err)
+	}
+	if err := db.Put(trieRootsKey, data); err != nil {
+		log.Crit("Failed to store persisted trie root list", "err", err)
+	}
+}
+
+func trieNodeKey(owner common.Hash, path []byte) []byte {
+	if owner == (common.Hash{}) {
+		return accountTrieNodeKey(path)
+	}
+	return storageTrieNodeKey(owner, path)
+}
+
+
+func ReadTrieNodeByPath(db ethdb.KeyValueReader, owner common.Hash, path []byte) []byte {
+	data, _ := db.Get(trieNodeKey(owner, path))
+	return data
+}
+
+
+func WriteTrieNodeByPath(db ethdb.KeyValueWriter, owner common.Hash, path []byte, node []byte) {
+	if err := db.Put(trieNodeKey(owner, path), node); err != nil {
+		log.Crit("Failed to store trie node", "err", err)
+	}
+}
+
+
+func DeleteTrieNodeByPath(db ethdb.KeyValueWriter, owner common.Hash, path []byte) {
+	if err := db.Delete(trieNodeKey(owner, path)); err != nil {
+		log.Crit("Failed to delete trie node", "err", err)
+	}
+}
+
+
+func IterateStorageTrieNodes(db ethdb.Iteratee, owner common.Hash) ethdb.Iterator {
+	return db.NewIterator(storageTrieNodeKey(owner, nil), nil)
+}
+
+
+func ReadStateScheme(db ethdb.KeyValueReader) string {
+	data, _ := db.Get(stateSchemeKey)
+	return string(data)
+}
+
+
+func WriteStateScheme(db ethdb.KeyValueWriter, scheme string) {
+	if err := db.Put(stateSchemeKey, []byte(scheme)); err != nil {
+		log.Crit("Failed to store state scheme", "err", err)
+	}
+}
@@ -57,6 +57,10 @@ var (
 	
 	fastTxLookupLimitKey = []byte("FastTransactionLookupLimit")
 
+	stateSchemeKey = []byte("StateScheme")
+
+	trieRootsKey = []byte("TrieRoots")
+
 	
 	headerPrefix       = []byte("h") 
 	headerTDSuffix     = []byte("t") 
@@ -65,12 +69,18 @@ var (
 
 	blockBodyPrefix     = []byte("b") 
 	blockReceiptsPrefix = []byte("r") 
+	stateDiffPrefix     = []byte("D")
+	blockWitnessPrefix  = []byte("W")
 
 	txLookupPrefix        = []byte("l") 
 	bloomBitsPrefix       = []byte("B") 
 	SnapshotAccountPrefix = []byte("a") 
 	SnapshotStoragePrefix = []byte("o") 
 	codePrefix            = []byte("c") 
+	TrieNodeAccountPrefix = []byte("A")
+	TrieNodeStoragePrefix = []byte("O")
+	trieNodeRefsPrefix    = []byte("R")
+	trieNodeUnrefPrefix   = []byte("Z")
 
 	preimagePrefix = []byte("secure-key-")      
 	configPrefix   = []byte("ethereum-config-") 
@@ -82,6 +92,12 @@ var (
 	preimageHitCounter = metrics.NewRegisteredCounter("db/preimage/hits", nil)
 )
 
+const (
+	HashScheme = "hash"
+
+	PathScheme = "path"
+)
+
 const (
 	
 	freezerHeaderTable = "headers"
@@ -160,6 +176,36 @@ func blockReceiptsKey(number uint64, hash common.Hash) []byte {
 }
 
 
+func stateDiffKey(number uint64, hash common.Hash) []byte {
+	return append(append(stateDiffPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+
+func blockWitnessKey(number uint64, hash common.Hash) []byte {
+	return append(append(blockWitnessPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+
+func accountTrieNodeKey(path []byte) []byte {
+	return append(TrieNodeAccountPrefix, path...)
+}
+
+
+func storageTrieNodeKey(owner common.Hash, path []byte) []byte {
+	return append(append(TrieNodeStoragePrefix, owner.Bytes()...), path...)
+}
+
+
+func trieNodeRefsKey(hash common.Hash) []byte {
+	return append(trieNodeRefsPrefix, hash.Bytes()...)
+}
+
+
+func trieNodeUnrefKey(hash common.Hash) []byte {
+	return append(trieNodeUnrefPrefix, hash.Bytes()...)
+}
+
+
 func txLookupKey(hash common.Hash) []byte {
 	return append(txLookupPrefix, hash.Bytes()...)
 }
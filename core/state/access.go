@@ -0,0 +1,220 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package state
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+type AccessSet struct {
+	Reads      map[common.Address]struct{}
+	SlotReads  map[common.Address]map[common.Hash]struct{}
+	Writes     map[common.Address]struct{}
+	SlotWrites map[common.Address]map[common.Hash]struct{}
+	Dirties    map[common.Address]struct{}
+	Resets     map[common.Address]struct{}
+
+	Destructive bool
+
+	origins map[common.Address]*Account
+}
+
+func NewAccessSet() *AccessSet {
+	return &AccessSet{
+		Reads:      make(map[common.Address]struct{}),
+		SlotReads:  make(map[common.Address]map[common.Hash]struct{}),
+		Writes:     make(map[common.Address]struct{}),
+		SlotWrites: make(map[common.Address]map[common.Hash]struct{}),
+		Dirties:    make(map[common.Address]struct{}),
+		Resets:     make(map[common.Address]struct{}),
+		origins:    make(map[common.Address]*Account),
+	}
+}
+
+func (a *AccessSet) recordOrigin(addr common.Address, obj *stateObject) {
+	if _, ok := a.origins[addr]; ok {
+		return
+	}
+	if obj == nil || obj.deleted {
+		a.origins[addr] = nil
+		return
+	}
+	a.origins[addr] = &Account{
+		Nonce:    obj.data.Nonce,
+		Balance:  new(big.Int).Set(obj.data.Balance),
+		CodeHash: obj.data.CodeHash,
+	}
+}
+
+func (a *AccessSet) recordDirty(addr common.Address, obj *stateObject) {
+	a.Dirties[addr] = struct{}{}
+
+	origin := a.origins[addr]
+	switch {
+	case obj.deleted:
+		a.Resets[addr] = struct{}{}
+		if origin != nil {
+			a.Writes[addr] = struct{}{}
+		}
+	case origin == nil:
+		a.Writes[addr] = struct{}{}
+	case origin.Nonce != obj.data.Nonce || origin.Balance.Cmp(obj.data.Balance) != 0 || !bytes.Equal(origin.CodeHash, obj.data.CodeHash):
+		a.Writes[addr] = struct{}{}
+	}
+}
+
+func (a *AccessSet) read(addr common.Address) {
+	a.Reads[addr] = struct{}{}
+}
+
+func (a *AccessSet) readSlot(addr common.Address, key common.Hash) {
+	addSlot(a.SlotReads, addr, key)
+}
+
+func (a *AccessSet) writeSlot(addr common.Address, key common.Hash) {
+	addSlot(a.SlotWrites, addr, key)
+}
+
+func addSlot(slots map[common.Address]map[common.Hash]struct{}, addr common.Address, key common.Hash) {
+	keys := slots[addr]
+	if keys == nil {
+		keys = make(map[common.Hash]struct{})
+		slots[addr] = keys
+	}
+	keys[key] = struct{}{}
+}
+
+func (a *AccessSet) balanceOnly(addr common.Address) bool {
+	if _, ok := a.Reads[addr]; ok {
+		return false
+	}
+	_, ok := a.SlotWrites[addr]
+	return !ok
+}
+
+func (a *AccessSet) Conflicts(prior *AccessSet) bool {
+	for addr := range a.Reads {
+		if _, ok := prior.Writes[addr]; ok {
+			return true
+		}
+	}
+	for addr := range a.Dirties {
+		if _, ok := prior.Resets[addr]; ok {
+			return true
+		}
+	}
+	for _, slots := range []map[common.Address]map[common.Hash]struct{}{a.SlotReads, a.SlotWrites} {
+		for addr, keys := range slots {
+			if _, ok := prior.Resets[addr]; ok {
+				return true
+			}
+			if written := prior.SlotWrites[addr]; written != nil {
+				for key := range keys {
+					if _, ok := written[key]; ok {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (a *AccessSet) Merge(other *AccessSet) {
+	for addr := range other.Reads {
+		a.Reads[addr] = struct{}{}
+	}
+	for addr := range other.Writes {
+		a.Writes[addr] = struct{}{}
+	}
+	for addr := range other.Dirties {
+		a.Dirties[addr] = struct{}{}
+	}
+	for addr := range other.Resets {
+		a.Resets[addr] = struct{}{}
+	}
+	for addr, keys := range other.SlotReads {
+		for key := range keys {
+			a.readSlot(addr, key)
+		}
+	}
+	for addr, keys := range other.SlotWrites {
+		for key := range keys {
+			a.writeSlot(addr, key)
+		}
+	}
+	a.Destructive = a.Destructive || other.Destructive
+}
+
+func (s *StateDB) StartAccessTracking() {
+	s.access = NewAccessSet()
+}
+
+func (s *StateDB) StopAccessTracking() *AccessSet {
+	access := s.access
+	s.access = nil
+	return access
+}
+
+func (s *StateDB) ApplyAccessSet(src *StateDB, origin *StateDB, access *AccessSet) {
+	for addr := range access.Dirties {
+		obj := src.stateObjects[addr]
+		deleted := obj == nil || obj.deleted
+
+		if access.balanceOnly(addr) {
+			final := new(big.Int)
+			if !deleted {
+				final.Set(obj.Balance())
+			}
+			delta := final.Sub(final, origin.GetBalance(addr))
+			if delta.Sign() >= 0 {
+				s.AddBalance(addr, delta)
+			} else {
+				s.SubBalance(addr, delta.Neg(delta))
+			}
+			continue
+		}
+		if deleted {
+			s.SetNonce(addr, 0)
+			s.SetBalance(addr, new(big.Int))
+			continue
+		}
+		s.SetNonce(addr, obj.Nonce())
+		s.SetBalance(addr, new(big.Int).Set(obj.Balance()))
+		if s.GetCodeHash(addr) != common.BytesToHash(obj.CodeHash()) {
+			s.SetCode(addr, obj.Code(src.db))
+		}
+		for key := range access.SlotWrites[addr] {
+			s.SetState(addr, key, obj.GetState(src.db, key))
+		}
+	}
+	for _, log := range src.GetLogs(src.thash) {
+		s.AddLog(&types.Log{
+			Address:     log.Address,
+			Topics:      log.Topics,
+			Data:        log.Data,
+			BlockNumber: log.BlockNumber,
+		})
+	}
+	for hash, preimage := range src.preimages {
+		s.AddPreimage(hash, preimage)
+	}
+}
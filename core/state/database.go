@@ -100,6 +100,10 @@ type Trie interface {
 	
 	
 	Prove(key []byte, fromLevel uint, proofDb ethdb.KeyValueWriter) error
+
+	
+	
+	ProveMulti(keys [][]byte, fromLevel uint, proofDb ethdb.KeyValueWriter) error
 }
 
 
@@ -113,9 +117,27 @@ func NewDatabase(db ethdb.Database) Database {
 
 
 func NewDatabaseWithCache(db ethdb.Database, cache int, journal string) Database {
+	return NewDatabaseWithConfig(db, &trie.Config{Cache: cache, Journal: journal})
+}
+
+
+
+func NewDatabaseWithConfig(db ethdb.Database, config *trie.Config) Database {
+	csc, _ := lru.New(codeSizeCacheSize)
+	return &cachingDB{
+		db:            trie.NewDatabaseWithConfig(db, config),
+		codeSizeCache: csc,
+		codeCache:     fastcache.New(codeCacheSize),
+	}
+}
+
+
+
+
+func NewDerivedDatabase(db Database, cache int) Database {
 	csc, _ := lru.New(codeSizeCacheSize)
 	return &cachingDB{
-		db:            trie.NewDatabaseWithCache(db, cache, journal),
+		db:            db.TrieDB().Derive(cache),
 		codeSizeCache: csc,
 		codeCache:     fastcache.New(codeCacheSize),
 	}
@@ -134,7 +156,7 @@ func (db *cachingDB) OpenTrie(root common.Hash) (Trie, error) {
 
 
 func (db *cachingDB) OpenStorageTrie(addrHash, root common.Hash) (Trie, error) {
-	return trie.NewSecure(root, db.db)
+	return trie.NewSecureWithOwner(addrHash, root, db.db)
 }
 
 
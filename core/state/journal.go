@@ -90,8 +90,10 @@ type (
 		account *common.Address
 	}
 	resetObjectChange struct {
-		prev         *stateObject
-		prevdestruct bool
+		prev             *stateObject
+		prevdestruct     bool
+		prevdiffdestruct bool
+		prevobjdestruct  bool
 	}
 	suicideChange struct {
 		account     *common.Address
@@ -146,6 +148,12 @@ func (ch resetObjectChange) revert(s *StateDB) {
 	if !ch.prevdestruct && s.snap != nil {
 		delete(s.snapDestructs, ch.prev.addrHash)
 	}
+	if !ch.prevdiffdestruct && s.diffs != nil {
+		delete(s.diffs.destructs, ch.prev.address)
+	}
+	if !ch.prevobjdestruct {
+		delete(s.stateObjectsDestruct, ch.prev.addrHash)
+	}
 }
 
 func (ch resetObjectChange) dirtied() *common.Address {
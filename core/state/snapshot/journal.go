@@ -184,6 +184,74 @@ func loadDiffLayer(parent snapshot, r *rlp.Stream) (snapshot, error) {
 }
 
 
+type JournalLayer struct {
+	Root      common.Hash
+	Destructs int
+	Accounts  int
+	Slots     int
+}
+
+
+type JournalStatus struct {
+	DiskRoot common.Hash
+	Wiping   bool
+	Done     bool
+	Marker   []byte
+	Accounts uint64
+	Slots    uint64
+	Storage  common.StorageSize
+	Layers   []JournalLayer
+}
+
+
+
+func ReadJournal(diskdb ethdb.KeyValueReader) (*JournalStatus, error) {
+	status := &JournalStatus{DiskRoot: rawdb.ReadSnapshotRoot(diskdb)}
+	if status.DiskRoot == (common.Hash{}) {
+		return nil, errors.New("missing or corrupted snapshot")
+	}
+	journal := rawdb.ReadSnapshotJournal(diskdb)
+	if len(journal) == 0 {
+		return nil, errors.New("missing or corrupted snapshot journal")
+	}
+	r := rlp.NewStream(bytes.NewReader(journal), 0)
+
+	var generator journalGenerator
+	if err := r.Decode(&generator); err != nil {
+		return nil, fmt.Errorf("failed to load snapshot progress marker: %v", err)
+	}
+	status.Wiping, status.Done, status.Marker = generator.Wiping, generator.Done, generator.Marker
+	status.Accounts, status.Slots, status.Storage = generator.Accounts, generator.Slots, common.StorageSize(generator.Storage)
+
+	for {
+		var layer JournalLayer
+		if err := r.Decode(&layer.Root); err != nil {
+			if err == io.EOF {
+				return status, nil
+			}
+			return nil, fmt.Errorf("load diff root: %v", err)
+		}
+		var destructs []journalDestruct
+		if err := r.Decode(&destructs); err != nil {
+			return nil, fmt.Errorf("load diff destructs: %v", err)
+		}
+		var accounts []journalAccount
+		if err := r.Decode(&accounts); err != nil {
+			return nil, fmt.Errorf("load diff accounts: %v", err)
+		}
+		var storage []journalStorage
+		if err := r.Decode(&storage); err != nil {
+			return nil, fmt.Errorf("load diff storage: %v", err)
+		}
+		layer.Destructs, layer.Accounts = len(destructs), len(accounts)
+		for _, entry := range storage {
+			layer.Slots += len(entry.Keys)
+		}
+		status.Layers = append(status.Layers, layer)
+	}
+}
+
+
 
 func (dl *diskLayer) Journal(buffer *bytes.Buffer) (common.Hash, error) {
 	
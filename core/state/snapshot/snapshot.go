@@ -195,6 +195,27 @@ func New(diskdb ethdb.KeyValueStore, triedb *trie.Database, cache int, root comm
 
 
 
+
+func Load(diskdb ethdb.KeyValueStore, triedb *trie.Database, cache int, root common.Hash) (*Tree, error) {
+	head, err := loadSnapshot(diskdb, triedb, cache, root)
+	if err != nil {
+		return nil, err
+	}
+	snap := &Tree{
+		diskdb: diskdb,
+		triedb: triedb,
+		cache:  cache,
+		layers: make(map[common.Hash]snapshot),
+	}
+	for head != nil {
+		snap.layers[head.Root()] = head
+		head = head.Parent()
+	}
+	return snap, nil
+}
+
+
+
 func (t *Tree) waitBuild() {
 	
 	var done chan struct{}
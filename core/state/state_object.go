@@ -200,7 +200,7 @@ func (s *stateObject) GetCommittedState(db Database, key common.Hash) common.Has
 		enc []byte
 		err error
 	)
-	if s.db.snap != nil {
+	if s.db.snap != nil && s.db.witness == nil {
 		if metrics.EnabledExpensive {
 			defer func(start time.Time) { s.db.SnapshotStorageReads += time.Since(start) }(time.Now())
 		}
@@ -216,7 +216,7 @@ func (s *stateObject) GetCommittedState(db Database, key common.Hash) common.Has
 		enc, err = s.db.snap.Storage(s.addrHash, crypto.Keccak256Hash(key.Bytes()))
 	}
 	
-	if s.db.snap == nil || err != nil {
+	if s.db.snap == nil || s.db.witness != nil || err != nil {
 		if metrics.EnabledExpensive {
 			defer func(start time.Time) { s.db.StorageReads += time.Since(start) }(time.Now())
 		}
@@ -320,6 +320,9 @@ func (s *stateObject) updateTrie(db Database) Trie {
 		if value == s.originStorage[key] {
 			continue
 		}
+		if s.db.diffs != nil {
+			s.db.diffs.recordStorage(s.address, key, s.originStorage[key])
+		}
 		s.originStorage[key] = value
 
 		var v []byte
@@ -76,6 +76,8 @@ type StateDB struct {
 	stateObjectsPending map[common.Address]struct{} 
 	stateObjectsDirty   map[common.Address]struct{} 
 
+	stateObjectsDestruct map[common.Hash]struct{}
+
 	
 	
 	
@@ -93,6 +95,10 @@ type StateDB struct {
 
 	preimages map[common.Hash][]byte
 
+	diffs   *diffRecorder
+	witness *Witness
+	access  *AccessSet
+
 	
 	
 	journal        *journal
@@ -129,6 +135,11 @@ func New(root common.Hash, db Database, snaps *snapshot.Tree) (*StateDB, error)
 		logs:                make(map[common.Hash][]*types.Log),
 		preimages:           make(map[common.Hash][]byte),
 		journal:             newJournal(),
+
+		stateObjectsDestruct: make(map[common.Hash]struct{}),
+	}
+	if wdb, ok := db.(*witnessDatabase); ok {
+		sdb.witness = wdb.witness
 	}
 	if sdb.snaps != nil {
 		if sdb.snap = sdb.snaps.Snapshot(root); sdb.snap != nil {
@@ -152,6 +163,11 @@ func (s *StateDB) Error() error {
 }
 
 
+func (s *StateDB) Witness() *Witness {
+	return s.witness
+}
+
+
 
 func (s *StateDB) Reset(root common.Hash) error {
 	tr, err := s.db.OpenTrie(root)
@@ -162,12 +178,16 @@ func (s *StateDB) Reset(root common.Hash) error {
 	s.stateObjects = make(map[common.Address]*stateObject)
 	s.stateObjectsPending = make(map[common.Address]struct{})
 	s.stateObjectsDirty = make(map[common.Address]struct{})
+	s.stateObjectsDestruct = make(map[common.Hash]struct{})
 	s.thash = common.Hash{}
 	s.bhash = common.Hash{}
 	s.txIndex = 0
 	s.logs = make(map[common.Hash][]*types.Log)
 	s.logSize = 0
 	s.preimages = make(map[common.Hash][]byte)
+	if s.diffs != nil {
+		s.diffs = newDiffRecorder()
+	}
 	s.clearJournalAndRefund()
 
 	if s.snaps != nil {
@@ -238,18 +258,27 @@ func (s *StateDB) SubRefund(gas uint64) {
 
 
 func (s *StateDB) Exist(addr common.Address) bool {
+	if s.access != nil {
+		s.access.read(addr)
+	}
 	return s.getStateObject(addr) != nil
 }
 
 
 
 func (s *StateDB) Empty(addr common.Address) bool {
+	if s.access != nil {
+		s.access.read(addr)
+	}
 	so := s.getStateObject(addr)
 	return so == nil || so.empty()
 }
 
 
 func (s *StateDB) GetBalance(addr common.Address) *big.Int {
+	if s.access != nil {
+		s.access.read(addr)
+	}
 	stateObject := s.getStateObject(addr)
 	if stateObject != nil {
 		return stateObject.Balance()
@@ -258,6 +287,9 @@ func (s *StateDB) GetBalance(addr common.Address) *big.Int {
 }
 
 func (s *StateDB) GetNonce(addr common.Address) uint64 {
+	if s.access != nil {
+		s.access.read(addr)
+	}
 	stateObject := s.getStateObject(addr)
 	if stateObject != nil {
 		return stateObject.Nonce()
@@ -277,6 +309,9 @@ func (s *StateDB) BlockHash() common.Hash {
 }
 
 func (s *StateDB) GetCode(addr common.Address) []byte {
+	if s.access != nil {
+		s.access.read(addr)
+	}
 	stateObject := s.getStateObject(addr)
 	if stateObject != nil {
 		return stateObject.Code(s.db)
@@ -285,6 +320,9 @@ func (s *StateDB) GetCode(addr common.Address) []byte {
 }
 
 func (s *StateDB) GetCodeSize(addr common.Address) int {
+	if s.access != nil {
+		s.access.read(addr)
+	}
 	stateObject := s.getStateObject(addr)
 	if stateObject != nil {
 		return stateObject.CodeSize(s.db)
@@ -293,6 +331,9 @@ func (s *StateDB) GetCodeSize(addr common.Address) int {
 }
 
 func (s *StateDB) GetCodeHash(addr common.Address) common.Hash {
+	if s.access != nil {
+		s.access.read(addr)
+	}
 	stateObject := s.getStateObject(addr)
 	if stateObject == nil {
 		return common.Hash{}
@@ -302,6 +343,9 @@ func (s *StateDB) GetCodeHash(addr common.Address) common.Hash {
 
 
 func (s *StateDB) GetState(addr common.Address, hash common.Hash) common.Hash {
+	if s.access != nil {
+		s.access.readSlot(addr, hash)
+	}
 	stateObject := s.getStateObject(addr)
 	if stateObject != nil {
 		return stateObject.GetState(s.db, hash)
@@ -328,7 +372,26 @@ func (s *StateDB) GetStorageProof(a common.Address, key common.Hash) ([][]byte,
 }
 
 
+
+func (s *StateDB) GetStorageMultiProof(a common.Address, keys []common.Hash) ([][]byte, error) {
+	var proof proofList
+	trie := s.StorageTrie(a)
+	if trie == nil {
+		return proof, errors.New("storage trie for requested address does not exist")
+	}
+	hashes := make([][]byte, len(keys))
+	for i, key := range keys {
+		hashes[i] = crypto.Keccak256(key.Bytes())
+	}
+	err := trie.ProveMulti(hashes, 0, &proof)
+	return [][]byte(proof), err
+}
+
+
 func (s *StateDB) GetCommittedState(addr common.Address, hash common.Hash) common.Hash {
+	if s.access != nil {
+		s.access.readSlot(addr, hash)
+	}
 	stateObject := s.getStateObject(addr)
 	if stateObject != nil {
 		return stateObject.GetCommittedState(s.db, hash)
@@ -354,6 +417,9 @@ func (s *StateDB) StorageTrie(addr common.Address) Trie {
 }
 
 func (s *StateDB) HasSuicided(addr common.Address) bool {
+	if s.access != nil {
+		s.access.read(addr)
+	}
 	stateObject := s.getStateObject(addr)
 	if stateObject != nil {
 		return stateObject.suicided
@@ -382,6 +448,9 @@ func (s *StateDB) SubBalance(addr common.Address, amount *big.Int) {
 }
 
 func (s *StateDB) SetBalance(addr common.Address, amount *big.Int) {
+	if s.access != nil {
+		s.access.read(addr)
+	}
 	stateObject := s.GetOrNewStateObject(addr)
 	if stateObject != nil {
 		stateObject.SetBalance(amount)
@@ -389,6 +458,9 @@ func (s *StateDB) SetBalance(addr common.Address, amount *big.Int) {
 }
 
 func (s *StateDB) SetNonce(addr common.Address, nonce uint64) {
+	if s.access != nil {
+		s.access.read(addr)
+	}
 	stateObject := s.GetOrNewStateObject(addr)
 	if stateObject != nil {
 		stateObject.SetNonce(nonce)
@@ -396,6 +468,9 @@ func (s *StateDB) SetNonce(addr common.Address, nonce uint64) {
 }
 
 func (s *StateDB) SetCode(addr common.Address, code []byte) {
+	if s.access != nil {
+		s.access.read(addr)
+	}
 	stateObject := s.GetOrNewStateObject(addr)
 	if stateObject != nil {
 		stateObject.SetCode(crypto.Keccak256Hash(code), code)
@@ -403,6 +478,9 @@ func (s *StateDB) SetCode(addr common.Address, code []byte) {
 }
 
 func (s *StateDB) SetState(addr common.Address, key, value common.Hash) {
+	if s.access != nil {
+		s.access.writeSlot(addr, key)
+	}
 	stateObject := s.GetOrNewStateObject(addr)
 	if stateObject != nil {
 		stateObject.SetState(s.db, key, value)
@@ -412,6 +490,9 @@ func (s *StateDB) SetState(addr common.Address, key, value common.Hash) {
 
 
 func (s *StateDB) SetStorage(addr common.Address, storage map[common.Hash]common.Hash) {
+	if s.access != nil {
+		s.access.Destructive = true
+	}
 	stateObject := s.GetOrNewStateObject(addr)
 	if stateObject != nil {
 		stateObject.SetStorage(storage)
@@ -428,6 +509,9 @@ func (s *StateDB) Suicide(addr common.Address) bool {
 	if stateObject == nil {
 		return false
 	}
+	if s.access != nil {
+		s.access.Destructive = true
+	}
 	s.journal.append(suicideChange{
 		account:     &addr,
 		prev:        stateObject.suicided,
@@ -499,6 +583,9 @@ func (s *StateDB) getStateObject(addr common.Address) *stateObject {
 func (s *StateDB) getDeletedStateObject(addr common.Address) *stateObject {
 	
 	if obj := s.stateObjects[addr]; obj != nil {
+		if s.access != nil {
+			s.access.recordOrigin(addr, obj)
+		}
 		return obj
 	}
 	
@@ -506,7 +593,7 @@ func (s *StateDB) getDeletedStateObject(addr common.Address) *stateObject {
 		data *Account
 		err  error
 	)
-	if s.snap != nil {
+	if s.snap != nil && s.witness == nil {
 		if metrics.EnabledExpensive {
 			defer func(start time.Time) { s.SnapshotAccountReads += time.Since(start) }(time.Now())
 		}
@@ -530,7 +617,7 @@ func (s *StateDB) getDeletedStateObject(addr common.Address) *stateObject {
 		}
 	}
 	
-	if s.snap == nil || err != nil {
+	if s.snap == nil || s.witness != nil || err != nil {
 		if metrics.EnabledExpensive {
 			defer func(start time.Time) { s.AccountReads += time.Since(start) }(time.Now())
 		}
@@ -549,8 +636,14 @@ func (s *StateDB) getDeletedStateObject(addr common.Address) *stateObject {
 		}
 	}
 	
+	if s.diffs != nil {
+		s.diffs.recordOrigin(addr, data)
+	}
 	obj := newObject(s, addr, *data)
 	s.setStateObject(obj)
+	if s.access != nil {
+		s.access.recordOrigin(addr, obj)
+	}
 	return obj
 }
 
@@ -579,12 +672,33 @@ func (s *StateDB) createObject(addr common.Address) (newobj, prev *stateObject)
 			s.snapDestructs[prev.addrHash] = struct{}{}
 		}
 	}
+	var prevobjdestruct bool
+	if prev != nil {
+		_, prevobjdestruct = s.stateObjectsDestruct[prev.addrHash]
+		if !prevobjdestruct {
+			s.stateObjectsDestruct[prev.addrHash] = struct{}{}
+		}
+	}
+	var prevdiffdestruct bool
+	if s.diffs != nil && prev != nil {
+		_, prevdiffdestruct = s.diffs.destructs[addr]
+		if !prevdiffdestruct {
+			s.diffs.destructs[addr] = struct{}{}
+		}
+	}
+	if s.access != nil {
+		s.access.recordOrigin(addr, prev)
+		if prev != nil {
+			s.access.Destructive = true
+			s.access.Resets[addr] = struct{}{}
+		}
+	}
 	newobj = newObject(s, addr, Account{})
 	newobj.setNonce(0) 
 	if prev == nil {
 		s.journal.append(createObjectChange{account: &addr})
 	} else {
-		s.journal.append(resetObjectChange{prev: prev, prevdestruct: prevdestruct})
+		s.journal.append(resetObjectChange{prev: prev, prevdestruct: prevdestruct, prevdiffdestruct: prevdiffdestruct, prevobjdestruct: prevobjdestruct})
 	}
 	s.setStateObject(newobj)
 	if prev != nil && !prev.deleted {
@@ -604,6 +718,9 @@ func (s *StateDB) createObject(addr common.Address) (newobj, prev *stateObject)
 
 
 func (s *StateDB) CreateAccount(addr common.Address) {
+	if s.access != nil {
+		s.access.read(addr)
+	}
 	newObj, prev := s.createObject(addr)
 	if prev != nil {
 		newObj.setBalance(prev.data.Balance)
@@ -654,6 +771,9 @@ func (s *StateDB) Copy() *StateDB {
 		logSize:             s.logSize,
 		preimages:           make(map[common.Hash][]byte, len(s.preimages)),
 		journal:             newJournal(),
+		witness:             s.witness,
+
+		stateObjectsDestruct: make(map[common.Hash]struct{}, len(s.stateObjectsDestruct)),
 	}
 	
 	for addr := range s.journal.dirties {
@@ -697,6 +817,12 @@ func (s *StateDB) Copy() *StateDB {
 	for hash, preimage := range s.preimages {
 		state.preimages[hash] = preimage
 	}
+	for addrHash := range s.stateObjectsDestruct {
+		state.stateObjectsDestruct[addrHash] = struct{}{}
+	}
+	if s.diffs != nil {
+		state.diffs = s.diffs.copy()
+	}
 	return state
 }
 
@@ -746,6 +872,10 @@ func (s *StateDB) Finalise(deleteEmptyObjects bool) {
 		}
 		if obj.suicided || (deleteEmptyObjects && obj.empty()) {
 			obj.deleted = true
+			s.stateObjectsDestruct[obj.addrHash] = struct{}{}
+			if s.diffs != nil {
+				s.diffs.destructs[addr] = struct{}{}
+			}
 
 			
 			
@@ -759,6 +889,9 @@ func (s *StateDB) Finalise(deleteEmptyObjects bool) {
 		} else {
 			obj.finalise()
 		}
+		if s.access != nil {
+			s.access.recordDirty(addr, obj)
+		}
 		s.stateObjectsPending[addr] = struct{}{}
 		s.stateObjectsDirty[addr] = struct{}{}
 	}
@@ -817,6 +950,14 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (common.Hash, error) {
 	s.IntermediateRoot(deleteEmptyObjects)
 
 	
+	if triedb := s.db.TrieDB(); triedb.Scheme() == rawdb.PathScheme {
+		for addrHash := range s.stateObjectsDestruct {
+			triedb.WipeOwner(addrHash)
+		}
+	}
+	if len(s.stateObjectsDestruct) > 0 {
+		s.stateObjectsDestruct = make(map[common.Hash]struct{})
+	}
 	codeWriter := s.db.TrieDB().DiskDB().NewBatch()
 	for addr := range s.stateObjectsDirty {
 		if obj := s.stateObjects[addr]; !obj.deleted {
@@ -834,6 +975,9 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (common.Hash, error) {
 	if len(s.stateObjectsDirty) > 0 {
 		s.stateObjectsDirty = make(map[common.Address]struct{})
 	}
+	if s.diffs != nil {
+		s.diffs = newDiffRecorder()
+	}
 	if codeWriter.ValueSize() > 0 {
 		if err := codeWriter.Write(); err != nil {
 			log.Crit("Failed to commit dirty codes", "error", err)
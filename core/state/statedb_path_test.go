@@ -0,0 +1,104 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package state
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+func storageNodePaths(db ethdb.Iteratee, addr common.Address) []string {
+	var paths []string
+
+	it := rawdb.IterateStorageTrieNodes(db, crypto.Keccak256Hash(addr[:]))
+	defer it.Release()
+
+	for it.Next() {
+		paths = append(paths, string(it.Key()[len(rawdb.TrieNodeStoragePrefix)+common.HashLength:]))
+	}
+	return paths
+}
+
+func TestPathSchemeDestructWipesStorage(t *testing.T) {
+	var (
+		diskdb = rawdb.NewMemoryDatabase()
+		sdb    = NewDatabaseWithConfig(diskdb, &trie.Config{Scheme: rawdb.PathScheme, Persist: true})
+
+		destructed = common.Address{0x01}
+		reverted   = common.Address{0x02}
+		recreated  = common.Address{0x03}
+	)
+	commit := func(state *StateDB) common.Hash {
+		root, err := state.Commit(true)
+		if err != nil {
+			t.Fatalf("failed to commit state: %v", err)
+		}
+		if err := sdb.TrieDB().Commit(root, false, nil); err != nil {
+			t.Fatalf("failed to commit trie database: %v", err)
+		}
+		return root
+	}
+	state, _ := New(common.Hash{}, sdb, nil)
+	for _, addr := range []common.Address{destructed, reverted, recreated} {
+		state.SetBalance(addr, big.NewInt(1))
+		for i := 0; i < 50; i++ {
+			state.SetState(addr, common.BigToHash(big.NewInt(int64(i))), common.Hash{0xff, byte(i)})
+		}
+	}
+	root := commit(state)
+	for _, addr := range []common.Address{destructed, reverted, recreated} {
+		if len(storageNodePaths(diskdb, addr)) == 0 {
+			t.Fatalf("no storage nodes persisted for %x", addr)
+		}
+	}
+
+	state, _ = New(root, sdb, nil)
+	state.Suicide(destructed)
+
+	snap := state.Snapshot()
+	state.CreateAccount(reverted)
+	state.RevertToSnapshot(snap)
+
+	state.Suicide(recreated)
+	state.Finalise(true)
+	state.SetBalance(recreated, big.NewInt(1))
+	state.SetState(recreated, common.Hash{0x01}, common.Hash{0x02})
+	root = commit(state)
+
+	if paths := storageNodePaths(diskdb, destructed); len(paths) != 0 {
+		t.Errorf("destructed account left %d storage nodes", len(paths))
+	}
+	if paths := storageNodePaths(diskdb, recreated); len(paths) != 1 || paths[0] != "" {
+		t.Errorf("recreated account has stale storage nodes: %x", paths)
+	}
+	if len(storageNodePaths(diskdb, reverted)) == 0 {
+		t.Errorf("reverted account creation wiped storage")
+	}
+	state, _ = New(root, NewDatabaseWithConfig(diskdb, &trie.Config{Scheme: rawdb.PathScheme}), nil)
+	if value := state.GetState(reverted, common.BigToHash(big.NewInt(7))); value != (common.Hash{0xff, 7}) {
+		t.Errorf("wrong reverted account storage: %x", value)
+	}
+	if value := state.GetState(recreated, common.Hash{0x01}); value != (common.Hash{0x02}) {
+		t.Errorf("wrong recreated account storage: %x", value)
+	}
+}
@@ -0,0 +1,148 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package state
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+type diffRecorder struct {
+	origins   map[common.Address]*Account
+	storage   map[common.Address]map[common.Hash]common.Hash
+	destructs map[common.Address]struct{}
+}
+
+func newDiffRecorder() *diffRecorder {
+	return &diffRecorder{
+		origins:   make(map[common.Address]*Account),
+		storage:   make(map[common.Address]map[common.Hash]common.Hash),
+		destructs: make(map[common.Address]struct{}),
+	}
+}
+
+func (r *diffRecorder) copy() *diffRecorder {
+	cpy := newDiffRecorder()
+	for addr, origin := range r.origins {
+		cpy.origins[addr] = origin
+	}
+	for addr, slots := range r.storage {
+		cpy.storage[addr] = make(map[common.Hash]common.Hash, len(slots))
+		for key, value := range slots {
+			cpy.storage[addr][key] = value
+		}
+	}
+	for addr := range r.destructs {
+		cpy.destructs[addr] = struct{}{}
+	}
+	return cpy
+}
+
+func (r *diffRecorder) recordOrigin(addr common.Address, data *Account) {
+	if _, ok := r.origins[addr]; ok {
+		return
+	}
+	r.origins[addr] = &Account{
+		Nonce:    data.Nonce,
+		Balance:  new(big.Int).Set(data.Balance),
+		Root:     data.Root,
+		CodeHash: common.CopyBytes(data.CodeHash),
+	}
+}
+
+func (r *diffRecorder) recordStorage(addr common.Address, key, prev common.Hash) {
+	slots := r.storage[addr]
+	if slots == nil {
+		slots = make(map[common.Hash]common.Hash)
+		r.storage[addr] = slots
+	}
+	if _, ok := slots[key]; !ok {
+		slots[key] = prev
+	}
+}
+
+func (s *StateDB) EnableStateDiff() {
+	if s.diffs == nil {
+		s.diffs = newDiffRecorder()
+	}
+}
+
+func (s *StateDB) StateDiff() *types.StateDiff {
+	if s.diffs == nil {
+		return nil
+	}
+	diff := &types.StateDiff{Accounts: []*types.AccountDiff{}}
+	for addr := range s.stateObjectsDirty {
+		obj := s.stateObjects[addr]
+
+		account := &types.AccountDiff{Address: addr, Storage: []*types.StorageDiff{}}
+		if origin := s.diffs.origins[addr]; origin != nil {
+			account.Before = &types.AccountState{
+				Nonce:    origin.Nonce,
+				Balance:  new(big.Int).Set(origin.Balance),
+				CodeHash: common.BytesToHash(origin.CodeHash),
+			}
+		}
+		if !obj.deleted {
+			account.After = &types.AccountState{
+				Nonce:    obj.data.Nonce,
+				Balance:  new(big.Int).Set(obj.data.Balance),
+				CodeHash: common.BytesToHash(obj.data.CodeHash),
+			}
+			if account.Before == nil || account.Before.CodeHash != account.After.CodeHash {
+				if !bytes.Equal(obj.data.CodeHash, emptyCodeHash) {
+					account.Code = common.CopyBytes(obj.Code(s.db))
+				}
+			}
+		}
+		if account.Before != nil {
+			_, account.Destructed = s.diffs.destructs[addr]
+		}
+
+		for key, prev := range s.diffs.storage[addr] {
+			var value common.Hash
+			if !obj.deleted {
+				value = obj.originStorage[key]
+			}
+			if value != prev {
+				account.Storage = append(account.Storage, &types.StorageDiff{Key: key, Before: prev, After: value})
+			}
+		}
+		sort.Slice(account.Storage, func(i, j int) bool {
+			return bytes.Compare(account.Storage[i].Key[:], account.Storage[j].Key[:]) < 0
+		})
+		if !account.Destructed && len(account.Storage) == 0 && accountStatesEqual(account.Before, account.After) {
+			continue
+		}
+		diff.Accounts = append(diff.Accounts, account)
+	}
+	sort.Slice(diff.Accounts, func(i, j int) bool {
+		return bytes.Compare(diff.Accounts[i].Address[:], diff.Accounts[j].Address[:]) < 0
+	})
+	return diff
+}
+
+func accountStatesEqual(a, b *types.AccountState) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Nonce == b.Nonce && a.Balance.Cmp(b.Balance) == 0 && a.CodeHash == b.CodeHash
+}
@@ -0,0 +1,166 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package state
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func findAccountDiff(diff *types.StateDiff, addr common.Address) *types.AccountDiff {
+	for _, account := range diff.Accounts {
+		if account.Address == addr {
+			return account
+		}
+	}
+	return nil
+}
+
+func TestStateDiffRecord(t *testing.T) {
+	var (
+		db = NewDatabase(rawdb.NewMemoryDatabase())
+
+		modified   = common.Address{0x01}
+		destructed = common.Address{0x02}
+		created    = common.Address{0x03}
+		untouched  = common.Address{0x04}
+		netZero    = common.Address{0x05}
+		reverted   = common.Address{0x06}
+	)
+	state, _ := New(common.Hash{}, db, nil)
+	state.SetBalance(modified, big.NewInt(100))
+	state.SetState(modified, common.Hash{0x01}, common.Hash{0x01})
+	state.SetState(modified, common.Hash{0x02}, common.Hash{0x02})
+	state.SetBalance(destructed, big.NewInt(50))
+	state.SetState(destructed, common.Hash{0x01}, common.Hash{0x01})
+	state.SetBalance(untouched, big.NewInt(1))
+	state.SetBalance(netZero, big.NewInt(1))
+	state.SetBalance(reverted, big.NewInt(1))
+	root, _ := state.Commit(true)
+
+	state, _ = New(root, db, nil)
+	state.EnableStateDiff()
+
+	state.AddBalance(modified, big.NewInt(1))
+	state.SetNonce(modified, 1)
+	state.SetState(modified, common.Hash{0x01}, common.Hash{0x05})
+	state.SetState(modified, common.Hash{0x02}, common.Hash{0x07})
+	state.SetState(modified, common.Hash{0x02}, common.Hash{0x02})
+	state.SetState(modified, common.Hash{0x03}, common.Hash{0x09})
+
+	state.Suicide(destructed)
+
+	state.SetBalance(created, big.NewInt(7))
+	state.SetCode(created, []byte{0x60, 0x00})
+
+	state.GetBalance(untouched)
+	state.AddBalance(netZero, big.NewInt(1))
+	state.SubBalance(netZero, big.NewInt(1))
+
+	snap := state.Snapshot()
+	state.AddBalance(reverted, big.NewInt(1))
+	state.SetState(reverted, common.Hash{0x01}, common.Hash{0x01})
+	state.RevertToSnapshot(snap)
+
+	cpy := state.Copy()
+	state.IntermediateRoot(true)
+	diff := state.StateDiff()
+
+
+	if len(diff.Accounts) != 3 {
+		t.Fatalf("wrong number of changed accounts: have %d, want 3", len(diff.Accounts))
+	}
+	for i := 1; i < len(diff.Accounts); i++ {
+		if bytes.Compare(diff.Accounts[i-1].Address[:], diff.Accounts[i].Address[:]) >= 0 {
+			t.Fatalf("accounts not sorted")
+		}
+	}
+	account := findAccountDiff(diff, modified)
+	if account == nil || account.Destructed || account.Code != nil {
+		t.Fatalf("wrong modified account diff: %+v", account)
+	}
+	if account.Before.Nonce != 0 || account.Before.Balance.Int64() != 100 || account.After.Nonce != 1 || account.After.Balance.Int64() != 101 {
+		t.Fatalf("wrong modified account states: before %+v, after %+v", account.Before, account.After)
+	}
+	want := []*types.StorageDiff{
+		{Key: common.Hash{0x01}, Before: common.Hash{0x01}, After: common.Hash{0x05}},
+		{Key: common.Hash{0x03}, Before: common.Hash{}, After: common.Hash{0x09}},
+	}
+	if len(account.Storage) != len(want) {
+		t.Fatalf("wrong storage diff: have %d slots, want %d", len(account.Storage), len(want))
+	}
+	for i := range want {
+		if *account.Storage[i] != *want[i] {
+			t.Errorf("slot %d: have %+v, want %+v", i, account.Storage[i], want[i])
+		}
+	}
+
+	account = findAccountDiff(diff, destructed)
+	if account == nil || !account.Destructed || account.After != nil || account.Before.Balance.Int64() != 50 {
+		t.Fatalf("wrong destructed account diff: %+v", account)
+	}
+
+	account = findAccountDiff(diff, created)
+	if account == nil || account.Before != nil || account.Destructed || account.After.Balance.Int64() != 7 {
+		t.Fatalf("wrong created account diff: %+v", account)
+	}
+	if account.After.CodeHash != crypto.Keccak256Hash([]byte{0x60, 0x00}) || len(account.Code) != 2 {
+		t.Fatalf("wrong created account code: %x", account.Code)
+	}
+
+
+	cpy.IntermediateRoot(true)
+	if have := cpy.StateDiff(); len(have.Accounts) != len(diff.Accounts) {
+		t.Fatalf("copied diff mismatch: have %d accounts, want %d", len(have.Accounts), len(diff.Accounts))
+	}
+	state, _ = New(root, db, nil)
+	if state.StateDiff() != nil {
+		t.Fatal("diff recorded without being enabled")
+	}
+}
+
+func TestStateDiffRecreate(t *testing.T) {
+	var (
+		db   = NewDatabase(rawdb.NewMemoryDatabase())
+		addr = common.Address{0x01}
+	)
+	state, _ := New(common.Hash{}, db, nil)
+	state.SetBalance(addr, big.NewInt(10))
+	state.SetState(addr, common.Hash{0x01}, common.Hash{0x01})
+	root, _ := state.Commit(true)
+
+	state, _ = New(root, db, nil)
+	state.EnableStateDiff()
+	state.Suicide(addr)
+	state.Finalise(true)
+	state.SetBalance(addr, big.NewInt(3))
+	state.IntermediateRoot(true)
+
+	account := findAccountDiff(state.StateDiff(), addr)
+	if account == nil || !account.Destructed {
+		t.Fatalf("recreated account not marked destructed: %+v", account)
+	}
+	if account.Before.Balance.Int64() != 10 || account.After == nil || account.After.Balance.Int64() != 3 {
+		t.Fatalf("wrong recreated account states: before %+v, after %+v", account.Before, account.After)
+	}
+}
@@ -0,0 +1,235 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package state
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+type Witness struct {
+	headers map[common.Hash]*types.Header
+	codes   map[common.Hash][]byte
+	nodes   map[common.Hash][]byte
+	lock    sync.Mutex
+}
+
+func NewWitness() *Witness {
+	return &Witness{
+		headers: make(map[common.Hash]*types.Header),
+		codes:   make(map[common.Hash][]byte),
+		nodes:   make(map[common.Hash][]byte),
+	}
+}
+
+func (w *Witness) AddHeader(header *types.Header) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.headers[header.Hash()] = header
+}
+
+func (w *Witness) RecordNode(hash common.Hash, blob []byte) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if _, ok := w.nodes[hash]; !ok {
+		w.nodes[hash] = common.CopyBytes(blob)
+	}
+}
+
+func (w *Witness) RecordCode(hash common.Hash, code []byte) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if _, ok := w.codes[hash]; !ok {
+		w.codes[hash] = common.CopyBytes(code)
+	}
+}
+
+func (w *Witness) Header(hash common.Hash) *types.Header {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.headers[hash]
+}
+
+func (w *Witness) Headers() []*types.Header {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	headers := make([]*types.Header, 0, len(w.headers))
+	for _, header := range w.headers {
+		headers = append(headers, header)
+	}
+	sort.Slice(headers, func(i, j int) bool {
+		return headers[i].Number.Cmp(headers[j].Number) < 0
+	})
+	return headers
+}
+
+func (w *Witness) Stats() (headers int, codes int, nodes int, size common.StorageSize) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for _, code := range w.codes {
+		size += common.StorageSize(len(code))
+	}
+	for _, blob := range w.nodes {
+		size += common.StorageSize(len(blob))
+	}
+	return len(w.headers), len(w.codes), len(w.nodes), size
+}
+
+func (w *Witness) Database() ethdb.Database {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	db := rawdb.NewMemoryDatabase()
+	for hash, blob := range w.nodes {
+		rawdb.WriteTrieNode(db, hash, blob)
+	}
+	for hash, code := range w.codes {
+		rawdb.WriteCode(db, hash, code)
+	}
+	return db
+}
+
+type witnessRLP struct {
+	Headers []*types.Header
+	Codes   [][]byte
+	Nodes   [][]byte
+}
+
+func sortedBlobs(blobs map[common.Hash][]byte) [][]byte {
+	hashes := make([]common.Hash, 0, len(blobs))
+	for hash := range blobs {
+		hashes = append(hashes, hash)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		return bytes.Compare(hashes[i][:], hashes[j][:]) < 0
+	})
+	sorted := make([][]byte, len(hashes))
+	for i, hash := range hashes {
+		sorted[i] = blobs[hash]
+	}
+	return sorted
+}
+
+func (w *Witness) EncodeRLP(out io.Writer) error {
+	headers := w.Headers()
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return rlp.Encode(out, &witnessRLP{
+		Headers: headers,
+		Codes:   sortedBlobs(w.codes),
+		Nodes:   sortedBlobs(w.nodes),
+	})
+}
+
+func (w *Witness) DecodeRLP(s *rlp.Stream) error {
+	var dec witnessRLP
+	if err := s.Decode(&dec); err != nil {
+		return err
+	}
+	w.headers = make(map[common.Hash]*types.Header, len(dec.Headers))
+	for _, header := range dec.Headers {
+		w.headers[header.Hash()] = header
+	}
+	w.codes = make(map[common.Hash][]byte, len(dec.Codes))
+	for _, code := range dec.Codes {
+		w.codes[crypto.Keccak256Hash(code)] = code
+	}
+	w.nodes = make(map[common.Hash][]byte, len(dec.Nodes))
+	for _, blob := range dec.Nodes {
+		w.nodes[crypto.Keccak256Hash(blob)] = blob
+	}
+	return nil
+}
+
+type witnessDatabase struct {
+	Database
+	witness *Witness
+}
+
+func NewWitnessDatabase(db Database, witness *Witness) Database {
+	return &witnessDatabase{Database: db, witness: witness}
+}
+
+func (db *witnessDatabase) Witness() *Witness {
+	return db.witness
+}
+
+func (db *witnessDatabase) OpenTrie(root common.Hash) (Trie, error) {
+	tr, err := db.Database.OpenTrie(root)
+	if err != nil {
+		return nil, err
+	}
+	return db.record(tr, root)
+}
+
+func (db *witnessDatabase) OpenStorageTrie(addrHash, root common.Hash) (Trie, error) {
+	tr, err := db.Database.OpenStorageTrie(addrHash, root)
+	if err != nil {
+		return nil, err
+	}
+	return db.record(tr, root)
+}
+
+func (db *witnessDatabase) record(tr Trie, root common.Hash) (Trie, error) {
+	recordable, ok := tr.(interface {
+		SetAccessRecorder(trie.AccessRecorder)
+	})
+	if !ok {
+		return nil, errors.New("trie does not support access recording")
+	}
+	recordable.SetAccessRecorder(db.witness)
+	if root != (common.Hash{}) && root != emptyRoot {
+		blob, err := db.TrieDB().Node(root)
+		if err != nil {
+			return nil, err
+		}
+		db.witness.RecordNode(root, blob)
+	}
+	return tr, nil
+}
+
+func (db *witnessDatabase) ContractCode(addrHash, codeHash common.Hash) ([]byte, error) {
+	code, err := db.Database.ContractCode(addrHash, codeHash)
+	if err == nil {
+		db.witness.RecordCode(codeHash, code)
+	}
+	return code, err
+}
+
+func (db *witnessDatabase) ContractCodeSize(addrHash, codeHash common.Hash) (int, error) {
+	code, err := db.ContractCode(addrHash, codeHash)
+	return len(code), err
+}
@@ -33,11 +33,17 @@ import (
 
 type StateProcessor struct {
 	config *params.ChainConfig 
-	bc     *BlockChain         
+	bc     processorChain      
 	engine consensus.Engine    
 }
 
 
+type processorChain interface {
+	consensus.ChainHeaderReader
+	Engine() consensus.Engine
+}
+
+
 func NewStateProcessor(config *params.ChainConfig, bc *BlockChain, engine consensus.Engine) *StateProcessor {
 	return &StateProcessor{
 		config: config,
@@ -61,6 +67,11 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 		allLogs  []*types.Log
 		gp       = new(GasPool).AddGas(block.GasLimit())
 	)
+	if witness := statedb.Witness(); witness != nil {
+		if parent := p.bc.GetHeader(block.ParentHash(), block.NumberU64()-1); parent != nil {
+			witness.AddHeader(parent)
+		}
+	}
 	
 	if p.config.DAOForkSupport && p.config.DAOForkBlock != nil && p.config.DAOForkBlock.Cmp(block.Number()) == 0 {
 		misc.ApplyDAOHardFork(statedb)
@@ -86,10 +97,19 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 
 
 func ApplyTransaction(config *params.ChainConfig, bc ChainContext, author *common.Address, gp *GasPool, statedb *state.StateDB, header *types.Header, tx *types.Transaction, usedGas *uint64, cfg vm.Config) (*types.Receipt, error) {
-	msg, err := tx.AsMessage(types.MakeSigner(config, header.Number))
+	return ApplyTransactionWithSigner(config, types.MakeSigner(config, header.Number), bc, author, gp, statedb, header, tx, usedGas, cfg)
+}
+
+
+
+func ApplyTransactionWithSigner(config *params.ChainConfig, signer types.Signer, bc ChainContext, author *common.Address, gp *GasPool, statedb *state.StateDB, header *types.Header, tx *types.Transaction, usedGas *uint64, cfg vm.Config) (*types.Receipt, error) {
+	msg, err := tx.AsMessage(signer)
 	if err != nil {
 		return nil, err
 	}
+	if witness := statedb.Witness(); witness != nil {
+		bc = &witnessChain{ChainContext: bc, witness: witness}
+	}
 	
 	context := NewEVMContext(msg, header, bc, author)
 	
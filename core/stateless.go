@@ -0,0 +1,124 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+type witnessChain struct {
+	ChainContext
+	witness *state.Witness
+}
+
+func (c *witnessChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	header := c.ChainContext.GetHeader(hash, number)
+	if header != nil {
+		c.witness.AddHeader(header)
+	}
+	return header
+}
+
+type statelessChain struct {
+	config  *params.ChainConfig
+	engine  consensus.Engine
+	witness *state.Witness
+	head    *types.Header
+}
+
+func (c *statelessChain) Config() *params.ChainConfig { return c.config }
+
+func (c *statelessChain) Engine() consensus.Engine { return c.engine }
+
+func (c *statelessChain) CurrentHeader() *types.Header { return c.head }
+
+func (c *statelessChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if header := c.witness.Header(hash); header != nil && header.Number.Uint64() == number {
+		return header
+	}
+	return nil
+}
+
+func (c *statelessChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	return c.witness.Header(hash)
+}
+
+func (c *statelessChain) GetHeaderByNumber(number uint64) *types.Header {
+	for header := c.head; header != nil; header = c.witness.Header(header.ParentHash) {
+		if header.Number.Uint64() == number {
+			return header
+		}
+		if header.Number.Uint64() < number {
+			break
+		}
+	}
+	return nil
+}
+
+type blockWitness struct {
+	Block   *types.Block
+	Witness *state.Witness
+}
+
+func EncodeBlockWitness(block *types.Block, witness *state.Witness) ([]byte, error) {
+	return rlp.EncodeToBytes(&blockWitness{Block: block, Witness: witness})
+}
+
+func DecodeBlockWitness(data []byte) (*types.Block, *state.Witness, error) {
+	dec := blockWitness{Witness: state.NewWitness()}
+	if err := rlp.DecodeBytes(data, &dec); err != nil {
+		return nil, nil, err
+	}
+	return dec.Block, dec.Witness, nil
+}
+
+func VerifyStateless(config *params.ChainConfig, engine consensus.Engine, block *types.Block, witness *state.Witness) error {
+	parent := witness.Header(block.ParentHash())
+	if parent == nil {
+		return errors.New("witness does not contain the parent header")
+	}
+	if parent.Number.Uint64()+1 != block.NumberU64() {
+		return fmt.Errorf("parent number mismatch: have %d, want %d", parent.Number, block.NumberU64()-1)
+	}
+	statedb, err := state.New(parent.Root, state.NewDatabase(witness.Database()), nil)
+	if err != nil {
+		return fmt.Errorf("witness does not contain the parent state root: %v", err)
+	}
+	processor := &StateProcessor{
+		config: config,
+		bc:     &statelessChain{config: config, engine: engine, witness: witness, head: parent},
+		engine: engine,
+	}
+	receipts, _, usedGas, err := processor.Process(block, statedb, vm.Config{})
+	if err != nil {
+		return err
+	}
+	if err := statedb.Error(); err != nil {
+		return fmt.Errorf("incomplete witness: %v", err)
+	}
+	validator := &BlockValidator{config: config, engine: engine}
+	return validator.ValidateState(block, statedb, receipts, usedGas)
+}
@@ -0,0 +1,230 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package core
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var statelessContract = common.HexToAddress("0xc0de")
+
+type statelessWitnessRLP struct {
+	Headers []*types.Header
+	Codes   [][]byte
+	Nodes   [][]byte
+}
+
+func newStatelessTestChain(t *testing.T, gspec *Genesis, witnesses bool) *BlockChain {
+	cacheConfig := *defaultCacheConfig
+	cacheConfig.SnapshotLimit = 0
+	cacheConfig.BlockWitnesses = witnesses
+
+	db := rawdb.NewMemoryDatabase()
+	gspec.MustCommit(db)
+	bc, err := NewBlockChain(db, &cacheConfig, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	return bc
+}
+
+func newStatelessBlocks(t *testing.T, blocks int) (*Genesis, []*types.Block) {
+	var (
+		key, _ = crypto.GenerateKey()
+		addr   = crypto.PubkeyToAddress(key.PublicKey)
+		signer = types.NewEIP155Signer(params.TestChainConfig.ChainID)
+		gspec  = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc: GenesisAlloc{
+				addr:              {Balance: big.NewInt(params.Ether)},
+				statelessContract: {Balance: new(big.Int), Code: common.Hex2Bytes("436003900340435560005460010160005500")},
+			},
+		}
+		db = rawdb.NewMemoryDatabase()
+	)
+	parent := gspec.MustCommit(db)
+	gen, _ := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	defer gen.Stop()
+
+	var chain []*types.Block
+	for i := 0; i < blocks; i++ {
+		next, _ := GenerateChain(gspec.Config, parent, ethash.NewFaker(), db, 1, func(_ int, b *BlockGen) {
+			call, _ := types.SignTx(types.NewTransaction(b.TxNonce(addr), statelessContract, new(big.Int), 100000, big.NewInt(1), nil), signer, key)
+			b.AddTxWithChain(gen, call)
+			transfer, _ := types.SignTx(types.NewTransaction(b.TxNonce(addr), common.Address{byte(i + 1)}, big.NewInt(1), params.TxGas, big.NewInt(1), nil), signer, key)
+			b.AddTx(transfer)
+		})
+		if _, err := gen.InsertChain(next); err != nil {
+			t.Fatalf("failed to generate block %d: %v", i+1, err)
+		}
+		chain, parent = append(chain, next[0]), next[0]
+	}
+	return gspec, chain
+}
+
+func splitWitness(t *testing.T, witness *state.Witness) *statelessWitnessRLP {
+	enc, err := rlp.EncodeToBytes(witness)
+	if err != nil {
+		t.Fatalf("failed to encode witness: %v", err)
+	}
+	dec := new(statelessWitnessRLP)
+	if err := rlp.DecodeBytes(enc, dec); err != nil {
+		t.Fatalf("failed to decode witness: %v", err)
+	}
+	return dec
+}
+
+func joinWitness(t *testing.T, parts *statelessWitnessRLP) *state.Witness {
+	enc, err := rlp.EncodeToBytes(parts)
+	if err != nil {
+		t.Fatalf("failed to encode witness: %v", err)
+	}
+	witness := state.NewWitness()
+	if err := rlp.DecodeBytes(enc, witness); err != nil {
+		t.Fatalf("failed to decode witness: %v", err)
+	}
+	return witness
+}
+
+func TestVerifyStateless(t *testing.T) {
+	gspec, blocks := newStatelessBlocks(t, 4)
+	chain := newStatelessTestChain(t, gspec, true)
+	defer chain.Stop()
+	plain := newStatelessTestChain(t, gspec, false)
+	defer plain.Stop()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+
+	for _, block := range blocks {
+		if len(rawdb.ReadBlockWitnessRLP(chain.db, block.Hash(), block.NumberU64())) == 0 {
+			t.Fatalf("block %d: witness not persisted", block.NumberU64())
+		}
+		witness, err := chain.GetBlockWitness(block)
+		if err != nil {
+			t.Fatalf("block %d: failed to read witness: %v", block.NumberU64(), err)
+		}
+		if err := VerifyStateless(chain.Config(), ethash.NewFaker(), block, witness); err != nil {
+			t.Fatalf("block %d: recorded witness rejected: %v", block.NumberU64(), err)
+		}
+		if headers, codes, nodes, _ := witness.Stats(); headers == 0 || codes != 1 || nodes == 0 {
+			t.Fatalf("block %d: wrong witness contents: %d headers, %d codes, %d nodes", block.NumberU64(), headers, codes, nodes)
+		}
+
+
+		enc, err := EncodeBlockWitness(block, witness)
+		if err != nil {
+			t.Fatalf("block %d: failed to encode block witness: %v", block.NumberU64(), err)
+		}
+		decBlock, decWitness, err := DecodeBlockWitness(enc)
+		if err != nil {
+			t.Fatalf("block %d: failed to decode block witness: %v", block.NumberU64(), err)
+		}
+		if decBlock.Hash() != block.Hash() {
+			t.Fatalf("block %d: decoded block mismatch", block.NumberU64())
+		}
+		if err := VerifyStateless(chain.Config(), ethash.NewFaker(), decBlock, decWitness); err != nil {
+			t.Fatalf("block %d: decoded witness rejected: %v", block.NumberU64(), err)
+		}
+	}
+	if _, err := plain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	for _, block := range blocks {
+		if len(rawdb.ReadBlockWitnessRLP(plain.db, block.Hash(), block.NumberU64())) != 0 {
+			t.Fatalf("block %d: witness persisted while disabled", block.NumberU64())
+		}
+		witness, err := plain.GetBlockWitness(block)
+		if err != nil {
+			t.Fatalf("block %d: failed to recompute witness: %v", block.NumberU64(), err)
+		}
+		if err := VerifyStateless(plain.Config(), ethash.NewFaker(), block, witness); err != nil {
+			t.Fatalf("block %d: recomputed witness rejected: %v", block.NumberU64(), err)
+		}
+	}
+}
+
+func TestVerifyStatelessIncomplete(t *testing.T) {
+	gspec, blocks := newStatelessBlocks(t, 3)
+	chain := newStatelessTestChain(t, gspec, true)
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+
+	block := blocks[2]
+	witness, err := chain.GetBlockWitness(block)
+	if err != nil {
+		t.Fatalf("failed to read witness: %v", err)
+	}
+	parts := splitWitness(t, witness)
+
+	for i := range parts.Nodes {
+		incomplete := *parts
+		incomplete.Nodes = append(append([][]byte{}, parts.Nodes[:i]...), parts.Nodes[i+1:]...)
+		if err := VerifyStateless(chain.Config(), ethash.NewFaker(), block, joinWitness(t, &incomplete)); err == nil {
+			t.Fatalf("witness without node %d accepted", i)
+		}
+	}
+	incomplete := *parts
+	incomplete.Codes = nil
+	if err := VerifyStateless(chain.Config(), ethash.NewFaker(), block, joinWitness(t, &incomplete)); err == nil {
+		t.Fatal("witness without contract code accepted")
+	}
+
+
+	if len(parts.Headers) < 2 {
+		t.Fatalf("witness lacks the BLOCKHASH ancestor: %d headers", len(parts.Headers))
+	}
+	for _, header := range parts.Headers {
+		incomplete := *parts
+		incomplete.Headers = nil
+		for _, h := range parts.Headers {
+			if h != header {
+				incomplete.Headers = append(incomplete.Headers, h)
+			}
+		}
+		err := VerifyStateless(chain.Config(), ethash.NewFaker(), block, joinWitness(t, &incomplete))
+		if err == nil {
+			t.Fatalf("witness without header %d accepted", header.Number)
+		}
+		if header.Hash() == block.ParentHash() && !strings.Contains(err.Error(), "parent header") {
+			t.Fatalf("wrong error for missing parent header: %v", err)
+		}
+	}
+
+
+	forged := *parts
+	forged.Codes = [][]byte{common.Hex2Bytes("00")}
+	if err := VerifyStateless(chain.Config(), ethash.NewFaker(), block, joinWitness(t, &forged)); err == nil {
+		t.Fatal("witness with substituted code accepted")
+	}
+}
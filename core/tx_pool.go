@@ -49,6 +49,8 @@ const (
 	
 	
 	txMaxSize = 4 * txSlotSize 
+
+	maxBundles = 1024
 )
 
 var (
@@ -79,6 +81,10 @@ var (
 	
 	
 	ErrOversizedData = errors.New("oversized data")
+
+	ErrEmptyBundle = errors.New("bundle contains no transactions")
+
+	ErrStaleBundle = errors.New("bundle targets a past block")
 )
 
 var (
@@ -238,6 +244,8 @@ type TxPool struct {
 	all     *txLookup                    
 	priced  *txPricedList                
 
+	bundles []*types.Bundle
+
 	chainHeadCh     chan ChainHeadEvent
 	chainHeadSub    event.Subscription
 	reqResetCh      chan *txpoolResetRequest
@@ -501,6 +509,56 @@ func (pool *TxPool) Locals() []common.Address {
 
 
 
+func (pool *TxPool) AddBundle(bundle *types.Bundle) error {
+	if len(bundle.Txs) == 0 {
+		return ErrEmptyBundle
+	}
+	for _, tx := range bundle.Txs {
+		if _, err := types.Sender(pool.signer, tx); err != nil {
+			return ErrInvalidSender
+		}
+	}
+	if head := pool.chain.CurrentBlock(); bundle.BlockNumber.Cmp(head.Number()) <= 0 {
+		return ErrStaleBundle
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.bundles = append(pool.bundles, bundle)
+	if len(pool.bundles) > maxBundles {
+		pool.bundles = pool.bundles[len(pool.bundles)-maxBundles:]
+	}
+	return nil
+}
+
+
+
+func (pool *TxPool) Bundles(number *big.Int, timestamp uint64) []*types.Bundle {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	var (
+		live     = pool.bundles[:0]
+		eligible []*types.Bundle
+	)
+	for _, bundle := range pool.bundles {
+		if bundle.BlockNumber.Cmp(number) < 0 {
+			continue
+		}
+		live = append(live, bundle)
+		if bundle.Eligible(number, timestamp) {
+			eligible = append(eligible, bundle)
+		}
+	}
+	for i := len(live); i < len(pool.bundles); i++ {
+		pool.bundles[i] = nil
+	}
+	pool.bundles = live
+	return eligible
+}
+
+
+
 func (pool *TxPool) local() map[common.Address]types.Transactions {
 	txs := make(map[common.Address]types.Transactions)
 	for addr := range pool.locals.accounts {
@@ -0,0 +1,116 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestTxPoolBundles(t *testing.T) {
+	var (
+		key, _ = crypto.GenerateKey()
+		signer = types.NewEIP155Signer(params.TestChainConfig.ChainID)
+		db     = rawdb.NewMemoryDatabase()
+		gspec  = &Genesis{Config: params.TestChainConfig}
+	)
+	genesis := gspec.MustCommit(db)
+	blocks, _ := GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 2, nil)
+
+	chain, _ := NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, nil)
+	defer chain.Stop()
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	config := DefaultTxPoolConfig
+	config.Journal = ""
+	pool := NewTxPool(config, params.TestChainConfig, chain)
+	defer pool.Stop()
+
+	makeBundle := func(number int64, min, max uint64) *types.Bundle {
+		tx, _ := types.SignTx(types.NewTransaction(uint64(number), common.Address{0x01}, big.NewInt(1), params.TxGas, big.NewInt(1), nil), signer, key)
+		return &types.Bundle{Txs: types.Transactions{tx}, BlockNumber: big.NewInt(number), MinTimestamp: min, MaxTimestamp: max}
+	}
+	if err := pool.AddBundle(&types.Bundle{BlockNumber: big.NewInt(3)}); err != ErrEmptyBundle {
+		t.Fatalf("empty bundle: have %v, want %v", err, ErrEmptyBundle)
+	}
+	unsigned := types.NewTransaction(0, common.Address{0x01}, big.NewInt(1), params.TxGas, big.NewInt(1), nil)
+	if err := pool.AddBundle(&types.Bundle{Txs: types.Transactions{unsigned}, BlockNumber: big.NewInt(3)}); err != ErrInvalidSender {
+		t.Fatalf("unsigned bundle: have %v, want %v", err, ErrInvalidSender)
+	}
+	for _, number := range []int64{1, 2} {
+		if err := pool.AddBundle(makeBundle(number, 0, 0)); err != ErrStaleBundle {
+			t.Fatalf("bundle for block %d: have %v, want %v", number, err, ErrStaleBundle)
+		}
+	}
+	var (
+		anytime = makeBundle(3, 0, 0)
+		early   = makeBundle(3, 0, 100)
+		late    = makeBundle(3, 200, 0)
+		window  = makeBundle(3, 100, 200)
+		next    = makeBundle(4, 0, 0)
+	)
+	for _, bundle := range []*types.Bundle{anytime, early, late, window, next} {
+		if err := pool.AddBundle(bundle); err != nil {
+			t.Fatalf("failed to add bundle: %v", err)
+		}
+	}
+	tests := []struct {
+		number    int64
+		timestamp uint64
+		want      []*types.Bundle
+	}{
+		{3, 50, []*types.Bundle{anytime, early}},
+		{3, 100, []*types.Bundle{anytime, early, window}},
+		{3, 150, []*types.Bundle{anytime, window}},
+		{3, 200, []*types.Bundle{anytime, late, window}},
+		{3, 250, []*types.Bundle{anytime, late}},
+		{4, 150, []*types.Bundle{next}},
+
+
+		{3, 150, nil},
+		{5, 0, nil},
+	}
+	for i, test := range tests {
+		have := pool.Bundles(big.NewInt(test.number), test.timestamp)
+		if len(have) != len(test.want) {
+			t.Fatalf("test %d: bundle count mismatch: have %d, want %d", i, len(have), len(test.want))
+		}
+		for j := range have {
+			if have[j] != test.want[j] {
+				t.Fatalf("test %d: bundle %d mismatch: have %x, want %x", i, j, have[j].Hash(), test.want[j].Hash())
+			}
+		}
+	}
+	for i := 0; i < maxBundles+10; i++ {
+		pool.AddBundle(makeBundle(int64(10+i), 0, 0))
+	}
+	if have := len(pool.bundles); have != maxBundles {
+		t.Fatalf("bundle cap not enforced: have %d, want %d", have, maxBundles)
+	}
+	if bundles := pool.Bundles(big.NewInt(10), 0); len(bundles) != 0 {
+		t.Fatalf("oldest bundle not evicted: %d left", len(bundles))
+	}
+}
@@ -0,0 +1,74 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package types
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+
+
+var BFTDigest = common.HexToHash("0x6266742d636f6d6d69747465642d7365616c732d66696c7465726564000000")
+
+const BFTExtraVanity = 32
+
+var (
+	errMissingBFTVanity = errors.New("extra-data 32 byte vanity prefix missing")
+	errInvalidBFTExtra  = errors.New("invalid extra-data")
+)
+
+
+
+
+type BFTExtra struct {
+	Validators     []common.Address
+	Seal           []byte
+	CommittedSeals [][]byte
+}
+
+func ExtractBFTExtra(h *Header) (*BFTExtra, error) {
+	if len(h.Extra) < BFTExtraVanity {
+		return nil, errMissingBFTVanity
+	}
+	extra := new(BFTExtra)
+	if err := rlp.DecodeBytes(h.Extra[BFTExtraVanity:], extra); err != nil {
+		return nil, errInvalidBFTExtra
+	}
+	return extra, nil
+}
+
+
+
+
+func BFTFilteredHeader(h *Header) *Header {
+	extra, err := ExtractBFTExtra(h)
+	if err != nil {
+		return nil
+	}
+	extra.CommittedSeals = nil
+
+	enc, err := rlp.EncodeToBytes(extra)
+	if err != nil {
+		return nil
+	}
+	filtered := CopyHeader(h)
+	filtered.Extra = append(filtered.Extra[:BFTExtraVanity:BFTExtraVanity], enc...)
+	return filtered
+}
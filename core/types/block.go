@@ -101,6 +101,11 @@ type headerMarshaling struct {
 
 
 func (h *Header) Hash() common.Hash {
+	if h.MixDigest == BFTDigest {
+		if filtered := BFTFilteredHeader(h); filtered != nil {
+			return rlpHash(filtered)
+		}
+	}
 	return rlpHash(h)
 }
 
@@ -0,0 +1,66 @@
+
+package types
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var _ = (*accountDiffMarshaling)(nil)
+
+func (a AccountDiff) MarshalJSON() ([]byte, error) {
+	type AccountDiff struct {
+		Address    common.Address `json:"address" gencodec:"required"`
+		Before     *AccountState  `json:"before" rlp:"nil"`
+		After      *AccountState  `json:"after" rlp:"nil"`
+		Code       hexutil.Bytes  `json:"code,omitempty"`
+		Destructed bool           `json:"destructed"`
+		Storage    []*StorageDiff `json:"storage"`
+	}
+	var enc AccountDiff
+	enc.Address = a.Address
+	enc.Before = a.Before
+	enc.After = a.After
+	enc.Code = a.Code
+	enc.Destructed = a.Destructed
+	enc.Storage = a.Storage
+	return json.Marshal(&enc)
+}
+
+func (a *AccountDiff) UnmarshalJSON(input []byte) error {
+	type AccountDiff struct {
+		Address    *common.Address `json:"address" gencodec:"required"`
+		Before     *AccountState   `json:"before" rlp:"nil"`
+		After      *AccountState   `json:"after" rlp:"nil"`
+		Code       *hexutil.Bytes  `json:"code,omitempty"`
+		Destructed *bool           `json:"destructed"`
+		Storage    []*StorageDiff  `json:"storage"`
+	}
+	var dec AccountDiff
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	if dec.Address == nil {
+		return errors.New("missing required field 'address' for AccountDiff")
+	}
+	a.Address = *dec.Address
+	if dec.Before != nil {
+		a.Before = dec.Before
+	}
+	if dec.After != nil {
+		a.After = dec.After
+	}
+	if dec.Code != nil {
+		a.Code = *dec.Code
+	}
+	if dec.Destructed != nil {
+		a.Destructed = *dec.Destructed
+	}
+	if dec.Storage != nil {
+		a.Storage = dec.Storage
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+
+package types
+
+import (
+	"encoding/json"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var _ = (*accountStateMarshaling)(nil)
+
+func (a AccountState) MarshalJSON() ([]byte, error) {
+	type AccountState struct {
+		Nonce    hexutil.Uint64 `json:"nonce"`
+		Balance  *hexutil.Big   `json:"balance"`
+		CodeHash common.Hash    `json:"codeHash"`
+	}
+	var enc AccountState
+	enc.Nonce = hexutil.Uint64(a.Nonce)
+	enc.Balance = (*hexutil.Big)(a.Balance)
+	enc.CodeHash = a.CodeHash
+	return json.Marshal(&enc)
+}
+
+func (a *AccountState) UnmarshalJSON(input []byte) error {
+	type AccountState struct {
+		Nonce    *hexutil.Uint64 `json:"nonce"`
+		Balance  *hexutil.Big    `json:"balance"`
+		CodeHash *common.Hash    `json:"codeHash"`
+	}
+	var dec AccountState
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	if dec.Nonce != nil {
+		a.Nonce = uint64(*dec.Nonce)
+	}
+	if dec.Balance != nil {
+		a.Balance = (*big.Int)(dec.Balance)
+	}
+	if dec.CodeHash != nil {
+		a.CodeHash = *dec.CodeHash
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package types
+
+import (
+	"encoding/json"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var _ = (*stateDiffMarshaling)(nil)
+
+func (s StateDiff) MarshalJSON() ([]byte, error) {
+	type StateDiff struct {
+		BlockHash   common.Hash    `json:"blockHash"`
+		BlockNumber hexutil.Uint64 `json:"blockNumber"`
+		Root        common.Hash    `json:"stateRoot"`
+		Accounts    []*AccountDiff `json:"accounts"`
+	}
+	var enc StateDiff
+	enc.BlockHash = s.BlockHash
+	enc.BlockNumber = hexutil.Uint64(s.BlockNumber)
+	enc.Root = s.Root
+	enc.Accounts = s.Accounts
+	return json.Marshal(&enc)
+}
+
+func (s *StateDiff) UnmarshalJSON(input []byte) error {
+	type StateDiff struct {
+		BlockHash   *common.Hash    `json:"blockHash"`
+		BlockNumber *hexutil.Uint64 `json:"blockNumber"`
+		Root        *common.Hash    `json:"stateRoot"`
+		Accounts    []*AccountDiff  `json:"accounts"`
+	}
+	var dec StateDiff
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	if dec.BlockHash != nil {
+		s.BlockHash = *dec.BlockHash
+	}
+	if dec.BlockNumber != nil {
+		s.BlockNumber = uint64(*dec.BlockNumber)
+	}
+	if dec.Root != nil {
+		s.Root = *dec.Root
+	}
+	if dec.Accounts != nil {
+		s.Accounts = dec.Accounts
+	}
+	return nil
+}
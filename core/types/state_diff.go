@@ -0,0 +1,73 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package types
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+type StateDiff struct {
+	BlockHash   common.Hash    `json:"blockHash"`
+	BlockNumber uint64         `json:"blockNumber"`
+	Root        common.Hash    `json:"stateRoot"`
+	Accounts    []*AccountDiff `json:"accounts"`
+}
+
+type stateDiffMarshaling struct {
+	BlockNumber hexutil.Uint64
+}
+
+type AccountState struct {
+	Nonce    uint64      `json:"nonce"`
+	Balance  *big.Int    `json:"balance"`
+	CodeHash common.Hash `json:"codeHash"`
+}
+
+type accountStateMarshaling struct {
+	Nonce   hexutil.Uint64
+	Balance *hexutil.Big
+}
+
+type StorageDiff struct {
+	Key    common.Hash `json:"key"`
+	Before common.Hash `json:"before"`
+	After  common.Hash `json:"after"`
+}
+
+type AccountDiff struct {
+	Address    common.Address `json:"address" gencodec:"required"`
+	Before     *AccountState  `json:"before" rlp:"nil"`
+	After      *AccountState  `json:"after" rlp:"nil"`
+	Code       []byte         `json:"code,omitempty"`
+	Destructed bool           `json:"destructed"`
+	Storage    []*StorageDiff `json:"storage"`
+}
+
+type accountDiffMarshaling struct {
+	Code hexutil.Bytes
+}
+
+func (d *AccountDiff) Created() bool {
+	return d.Before == nil && d.After != nil
+}
+
+func (d *AccountDiff) Deleted() bool {
+	return d.Before != nil && d.After == nil
+}
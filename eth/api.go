@@ -155,6 +155,52 @@ func (api *PrivateMinerAPI) GetHashrate() uint64 {
 }
 
 
+type BuiltBlock struct {
+	Block    hexutil.Bytes    `json:"block"`
+	Hash     common.Hash      `json:"hash"`
+	SealHash common.Hash      `json:"sealHash"`
+	Receipts []*types.Receipt `json:"receipts"`
+}
+
+
+
+
+func (api *PrivateMinerAPI) BuildBlock(parentHash common.Hash, timestamp hexutil.Uint64, feeRecipient common.Address, extra *hexutil.Bytes) (*BuiltBlock, error) {
+	var data []byte
+	if extra != nil {
+		data = *extra
+	}
+	block, receipts, err := api.e.miner.BuildPayload(parentHash, uint64(timestamp), feeRecipient, data)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		return nil, err
+	}
+	return &BuiltBlock{
+		Block:    blob,
+		Hash:     block.Hash(),
+		SealHash: api.e.engine.SealHash(block.Header()),
+		Receipts: receipts,
+	}, nil
+}
+
+
+
+
+func (api *PrivateMinerAPI) SubmitSealedBlock(blob hexutil.Bytes) (common.Hash, error) {
+	block := new(types.Block)
+	if err := rlp.DecodeBytes(blob, block); err != nil {
+		return common.Hash{}, err
+	}
+	if err := api.e.miner.SubmitSealedBlock(block); err != nil {
+		return common.Hash{}, err
+	}
+	return block.Hash(), nil
+}
+
+
 
 type PrivateAdminAPI struct {
 	eth *Ethereum
@@ -303,6 +349,94 @@ func (api *PublicDebugAPI) DumpBlock(blockNr rpc.BlockNumber) (state.Dump, error
 
 
 
+func (api *PublicDebugAPI) GetStateDiff(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.StateDiff, error) {
+	block, err := api.blockByNumberOrHash(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	return api.eth.blockchain.GetStateDiff(block)
+}
+
+
+
+func (api *PublicDebugAPI) GetBlockWitness(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	block, err := api.blockByNumberOrHash(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	if block.NumberU64() == 0 {
+		return nil, errors.New("genesis block has no witness")
+	}
+	witness, err := api.eth.blockchain.GetBlockWitness(block)
+	if err != nil {
+		return nil, err
+	}
+	return core.EncodeBlockWitness(block, witness)
+}
+
+func (api *PublicDebugAPI) blockByNumberOrHash(blockNrOrHash rpc.BlockNumberOrHash) (*types.Block, error) {
+	var block *types.Block
+	if number, ok := blockNrOrHash.Number(); ok {
+		switch number {
+		case rpc.PendingBlockNumber:
+			return nil, errors.New("not available for pending block")
+		case rpc.LatestBlockNumber:
+			block = api.eth.blockchain.CurrentBlock()
+		default:
+			block = api.eth.blockchain.GetBlockByNumber(uint64(number))
+		}
+		if block == nil {
+			return nil, fmt.Errorf("block #%d not found", number)
+		}
+	} else if hash, ok := blockNrOrHash.Hash(); ok {
+		block = api.eth.blockchain.GetBlockByHash(hash)
+		if block == nil {
+			return nil, fmt.Errorf("block %s not found", hash.Hex())
+		}
+		if blockNrOrHash.RequireCanonical && api.eth.blockchain.GetCanonicalHash(block.NumberU64()) != hash {
+			return nil, fmt.Errorf("hash %s is not currently canonical", hash.Hex())
+		}
+	}
+	return block, nil
+}
+
+
+
+func (api *PublicDebugAPI) StateDiffs(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	if !api.eth.blockchain.StateDiffsEnabled() {
+		return &rpc.Subscription{}, errors.New("state diff persistence is disabled")
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		diffs := make(chan core.StateDiffEvent, 16)
+		diffsSub := api.eth.blockchain.SubscribeStateDiffEvent(diffs)
+		defer diffsSub.Unsubscribe()
+
+		for {
+			select {
+			case ev := <-diffs:
+				notifier.Notify(rpcSub.ID, &stateDiffNotification{Diff: ev.Diff, Removed: ev.Removed})
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
+
+type stateDiffNotification struct {
+	Diff    *types.StateDiff `json:"diff"`
+	Removed bool             `json:"removed"`
+}
+
+
 type PrivateDebugAPI struct {
 	eth *Ethereum
 }
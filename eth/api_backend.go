@@ -70,7 +70,10 @@ func (b *EthAPIBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumb
 	if number == rpc.LatestBlockNumber {
 		return b.eth.blockchain.CurrentBlock().Header(), nil
 	}
-	return b.eth.blockchain.GetHeaderByNumber(uint64(number)), nil
+	if header := b.eth.blockchain.GetHeaderByNumber(uint64(number)); header != nil {
+		return header, nil
+	}
+	return b.historyHeaderByNumber(uint64(number)), nil
 }
 
 func (b *EthAPIBackend) HeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.Header, error) {
@@ -80,6 +83,9 @@ func (b *EthAPIBackend) HeaderByNumberOrHash(ctx context.Context, blockNrOrHash
 	if hash, ok := blockNrOrHash.Hash(); ok {
 		header := b.eth.blockchain.GetHeaderByHash(hash)
 		if header == nil {
+			if header = b.historyHeaderByHash(hash); header != nil {
+				return header, nil
+			}
 			return nil, errors.New("header for hash not found")
 		}
 		if blockNrOrHash.RequireCanonical && b.eth.blockchain.GetCanonicalHash(header.Number.Uint64()) != hash {
@@ -91,7 +97,10 @@ func (b *EthAPIBackend) HeaderByNumberOrHash(ctx context.Context, blockNrOrHash
 }
 
 func (b *EthAPIBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
-	return b.eth.blockchain.GetHeaderByHash(hash), nil
+	if header := b.eth.blockchain.GetHeaderByHash(hash); header != nil {
+		return header, nil
+	}
+	return b.historyHeaderByHash(hash), nil
 }
 
 func (b *EthAPIBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error) {
@@ -104,11 +113,17 @@ func (b *EthAPIBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumbe
 	if number == rpc.LatestBlockNumber {
 		return b.eth.blockchain.CurrentBlock(), nil
 	}
-	return b.eth.blockchain.GetBlockByNumber(uint64(number)), nil
+	if block := b.eth.blockchain.GetBlockByNumber(uint64(number)); block != nil {
+		return block, nil
+	}
+	return b.historyBlockByNumber(uint64(number)), nil
 }
 
 func (b *EthAPIBackend) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
-	return b.eth.blockchain.GetBlockByHash(hash), nil
+	if block := b.eth.blockchain.GetBlockByHash(hash); block != nil {
+		return block, nil
+	}
+	return b.historyBlockByHash(hash), nil
 }
 
 func (b *EthAPIBackend) BlockByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.Block, error) {
@@ -118,6 +133,9 @@ func (b *EthAPIBackend) BlockByNumberOrHash(ctx context.Context, blockNrOrHash r
 	if hash, ok := blockNrOrHash.Hash(); ok {
 		header := b.eth.blockchain.GetHeaderByHash(hash)
 		if header == nil {
+			if block := b.historyBlockByHash(hash); block != nil {
+				return block, nil
+			}
 			return nil, errors.New("header for hash not found")
 		}
 		if blockNrOrHash.RequireCanonical && b.eth.blockchain.GetCanonicalHash(header.Number.Uint64()) != hash {
@@ -125,6 +143,9 @@ func (b *EthAPIBackend) BlockByNumberOrHash(ctx context.Context, blockNrOrHash r
 		}
 		block := b.eth.blockchain.GetBlock(hash, header.Number.Uint64())
 		if block == nil {
+			if block = b.historyBlockByHash(hash); block != nil {
+				return block, nil
+			}
 			return nil, errors.New("header found, but block body is missing")
 		}
 		return block, nil
@@ -188,7 +209,80 @@ func (b *EthAPIBackend) GetLogs(ctx context.Context, hash common.Hash) ([][]*typ
 }
 
 func (b *EthAPIBackend) GetTd(ctx context.Context, hash common.Hash) *big.Int {
-	return b.eth.blockchain.GetTdByHash(hash)
+	if td := b.eth.blockchain.GetTdByHash(hash); td != nil {
+		return td
+	}
+	number, ok := b.historyNumber(hash)
+	if !ok {
+		return nil
+	}
+	td, err := b.eth.history.GetTdByNumber(number)
+	if err != nil {
+		return nil
+	}
+	return td
+}
+
+
+
+
+
+func (b *EthAPIBackend) historyNumber(hash common.Hash) (uint64, bool) {
+	if b.eth.history == nil {
+		return 0, false
+	}
+	number := rawdb.ReadHeaderNumber(b.eth.chainDb, hash)
+	if number == nil || *number >= b.eth.historyLimit {
+		return 0, false
+	}
+	if b.eth.blockchain.GetCanonicalHash(*number) != hash {
+		return 0, false
+	}
+	return *number, true
+}
+
+func (b *EthAPIBackend) historyHeaderByNumber(number uint64) *types.Header {
+	if b.eth.history == nil || number >= b.eth.historyLimit {
+		return nil
+	}
+	header, err := b.eth.history.GetHeaderByNumber(number)
+	if err != nil {
+		return nil
+	}
+	return header
+}
+
+func (b *EthAPIBackend) historyHeaderByHash(hash common.Hash) *types.Header {
+	number, ok := b.historyNumber(hash)
+	if !ok {
+		return nil
+	}
+	if header := b.historyHeaderByNumber(number); header != nil && header.Hash() == hash {
+		return header
+	}
+	return nil
+}
+
+func (b *EthAPIBackend) historyBlockByNumber(number uint64) *types.Block {
+	if b.eth.history == nil || number >= b.eth.historyLimit {
+		return nil
+	}
+	block, err := b.eth.history.GetBlockByNumber(number)
+	if err != nil {
+		return nil
+	}
+	return block
+}
+
+func (b *EthAPIBackend) historyBlockByHash(hash common.Hash) *types.Block {
+	number, ok := b.historyNumber(hash)
+	if !ok {
+		return nil
+	}
+	if block := b.historyBlockByNumber(number); block != nil && block.Hash() == hash {
+		return block
+	}
+	return nil
 }
 
 func (b *EthAPIBackend) GetEVM(ctx context.Context, msg core.Message, state *state.StateDB, header *types.Header) (*vm.EVM, func() error, error) {
@@ -223,9 +317,18 @@ func (b *EthAPIBackend) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscri
 }
 
 func (b *EthAPIBackend) SendTx(ctx context.Context, signedTx *types.Transaction) error {
+	if b.eth.impersonator != nil {
+		if from, ok := b.eth.impersonator.Sender(signedTx); ok {
+			return b.eth.dev.sendImpersonated(from, signedTx)
+		}
+	}
 	return b.eth.txPool.AddLocal(signedTx)
 }
 
+func (b *EthAPIBackend) SendBundle(ctx context.Context, bundle *types.Bundle) error {
+	return b.eth.txPool.AddBundle(bundle)
+}
+
 func (b *EthAPIBackend) GetPoolTransactions() (types.Transactions, error) {
 	pending, err := b.eth.txPool.Pending()
 	if err != nil {
@@ -0,0 +1,247 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package eth
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var errDevEngine = errors.New("developer mode requires the clique engine")
+
+type devSnapshot struct {
+	number uint64
+	offset time.Duration
+}
+
+
+
+
+type impersonatedSigner struct {
+	types.Signer
+	from common.Address
+	hash common.Hash
+}
+
+func (s impersonatedSigner) Sender(tx *types.Transaction) (common.Address, error) {
+	if tx.Hash() == s.hash {
+		return s.from, nil
+	}
+	return s.Signer.Sender(tx)
+}
+
+func (s impersonatedSigner) Equal(other types.Signer) bool {
+	o, ok := other.(impersonatedSigner)
+	return ok && o.from == s.from && o.hash == s.hash && s.Signer.Equal(o.Signer)
+}
+
+type PrivateDevAPI struct {
+	e *Ethereum
+
+	snapshots map[uint64]devSnapshot
+	nextID    uint64
+	lock      sync.Mutex
+}
+
+func NewPrivateDevAPI(e *Ethereum) *PrivateDevAPI {
+	return &PrivateDevAPI{
+		e:         e,
+		snapshots: make(map[uint64]devSnapshot),
+	}
+}
+
+func (api *PrivateDevAPI) mine(mutate func(*types.Header, *state.StateDB) error) (*types.Block, error) {
+	return api.seal(api.e.miner.BuildBlock(mutate))
+}
+
+func (api *PrivateDevAPI) seal(block *types.Block, receipts []*types.Receipt, statedb *state.StateDB, err error) (*types.Block, error) {
+	if err != nil {
+		return nil, err
+	}
+	engine, ok := api.e.engine.(*clique.Clique)
+	if !ok {
+		return nil, errDevEngine
+	}
+	header := block.Header()
+	if err := engine.SignHeader(api.e.blockchain, header); err != nil {
+		return nil, err
+	}
+	block = block.WithSeal(header)
+	if err := api.e.miner.WriteBlock(block, receipts, statedb); err != nil {
+		return nil, err
+	}
+	log.Info("Mined developer block", "number", block.Number(), "hash", block.Hash(), "txs", len(block.Transactions()))
+	return block, nil
+}
+
+func (api *PrivateDevAPI) Mine(blocks *hexutil.Uint64) ([]common.Hash, error) {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+
+	n := uint64(1)
+	if blocks != nil {
+		n = uint64(*blocks)
+	}
+	hashes := make([]common.Hash, 0, n)
+	for i := uint64(0); i < n; i++ {
+		block, err := api.mine(nil)
+		if err != nil {
+			return hashes, err
+		}
+		hashes = append(hashes, block.Hash())
+	}
+	return hashes, nil
+}
+
+func (api *PrivateDevAPI) setTimeOffset(offset time.Duration) {
+	api.e.miner.SetTimeOffset(offset)
+	if engine, ok := api.e.engine.(*clique.Clique); ok {
+		engine.SetTimeOffset(offset)
+	}
+}
+
+func (api *PrivateDevAPI) SetNextBlockTimestamp(timestamp hexutil.Uint64) error {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+
+	if head := api.e.blockchain.CurrentBlock().Time(); uint64(timestamp) <= head {
+		return fmt.Errorf("timestamp %d is not after the head block timestamp %d", timestamp, head)
+	}
+	api.setTimeOffset(time.Duration(int64(timestamp)-time.Now().Unix()) * time.Second)
+	return nil
+}
+
+func (api *PrivateDevAPI) IncreaseTime(seconds hexutil.Uint64) hexutil.Uint64 {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+
+	offset := api.e.miner.TimeOffset() + time.Duration(seconds)*time.Second
+	api.setTimeOffset(offset)
+	return hexutil.Uint64(offset / time.Second)
+}
+
+func (api *PrivateDevAPI) Snapshot() hexutil.Uint64 {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+
+	api.nextID++
+	api.snapshots[api.nextID] = devSnapshot{
+		number: api.e.blockchain.CurrentBlock().NumberU64(),
+		offset: api.e.miner.TimeOffset(),
+	}
+	return hexutil.Uint64(api.nextID)
+}
+
+func (api *PrivateDevAPI) Revert(id hexutil.Uint64) (bool, error) {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+
+	snap, ok := api.snapshots[uint64(id)]
+	if !ok {
+		return false, nil
+	}
+	for n := range api.snapshots {
+		if n >= uint64(id) {
+			delete(api.snapshots, n)
+		}
+	}
+	if err := api.e.blockchain.SetHead(snap.number); err != nil {
+		return false, err
+	}
+	if engine, ok := api.e.engine.(*clique.Clique); ok {
+		if err := engine.RewindSigningHistory(snap.number); err != nil {
+			return false, err
+		}
+	}
+	api.setTimeOffset(snap.offset)
+	return true, nil
+}
+
+func (api *PrivateDevAPI) ImpersonateAccount(address common.Address) {
+	api.e.impersonator.Impersonate(address)
+}
+
+func (api *PrivateDevAPI) StopImpersonatingAccount(address common.Address) bool {
+	return api.e.impersonator.Stop(address)
+}
+
+func (api *PrivateDevAPI) modify(mutate func(*types.Header, *state.StateDB) error) (common.Hash, error) {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+
+	block, err := api.mine(mutate)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return block.Hash(), nil
+}
+
+func (api *PrivateDevAPI) SetBalance(address common.Address, balance hexutil.Big) (common.Hash, error) {
+	return api.modify(func(header *types.Header, statedb *state.StateDB) error {
+		statedb.SetBalance(address, (*big.Int)(&balance))
+		return nil
+	})
+}
+
+func (api *PrivateDevAPI) SetCode(address common.Address, code hexutil.Bytes) (common.Hash, error) {
+	return api.modify(func(header *types.Header, statedb *state.StateDB) error {
+		statedb.SetCode(address, code)
+		return nil
+	})
+}
+
+func (api *PrivateDevAPI) SetNonce(address common.Address, nonce hexutil.Uint64) (common.Hash, error) {
+	return api.modify(func(header *types.Header, statedb *state.StateDB) error {
+		statedb.SetNonce(address, uint64(nonce))
+		return nil
+	})
+}
+
+func (api *PrivateDevAPI) SetStorageAt(address common.Address, key common.Hash, value common.Hash) (common.Hash, error) {
+	return api.modify(func(header *types.Header, statedb *state.StateDB) error {
+		statedb.SetState(address, key, value)
+		return nil
+	})
+}
+
+func (api *PrivateDevAPI) sendImpersonated(from common.Address, tx *types.Transaction) error {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+
+	number := new(big.Int).Add(api.e.blockchain.CurrentBlock().Number(), common.Big1)
+	signer := impersonatedSigner{
+		Signer: types.MakeSigner(api.e.blockchain.Config(), number),
+		from:   from,
+		hash:   tx.Hash(),
+	}
+	block, err := api.seal(api.e.miner.BuildBlockWithTxs([]*types.Transaction{tx}, signer))
+	if err != nil {
+		return err
+	}
+	log.Info("Included impersonated transaction", "hash", tx.Hash(), "from", from, "number", block.Number())
+	return nil
+}
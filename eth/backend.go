@@ -22,13 +22,16 @@ import (
 	"fmt"
 	"math/big"
 	"runtime"
+	"sort"
 	"sync"
 	"sync/atomic"
 
 	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/impersonate"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/bft"
 	"github.com/ethereum/go-ethereum/consensus/clique"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
@@ -41,6 +44,7 @@ import (
 	"github.com/ethereum/go-ethereum/eth/gasprice"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/internal/era"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/miner"
@@ -66,9 +70,17 @@ type Ethereum struct {
 	
 	chainDb ethdb.Database 
 
+	
+	history      *era.Store
+	historyLimit uint64
+
 	eventMux       *event.TypeMux
 	engine         consensus.Engine
 	accountManager *accounts.Manager
+	impersonator   *impersonate.Backend
+	dev            *PrivateDevAPI
+
+	openSigningHistory func() (ethdb.Database, error)
 
 	bloomRequests     chan chan *bloombits.Retrieval 
 	bloomIndexer      *core.ChainIndexer             
@@ -118,6 +130,12 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 	if err != nil {
 		return nil, err
 	}
+	scheme, err := core.SetupStateScheme(chainDb, config.StateScheme)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Initialised state storage scheme", "scheme", scheme)
+
 	chainConfig, genesisHash, genesisErr := core.SetupGenesisBlock(chainDb, config.Genesis)
 	if _, ok := genesisErr.(*params.ConfigCompatError); genesisErr != nil && !ok {
 		return nil, genesisErr
@@ -138,6 +156,16 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 		bloomIndexer:      NewBloomIndexer(chainDb, params.BloomBitsBlocks, params.BloomConfirms),
 		p2pServer:         stack.Server(),
 	}
+	if config.Developer {
+		eth.impersonator = impersonate.NewBackend()
+		eth.accountManager.AddBackend(eth.impersonator)
+		eth.dev = NewPrivateDevAPI(eth)
+	}
+	if _, ok := eth.engine.(*clique.Clique); ok {
+		eth.openSigningHistory = func() (ethdb.Database, error) {
+			return stack.OpenDatabase("cliquehistory", 0, 0, "eth/db/cliquehistory/")
+		}
+	}
 
 	bcVersion := rawdb.ReadDatabaseVersion(chainDb)
 	var dbVer = "<nil>"
@@ -166,9 +194,13 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 			TrieCleanRejournal:  config.TrieCleanCacheRejournal,
 			TrieCleanNoPrefetch: config.NoPrefetch,
 			TrieDirtyLimit:      config.TrieDirtyCache,
-			TrieDirtyDisabled:   config.NoPruning,
+			TrieDirtyDisabled:   config.NoPruning || scheme == rawdb.PathScheme,
 			TrieTimeLimit:       config.TrieTimeout,
 			SnapshotLimit:       config.SnapshotCache,
+			TrieDiskGC:          config.StateGC,
+			StateDiffs:          config.StateDiffs,
+			BlockWitnesses:      config.BlockWitnesses,
+			ParallelWorkers:     config.ParallelWorkers,
 		}
 	)
 	eth.blockchain, err = core.NewBlockChain(chainDb, cacheConfig, chainConfig, eth.engine, vmConfig, eth.shouldPreserve, &config.TxLookupLimit)
@@ -183,6 +215,17 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 	}
 	eth.bloomIndexer.Start(eth.blockchain)
 
+	if config.HistoryDir != "" {
+		if eth.history, err = era.NewStore(config.HistoryDir, era.NetworkName(genesisHash), eth.blockchain); err != nil {
+			return nil, err
+		}
+		eth.historyLimit = oldestLocalBody(eth.blockchain)
+		if !eth.history.Empty() {
+			first, last := eth.history.Range()
+			log.Info("Opened history archive", "dir", config.HistoryDir, "first", first, "last", last, "local", eth.historyLimit)
+		}
+	}
+
 	if config.TxPool.Journal != "" {
 		config.TxPool.Journal = stack.ResolvePath(config.TxPool.Journal)
 	}
@@ -197,6 +240,9 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 	if eth.protocolManager, err = NewProtocolManager(chainConfig, checkpoint, config.SyncMode, config.NetworkId, eth.eventMux, eth.txPool, eth.engine, eth.blockchain, chainDb, cacheLimit, config.Whitelist); err != nil {
 		return nil, err
 	}
+	if clock := stack.Config().P2P.Clock; clock != nil {
+		eth.protocolManager.clock = clock
+	}
 	eth.miner = miner.New(eth, &config.Miner, chainConfig, eth.EventMux(), eth.engine, eth.isLocalBlock)
 	eth.miner.SetExtra(makeExtraData(config.Miner.ExtraData))
 
@@ -222,6 +268,17 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 	return eth, nil
 }
 
+
+
+
+func oldestLocalBody(chain *core.BlockChain) uint64 {
+	head := chain.CurrentBlock().NumberU64()
+	return 1 + uint64(sort.Search(int(head), func(i int) bool {
+		number := uint64(i) + 1
+		return chain.HasBlock(chain.GetCanonicalHash(number), number)
+	}))
+}
+
 func makeExtraData(extra []byte) []byte {
 	if len(extra) == 0 {
 		
@@ -245,6 +302,9 @@ func CreateConsensusEngine(stack *node.Node, chainConfig *params.ChainConfig, co
 	if chainConfig.Clique != nil {
 		return clique.New(chainConfig.Clique, db)
 	}
+	if chainConfig.BFT != nil {
+		return bft.New(chainConfig.BFT, db)
+	}
 	
 	switch config.PowMode {
 	case ethash.ModeFake:
@@ -266,6 +326,7 @@ func CreateConsensusEngine(stack *node.Node, chainConfig *params.ChainConfig, co
 			DatasetsInMem:    config.DatasetsInMem,
 			DatasetsOnDisk:   config.DatasetsOnDisk,
 			DatasetsLockMmap: config.DatasetsLockMmap,
+			StratumAddr:      config.StratumAddr,
 		}, notify, noverify)
 		engine.SetThreads(-1) 
 		return engine
@@ -281,6 +342,15 @@ func (s *Ethereum) APIs() []rpc.API {
 	apis = append(apis, s.engine.APIs(s.BlockChain())...)
 
 	
+	if s.config.Developer {
+		apis = append(apis, rpc.API{
+			Namespace: "dev",
+			Version:   "1.0",
+			Service:   s.dev,
+		})
+	}
+
+	
 	return append(apis, []rpc.API{
 		{
 			Namespace: "eth",
@@ -407,6 +477,9 @@ func (s *Ethereum) shouldPreserve(block *types.Block) bool {
 	if _, ok := s.engine.(*clique.Clique); ok {
 		return false
 	}
+	if _, ok := s.engine.(*bft.BFT); ok {
+		return false
+	}
 	return s.isLocalBlock(block)
 }
 
@@ -454,8 +527,20 @@ func (s *Ethereum) StartMining(threads int) error {
 				log.Error("Etherbase account unavailable locally", "err", err)
 				return fmt.Errorf("signer missing: %v", err)
 			}
+			if err := s.enableSigningHistory(clique); err != nil {
+				log.Error("Failed to open signing history", "err", err)
+				return fmt.Errorf("signing history unavailable: %v", err)
+			}
 			clique.Authorize(eb, wallet.SignData)
 		}
+		if bft, ok := s.engine.(*bft.BFT); ok {
+			wallet, err := s.accountManager.Find(accounts.Account{Address: eb})
+			if wallet == nil || err != nil {
+				log.Error("Etherbase account unavailable locally", "err", err)
+				return fmt.Errorf("signer missing: %v", err)
+			}
+			bft.Authorize(eb, wallet.SignData)
+		}
 		
 		
 		atomic.StoreUint32(&s.protocolManager.acceptTxs, 1)
@@ -467,6 +552,24 @@ func (s *Ethereum) StartMining(threads int) error {
 
 
 
+func (s *Ethereum) enableSigningHistory(engine *clique.Clique) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.openSigningHistory == nil {
+		return nil
+	}
+	db, err := s.openSigningHistory()
+	if err != nil {
+		return err
+	}
+	engine.SetSigningHistory(clique.NewSigningHistory(db))
+	s.openSigningHistory = nil
+	return nil
+}
+
+
+
 func (s *Ethereum) StopMining() {
 	
 	type threaded interface {
@@ -505,6 +608,9 @@ func (s *Ethereum) Protocols() []p2p.Protocol {
 		protos[i].Attributes = []enr.Entry{s.currentEthEntry()}
 		protos[i].DialCandidates = s.dialCandidates
 	}
+	if bft, ok := s.engine.(*bft.BFT); ok {
+		protos = append(protos, bft.Protocols()...)
+	}
 	return protos
 }
 
@@ -526,6 +632,10 @@ func (s *Ethereum) Start() error {
 	}
 	
 	s.protocolManager.Start(maxPeers)
+
+	if bft, ok := s.engine.(*bft.BFT); ok {
+		bft.Start(s.blockchain)
+	}
 	return nil
 }
 
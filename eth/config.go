@@ -120,8 +120,20 @@ type Config struct {
 	NoPruning  bool 
 	NoPrefetch bool 
 
+	StateScheme string `toml:",omitempty"` 
+	StateGC     bool   `toml:",omitempty"` 
+
 	TxLookupLimit uint64 `toml:",omitempty"` 
 
+	StateDiffs     bool `toml:",omitempty"`
+	BlockWitnesses bool `toml:",omitempty"`
+
+	ParallelWorkers int `toml:",omitempty"`
+
+	HistoryDir string `toml:",omitempty"`
+
+	Developer bool `toml:",omitempty"`
+
 	
 	Whitelist map[uint64]common.Hash `toml:"-"`
 
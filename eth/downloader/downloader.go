@@ -641,7 +641,7 @@ func (d *Downloader) fetchHead(p *peerConnection) (head *types.Header, pivot *ty
 	if mode == FastSync {
 		fetch = 2 
 	}
-	go p.peer.RequestHeadersByHash(latest, fetch, fsMinFullBlocks-1, true)
+	go p.peer.RequestHeadersByHash(p.newRequest(p.headerReqs), latest, fetch, fsMinFullBlocks-1, true)
 
 	ttl := d.requestTTL()
 	timeout := time.After(ttl)
@@ -801,7 +801,7 @@ func (d *Downloader) findAncestor(p *peerConnection, remoteHeader *types.Header)
 	from, count, skip, max := calculateRequestSpan(remoteHeight, localHeight)
 
 	p.log.Trace("Span searching for common ancestor", "count", count, "from", from, "skip", skip)
-	go p.peer.RequestHeadersByNumber(uint64(from), count, skip, false)
+	go p.peer.RequestHeadersByNumber(p.newRequest(p.headerReqs), uint64(from), count, skip, false)
 
 	
 	number, hash := uint64(0), common.Hash{}
@@ -892,7 +892,7 @@ func (d *Downloader) findAncestor(p *peerConnection, remoteHeader *types.Header)
 		ttl := d.requestTTL()
 		timeout := time.After(ttl)
 
-		go p.peer.RequestHeadersByNumber(check, 1, 0, false)
+		go p.peer.RequestHeadersByNumber(p.newRequest(p.headerReqs), check, 1, 0, false)
 
 		
 		for arrived := false; !arrived; {
@@ -987,10 +987,10 @@ func (d *Downloader) fetchHeaders(p *peerConnection, from uint64) error {
 
 		if skeleton {
 			p.log.Trace("Fetching skeleton headers", "count", MaxHeaderFetch, "from", from)
-			go p.peer.RequestHeadersByNumber(from+uint64(MaxHeaderFetch)-1, MaxSkeletonSize, MaxHeaderFetch-1, false)
+			go p.peer.RequestHeadersByNumber(p.newRequest(p.headerReqs), from+uint64(MaxHeaderFetch)-1, MaxSkeletonSize, MaxHeaderFetch-1, false)
 		} else {
 			p.log.Trace("Fetching full headers", "count", MaxHeaderFetch, "from", from)
-			go p.peer.RequestHeadersByNumber(from, MaxHeaderFetch, 0, false)
+			go p.peer.RequestHeadersByNumber(p.newRequest(p.headerReqs), from, MaxHeaderFetch, 0, false)
 		}
 	}
 	getNextPivot := func() {
@@ -1005,7 +1005,7 @@ func (d *Downloader) fetchHeaders(p *peerConnection, from uint64) error {
 		d.pivotLock.RUnlock()
 
 		p.log.Trace("Fetching next pivot header", "number", pivot+uint64(fsMinFullBlocks))
-		go p.peer.RequestHeadersByNumber(pivot+uint64(fsMinFullBlocks), 2, fsMinFullBlocks-9, false) 
+		go p.peer.RequestHeadersByNumber(p.newRequest(p.headerReqs), pivot+uint64(fsMinFullBlocks), 2, fsMinFullBlocks-9, false) 
 	}
 	
 	ancestor := from
@@ -1910,23 +1910,23 @@ func (d *Downloader) commitPivotBlock(result *fetchResult) error {
 
 
 
-func (d *Downloader) DeliverHeaders(id string, headers []*types.Header) (err error) {
-	return d.deliver(id, d.headerCh, &headerPack{id, headers}, headerInMeter, headerDropMeter)
+func (d *Downloader) DeliverHeaders(id string, reqID uint64, headers []*types.Header) (err error) {
+	return d.deliver(id, d.headerCh, &headerPack{id, reqID, headers}, headerInMeter, headerDropMeter)
 }
 
 
-func (d *Downloader) DeliverBodies(id string, transactions [][]*types.Transaction, uncles [][]*types.Header) (err error) {
-	return d.deliver(id, d.bodyCh, &bodyPack{id, transactions, uncles}, bodyInMeter, bodyDropMeter)
+func (d *Downloader) DeliverBodies(id string, reqID uint64, transactions [][]*types.Transaction, uncles [][]*types.Header) (err error) {
+	return d.deliver(id, d.bodyCh, &bodyPack{id, reqID, transactions, uncles}, bodyInMeter, bodyDropMeter)
 }
 
 
-func (d *Downloader) DeliverReceipts(id string, receipts [][]*types.Receipt) (err error) {
-	return d.deliver(id, d.receiptCh, &receiptPack{id, receipts}, receiptInMeter, receiptDropMeter)
+func (d *Downloader) DeliverReceipts(id string, reqID uint64, receipts [][]*types.Receipt) (err error) {
+	return d.deliver(id, d.receiptCh, &receiptPack{id, reqID, receipts}, receiptInMeter, receiptDropMeter)
 }
 
 
-func (d *Downloader) DeliverNodeData(id string, data [][]byte) (err error) {
-	return d.deliver(id, d.stateCh, &statePack{id, data}, stateInMeter, stateDropMeter)
+func (d *Downloader) DeliverNodeData(id string, reqID uint64, data [][]byte) (err error) {
+	return d.deliver(id, d.stateCh, &statePack{id, reqID, data}, stateInMeter, stateDropMeter)
 }
 
 
@@ -1939,6 +1939,10 @@ func (d *Downloader) deliver(id string, destCh chan dataPack, packet dataPack, i
 		}
 	}()
 	
+	if p := d.peers.Peer(id); p != nil && !p.expects(packet) {
+		return errStaleDelivery
+	}
+	
 	d.cancelLock.RLock()
 	cancel := d.cancelCh
 	d.cancelLock.RUnlock()
@@ -20,6 +20,8 @@
 package downloader
 
 import (
+	"crypto/rand"
+	"encoding/binary"
 	"errors"
 	"math"
 	"math/big"
@@ -65,6 +67,13 @@ type peerConnection struct {
 	receiptStarted time.Time 
 	stateStarted   time.Time 
 
+	
+	
+	headerReqs  map[uint64]struct{} 
+	blockReqs   map[uint64]struct{} 
+	receiptReqs map[uint64]struct{} 
+	stateReqs   map[uint64]struct{} 
+
 	lacking map[common.Hash]struct{} 
 
 	peer Peer
@@ -77,16 +86,16 @@ type peerConnection struct {
 
 type LightPeer interface {
 	Head() (common.Hash, *big.Int)
-	RequestHeadersByHash(common.Hash, int, int, bool) error
-	RequestHeadersByNumber(uint64, int, int, bool) error
+	RequestHeadersByHash(uint64, common.Hash, int, int, bool) error
+	RequestHeadersByNumber(uint64, uint64, int, int, bool) error
 }
 
 
 type Peer interface {
 	LightPeer
-	RequestBodies([]common.Hash) error
-	RequestReceipts([]common.Hash) error
-	RequestNodeData([]common.Hash) error
+	RequestBodies(uint64, []common.Hash) error
+	RequestReceipts(uint64, []common.Hash) error
+	RequestNodeData(uint64, []common.Hash) error
 }
 
 
@@ -95,27 +104,31 @@ type lightPeerWrapper struct {
 }
 
 func (w *lightPeerWrapper) Head() (common.Hash, *big.Int) { return w.peer.Head() }
-func (w *lightPeerWrapper) RequestHeadersByHash(h common.Hash, amount int, skip int, reverse bool) error {
-	return w.peer.RequestHeadersByHash(h, amount, skip, reverse)
+func (w *lightPeerWrapper) RequestHeadersByHash(id uint64, h common.Hash, amount int, skip int, reverse bool) error {
+	return w.peer.RequestHeadersByHash(id, h, amount, skip, reverse)
 }
-func (w *lightPeerWrapper) RequestHeadersByNumber(i uint64, amount int, skip int, reverse bool) error {
-	return w.peer.RequestHeadersByNumber(i, amount, skip, reverse)
+func (w *lightPeerWrapper) RequestHeadersByNumber(id uint64, i uint64, amount int, skip int, reverse bool) error {
+	return w.peer.RequestHeadersByNumber(id, i, amount, skip, reverse)
 }
-func (w *lightPeerWrapper) RequestBodies([]common.Hash) error {
+func (w *lightPeerWrapper) RequestBodies(uint64, []common.Hash) error {
 	panic("RequestBodies not supported in light client mode sync")
 }
-func (w *lightPeerWrapper) RequestReceipts([]common.Hash) error {
+func (w *lightPeerWrapper) RequestReceipts(uint64, []common.Hash) error {
 	panic("RequestReceipts not supported in light client mode sync")
 }
-func (w *lightPeerWrapper) RequestNodeData([]common.Hash) error {
+func (w *lightPeerWrapper) RequestNodeData(uint64, []common.Hash) error {
 	panic("RequestNodeData not supported in light client mode sync")
 }
 
 
 func newPeerConnection(id string, version int, peer Peer, logger log.Logger) *peerConnection {
 	return &peerConnection{
-		id:      id,
-		lacking: make(map[common.Hash]struct{}),
+		id:          id,
+		headerReqs:  make(map[uint64]struct{}),
+		blockReqs:   make(map[uint64]struct{}),
+		receiptReqs: make(map[uint64]struct{}),
+		stateReqs:   make(map[uint64]struct{}),
+		lacking:     make(map[common.Hash]struct{}),
 		peer:    peer,
 		version: version,
 		log:     logger,
@@ -137,6 +150,11 @@ func (p *peerConnection) Reset() {
 	p.receiptThroughput = 0
 	p.stateThroughput = 0
 
+	for _, pending := range []map[uint64]struct{}{p.headerReqs, p.blockReqs, p.receiptReqs, p.stateReqs} {
+		for id := range pending {
+			delete(pending, id)
+		}
+	}
 	p.lacking = make(map[common.Hash]struct{})
 }
 
@@ -147,9 +165,7 @@ func (p *peerConnection) FetchHeaders(from uint64, count int) error {
 		return errAlreadyFetching
 	}
 	p.headerStarted = time.Now()
-
-	
-	go p.peer.RequestHeadersByNumber(from, count, 0, false)
+	go p.peer.RequestHeadersByNumber(p.newRequest(p.headerReqs), from, count, 0, false)
 
 	return nil
 }
@@ -161,14 +177,14 @@ func (p *peerConnection) FetchBodies(request *fetchRequest) error {
 		return errAlreadyFetching
 	}
 	p.blockStarted = time.Now()
-
+	id := p.newRequest(p.blockReqs)
 	go func() {
 		
 		hashes := make([]common.Hash, 0, len(request.Headers))
 		for _, header := range request.Headers {
 			hashes = append(hashes, header.Hash())
 		}
-		p.peer.RequestBodies(hashes)
+		p.peer.RequestBodies(id, hashes)
 	}()
 
 	return nil
@@ -181,14 +197,14 @@ func (p *peerConnection) FetchReceipts(request *fetchRequest) error {
 		return errAlreadyFetching
 	}
 	p.receiptStarted = time.Now()
-
+	id := p.newRequest(p.receiptReqs)
 	go func() {
 		
 		hashes := make([]common.Hash, 0, len(request.Headers))
 		for _, header := range request.Headers {
 			hashes = append(hashes, header.Hash())
 		}
-		p.peer.RequestReceipts(hashes)
+		p.peer.RequestReceipts(id, hashes)
 	}()
 
 	return nil
@@ -202,13 +218,62 @@ func (p *peerConnection) FetchNodeData(hashes []common.Hash) error {
 	}
 	p.stateStarted = time.Now()
 
-	go p.peer.RequestNodeData(hashes)
+	go p.peer.RequestNodeData(p.newRequest(p.stateReqs), hashes)
 
 	return nil
 }
 
 
 
+func (p *peerConnection) newRequest(pending map[uint64]struct{}) uint64 {
+	id := GenRequestID()
+
+	p.lock.Lock()
+	pending[id] = struct{}{}
+	p.lock.Unlock()
+	return id
+}
+
+
+
+
+
+func (p *peerConnection) expects(packet dataPack) bool {
+	id := packet.RequestId()
+	if id == 0 {
+		return true
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var pending map[uint64]struct{}
+	switch packet.(type) {
+	case *headerPack:
+		pending = p.headerReqs
+	case *bodyPack:
+		pending = p.blockReqs
+	case *receiptPack:
+		pending = p.receiptReqs
+	case *statePack:
+		pending = p.stateReqs
+	}
+	if _, ok := pending[id]; !ok {
+		return false
+	}
+	delete(pending, id)
+	return true
+}
+
+
+
+func GenRequestID() uint64 {
+	var rnd [8]byte
+	rand.Read(rnd[:])
+	return binary.BigEndian.Uint64(rnd[:])
+}
+
+
+
 
 func (p *peerConnection) SetHeadersIdle(delivered int, deliveryTime time.Time) {
 	p.setIdle(deliveryTime.Sub(p.headerStarted), delivered, &p.headerThroughput, &p.headerIdle)
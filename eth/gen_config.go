@@ -23,7 +23,14 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		DiscoveryURLs           []string
 		NoPruning               bool
 		NoPrefetch              bool
+		StateScheme             string                 `toml:",omitempty"`
+		StateGC                 bool                   `toml:",omitempty"`
 		TxLookupLimit           uint64                 `toml:",omitempty"`
+		StateDiffs              bool                   `toml:",omitempty"`
+		BlockWitnesses          bool                   `toml:",omitempty"`
+		ParallelWorkers         int                    `toml:",omitempty"`
+		HistoryDir              string                 `toml:",omitempty"`
+		Developer               bool                   `toml:",omitempty"`
 		Whitelist               map[uint64]common.Hash `toml:"-"`
 		LightServ               int                    `toml:",omitempty"`
 		LightIngress            int                    `toml:",omitempty"`
@@ -63,7 +70,14 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.DiscoveryURLs = c.DiscoveryURLs
 	enc.NoPruning = c.NoPruning
 	enc.NoPrefetch = c.NoPrefetch
+	enc.StateScheme = c.StateScheme
+	enc.StateGC = c.StateGC
 	enc.TxLookupLimit = c.TxLookupLimit
+	enc.StateDiffs = c.StateDiffs
+	enc.BlockWitnesses = c.BlockWitnesses
+	enc.ParallelWorkers = c.ParallelWorkers
+	enc.HistoryDir = c.HistoryDir
+	enc.Developer = c.Developer
 	enc.Whitelist = c.Whitelist
 	enc.LightServ = c.LightServ
 	enc.LightIngress = c.LightIngress
@@ -107,7 +121,14 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		DiscoveryURLs           []string
 		NoPruning               *bool
 		NoPrefetch              *bool
+		StateScheme             *string                `toml:",omitempty"`
+		StateGC                 *bool                  `toml:",omitempty"`
 		TxLookupLimit           *uint64                `toml:",omitempty"`
+		StateDiffs              *bool                  `toml:",omitempty"`
+		BlockWitnesses          *bool                  `toml:",omitempty"`
+		ParallelWorkers         *int                   `toml:",omitempty"`
+		HistoryDir              *string                `toml:",omitempty"`
+		Developer               *bool                  `toml:",omitempty"`
 		Whitelist               map[uint64]common.Hash `toml:"-"`
 		LightServ               *int                   `toml:",omitempty"`
 		LightIngress            *int                   `toml:",omitempty"`
@@ -162,9 +183,30 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.NoPrefetch != nil {
 		c.NoPrefetch = *dec.NoPrefetch
 	}
+	if dec.StateScheme != nil {
+		c.StateScheme = *dec.StateScheme
+	}
+	if dec.StateGC != nil {
+		c.StateGC = *dec.StateGC
+	}
 	if dec.TxLookupLimit != nil {
 		c.TxLookupLimit = *dec.TxLookupLimit
 	}
+	if dec.StateDiffs != nil {
+		c.StateDiffs = *dec.StateDiffs
+	}
+	if dec.BlockWitnesses != nil {
+		c.BlockWitnesses = *dec.BlockWitnesses
+	}
+	if dec.ParallelWorkers != nil {
+		c.ParallelWorkers = *dec.ParallelWorkers
+	}
+	if dec.HistoryDir != nil {
+		c.HistoryDir = *dec.HistoryDir
+	}
+	if dec.Developer != nil {
+		c.Developer = *dec.Developer
+	}
 	if dec.Whitelist != nil {
 		c.Whitelist = dec.Whitelist
 	}
@@ -27,6 +27,7 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/mclock"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/forkid"
@@ -50,14 +51,42 @@ const (
 	
 	
 	txChanSize = 4096
+
+	
+	violationPenalty  = -50
+	offencePenalty    = -25
+	checkpointPenalty = -100
+	checkpointReward  = 10
 )
 
 var (
 	syncChallengeTimeout = 15 * time.Second 
 )
 
+
+
+
+type protocolError struct {
+	code errCode
+	msg  string
+}
+
+func (e *protocolError) Error() string {
+	return fmt.Sprintf("%v - %v", e.code, e.msg)
+}
+
+
+
+func (e *protocolError) violation() bool {
+	switch e.code {
+	case ErrMsgTooLarge, ErrDecode, ErrInvalidMsgCode, ErrExtraStatusMsg:
+		return true
+	}
+	return false
+}
+
 func errResp(code errCode, format string, v ...interface{}) error {
-	return fmt.Errorf("%v - %v", code, fmt.Sprintf(format, v...))
+	return &protocolError{code: code, msg: fmt.Sprintf(format, v...)}
 }
 
 type ProtocolManager struct {
@@ -92,6 +121,7 @@ type ProtocolManager struct {
 	quitSync chan struct{}
 
 	chainSync *chainSyncer
+	clock     mclock.Clock
 	wg        sync.WaitGroup
 	peerWG    sync.WaitGroup
 
@@ -114,6 +144,7 @@ func NewProtocolManager(config *params.ChainConfig, checkpoint *params.TrustedCh
 		whitelist:  whitelist,
 		txsyncCh:   make(chan *txsync),
 		quitSync:   make(chan struct{}),
+		clock:      mclock.System{},
 	}
 
 	if mode == downloader.FullSync {
@@ -153,7 +184,7 @@ func NewProtocolManager(config *params.ChainConfig, checkpoint *params.TrustedCh
 	if atomic.LoadUint32(&manager.fastSync) == 1 {
 		stateBloom = trie.NewSyncBloom(uint64(cacheLimit), chaindb)
 	}
-	manager.downloader = downloader.New(manager.checkpointNumber, chaindb, stateBloom, manager.eventMux, blockchain, nil, manager.removePeer)
+	manager.downloader = downloader.New(manager.checkpointNumber, chaindb, stateBloom, manager.eventMux, blockchain, nil, manager.dropOffender)
 
 	
 	validator := func(header *types.Header) error {
@@ -188,7 +219,7 @@ func NewProtocolManager(config *params.ChainConfig, checkpoint *params.TrustedCh
 		}
 		return n, err
 	}
-	manager.blockFetcher = fetcher.NewBlockFetcher(false, nil, blockchain.GetBlockByHash, validator, manager.BroadcastBlock, heighter, nil, inserter, manager.removePeer)
+	manager.blockFetcher = fetcher.NewBlockFetcher(false, nil, blockchain.GetBlockByHash, validator, manager.BroadcastBlock, heighter, nil, inserter, manager.dropOffender)
 
 	fetchTx := func(peer string, hashes []common.Hash) error {
 		p := manager.peers.Peer(peer)
@@ -229,6 +260,16 @@ func (pm *ProtocolManager) makeProtocol(version uint) p2p.Protocol {
 	}
 }
 
+
+
+
+func (pm *ProtocolManager) dropOffender(id string) {
+	if p := pm.peers.Peer(id); p != nil {
+		p.Report(offencePenalty, "dropped by block sync")
+	}
+	pm.removePeer(id)
+}
+
 func (pm *ProtocolManager) removePeer(id string) {
 	
 	peer := pm.peers.Peer(id)
@@ -322,6 +363,7 @@ func (pm *ProtocolManager) handle(p *peer) error {
 	forkID := forkid.NewID(pm.blockchain.Config(), pm.blockchain.Genesis().Hash(), pm.blockchain.CurrentHeader().Number.Uint64())
 	if err := p.Handshake(pm.networkID, td, hash, genesis.Hash(), forkID, pm.forkFilter); err != nil {
 		p.Log().Debug("Ethereum handshake failed", "err", err)
+		pm.reportViolation(p, err)
 		return err
 	}
 
@@ -345,11 +387,11 @@ func (pm *ProtocolManager) handle(p *peer) error {
 	
 	if pm.checkpointHash != (common.Hash{}) {
 		
-		if err := p.RequestHeadersByNumber(pm.checkpointNumber, 1, 0, false); err != nil {
+		if err := p.RequestHeadersByNumber(downloader.GenRequestID(), pm.checkpointNumber, 1, 0, false); err != nil {
 			return err
 		}
 		
-		p.syncDrop = time.AfterFunc(syncChallengeTimeout, func() {
+		p.syncDrop = p.Clock().AfterFunc(syncChallengeTimeout, func() {
 			p.Log().Warn("Checkpoint challenge timed out, dropping", "addr", p.RemoteAddr(), "type", p.Name())
 			pm.removePeer(p.id)
 		})
@@ -363,7 +405,7 @@ func (pm *ProtocolManager) handle(p *peer) error {
 	}
 	
 	for number := range pm.whitelist {
-		if err := p.RequestHeadersByNumber(number, 1, 0, false); err != nil {
+		if err := p.RequestHeadersByNumber(downloader.GenRequestID(), number, 1, 0, false); err != nil {
 			return err
 		}
 	}
@@ -371,6 +413,7 @@ func (pm *ProtocolManager) handle(p *peer) error {
 	for {
 		if err := pm.handleMsg(p); err != nil {
 			p.Log().Debug("Ethereum message handling failed", "err", err)
+			pm.reportViolation(p, err)
 			return err
 		}
 	}
@@ -378,6 +421,14 @@ func (pm *ProtocolManager) handle(p *peer) error {
 
 
 
+func (pm *ProtocolManager) reportViolation(p *peer, err error) {
+	if perr, ok := err.(*protocolError); ok && perr.violation() {
+		p.Report(violationPenalty, perr.Error())
+	}
+}
+
+
+
 func (pm *ProtocolManager) handleMsg(p *peer) error {
 	
 	msg, err := p.rw.ReadMsg()
@@ -399,7 +450,8 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 	case msg.Code == GetBlockHeadersMsg:
 		
 		var query getBlockHeadersData
-		if err := msg.Decode(&query); err != nil {
+		reqID, err := p.decode(msg, &query)
+		if err != nil {
 			return errResp(ErrDecode, "%v: %v", msg, err)
 		}
 		hashMode := query.Origin.Hash != (common.Hash{})
@@ -481,14 +533,19 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 				query.Origin.Number += query.Skip + 1
 			}
 		}
-		return p.SendBlockHeaders(headers)
+		return p.SendBlockHeaders(reqID, headers)
 
 	case msg.Code == BlockHeadersMsg:
 		
 		var headers []*types.Header
-		if err := msg.Decode(&headers); err != nil {
+		reqID, err := p.decode(msg, &headers)
+		if err != nil {
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
+		if !p.resolveRequest(reqID, BlockHeadersMsg) {
+			p.Log().Debug("Dropping unsolicited headers", "id", reqID, "count", len(headers))
+			return nil
+		}
 		
 		if len(headers) == 0 && p.syncDrop != nil {
 			
@@ -514,23 +571,27 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 
 				
 				if headers[0].Hash() != pm.checkpointHash {
+					p.Report(checkpointPenalty, "checkpoint hash mismatch")
 					return errors.New("checkpoint hash mismatch")
 				}
+				p.Report(checkpointReward, "checkpoint verified")
 				return nil
 			}
 			
 			if want, ok := pm.whitelist[headers[0].Number.Uint64()]; ok {
 				if hash := headers[0].Hash(); want != hash {
 					p.Log().Info("Whitelist mismatch, dropping peer", "number", headers[0].Number.Uint64(), "hash", hash, "want", want)
+					p.Report(checkpointPenalty, "whitelist block mismatch")
 					return errors.New("whitelist block mismatch")
 				}
+				p.Report(checkpointReward, "whitelist block verified")
 				p.Log().Debug("Whitelist block verified", "number", headers[0].Number.Uint64(), "hash", want)
 			}
 			
 			headers = pm.blockFetcher.FilterHeaders(p.id, headers, time.Now())
 		}
 		if len(headers) > 0 || !filter {
-			err := pm.downloader.DeliverHeaders(p.id, headers)
+			err := pm.downloader.DeliverHeaders(p.id, reqID, headers)
 			if err != nil {
 				log.Debug("Failed to deliver headers", "err", err)
 			}
@@ -538,8 +599,8 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 
 	case msg.Code == GetBlockBodiesMsg:
 		
-		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
-		if _, err := msgStream.List(); err != nil {
+		msgStream, reqID, err := p.decodeStream(msg)
+		if err != nil {
 			return err
 		}
 		
@@ -561,14 +622,19 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 				bytes += len(data)
 			}
 		}
-		return p.SendBlockBodiesRLP(bodies)
+		return p.SendBlockBodiesRLP(reqID, bodies)
 
 	case msg.Code == BlockBodiesMsg:
 		
 		var request blockBodiesData
-		if err := msg.Decode(&request); err != nil {
+		reqID, err := p.decode(msg, &request)
+		if err != nil {
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
+		if !p.resolveRequest(reqID, BlockBodiesMsg) {
+			p.Log().Debug("Dropping unsolicited block bodies", "id", reqID, "count", len(request))
+			return nil
+		}
 		
 		transactions := make([][]*types.Transaction, len(request))
 		uncles := make([][]*types.Header, len(request))
@@ -583,7 +649,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			transactions, uncles = pm.blockFetcher.FilterBodies(p.id, transactions, uncles, time.Now())
 		}
 		if len(transactions) > 0 || len(uncles) > 0 || !filter {
-			err := pm.downloader.DeliverBodies(p.id, transactions, uncles)
+			err := pm.downloader.DeliverBodies(p.id, reqID, transactions, uncles)
 			if err != nil {
 				log.Debug("Failed to deliver bodies", "err", err)
 			}
@@ -591,8 +657,8 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 
 	case p.version >= eth63 && msg.Code == GetNodeDataMsg:
 		
-		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
-		if _, err := msgStream.List(); err != nil {
+		msgStream, reqID, err := p.decodeStream(msg)
+		if err != nil {
 			return err
 		}
 		
@@ -625,23 +691,28 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 				bytes += len(entry)
 			}
 		}
-		return p.SendNodeData(data)
+		return p.SendNodeData(reqID, data)
 
 	case p.version >= eth63 && msg.Code == NodeDataMsg:
 		
 		var data [][]byte
-		if err := msg.Decode(&data); err != nil {
+		reqID, err := p.decode(msg, &data)
+		if err != nil {
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
+		if !p.resolveRequest(reqID, NodeDataMsg) {
+			p.Log().Debug("Dropping unsolicited state data", "id", reqID, "count", len(data))
+			return nil
+		}
 		
-		if err := pm.downloader.DeliverNodeData(p.id, data); err != nil {
+		if err := pm.downloader.DeliverNodeData(p.id, reqID, data); err != nil {
 			log.Debug("Failed to deliver node state data", "err", err)
 		}
 
 	case p.version >= eth63 && msg.Code == GetReceiptsMsg:
 		
-		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
-		if _, err := msgStream.List(); err != nil {
+		msgStream, reqID, err := p.decodeStream(msg)
+		if err != nil {
 			return err
 		}
 		
@@ -672,16 +743,21 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 				bytes += len(encoded)
 			}
 		}
-		return p.SendReceiptsRLP(receipts)
+		return p.SendReceiptsRLP(reqID, receipts)
 
 	case p.version >= eth63 && msg.Code == ReceiptsMsg:
 		
 		var receipts [][]*types.Receipt
-		if err := msg.Decode(&receipts); err != nil {
+		reqID, err := p.decode(msg, &receipts)
+		if err != nil {
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
+		if !p.resolveRequest(reqID, ReceiptsMsg) {
+			p.Log().Debug("Dropping unsolicited receipts", "id", reqID, "count", len(receipts))
+			return nil
+		}
 		
-		if err := pm.downloader.DeliverReceipts(p.id, receipts); err != nil {
+		if err := pm.downloader.DeliverReceipts(p.id, reqID, receipts); err != nil {
 			log.Debug("Failed to deliver receipts", "err", err)
 		}
 
@@ -702,7 +778,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			}
 		}
 		for _, block := range unknown {
-			pm.blockFetcher.Notify(p.id, block.Hash, block.Number, time.Now(), p.RequestOneHeader, p.RequestBodies)
+			pm.blockFetcher.Notify(p.id, block.Hash, block.Number, time.Now(), p.RequestOneHeader, p.requestBodies)
 		}
 
 	case msg.Code == NewBlockMsg:
@@ -759,8 +835,8 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 
 	case msg.Code == GetPooledTransactionsMsg && p.version >= eth65:
 		
-		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
-		if _, err := msgStream.List(); err != nil {
+		msgStream, reqID, err := p.decodeStream(msg)
+		if err != nil {
 			return err
 		}
 		
@@ -791,7 +867,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 				bytes += len(encoded)
 			}
 		}
-		return p.SendPooledTransactionsRLP(hashes, txs)
+		return p.SendPooledTransactionsRLP(reqID, hashes, txs)
 
 	case msg.Code == TransactionMsg || (msg.Code == PooledTransactionsMsg && p.version >= eth65):
 		
@@ -800,7 +876,16 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		}
 		
 		var txs []*types.Transaction
-		if err := msg.Decode(&txs); err != nil {
+		if msg.Code == PooledTransactionsMsg {
+			reqID, err := p.decode(msg, &txs)
+			if err != nil {
+				return errResp(ErrDecode, "msg %v: %v", msg, err)
+			}
+			if !p.resolveRequest(reqID, PooledTransactionsMsg) {
+				p.Log().Debug("Dropping unsolicited transactions", "id", reqID, "count", len(txs))
+				return nil
+			}
+		} else if err := msg.Decode(&txs); err != nil {
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
 		for i, tx := range txs {
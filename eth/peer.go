@@ -17,6 +17,7 @@
 package eth
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"math/big"
@@ -25,8 +26,10 @@ import (
 
 	mapset "github.com/deckarep/golang-set"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/mclock"
 	"github.com/ethereum/go-ethereum/core/forkid"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/downloader"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/rlp"
 )
@@ -60,9 +63,23 @@ const (
 	maxQueuedBlockAnns = 4
 
 	handshakeTimeout = 5 * time.Second
+
+	
+	
+	maxPendingRequests = 1024
+	pendingRequestTTL  = time.Minute
 )
 
 
+var responseCodes = map[uint64]uint64{
+	GetBlockHeadersMsg:       BlockHeadersMsg,
+	GetBlockBodiesMsg:        BlockBodiesMsg,
+	GetNodeDataMsg:           NodeDataMsg,
+	GetReceiptsMsg:           ReceiptsMsg,
+	GetPooledTransactionsMsg: PooledTransactionsMsg,
+}
+
+
 func max(a, b int) int {
 	if a > b {
 		return a
@@ -84,6 +101,13 @@ type propEvent struct {
 	td    *big.Int
 }
 
+
+type pendingRequest struct {
+	req  uint64    
+	code uint64    
+	sent time.Time 
+}
+
 type peer struct {
 	id string
 
@@ -91,7 +115,7 @@ type peer struct {
 	rw p2p.MsgReadWriter
 
 	version  int         
-	syncDrop *time.Timer 
+	syncDrop mclock.Timer 
 
 	head common.Hash
 	td   *big.Int
@@ -106,6 +130,9 @@ type peer struct {
 	txAnnounce  chan []common.Hash                   
 	getPooledTx func(common.Hash) *types.Transaction 
 
+	requests map[uint64]*pendingRequest 
+	reqLock  sync.Mutex
+
 	term chan struct{} 
 }
 
@@ -122,6 +149,7 @@ func newPeer(version int, p *p2p.Peer, rw p2p.MsgReadWriter, getPooledTx func(ha
 		txBroadcast:     make(chan []common.Hash),
 		txAnnounce:      make(chan []common.Hash),
 		getPooledTx:     getPooledTx,
+		requests:        make(map[uint64]*pendingRequest),
 		term:            make(chan struct{}),
 	}
 }
@@ -417,7 +445,7 @@ func (p *peer) AsyncSendPooledTransactionHashes(hashes []common.Hash) {
 
 
 
-func (p *peer) SendPooledTransactionsRLP(hashes []common.Hash, txs []rlp.RawValue) error {
+func (p *peer) SendPooledTransactionsRLP(id uint64, hashes []common.Hash, txs []rlp.RawValue) error {
 	
 	for p.knownTxs.Cardinality() > max(0, maxKnownTxs-len(hashes)) {
 		p.knownTxs.Pop()
@@ -425,7 +453,7 @@ func (p *peer) SendPooledTransactionsRLP(hashes []common.Hash, txs []rlp.RawValu
 	for _, hash := range hashes {
 		p.knownTxs.Add(hash)
 	}
-	return p2p.Send(p.rw, PooledTransactionsMsg, txs)
+	return p.send(PooledTransactionsMsg, id, txs)
 }
 
 
@@ -488,78 +516,191 @@ func (p *peer) AsyncSendNewBlock(block *types.Block, td *big.Int) {
 }
 
 
-func (p *peer) SendBlockHeaders(headers []*types.Header) error {
-	return p2p.Send(p.rw, BlockHeadersMsg, headers)
+func (p *peer) SendBlockHeaders(id uint64, headers []*types.Header) error {
+	return p.send(BlockHeadersMsg, id, headers)
 }
 
 
-func (p *peer) SendBlockBodies(bodies []*blockBody) error {
-	return p2p.Send(p.rw, BlockBodiesMsg, blockBodiesData(bodies))
+func (p *peer) SendBlockBodies(id uint64, bodies []*blockBody) error {
+	return p.send(BlockBodiesMsg, id, blockBodiesData(bodies))
 }
 
 
 
-func (p *peer) SendBlockBodiesRLP(bodies []rlp.RawValue) error {
-	return p2p.Send(p.rw, BlockBodiesMsg, bodies)
+func (p *peer) SendBlockBodiesRLP(id uint64, bodies []rlp.RawValue) error {
+	return p.send(BlockBodiesMsg, id, bodies)
 }
 
 
 
-func (p *peer) SendNodeData(data [][]byte) error {
-	return p2p.Send(p.rw, NodeDataMsg, data)
+func (p *peer) SendNodeData(id uint64, data [][]byte) error {
+	return p.send(NodeDataMsg, id, data)
 }
 
 
 
-func (p *peer) SendReceiptsRLP(receipts []rlp.RawValue) error {
-	return p2p.Send(p.rw, ReceiptsMsg, receipts)
+func (p *peer) SendReceiptsRLP(id uint64, receipts []rlp.RawValue) error {
+	return p.send(ReceiptsMsg, id, receipts)
 }
 
 
 
 func (p *peer) RequestOneHeader(hash common.Hash) error {
 	p.Log().Debug("Fetching single header", "hash", hash)
-	return p2p.Send(p.rw, GetBlockHeadersMsg, &getBlockHeadersData{Origin: hashOrNumber{Hash: hash}, Amount: uint64(1), Skip: uint64(0), Reverse: false})
+	return p.sendRequest(GetBlockHeadersMsg, downloader.GenRequestID(), &getBlockHeadersData{Origin: hashOrNumber{Hash: hash}, Amount: uint64(1), Skip: uint64(0), Reverse: false})
 }
 
 
 
-func (p *peer) RequestHeadersByHash(origin common.Hash, amount int, skip int, reverse bool) error {
+func (p *peer) RequestHeadersByHash(id uint64, origin common.Hash, amount int, skip int, reverse bool) error {
 	p.Log().Debug("Fetching batch of headers", "count", amount, "fromhash", origin, "skip", skip, "reverse", reverse)
-	return p2p.Send(p.rw, GetBlockHeadersMsg, &getBlockHeadersData{Origin: hashOrNumber{Hash: origin}, Amount: uint64(amount), Skip: uint64(skip), Reverse: reverse})
+	return p.sendRequest(GetBlockHeadersMsg, id, &getBlockHeadersData{Origin: hashOrNumber{Hash: origin}, Amount: uint64(amount), Skip: uint64(skip), Reverse: reverse})
 }
 
 
 
-func (p *peer) RequestHeadersByNumber(origin uint64, amount int, skip int, reverse bool) error {
+func (p *peer) RequestHeadersByNumber(id uint64, origin uint64, amount int, skip int, reverse bool) error {
 	p.Log().Debug("Fetching batch of headers", "count", amount, "fromnum", origin, "skip", skip, "reverse", reverse)
-	return p2p.Send(p.rw, GetBlockHeadersMsg, &getBlockHeadersData{Origin: hashOrNumber{Number: origin}, Amount: uint64(amount), Skip: uint64(skip), Reverse: reverse})
+	return p.sendRequest(GetBlockHeadersMsg, id, &getBlockHeadersData{Origin: hashOrNumber{Number: origin}, Amount: uint64(amount), Skip: uint64(skip), Reverse: reverse})
 }
 
 
 
-func (p *peer) RequestBodies(hashes []common.Hash) error {
+func (p *peer) RequestBodies(id uint64, hashes []common.Hash) error {
 	p.Log().Debug("Fetching batch of block bodies", "count", len(hashes))
-	return p2p.Send(p.rw, GetBlockBodiesMsg, hashes)
+	return p.sendRequest(GetBlockBodiesMsg, id, hashes)
+}
+
+
+
+func (p *peer) requestBodies(hashes []common.Hash) error {
+	return p.RequestBodies(downloader.GenRequestID(), hashes)
 }
 
 
 
-func (p *peer) RequestNodeData(hashes []common.Hash) error {
+func (p *peer) RequestNodeData(id uint64, hashes []common.Hash) error {
 	p.Log().Debug("Fetching batch of state data", "count", len(hashes))
-	return p2p.Send(p.rw, GetNodeDataMsg, hashes)
+	return p.sendRequest(GetNodeDataMsg, id, hashes)
 }
 
 
-func (p *peer) RequestReceipts(hashes []common.Hash) error {
+func (p *peer) RequestReceipts(id uint64, hashes []common.Hash) error {
 	p.Log().Debug("Fetching batch of receipts", "count", len(hashes))
-	return p2p.Send(p.rw, GetReceiptsMsg, hashes)
+	return p.sendRequest(GetReceiptsMsg, id, hashes)
 }
 
 
 func (p *peer) RequestTxs(hashes []common.Hash) error {
 	p.Log().Debug("Fetching batch of transactions", "count", len(hashes))
-	return p2p.Send(p.rw, GetPooledTransactionsMsg, hashes)
+	return p.sendRequest(GetPooledTransactionsMsg, downloader.GenRequestID(), hashes)
+}
+
+
+
+func (p *peer) send(code uint64, id uint64, data interface{}) error {
+	if p.version < eth66 {
+		return p2p.Send(p.rw, code, data)
+	}
+	return p2p.Send(p.rw, code, []interface{}{id, data})
+}
+
+
+
+func (p *peer) sendRequest(code uint64, id uint64, data interface{}) error {
+	p.trackRequest(id, code)
+	return p.send(code, id, data)
+}
+
+func (p *peer) trackRequest(id uint64, code uint64) {
+	p.reqLock.Lock()
+	defer p.reqLock.Unlock()
+
+	now := time.Now()
+	if len(p.requests) >= maxPendingRequests {
+		var (
+			oldest   uint64
+			oldestAt time.Time
+		)
+		for reqID, req := range p.requests {
+			if now.Sub(req.sent) > pendingRequestTTL {
+				delete(p.requests, reqID)
+				continue
+			}
+			if oldestAt.IsZero() || req.sent.Before(oldestAt) {
+				oldest, oldestAt = reqID, req.sent
+			}
+		}
+		if len(p.requests) >= maxPendingRequests {
+			delete(p.requests, oldest)
+		}
+	}
+	p.requests[id] = &pendingRequest{req: code, code: responseCodes[code], sent: now}
+}
+
+
+
+
+func (p *peer) resolveRequest(id uint64, code uint64) bool {
+	p.reqLock.Lock()
+	defer p.reqLock.Unlock()
+
+	if p.version < eth66 {
+		var (
+			now    = time.Now()
+			oldest *pendingRequest
+		)
+		for reqID, req := range p.requests {
+			if now.Sub(req.sent) > pendingRequestTTL {
+				delete(p.requests, reqID)
+				continue
+			}
+			if req.code == code && (oldest == nil || req.sent.Before(oldest.sent)) {
+				id, oldest = reqID, req
+			}
+		}
+		if oldest == nil {
+			return true
+		}
+	}
+	req, ok := p.requests[id]
+	if !ok || req.code != code {
+		return false
+	}
+	delete(p.requests, id)
+	p.Peer.MarkLatency(p2p.Cap{Name: protocolName, Version: uint(p.version)}, req.req, time.Since(req.sent))
+	return true
+}
+
+
+
+func (p *peer) decode(msg p2p.Msg, val interface{}) (uint64, error) {
+	if p.version < eth66 {
+		return 0, msg.Decode(val)
+	}
+	var packet packet66
+	if err := msg.Decode(&packet); err != nil {
+		return 0, err
+	}
+	return packet.RequestId, rlp.DecodeBytes(packet.Data, val)
+}
+
+
+
+
+func (p *peer) decodeStream(msg p2p.Msg) (*rlp.Stream, uint64, error) {
+	if p.version < eth66 {
+		stream := rlp.NewStream(msg.Payload, uint64(msg.Size))
+		_, err := stream.List()
+		return stream, 0, err
+	}
+	var packet packet66
+	if err := msg.Decode(&packet); err != nil {
+		return nil, 0, err
+	}
+	stream := rlp.NewStream(bytes.NewReader(packet.Data), uint64(len(packet.Data)))
+	_, err := stream.List()
+	return stream, packet.RequestId, err
 }
 
 
@@ -605,7 +746,7 @@ func (p *peer) Handshake(network uint64, td *big.Int, head common.Hash, genesis
 			panic(fmt.Sprintf("unsupported eth protocol version: %d", p.version))
 		}
 	}()
-	timeout := time.NewTimer(handshakeTimeout)
+	timeout := p.Clock().NewTimer(handshakeTimeout)
 	defer timeout.Stop()
 	for i := 0; i < 2; i++ {
 		select {
@@ -613,7 +754,7 @@ func (p *peer) Handshake(network uint64, td *big.Int, head common.Hash, genesis
 			if err != nil {
 				return err
 			}
-		case <-timeout.C:
+		case <-timeout.C():
 			return p2p.DiscReadTimeout
 		}
 	}
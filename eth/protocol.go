@@ -34,16 +34,17 @@ const (
 	eth63 = 63
 	eth64 = 64
 	eth65 = 65
+	eth66 = 66
 )
 
 
 const protocolName = "eth"
 
 
-var ProtocolVersions = []uint{eth65, eth64, eth63}
+var ProtocolVersions = []uint{eth66, eth65, eth64, eth63}
 
 
-var protocolLengths = map[uint]uint64{eth65: 17, eth64: 17, eth63: 17}
+var protocolLengths = map[uint]uint64{eth66: 17, eth65: 17, eth64: 17, eth63: 17}
 
 const protocolMaxMsgSize = 10 * 1024 * 1024 
 
@@ -219,3 +220,10 @@ type blockBody struct {
 
 
 type blockBodiesData []*blockBody
+
+
+
+type packet66 struct {
+	RequestId uint64
+	Data      rlp.RawValue
+}
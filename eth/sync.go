@@ -23,6 +23,7 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/mclock"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/eth/downloader"
@@ -157,7 +158,7 @@ func (pm *ProtocolManager) txsyncLoop64() {
 
 type chainSyncer struct {
 	pm          *ProtocolManager
-	force       *time.Timer
+	force       mclock.ChanTimer
 	forced      bool 
 	peerEventCh chan struct{}
 	doneCh      chan error 
@@ -202,7 +203,7 @@ func (cs *chainSyncer) loop() {
 
 	
 	
-	cs.force = time.NewTimer(forceSyncCycle)
+	cs.force = cs.pm.clock.NewTimer(forceSyncCycle)
 	defer cs.force.Stop()
 
 	for {
@@ -217,7 +218,7 @@ func (cs *chainSyncer) loop() {
 			cs.doneCh = nil
 			cs.force.Reset(forceSyncCycle)
 			cs.forced = false
-		case <-cs.force.C:
+		case <-cs.force.C():
 			cs.forced = true
 
 		case <-cs.pm.quitSync:
@@ -0,0 +1,120 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package era
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const accumulatorDepth = 13
+
+func accumulatorLeaf(hash common.Hash, td *big.Int) common.Hash {
+	return crypto.Keccak256Hash(hash[:], common.BigToHash(td).Bytes())
+}
+
+func merkleLayers(leaves []common.Hash) [][]common.Hash {
+	layers := [][]common.Hash{leaves}
+	zero := common.Hash{}
+	for depth := 0; depth < accumulatorDepth; depth++ {
+		prev := layers[depth]
+		next := make([]common.Hash, (len(prev)+1)/2)
+		for i := range next {
+			right := zero
+			if 2*i+1 < len(prev) {
+				right = prev[2*i+1]
+			}
+			next[i] = crypto.Keccak256Hash(prev[2*i][:], right[:])
+		}
+		if len(next) == 0 {
+			next = []common.Hash{crypto.Keccak256Hash(zero[:], zero[:])}
+		}
+		layers = append(layers, next)
+		zero = crypto.Keccak256Hash(zero[:], zero[:])
+	}
+	return layers
+}
+
+func mixInLength(root common.Hash, length int) common.Hash {
+	var count [32]byte
+	binary.BigEndian.PutUint64(count[24:], uint64(length))
+	return crypto.Keccak256Hash(root[:], count[:])
+}
+
+func ComputeAccumulator(hashes []common.Hash, tds []*big.Int) (common.Hash, error) {
+	if len(hashes) != len(tds) {
+		return common.Hash{}, errors.New("hash and total difficulty count mismatch")
+	}
+	if len(hashes) > MaxSize {
+		return common.Hash{}, errors.New("too many blocks for a single epoch")
+	}
+	leaves := make([]common.Hash, len(hashes))
+	for i := range hashes {
+		leaves[i] = accumulatorLeaf(hashes[i], tds[i])
+	}
+	layers := merkleLayers(leaves)
+	return mixInLength(layers[accumulatorDepth][0], len(leaves)), nil
+}
+
+func buildProof(hashes []common.Hash, tds []*big.Int, index int) []common.Hash {
+	leaves := make([]common.Hash, len(hashes))
+	for i := range hashes {
+		leaves[i] = accumulatorLeaf(hashes[i], tds[i])
+	}
+	var (
+		layers = merkleLayers(leaves)
+		proof  = make([]common.Hash, accumulatorDepth)
+		zero   = common.Hash{}
+	)
+	for depth := 0; depth < accumulatorDepth; depth++ {
+		sibling := index ^ 1
+		if sibling < len(layers[depth]) {
+			proof[depth] = layers[depth][sibling]
+		} else {
+			proof[depth] = zero
+		}
+		zero = crypto.Keccak256Hash(zero[:], zero[:])
+		index >>= 1
+	}
+	return proof
+}
+
+func VerifyProof(root common.Hash, count int, index int, hash common.Hash, td *big.Int, proof []common.Hash) error {
+	if len(proof) != accumulatorDepth {
+		return errors.New("invalid proof length")
+	}
+	if index < 0 || index >= count {
+		return errors.New("index out of range")
+	}
+	node := accumulatorLeaf(hash, td)
+	for depth := 0; depth < accumulatorDepth; depth++ {
+		if index&1 == 0 {
+			node = crypto.Keccak256Hash(node[:], proof[depth][:])
+		} else {
+			node = crypto.Keccak256Hash(proof[depth][:], node[:])
+		}
+		index >>= 1
+	}
+	if mixInLength(node, count) != root {
+		return errors.New("accumulator root mismatch")
+	}
+	return nil
+}
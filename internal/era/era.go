@@ -0,0 +1,451 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package era
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/golang/snappy"
+)
+
+const (
+	TypeVersion     uint16 = 0x3265
+	TypeHeader      uint16 = 0x03
+	TypeBody        uint16 = 0x04
+	TypeReceipts    uint16 = 0x05
+	TypeTD          uint16 = 0x06
+	TypeAccumulator uint16 = 0x07
+	TypeBlockIndex  uint16 = 0x3266
+
+	MaxSize = 8192
+)
+
+func Filename(network string, epoch int, root common.Hash) string {
+	return fmt.Sprintf("%s-%05d-%s.era1", network, epoch, common.Bytes2Hex(root[:4]))
+}
+
+func ReadDir(dir, network string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		last  = -1
+		files []string
+	)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".era1" {
+			continue
+		}
+		parts := strings.Split(strings.TrimSuffix(entry.Name(), ".era1"), "-")
+		if len(parts) != 3 || parts[0] != network {
+			continue
+		}
+		epoch, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed era1 filename: %s", entry.Name())
+		}
+		if int(epoch) == last {
+			return nil, fmt.Errorf("duplicate epoch %d", epoch)
+		}
+		last = int(epoch)
+		files = append(files, entry.Name())
+	}
+	return files, nil
+}
+
+type Builder struct {
+	w        *Writer
+	written  int64
+	start    *uint64
+	offsets  []int64
+	hashes   []common.Hash
+	tds      []*big.Int
+	prevHash common.Hash
+}
+
+func NewBuilder(w io.Writer) *Builder {
+	return &Builder{w: NewWriter(w)}
+}
+
+func (b *Builder) write(typ uint16, value []byte) error {
+	n, err := b.w.Write(typ, value)
+	b.written += int64(n)
+	return err
+}
+
+func (b *Builder) writeCompressed(typ uint16, value interface{}) error {
+	enc, err := rlp.EncodeToBytes(value)
+	if err != nil {
+		return err
+	}
+	return b.write(typ, snappy.Encode(nil, enc))
+}
+
+func (b *Builder) Add(block *types.Block, receipts types.Receipts, td *big.Int) error {
+	if len(b.offsets) >= MaxSize {
+		return fmt.Errorf("exceeding maximum epoch size of %d blocks", MaxSize)
+	}
+	if b.start == nil {
+		if err := b.write(TypeVersion, nil); err != nil {
+			return err
+		}
+		number := block.NumberU64()
+		b.start = &number
+	} else {
+		if block.NumberU64() != *b.start+uint64(len(b.offsets)) {
+			return fmt.Errorf("non-contiguous block: have %d, want %d", block.NumberU64(), *b.start+uint64(len(b.offsets)))
+		}
+		if block.ParentHash() != b.prevHash {
+			return fmt.Errorf("block %d parent hash mismatch", block.NumberU64())
+		}
+	}
+	b.offsets = append(b.offsets, b.written)
+
+	if err := b.writeCompressed(TypeHeader, block.Header()); err != nil {
+		return err
+	}
+	if err := b.writeCompressed(TypeBody, block.Body()); err != nil {
+		return err
+	}
+	if err := b.writeCompressed(TypeReceipts, receipts); err != nil {
+		return err
+	}
+	if err := b.write(TypeTD, common.BigToHash(td).Bytes()); err != nil {
+		return err
+	}
+	b.hashes = append(b.hashes, block.Hash())
+	b.tds = append(b.tds, new(big.Int).Set(td))
+	b.prevHash = block.Hash()
+	return nil
+}
+
+func (b *Builder) Finalize() (common.Hash, error) {
+	if b.start == nil {
+		return common.Hash{}, errors.New("empty epoch")
+	}
+	root, err := ComputeAccumulator(b.hashes, b.tds)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if err := b.write(TypeAccumulator, root.Bytes()); err != nil {
+		return common.Hash{}, err
+	}
+	base := b.written
+	index := make([]byte, 16+8*len(b.offsets))
+	binary.LittleEndian.PutUint64(index, *b.start)
+	for i, offset := range b.offsets {
+		binary.LittleEndian.PutUint64(index[8+i*8:], uint64(offset-base))
+	}
+	binary.LittleEndian.PutUint64(index[8+len(b.offsets)*8:], uint64(len(b.offsets)))
+	if err := b.write(TypeBlockIndex, index); err != nil {
+		return common.Hash{}, err
+	}
+	return root, nil
+}
+
+type ReadAtCloser interface {
+	io.ReaderAt
+	io.Closer
+}
+
+type Era struct {
+	f       ReadAtCloser
+	r       *Reader
+	start   uint64
+	base    int64
+	offsets []int64
+}
+
+func Open(filename string) (*Era, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	e, err := From(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
+func From(f ReadAtCloser, size int64) (*Era, error) {
+	var count [8]byte
+	if size < headerSize+24 {
+		return nil, errors.New("file too short")
+	}
+	if _, err := f.ReadAt(count[:], size-8); err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint64(count[:])
+	if n == 0 || n > MaxSize {
+		return nil, fmt.Errorf("invalid block count %d", n)
+	}
+	e := &Era{
+		f:       f,
+		r:       NewReader(f),
+		base:    size - headerSize - 16 - 8*int64(n),
+		offsets: make([]int64, n),
+	}
+	index, _, err := e.r.ReadTypedAt(e.base, TypeBlockIndex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block index: %v", err)
+	}
+	if len(index) != 16+8*int(n) {
+		return nil, errors.New("invalid block index length")
+	}
+	e.start = binary.LittleEndian.Uint64(index)
+	for i := range e.offsets {
+		e.offsets[i] = e.base + int64(binary.LittleEndian.Uint64(index[8+i*8:]))
+		if e.offsets[i] < 0 || e.offsets[i] >= e.base {
+			return nil, fmt.Errorf("invalid offset for block %d", e.start+uint64(i))
+		}
+	}
+	return e, nil
+}
+
+func (e *Era) Close() error {
+	return e.f.Close()
+}
+
+func (e *Era) Start() uint64 {
+	return e.start
+}
+
+func (e *Era) Count() uint64 {
+	return uint64(len(e.offsets))
+}
+
+func (e *Era) Contains(number uint64) bool {
+	return number >= e.start && number < e.start+e.Count()
+}
+
+func (e *Era) readCompressed(off int64, typ uint16, val interface{}) (int64, error) {
+	blob, n, err := e.r.ReadTypedAt(off, typ)
+	if err != nil {
+		return 0, err
+	}
+	enc, err := snappy.Decode(nil, blob)
+	if err != nil {
+		return 0, err
+	}
+	return n, rlp.DecodeBytes(enc, val)
+}
+
+func (e *Era) offset(number uint64) (int64, error) {
+	if !e.Contains(number) {
+		return 0, fmt.Errorf("block %d out of range [%d, %d)", number, e.start, e.start+e.Count())
+	}
+	return e.offsets[number-e.start], nil
+}
+
+func (e *Era) skip(off int64, entries int) (int64, error) {
+	for i := 0; i < entries; i++ {
+		_, n, err := e.r.ReadHeaderAt(off)
+		if err != nil {
+			return 0, err
+		}
+		off += headerSize + int64(n)
+	}
+	return off, nil
+}
+
+func (e *Era) GetHeaderByNumber(number uint64) (*types.Header, error) {
+	off, err := e.offset(number)
+	if err != nil {
+		return nil, err
+	}
+	header := new(types.Header)
+	if _, err := e.readCompressed(off, TypeHeader, header); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+func (e *Era) GetBlockByNumber(number uint64) (*types.Block, error) {
+	off, err := e.offset(number)
+	if err != nil {
+		return nil, err
+	}
+	header := new(types.Header)
+	n, err := e.readCompressed(off, TypeHeader, header)
+	if err != nil {
+		return nil, err
+	}
+	body := new(types.Body)
+	if _, err := e.readCompressed(off+n, TypeBody, body); err != nil {
+		return nil, err
+	}
+	return types.NewBlockWithHeader(header).WithBody(body.Transactions, body.Uncles), nil
+}
+
+func (e *Era) GetReceiptsByNumber(number uint64) (types.Receipts, error) {
+	off, err := e.offset(number)
+	if err != nil {
+		return nil, err
+	}
+	if off, err = e.skip(off, 2); err != nil {
+		return nil, err
+	}
+	var receipts types.Receipts
+	if _, err := e.readCompressed(off, TypeReceipts, &receipts); err != nil {
+		return nil, err
+	}
+	return receipts, nil
+}
+
+func (e *Era) GetTdByNumber(number uint64) (*big.Int, error) {
+	off, err := e.offset(number)
+	if err != nil {
+		return nil, err
+	}
+	if off, err = e.skip(off, 3); err != nil {
+		return nil, err
+	}
+	blob, _, err := e.r.ReadTypedAt(off, TypeTD)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(blob), nil
+}
+
+func (e *Era) Accumulator() (common.Hash, error) {
+	last, err := e.offset(e.start + e.Count() - 1)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	off, err := e.skip(last, 4)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	blob, _, err := e.r.ReadTypedAt(off, TypeAccumulator)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if len(blob) != common.HashLength {
+		return common.Hash{}, errors.New("invalid accumulator length")
+	}
+	return common.BytesToHash(blob), nil
+}
+
+func (e *Era) hashesAndTds() ([]common.Hash, []*big.Int, error) {
+	var (
+		hashes = make([]common.Hash, e.Count())
+		tds    = make([]*big.Int, e.Count())
+	)
+	for i := range hashes {
+		header, err := e.GetHeaderByNumber(e.start + uint64(i))
+		if err != nil {
+			return nil, nil, err
+		}
+		td, err := e.GetTdByNumber(e.start + uint64(i))
+		if err != nil {
+			return nil, nil, err
+		}
+		hashes[i], tds[i] = header.Hash(), td
+	}
+	return hashes, tds, nil
+}
+
+func (e *Era) Proof(number uint64) ([]common.Hash, error) {
+	if !e.Contains(number) {
+		return nil, fmt.Errorf("block %d out of range", number)
+	}
+	hashes, tds, err := e.hashesAndTds()
+	if err != nil {
+		return nil, err
+	}
+	return buildProof(hashes, tds, int(number-e.start)), nil
+}
+
+func (e *Era) Verify() error {
+	var (
+		hashes = make([]common.Hash, 0, e.Count())
+		tds    = make([]*big.Int, 0, e.Count())
+		prev   *types.Header
+		prevTd *big.Int
+	)
+	for number := e.start; number < e.start+e.Count(); number++ {
+		block, err := e.GetBlockByNumber(number)
+		if err != nil {
+			return fmt.Errorf("block %d: %v", number, err)
+		}
+		header := block.Header()
+		if header.Number.Uint64() != number {
+			return fmt.Errorf("block %d: header number mismatch: %d", number, header.Number)
+		}
+		if prev != nil && header.ParentHash != prev.Hash() {
+			return fmt.Errorf("block %d: parent hash mismatch", number)
+		}
+		if hash := types.DeriveSha(block.Transactions(), trie.NewStackTrie(nil)); hash != header.TxHash {
+			return fmt.Errorf("block %d: transaction root mismatch: have %x, want %x", number, hash, header.TxHash)
+		}
+		if hash := types.CalcUncleHash(block.Uncles()); hash != header.UncleHash {
+			return fmt.Errorf("block %d: uncle hash mismatch: have %x, want %x", number, hash, header.UncleHash)
+		}
+		receipts, err := e.GetReceiptsByNumber(number)
+		if err != nil {
+			return fmt.Errorf("block %d: %v", number, err)
+		}
+		if len(receipts) != len(block.Transactions()) {
+			return fmt.Errorf("block %d: receipt count mismatch: have %d, want %d", number, len(receipts), len(block.Transactions()))
+		}
+		if hash := types.DeriveSha(receipts, trie.NewStackTrie(nil)); hash != header.ReceiptHash {
+			return fmt.Errorf("block %d: receipt root mismatch: have %x, want %x", number, hash, header.ReceiptHash)
+		}
+		td, err := e.GetTdByNumber(number)
+		if err != nil {
+			return fmt.Errorf("block %d: %v", number, err)
+		}
+		if prevTd != nil && new(big.Int).Add(prevTd, header.Difficulty).Cmp(td) != 0 {
+			return fmt.Errorf("block %d: total difficulty mismatch", number)
+		}
+		hashes, tds = append(hashes, header.Hash()), append(tds, td)
+		prev, prevTd = header, td
+	}
+	want, err := e.Accumulator()
+	if err != nil {
+		return err
+	}
+	have, err := ComputeAccumulator(hashes, tds)
+	if err != nil {
+		return err
+	}
+	if have != want {
+		return fmt.Errorf("accumulator mismatch: have %x, want %x", have, want)
+	}
+	return nil
+}
@@ -0,0 +1,362 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package era
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+type testChain map[uint64]common.Hash
+
+func (c testChain) GetCanonicalHash(number uint64) common.Hash {
+	return c[number]
+}
+
+type testEpoch struct {
+	blocks   []*types.Block
+	receipts []types.Receipts
+	tds      []*big.Int
+}
+
+func newTestEpoch(n int) *testEpoch {
+	var (
+		key, _  = crypto.GenerateKey()
+		addr    = crypto.PubkeyToAddress(key.PublicKey)
+		db      = rawdb.NewMemoryDatabase()
+		signer  = types.HomesteadSigner{}
+		genesis = (&core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  core.GenesisAlloc{addr: {Balance: big.NewInt(params.Ether)}},
+		}).MustCommit(db)
+	)
+	blocks, receipts := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, n-1, func(i int, gen *core.BlockGen) {
+		if i%3 == 0 {
+			return
+		}
+		tx, _ := types.SignTx(types.NewTransaction(gen.TxNonce(addr), common.Address{0x01}, big.NewInt(1), params.TxGas, big.NewInt(1), nil), signer, key)
+		gen.AddTx(tx)
+	})
+	epoch := &testEpoch{
+		blocks:   append([]*types.Block{genesis}, blocks...),
+		receipts: append([]types.Receipts{nil}, receipts...),
+	}
+	td := new(big.Int)
+	for _, block := range epoch.blocks {
+		td = new(big.Int).Add(td, block.Difficulty())
+		epoch.tds = append(epoch.tds, td)
+	}
+	return epoch
+}
+
+func (te *testEpoch) chain() testChain {
+	chain := make(testChain)
+	for _, block := range te.blocks {
+		chain[block.NumberU64()] = block.Hash()
+	}
+	return chain
+}
+
+func (te *testEpoch) build(t *testing.T, receipts []types.Receipts, tds []*big.Int) ([]byte, common.Hash) {
+	var buf bytes.Buffer
+	builder := NewBuilder(&buf)
+	for i, block := range te.blocks {
+		if err := builder.Add(block, receipts[i], tds[i]); err != nil {
+			t.Fatalf("failed to add block %d: %v", i, err)
+		}
+	}
+	root, err := builder.Finalize()
+	if err != nil {
+		t.Fatalf("failed to finalize epoch: %v", err)
+	}
+	return buf.Bytes(), root
+}
+
+func writeTestEra(t *testing.T, dir string, blob []byte, root common.Hash) string {
+	path := filepath.Join(dir, Filename("test", 0, root))
+	if err := ioutil.WriteFile(path, blob, 0644); err != nil {
+		t.Fatalf("failed to write era file: %v", err)
+	}
+	return path
+}
+
+func TestEraRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "era-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	te := newTestEpoch(128)
+	blob, root := te.build(t, te.receipts, te.tds)
+	path := writeTestEra(t, dir, blob, root)
+
+	e, err := Open(path)
+	if err != nil {
+		t.Fatalf("failed to open era file: %v", err)
+	}
+	defer e.Close()
+
+	if e.Start() != 0 || e.Count() != uint64(len(te.blocks)) {
+		t.Fatalf("wrong range: have [%d, +%d), want [0, +%d)", e.Start(), e.Count(), len(te.blocks))
+	}
+	if have, err := e.Accumulator(); err != nil || have != root {
+		t.Fatalf("accumulator mismatch: have %x (%v), want %x", have, err, root)
+	}
+	for i, want := range te.blocks {
+		number := want.NumberU64()
+		header, err := e.GetHeaderByNumber(number)
+		if err != nil || header.Hash() != want.Hash() {
+			t.Fatalf("block %d: header mismatch: %v", number, err)
+		}
+		block, err := e.GetBlockByNumber(number)
+		if err != nil || block.Hash() != want.Hash() {
+			t.Fatalf("block %d: block mismatch: %v", number, err)
+		}
+		if have, want := types.DeriveSha(block.Transactions(), trie.NewStackTrie(nil)), want.TxHash(); have != want {
+			t.Fatalf("block %d: body mismatch: have %x, want %x", number, have, want)
+		}
+		receipts, err := e.GetReceiptsByNumber(number)
+		if err != nil || len(receipts) != len(te.receipts[i]) {
+			t.Fatalf("block %d: receipts mismatch: have %d (%v), want %d", number, len(receipts), err, len(te.receipts[i]))
+		}
+		if td, err := e.GetTdByNumber(number); err != nil || td.Cmp(te.tds[i]) != 0 {
+			t.Fatalf("block %d: td mismatch: have %v (%v), want %v", number, td, err, te.tds[i])
+		}
+		proof, err := e.Proof(number)
+		if err != nil {
+			t.Fatalf("block %d: failed to build proof: %v", number, err)
+		}
+		if err := VerifyProof(root, int(e.Count()), i, want.Hash(), te.tds[i], proof); err != nil {
+			t.Fatalf("block %d: proof rejected: %v", number, err)
+		}
+	}
+	if _, err := e.GetBlockByNumber(e.Count()); err == nil {
+		t.Fatal("block past the epoch returned")
+	}
+	if err := e.Verify(); err != nil {
+		t.Fatalf("failed to verify era file: %v", err)
+	}
+	if err := verifyAgainstChain(e, te.chain()); err != nil {
+		t.Fatalf("failed to verify era file against chain: %v", err)
+	}
+
+
+	store, err := NewStore(dir, "test", te.chain())
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	if first, last := store.Range(); first != 0 || last != uint64(len(te.blocks)-1) {
+		t.Fatalf("wrong store range: have [%d, %d], want [0, %d]", first, last, len(te.blocks)-1)
+	}
+	if block, err := store.GetBlockByNumber(100); err != nil || block.Hash() != te.blocks[100].Hash() {
+		t.Fatalf("store block mismatch: %v", err)
+	}
+	if _, err := store.GetHeaderByNumber(uint64(len(te.blocks))); err == nil {
+		t.Fatal("store returned block past the archive")
+	}
+}
+
+func TestEraCorrupted(t *testing.T) {
+	te := newTestEpoch(32)
+	blob, root := te.build(t, te.receipts, te.tds)
+
+	open := func(t *testing.T, blob []byte) *Era {
+		e, err := From(nopCloser{bytes.NewReader(blob)}, int64(len(blob)))
+		if err != nil {
+			t.Fatalf("failed to open era: %v", err)
+		}
+		return e
+	}
+	entry := func(e *Era, number uint64, skip int) int64 {
+		off, err := e.skip(e.offsets[number-e.start], skip)
+		if err != nil {
+			t.Fatalf("failed to locate entry: %v", err)
+		}
+		return off
+	}
+	e := open(t, blob)
+	tdOffset, accOffset := entry(e, 10, 3), entry(e, e.start+e.Count()-1, 4)
+
+	tests := []struct {
+		name   string
+		blob   func() []byte
+		verify string
+		chain  string
+	}{
+		{
+			name: "td",
+			blob: func() []byte {
+				b := common.CopyBytes(blob)
+				b[tdOffset+headerSize+31]++
+				return b
+			},
+			verify: "total difficulty mismatch",
+			chain:  "accumulator mismatch",
+		},
+		{
+			name: "accumulator",
+			blob: func() []byte {
+				b := common.CopyBytes(blob)
+				b[accOffset+headerSize]++
+				return b
+			},
+			verify: "accumulator mismatch",
+			chain:  "accumulator mismatch",
+		},
+		{
+			name: "reserved",
+			blob: func() []byte {
+				b := common.CopyBytes(blob)
+				b[tdOffset+6] = 0x01
+				return b
+			},
+			verify: "reserved bytes are non-zero",
+			chain:  "reserved bytes are non-zero",
+		},
+		{
+			name: "type",
+			blob: func() []byte {
+				b := common.CopyBytes(blob)
+				b[tdOffset] = byte(TypeReceipts)
+				return b
+			},
+			verify: "invalid entry type",
+			chain:  "invalid entry type",
+		},
+		{
+			name: "receipts",
+			blob: func() []byte {
+				receipts := append([]types.Receipts{}, te.receipts...)
+				failed := *receipts[2][0]
+				failed.Status = types.ReceiptStatusFailed
+				receipts[2] = types.Receipts{&failed}
+				b, _ := te.build(t, receipts, te.tds)
+				return b
+			},
+			verify: "receipt root mismatch",
+		},
+	}
+	for _, test := range tests {
+		e := open(t, test.blob())
+		if err := e.Verify(); err == nil || !strings.Contains(err.Error(), test.verify) {
+			t.Errorf("%s: verification error mismatch: have %v, want %q", test.name, err, test.verify)
+		}
+		err := verifyAgainstChain(e, te.chain())
+		if test.chain == "" && err != nil {
+			t.Errorf("%s: unexpected chain verification error: %v", test.name, err)
+		}
+		if test.chain != "" && (err == nil || !strings.Contains(err.Error(), test.chain)) {
+			t.Errorf("%s: chain verification error mismatch: have %v, want %q", test.name, err, test.chain)
+		}
+	}
+
+
+	if _, err := From(nopCloser{bytes.NewReader(blob[:len(blob)-1])}, int64(len(blob)-1)); err == nil {
+		t.Error("truncated era opened")
+	}
+	other := newTestEpoch(32)
+	if err := verifyAgainstChain(open(t, blob), other.chain()); err == nil || !strings.Contains(err.Error(), "hash mismatch with local chain") {
+		t.Errorf("foreign chain error mismatch: %v", err)
+	}
+	if err := verifyAgainstChain(open(t, blob), testChain{}); err == nil || !strings.Contains(err.Error(), "not in local chain") {
+		t.Errorf("missing chain error mismatch: %v", err)
+	}
+	if have, _ := open(t, blob).Accumulator(); have != root {
+		t.Errorf("accumulator mismatch: have %x, want %x", have, root)
+	}
+}
+
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Close() error { return nil }
+
+func referenceAccumulator(hashes []common.Hash, tds []*big.Int) common.Hash {
+	layer := make([]common.Hash, 1<<accumulatorDepth)
+	for i := range hashes {
+		layer[i] = accumulatorLeaf(hashes[i], tds[i])
+	}
+	for len(layer) > 1 {
+		next := make([]common.Hash, len(layer)/2)
+		for i := range next {
+			next[i] = crypto.Keccak256Hash(layer[2*i][:], layer[2*i+1][:])
+		}
+		layer = next
+	}
+	return mixInLength(layer[0], len(hashes))
+}
+
+func TestAccumulatorDepth(t *testing.T) {
+	if 1<<accumulatorDepth != MaxSize {
+		t.Fatalf("accumulator depth %d does not cover %d blocks", accumulatorDepth, MaxSize)
+	}
+	hashes := make([]common.Hash, MaxSize)
+	tds := make([]*big.Int, MaxSize)
+	for i := range hashes {
+		hashes[i] = crypto.Keccak256Hash(big.NewInt(int64(i)).Bytes())
+		tds[i] = big.NewInt(int64(i + 1))
+	}
+	for _, n := range []int{1, 2, 3, 5, 128, 8191, MaxSize} {
+		root, err := ComputeAccumulator(hashes[:n], tds[:n])
+		if err != nil {
+			t.Fatalf("%d blocks: failed to compute accumulator: %v", n, err)
+		}
+		if want := referenceAccumulator(hashes[:n], tds[:n]); root != want {
+			t.Fatalf("%d blocks: accumulator mismatch: have %x, want %x", n, root, want)
+		}
+		for _, index := range []int{0, n / 2, n - 1} {
+			proof := buildProof(hashes[:n], tds[:n], index)
+			if len(proof) != accumulatorDepth {
+				t.Fatalf("%d blocks: proof length %d, want %d", n, len(proof), accumulatorDepth)
+			}
+			if err := VerifyProof(root, n, index, hashes[index], tds[index], proof); err != nil {
+				t.Fatalf("%d blocks, index %d: proof rejected: %v", n, index, err)
+			}
+			if err := VerifyProof(root, n, index, hashes[index], new(big.Int).Add(tds[index], common.Big1), proof); err == nil {
+				t.Fatalf("%d blocks, index %d: proof with wrong td accepted", n, index)
+			}
+			if err := VerifyProof(root, n+1, index, hashes[index], tds[index], proof); err == nil {
+				t.Fatalf("%d blocks, index %d: proof with wrong count accepted", n, index)
+			}
+		}
+		if err := VerifyProof(root, n, n, hashes[0], tds[0], buildProof(hashes[:n], tds[:n], 0)); err == nil {
+			t.Fatalf("%d blocks: out of range proof accepted", n)
+		}
+		if err := VerifyProof(root, n, 0, hashes[0], tds[0], buildProof(hashes[:n], tds[:n], 0)[1:]); err == nil {
+			t.Fatalf("%d blocks: short proof accepted", n)
+		}
+	}
+	if _, err := ComputeAccumulator(append(hashes, common.Hash{}), append(tds, common.Big1)); err == nil {
+		t.Fatal("oversized epoch accepted")
+	}
+}
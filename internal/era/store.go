@@ -0,0 +1,186 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package era
+
+import (
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func NetworkName(genesis common.Hash) string {
+	switch genesis {
+	case params.MainnetGenesisHash:
+		return "mainnet"
+	case params.RopstenGenesisHash:
+		return "ropsten"
+	case params.RinkebyGenesisHash:
+		return "rinkeby"
+	case params.GoerliGenesisHash:
+		return "goerli"
+	}
+	return fmt.Sprintf("%x", genesis[:4])
+}
+
+type epoch struct {
+	path  string
+	start uint64
+	count uint64
+}
+
+type Store struct {
+	dir    string
+	epochs []epoch
+}
+
+
+
+type ChainReader interface {
+	GetCanonicalHash(number uint64) common.Hash
+}
+
+
+
+
+func NewStore(dir, network string, chain ChainReader) (*Store, error) {
+	files, err := ReadDir(dir, network)
+	if err != nil {
+		return nil, err
+	}
+	store := &Store{dir: dir}
+	for _, file := range files {
+		path := filepath.Join(dir, file)
+		e, err := Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		err = verifyAgainstChain(e, chain)
+		e.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		store.epochs = append(store.epochs, epoch{path: path, start: e.Start(), count: e.Count()})
+	}
+	return store, nil
+}
+
+
+
+
+func verifyAgainstChain(e *Era, chain ChainReader) error {
+	var (
+		hashes = make([]common.Hash, 0, e.Count())
+		tds    = make([]*big.Int, 0, e.Count())
+	)
+	for number := e.Start(); number < e.Start()+e.Count(); number++ {
+		header, err := e.GetHeaderByNumber(number)
+		if err != nil {
+			return fmt.Errorf("block %d: %v", number, err)
+		}
+		if len(hashes) > 0 && header.ParentHash != hashes[len(hashes)-1] {
+			return fmt.Errorf("block %d: parent hash mismatch", number)
+		}
+		td, err := e.GetTdByNumber(number)
+		if err != nil {
+			return fmt.Errorf("block %d: %v", number, err)
+		}
+		hashes, tds = append(hashes, header.Hash()), append(tds, td)
+	}
+	want, err := e.Accumulator()
+	if err != nil {
+		return err
+	}
+	have, err := ComputeAccumulator(hashes, tds)
+	if err != nil {
+		return err
+	}
+	if have != want {
+		return fmt.Errorf("accumulator mismatch: have %x, want %x", have, want)
+	}
+	last := e.Start() + e.Count() - 1
+	canonical := chain.GetCanonicalHash(last)
+	if canonical == (common.Hash{}) {
+		return fmt.Errorf("block %d not in local chain", last)
+	}
+	if hashes[len(hashes)-1] != canonical {
+		return fmt.Errorf("block %d: hash mismatch with local chain: have %x, want %x", last, hashes[len(hashes)-1], canonical)
+	}
+	return nil
+}
+
+func (s *Store) Empty() bool {
+	return len(s.epochs) == 0
+}
+
+func (s *Store) Range() (uint64, uint64) {
+	if len(s.epochs) == 0 {
+		return 0, 0
+	}
+	last := s.epochs[len(s.epochs)-1]
+	return s.epochs[0].start, last.start + last.count - 1
+}
+
+func (s *Store) open(number uint64) (*Era, error) {
+	i := sort.Search(len(s.epochs), func(i int) bool {
+		return s.epochs[i].start+s.epochs[i].count > number
+	})
+	if i == len(s.epochs) || s.epochs[i].start > number {
+		return nil, fmt.Errorf("block %d not in history archive", number)
+	}
+	return Open(s.epochs[i].path)
+}
+
+func (s *Store) GetHeaderByNumber(number uint64) (*types.Header, error) {
+	e, err := s.open(number)
+	if err != nil {
+		return nil, err
+	}
+	defer e.Close()
+	return e.GetHeaderByNumber(number)
+}
+
+func (s *Store) GetBlockByNumber(number uint64) (*types.Block, error) {
+	e, err := s.open(number)
+	if err != nil {
+		return nil, err
+	}
+	defer e.Close()
+	return e.GetBlockByNumber(number)
+}
+
+func (s *Store) GetReceiptsByNumber(number uint64) (types.Receipts, error) {
+	e, err := s.open(number)
+	if err != nil {
+		return nil, err
+	}
+	defer e.Close()
+	return e.GetReceiptsByNumber(number)
+}
+
+func (s *Store) GetTdByNumber(number uint64) (*big.Int, error) {
+	e, err := s.open(number)
+	if err != nil {
+		return nil, err
+	}
+	defer e.Close()
+	return e.GetTdByNumber(number)
+}
@@ -565,6 +565,7 @@ type AccountResult struct {
 	Nonce        hexutil.Uint64  `json:"nonce"`
 	StorageHash  common.Hash     `json:"storageHash"`
 	StorageProof []StorageResult `json:"storageProof"`
+	StorageNodes []string        `json:"storageNodes,omitempty"`
 }
 type StorageResult struct {
 	Key   string       `json:"key"`
@@ -573,7 +574,7 @@ type StorageResult struct {
 }
 
 
-func (s *PublicBlockChainAPI) GetProof(ctx context.Context, address common.Address, storageKeys []string, blockNrOrHash rpc.BlockNumberOrHash) (*AccountResult, error) {
+func (s *PublicBlockChainAPI) GetProof(ctx context.Context, address common.Address, storageKeys []string, blockNrOrHash rpc.BlockNumberOrHash, compact *bool) (*AccountResult, error) {
 	state, _, err := s.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
 	if state == nil || err != nil {
 		return nil, err
@@ -583,6 +584,7 @@ func (s *PublicBlockChainAPI) GetProof(ctx context.Context, address common.Addre
 	storageHash := types.EmptyRootHash
 	codeHash := state.GetCodeHash(address)
 	storageProof := make([]StorageResult, len(storageKeys))
+	var storageNodes []string
 
 	
 	if storageTrie != nil {
@@ -593,15 +595,30 @@ func (s *PublicBlockChainAPI) GetProof(ctx context.Context, address common.Addre
 	}
 
 	
-	for i, key := range storageKeys {
+	if compact != nil && *compact {
+		keys := make([]common.Hash, len(storageKeys))
+		for i, key := range storageKeys {
+			keys[i] = common.HexToHash(key)
+			storageProof[i] = StorageResult{key, (*hexutil.Big)(state.GetState(address, keys[i]).Big()), []string{}}
+		}
 		if storageTrie != nil {
-			proof, storageError := state.GetStorageProof(address, common.HexToHash(key))
+			proof, storageError := state.GetStorageMultiProof(address, keys)
 			if storageError != nil {
 				return nil, storageError
 			}
-			storageProof[i] = StorageResult{key, (*hexutil.Big)(state.GetState(address, common.HexToHash(key)).Big()), common.ToHexArray(proof)}
-		} else {
-			storageProof[i] = StorageResult{key, &hexutil.Big{}, []string{}}
+			storageNodes = common.ToHexArray(proof)
+		}
+	} else {
+		for i, key := range storageKeys {
+			if storageTrie != nil {
+				proof, storageError := state.GetStorageProof(address, common.HexToHash(key))
+				if storageError != nil {
+					return nil, storageError
+				}
+				storageProof[i] = StorageResult{key, (*hexutil.Big)(state.GetState(address, common.HexToHash(key)).Big()), common.ToHexArray(proof)}
+			} else {
+				storageProof[i] = StorageResult{key, &hexutil.Big{}, []string{}}
+			}
 		}
 	}
 
@@ -619,6 +636,7 @@ func (s *PublicBlockChainAPI) GetProof(ctx context.Context, address common.Addre
 		Nonce:        hexutil.Uint64(state.GetNonce(address)),
 		StorageHash:  storageHash,
 		StorageProof: storageProof,
+		StorageNodes: storageNodes,
 	}, state.Error()
 }
 
@@ -1943,3 +1961,56 @@ func checkTxFee(gasPrice *big.Int, gas uint64, cap float64) error {
 	}
 	return nil
 }
+
+type PublicBundleAPI struct {
+	b Backend
+}
+
+func NewPublicBundleAPI(b Backend) *PublicBundleAPI {
+	return &PublicBundleAPI{b}
+}
+
+type SendBundleArgs struct {
+	Txs               []hexutil.Bytes `json:"txs"`
+	BlockNumber       rpc.BlockNumber `json:"blockNumber"`
+	MinTimestamp      *uint64         `json:"minTimestamp"`
+	MaxTimestamp      *uint64         `json:"maxTimestamp"`
+	RevertingTxHashes []common.Hash   `json:"revertingTxHashes"`
+}
+
+func (s *PublicBundleAPI) SendBundle(ctx context.Context, args SendBundleArgs) (common.Hash, error) {
+	if len(args.Txs) == 0 {
+		return common.Hash{}, errors.New("bundle missing txs")
+	}
+	if args.BlockNumber <= 0 {
+		return common.Hash{}, errors.New("bundle missing blockNumber")
+	}
+	bundle := &types.Bundle{
+		BlockNumber:       big.NewInt(args.BlockNumber.Int64()),
+		RevertingTxHashes: args.RevertingTxHashes,
+	}
+	for _, encodedTx := range args.Txs {
+		tx := new(types.Transaction)
+		if err := rlp.DecodeBytes(encodedTx, tx); err != nil {
+			return common.Hash{}, err
+		}
+		if err := checkTxFee(tx.GasPrice(), tx.Gas(), s.b.RPCTxFeeCap()); err != nil {
+			return common.Hash{}, err
+		}
+		bundle.Txs = append(bundle.Txs, tx)
+	}
+	if args.MinTimestamp != nil {
+		bundle.MinTimestamp = *args.MinTimestamp
+	}
+	if args.MaxTimestamp != nil {
+		bundle.MaxTimestamp = *args.MaxTimestamp
+	}
+	if bundle.MaxTimestamp != 0 && bundle.MinTimestamp > bundle.MaxTimestamp {
+		return common.Hash{}, errors.New("bundle minTimestamp exceeds maxTimestamp")
+	}
+	if err := s.b.SendBundle(ctx, bundle); err != nil {
+		return common.Hash{}, err
+	}
+	log.Info("Submitted transaction bundle", "hash", bundle.Hash(), "txs", len(bundle.Txs), "block", bundle.BlockNumber)
+	return bundle.Hash(), nil
+}
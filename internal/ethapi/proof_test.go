@@ -0,0 +1,160 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package ethapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+type proofTestBackend struct {
+	Backend
+	state *state.StateDB
+}
+
+func (b *proofTestBackend) StateAndHeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*state.StateDB, *types.Header, error) {
+	return b.state, &types.Header{Root: b.state.IntermediateRoot(false)}, nil
+}
+
+func newProofTestAPI(t *testing.T, addr common.Address, slots int) *PublicBlockChainAPI {
+	db := state.NewDatabase(rawdb.NewMemoryDatabase())
+	statedb, _ := state.New(common.Hash{}, db, nil)
+	statedb.SetBalance(addr, big.NewInt(1))
+	for i := 0; i < slots; i++ {
+		statedb.SetState(addr, common.BigToHash(big.NewInt(int64(i))), common.BigToHash(big.NewInt(int64(i+1))))
+	}
+	root, err := statedb.Commit(true)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	statedb, _ = state.New(root, db, nil)
+	return NewPublicBlockChainAPI(&proofTestBackend{state: statedb})
+}
+
+func proofNodeSet(t *testing.T, nodes []string) *memorydb.Database {
+	db := memorydb.New()
+	for _, node := range nodes {
+		blob, err := hexutil.Decode(node)
+		if err != nil {
+			t.Fatalf("invalid proof node %q: %v", node, err)
+		}
+		db.Put(crypto.Keccak256(blob), blob)
+	}
+	return db
+}
+
+func TestGetProofCompact(t *testing.T) {
+	var (
+		addr    = common.Address{0x01}
+		api     = newProofTestAPI(t, addr, 200)
+		number  = rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+		compact = true
+	)
+	keys := []string{"0x00", "0x07", "0x42", "0xc7", "0x1000", "0xdead"}
+
+	full, err := api.GetProof(context.Background(), addr, keys, number, nil)
+	if err != nil {
+		t.Fatalf("failed to get full proof: %v", err)
+	}
+	result, err := api.GetProof(context.Background(), addr, keys, number, &compact)
+	if err != nil {
+		t.Fatalf("failed to get compact proof: %v", err)
+	}
+	if result.StorageHash != full.StorageHash {
+		t.Fatalf("storage hash mismatch: have %x, want %x", result.StorageHash, full.StorageHash)
+	}
+	blob, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("failed to encode compact proof: %v", err)
+	}
+	if bytes.Contains(blob, []byte(`"proof":null`)) {
+		t.Fatalf("compact proof encodes null per-key proofs: %s", blob)
+	}
+
+
+	total := 0
+	hashes := make([][]byte, len(keys))
+	for i, key := range keys {
+		if len(result.StorageProof[i].Proof) != 0 {
+			t.Errorf("key %s: compact result carries per-key proof", key)
+		}
+		if result.StorageProof[i].Value.ToInt().Cmp(full.StorageProof[i].Value.ToInt()) != 0 {
+			t.Errorf("key %s: value mismatch: have %v, want %v", key, result.StorageProof[i].Value, full.StorageProof[i].Value)
+		}
+		hashes[i] = crypto.Keccak256(common.HexToHash(key).Bytes())
+		total += len(full.StorageProof[i].Proof)
+	}
+	if len(result.StorageNodes) >= total {
+		t.Fatalf("storage nodes not deduplicated: %d nodes, %d in per-key proofs", len(result.StorageNodes), total)
+	}
+	nodes := proofNodeSet(t, result.StorageNodes)
+	if nodes.Len() != len(result.StorageNodes) {
+		t.Fatalf("duplicate storage nodes: %d unique of %d", nodes.Len(), len(result.StorageNodes))
+	}
+	values, err := trie.VerifyMultiProof(result.StorageHash, hashes, nodes)
+	if err != nil {
+		t.Fatalf("failed to verify storage nodes: %v", err)
+	}
+	for i, key := range keys {
+		var want []byte
+		if value := full.StorageProof[i].Value.ToInt(); value.Sign() != 0 {
+			want, _ = rlp.EncodeToBytes(value.Bytes())
+		}
+		if !bytes.Equal(values[i], want) {
+			t.Errorf("key %s: proven value mismatch: have %x, want %x", key, values[i], want)
+		}
+	}
+}
+
+func TestGetProofCompactNoStorage(t *testing.T) {
+	var (
+		addr    = common.Address{0x02}
+		api     = newProofTestAPI(t, common.Address{0x01}, 10)
+		number  = rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+		compact = true
+	)
+	result, err := api.GetProof(context.Background(), addr, []string{"0x01"}, number, &compact)
+	if err != nil {
+		t.Fatalf("failed to get compact proof: %v", err)
+	}
+	if result.StorageHash != types.EmptyRootHash {
+		t.Fatalf("wrong storage hash: have %x, want %x", result.StorageHash, types.EmptyRootHash)
+	}
+	if result.StorageProof[0].Proof == nil || len(result.StorageProof[0].Proof) != 0 {
+		t.Fatalf("wrong per-key proof: %v", result.StorageProof[0].Proof)
+	}
+	if result.StorageProof[0].Value.ToInt().Sign() != 0 {
+		t.Fatalf("wrong value for missing slot: %v", result.StorageProof[0].Value)
+	}
+	if blob, _ := json.Marshal(result); bytes.Contains(blob, []byte("storageNodes")) {
+		t.Fatalf("empty storage encodes storage nodes: %s", blob)
+	}
+}
@@ -23,10 +23,12 @@ package utesting
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"regexp"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 )
@@ -39,10 +41,10 @@ type Test struct {
 
 
 type Result struct {
-	Name     string
-	Failed   bool
-	Output   string
-	Duration time.Duration
+	Name     string        `json:"name"`
+	Failed   bool          `json:"failed"`
+	Output   string        `json:"output"`
+	Duration time.Duration `json:"duration"`
 }
 
 
@@ -65,17 +67,7 @@ func MatchTests(tests []Test, expr string) []Test {
 func RunTests(tests []Test, report io.Writer) []Result {
 	results := make([]Result, len(tests))
 	for i, test := range tests {
-		var output io.Writer
-		buffer := new(bytes.Buffer)
-		output = buffer
-		if report != nil {
-			output = io.MultiWriter(buffer, report)
-		}
-		start := time.Now()
-		results[i].Name = test.Name
-		results[i].Failed = run(test, output)
-		results[i].Duration = time.Since(start)
-		results[i].Output = buffer.String()
+		results[i] = runTest(test, report)
 		if report != nil {
 			printResult(results[i], report)
 		}
@@ -83,6 +75,39 @@ func RunTests(tests []Test, report io.Writer) []Result {
 	return results
 }
 
+
+
+func RunTAP(tests []Test, report io.Writer) []Result {
+	fmt.Fprintf(report, "1..%d\n", len(tests))
+	results := make([]Result, len(tests))
+	for i, test := range tests {
+		results[i] = runTest(test, nil)
+		printTAPResult(i+1, results[i], report)
+	}
+	return results
+}
+
+
+func WriteJSON(w io.Writer, results []Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+func runTest(test Test, report io.Writer) Result {
+	buffer := new(bytes.Buffer)
+	var output io.Writer = buffer
+	if report != nil {
+		output = io.MultiWriter(buffer, report)
+	}
+	start := time.Now()
+	result := Result{Name: test.Name}
+	result.Failed = run(test, output)
+	result.Duration = time.Since(start)
+	result.Output = buffer.String()
+	return result
+}
+
 func printResult(r Result, w io.Writer) {
 	pd := r.Duration.Truncate(100 * time.Microsecond)
 	if r.Failed {
@@ -92,6 +117,20 @@ func printResult(r Result, w io.Writer) {
 	}
 }
 
+func printTAPResult(n int, r Result, w io.Writer) {
+	status := "ok"
+	if r.Failed {
+		status = "not ok"
+	}
+	fmt.Fprintf(w, "%s %d - %s\n", status, n, r.Name)
+	fmt.Fprintf(w, "# duration: %v\n", r.Duration.Truncate(100*time.Microsecond))
+	for _, line := range strings.Split(strings.TrimRight(r.Output, "\n"), "\n") {
+		if line != "" {
+			fmt.Fprintf(w, "# %s\n", line)
+		}
+	}
+}
+
 
 func CountFailures(rr []Result) int {
 	count := 0
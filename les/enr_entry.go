@@ -36,9 +36,28 @@ func (e lesEntry) ENRKey() string {
 
 
 func (eth *LightEthereum) setupDiscovery(cfg *p2p.Config) (enode.Iterator, error) {
-	if /*cfg.NoDiscovery || */ len(eth.config.DiscoveryURLs) == 0 {
+	if len(eth.config.DiscoveryURLs) == 0 && !cfg.DiscoveryV5 {
 		return nil, nil
 	}
-	client := dnsdisc.NewClient(dnsdisc.Config{})
-	return client.NewIterator(eth.config.DiscoveryURLs...)
+	eth.discovery = enode.NewFairMix(0)
+	if len(eth.config.DiscoveryURLs) != 0 {
+		client := dnsdisc.NewClient(dnsdisc.Config{})
+		dns, err := client.NewIterator(eth.config.DiscoveryURLs...)
+		if err != nil {
+			return nil, err
+		}
+		eth.discovery.AddSource(dns)
+	}
+	return eth.discovery, nil
+}
+
+
+
+func (eth *LightEthereum) startTopicDiscovery() {
+	if eth.discovery == nil || eth.p2pServer.DiscV5 == nil {
+		return
+	}
+	for _, pv := range AdvertiseProtocolVersions {
+		eth.discovery.AddSource(eth.p2pServer.DiscV5.TopicSearch(lesTopic(eth.genesis, pv)))
+	}
 }
@@ -227,7 +227,7 @@ func (p *peerCommons) sendReceiveHandshake(sendList keyValueList) (keyValueList,
 		}
 		errc <- nil
 	}()
-	timeout := time.NewTimer(handshakeTimeout)
+	timeout := p.Peer.Clock().NewTimer(handshakeTimeout)
 	defer timeout.Stop()
 	for i := 0; i < 2; i++ {
 		select {
@@ -235,7 +235,7 @@ func (p *peerCommons) sendReceiveHandshake(sendList keyValueList) (keyValueList,
 			if err != nil {
 				return nil, err
 			}
-		case <-timeout.C:
+		case <-timeout.C():
 			return nil, p2p.DiscReadTimeout
 		}
 	}
@@ -612,7 +612,7 @@ func (p *serverPeer) Handshake(td *big.Int, head common.Hash, headNum uint64, ge
 			return err
 		}
 		p.fcParams = sParams
-		p.fcServer = flowcontrol.NewServerNode(sParams, &mclock.System{})
+		p.fcServer = flowcontrol.NewServerNode(sParams, p.Peer.Clock())
 		p.fcCosts = MRC.decode(ProtocolLengths[uint(p.version)])
 
 		recv.get("checkpoint/value", &p.checkpoint)
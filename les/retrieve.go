@@ -242,7 +242,7 @@ func (r *sentReq) stateRequesting() reqStateFn {
 
 func (r *sentReq) stateNoMorePeers() reqStateFn {
 	select {
-	case <-time.After(retryQueue):
+	case <-r.rm.dist.clock.After(retryQueue):
 		go r.tryRequest()
 		r.lastReqQueued = true
 		return r.stateRequesting
@@ -351,7 +351,7 @@ func (r *sentReq) tryRequest() {
 		}
 		r.eventsCh <- reqPeerEvent{event, p}
 		return
-	case <-time.After(r.rm.softRequestTimeout()):
+	case <-r.rm.dist.clock.After(r.rm.softRequestTimeout()):
 		r.eventsCh <- reqPeerEvent{rpSoftTimeout, p}
 	}
 
@@ -363,7 +363,7 @@ func (r *sentReq) tryRequest() {
 			r.lock.Unlock()
 		}
 		r.eventsCh <- reqPeerEvent{event, p}
-	case <-time.After(hardRequestTimeout):
+	case <-r.rm.dist.clock.After(hardRequestTimeout):
 		hrto = true
 		r.eventsCh <- reqPeerEvent{rpHardTimeout, p}
 	}
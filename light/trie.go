@@ -147,6 +147,10 @@ func (t *odrTrie) Prove(key []byte, fromLevel uint, proofDb ethdb.KeyValueWriter
 	return errors.New("not implemented, needs client/server interface split")
 }
 
+func (t *odrTrie) ProveMulti(keys [][]byte, fromLevel uint, proofDb ethdb.KeyValueWriter) error {
+	return errors.New("not implemented, needs client/server interface split")
+}
+
 
 
 func (t *odrTrie) do(key []byte, fn func() error) error {
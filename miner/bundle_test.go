@@ -0,0 +1,193 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package miner
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	bundleCoinbase = common.Address{0xc0}
+	bundleReverter = common.Address{0xc1}
+)
+
+type bundleTester struct {
+	t      *testing.T
+	keys   []*ecdsa.PrivateKey
+	nonces map[common.Address]uint64
+	signer types.Signer
+	chain  *core.BlockChain
+	worker *worker
+}
+
+func newBundleTester(t *testing.T, accounts int) *bundleTester {
+	bt := &bundleTester{
+		t:      t,
+		nonces: make(map[common.Address]uint64),
+		signer: types.NewEIP155Signer(params.TestChainConfig.ChainID),
+	}
+	gspec := &core.Genesis{
+		Config:   params.TestChainConfig,
+		GasLimit: 10000000,
+		Alloc: core.GenesisAlloc{
+			bundleReverter: {Balance: new(big.Int), Code: common.Hex2Bytes("60006000fd")},
+		},
+	}
+	for i := 0; i < accounts; i++ {
+		key, _ := crypto.GenerateKey()
+		bt.keys = append(bt.keys, key)
+		gspec.Alloc[crypto.PubkeyToAddress(key.PublicKey)] = core.GenesisAccount{Balance: big.NewInt(params.Ether)}
+	}
+	db := rawdb.NewMemoryDatabase()
+	gspec.MustCommit(db)
+
+	bt.chain, _ = core.NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, nil)
+	bt.worker = &worker{chainConfig: params.TestChainConfig, chain: bt.chain}
+	return bt
+}
+
+func (bt *bundleTester) env(gasLimit uint64) *environment {
+	parent := bt.chain.CurrentBlock()
+	statedb, err := bt.chain.StateAt(parent.Root())
+	if err != nil {
+		bt.t.Fatalf("failed to open state: %v", err)
+	}
+	return &environment{
+		signer:  bt.signer,
+		state:   statedb,
+		gasPool: new(core.GasPool).AddGas(gasLimit),
+		header: &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     new(big.Int).Add(parent.Number(), common.Big1),
+			GasLimit:   gasLimit,
+			Time:       parent.Time() + 10,
+			Difficulty: big.NewInt(1),
+			Coinbase:   bundleCoinbase,
+		},
+	}
+}
+
+func (bt *bundleTester) tx(key int, to common.Address, value *big.Int, gas uint64, price int64) *types.Transaction {
+	from := crypto.PubkeyToAddress(bt.keys[key].PublicKey)
+	tx, _ := types.SignTx(types.NewTransaction(bt.nonces[from], to, value, gas, big.NewInt(price), nil), bt.signer, bt.keys[key])
+	bt.nonces[from]++
+	return tx
+}
+
+func TestSimulateBundle(t *testing.T) {
+	bt := newBundleTester(t, 2)
+	env := bt.env(1000000)
+
+	ok := bt.tx(0, common.Address{0x01}, big.NewInt(1), params.TxGas, 5)
+	reverts := bt.tx(1, bundleReverter, new(big.Int), 50000, 3)
+
+	sim, err := bt.worker.simulateBundle(env, &types.Bundle{Txs: types.Transactions{ok}}, bundleCoinbase)
+	if err != nil {
+		t.Fatalf("failed to simulate bundle: %v", err)
+	}
+	if sim.gasUsed != params.TxGas || sim.profit.Cmp(big.NewInt(5*int64(params.TxGas))) != 0 || sim.price.Cmp(big.NewInt(5)) != 0 {
+		t.Fatalf("wrong simulation result: gas %d, profit %v, price %v", sim.gasUsed, sim.profit, sim.price)
+	}
+	if env.state.GetBalance(bundleCoinbase).Sign() != 0 || env.gasPool.Gas() != 1000000 {
+		t.Fatalf("simulation modified the environment")
+	}
+	if _, err := bt.worker.simulateBundle(env, &types.Bundle{Txs: types.Transactions{ok, reverts}}, bundleCoinbase); err != errBundleReverted {
+		t.Fatalf("reverting bundle: have %v, want %v", err, errBundleReverted)
+	}
+
+
+	bundle := &types.Bundle{Txs: types.Transactions{ok, reverts}, RevertingTxHashes: []common.Hash{reverts.Hash()}}
+	sim, err = bt.worker.simulateBundle(env, bundle, bundleCoinbase)
+	if err != nil {
+		t.Fatalf("failed to simulate bundle with revertible tx: %v", err)
+	}
+	if sim.gasUsed <= params.TxGas || sim.profit.Cmp(new(big.Int).SetUint64(5*params.TxGas+3*(sim.gasUsed-params.TxGas))) != 0 {
+		t.Fatalf("wrong simulation result: gas %d, profit %v", sim.gasUsed, sim.profit)
+	}
+}
+
+func TestCommitBundleRevert(t *testing.T) {
+	bt := newBundleTester(t, 2)
+	env := bt.env(1000000)
+
+	var (
+		ok      = bt.tx(0, common.Address{0x01}, big.NewInt(1), params.TxGas, 5)
+		reverts = bt.tx(1, bundleReverter, new(big.Int), 50000, 3)
+		sender  = crypto.PubkeyToAddress(bt.keys[0].PublicKey)
+		balance = env.state.GetBalance(sender)
+	)
+	if err := bt.worker.commitBundle(env, &types.Bundle{Txs: types.Transactions{ok, reverts}}, bundleCoinbase); err != errBundleReverted {
+		t.Fatalf("reverting bundle: have %v, want %v", err, errBundleReverted)
+	}
+	if len(env.txs) != 0 || len(env.receipts) != 0 || env.tcount != 0 || env.header.GasUsed != 0 || env.gasPool.Gas() != 1000000 {
+		t.Fatalf("environment not restored: txs %d, receipts %d, tcount %d, gas used %d, gas pool %d", len(env.txs), len(env.receipts), env.tcount, env.header.GasUsed, env.gasPool.Gas())
+	}
+	if env.state.GetNonce(sender) != 0 || env.state.GetBalance(sender).Cmp(balance) != 0 {
+		t.Fatalf("state not restored: nonce %d, balance %v", env.state.GetNonce(sender), env.state.GetBalance(sender))
+	}
+
+
+	bundle := &types.Bundle{Txs: types.Transactions{ok, reverts}, RevertingTxHashes: []common.Hash{reverts.Hash()}}
+	if err := bt.worker.commitBundle(env, bundle, bundleCoinbase); err != nil {
+		t.Fatalf("failed to commit bundle with revertible tx: %v", err)
+	}
+	if len(env.txs) != 2 || env.tcount != 2 || env.receipts[1].Status != types.ReceiptStatusFailed {
+		t.Fatalf("wrong committed bundle: txs %d, tcount %d", len(env.txs), env.tcount)
+	}
+}
+
+func TestCommitBundlesOrder(t *testing.T) {
+	bt := newBundleTester(t, 5)
+	env := bt.env(1000000)
+
+	var (
+		cheap    = &types.Bundle{Txs: types.Transactions{bt.tx(0, common.Address{0x01}, big.NewInt(1), params.TxGas, 2)}}
+		pricey   = &types.Bundle{Txs: types.Transactions{bt.tx(1, common.Address{0x01}, big.NewInt(1), params.TxGas, 7)}}
+		bribe    = &types.Bundle{Txs: types.Transactions{bt.tx(2, bundleCoinbase, big.NewInt(params.GWei), params.TxGas, 0)}}
+		failing  = &types.Bundle{Txs: types.Transactions{bt.tx(3, bundleReverter, new(big.Int), 50000, 100)}}
+		unpaid   = &types.Bundle{Txs: types.Transactions{bt.tx(4, common.Address{0x01}, big.NewInt(1), params.TxGas, 0)}}
+		expected = []*types.Bundle{bribe, pricey, cheap}
+	)
+	bt.worker.commitBundles(env, []*types.Bundle{cheap, failing, pricey, unpaid, bribe}, bundleCoinbase)
+
+	if len(env.txs) != len(expected) {
+		t.Fatalf("wrong committed tx count: have %d, want %d", len(env.txs), len(expected))
+	}
+	for i, bundle := range expected {
+		if env.txs[i].Hash() != bundle.Txs[0].Hash() {
+			t.Errorf("tx %d: have %x, want %x", i, env.txs[i].Hash(), bundle.Txs[0].Hash())
+		}
+	}
+
+
+	env = bt.env(2 * params.TxGas)
+	bt.worker.commitBundles(env, []*types.Bundle{cheap, pricey, bribe}, bundleCoinbase)
+	if len(env.txs) != 2 || env.txs[0].Hash() != bribe.Txs[0].Hash() || env.txs[1].Hash() != pricey.Txs[0].Hash() {
+		t.Fatalf("wrong bundles committed under gas limit: %d txs", len(env.txs))
+	}
+}
@@ -32,6 +32,7 @@ import (
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/params"
+	lru "github.com/hashicorp/golang-lru"
 )
 
 
@@ -62,17 +63,20 @@ type Miner struct {
 	exitCh   chan struct{}
 	startCh  chan common.Address
 	stopCh   chan struct{}
+	payloads *lru.Cache
 }
 
 func New(eth Backend, config *Config, chainConfig *params.ChainConfig, mux *event.TypeMux, engine consensus.Engine, isLocalBlock func(block *types.Block) bool) *Miner {
+	payloads, _ := lru.New(payloadCacheLimit)
 	miner := &Miner{
-		eth:     eth,
-		mux:     mux,
-		engine:  engine,
-		exitCh:  make(chan struct{}),
-		startCh: make(chan common.Address),
-		stopCh:  make(chan struct{}),
-		worker:  newWorker(config, chainConfig, engine, eth, mux, isLocalBlock, true),
+		eth:      eth,
+		mux:      mux,
+		engine:   engine,
+		exitCh:   make(chan struct{}),
+		startCh:  make(chan common.Address),
+		stopCh:   make(chan struct{}),
+		worker:   newWorker(config, chainConfig, engine, eth, mux, isLocalBlock, true),
+		payloads: payloads,
 	}
 	go miner.update()
 
@@ -217,6 +221,71 @@ func (miner *Miner) DisablePreseal() {
 
 
 
+func (miner *Miner) SetTimeOffset(offset time.Duration) {
+	miner.worker.setTimeOffset(int64(offset / time.Second))
+}
+
+func (miner *Miner) TimeOffset() time.Duration {
+	return time.Duration(miner.worker.getTimeOffset()) * time.Second
+}
+
+func (miner *Miner) BuildBlock(mutate func(*types.Header, *state.StateDB) error) (*types.Block, []*types.Receipt, *state.StateDB, error) {
+	return miner.worker.requestBlock(&buildReq{mutate: mutate})
+}
+
+
+
+func (miner *Miner) BuildBlockWithTxs(txs []*types.Transaction, signer types.Signer) (*types.Block, []*types.Receipt, *state.StateDB, error) {
+	return miner.worker.requestBlock(&buildReq{txs: txs, signer: signer})
+}
+
+func (miner *Miner) WriteBlock(block *types.Block, receipts []*types.Receipt, state *state.StateDB) error {
+	return miner.worker.writeBlock(block, receipts, state)
+}
+
+
+
+
+func (miner *Miner) BuildPayload(parent common.Hash, timestamp uint64, coinbase common.Address, extra []byte) (*types.Block, []*types.Receipt, error) {
+	if uint64(len(extra)) > params.MaximumExtraDataSize {
+		return nil, nil, fmt.Errorf("extra exceeds max length. %d > %v", len(extra), params.MaximumExtraDataSize)
+	}
+	res := miner.worker.buildPayload(parent, timestamp, coinbase, extra)
+	if res.err != nil {
+		return nil, nil, res.err
+	}
+	miner.payloads.Add(miner.engine.SealHash(res.block.Header()), res)
+	return res.block, res.receipts, nil
+}
+
+
+
+
+
+func (miner *Miner) SubmitSealedBlock(block *types.Block) error {
+	chain := miner.eth.BlockChain()
+	if chain.HasBlock(block.Hash(), block.NumberU64()) {
+		return nil
+	}
+	sealhash := miner.engine.SealHash(block.Header())
+	cached, ok := miner.payloads.Get(sealhash)
+	if !ok {
+		_, err := chain.InsertChain(types.Blocks{block})
+		return err
+	}
+	res := cached.(*buildResult)
+	if err := miner.engine.VerifyHeader(chain, block.Header(), true); err != nil {
+		return err
+	}
+	if err := miner.worker.writeBlock(res.block.WithSeal(block.Header()), res.receipts, res.state.Copy()); err != nil {
+		return err
+	}
+	miner.payloads.Remove(sealhash)
+	return nil
+}
+
+
+
 func (miner *Miner) SubscribePendingLogs(ch chan<- []*types.Log) event.Subscription {
 	return miner.worker.pendingLogsFeed.Subscribe(ch)
 }
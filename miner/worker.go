@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"errors"
 	"math/big"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -75,6 +76,9 @@ const (
 
 	
 	staleThreshold = 7
+
+	
+	payloadCacheLimit = 64
 )
 
 
@@ -91,6 +95,9 @@ type environment struct {
 	header   *types.Header
 	txs      []*types.Transaction
 	receipts []*types.Receipt
+
+	payload     bool
+	applySigner types.Signer
 }
 
 
@@ -149,6 +156,7 @@ type worker struct {
 	exitCh             chan struct{}
 	resubmitIntervalCh chan time.Duration
 	resubmitAdjustCh   chan *intervalAdjust
+	buildCh            chan *buildReq
 
 	current      *environment                 
 	localUncles  map[common.Hash]*types.Block 
@@ -177,6 +185,8 @@ type worker struct {
 	
 	noempty uint32
 
+	timeOffset int64
+
 	
 	isLocalBlock func(block *types.Block) bool 
 
@@ -210,6 +220,7 @@ func newWorker(config *Config, chainConfig *params.ChainConfig, engine consensus
 		startCh:            make(chan struct{}, 1),
 		resubmitIntervalCh: make(chan time.Duration),
 		resubmitAdjustCh:   make(chan *intervalAdjust, resubmitAdjustChanSize),
+		buildCh:            make(chan *buildReq),
 	}
 	
 	worker.txsSub = eth.TxPool().SubscribeNewTxsEvent(worker.txsCh)
@@ -256,6 +267,14 @@ func (w *worker) setRecommitInterval(interval time.Duration) {
 }
 
 
+func (w *worker) setTimeOffset(offset int64) {
+	atomic.StoreInt64(&w.timeOffset, offset)
+}
+
+func (w *worker) getTimeOffset() int64 {
+	return atomic.LoadInt64(&w.timeOffset)
+}
+
 func (w *worker) disablePreseal() {
 	atomic.StoreUint32(&w.noempty, 1)
 }
@@ -366,18 +385,18 @@ func (w *worker) newWorkLoop(recommit time.Duration) {
 		select {
 		case <-w.startCh:
 			clearPending(w.chain.CurrentBlock().NumberU64())
-			timestamp = time.Now().Unix()
+			timestamp = w.now()
 			commit(false, commitInterruptNewHead)
 
 		case head := <-w.chainHeadCh:
 			clearPending(head.Block.NumberU64())
-			timestamp = time.Now().Unix()
+			timestamp = w.now()
 			commit(false, commitInterruptNewHead)
 
 		case <-timer.C:
 			
 			
-			if w.isRunning() && (w.chainConfig.Clique == nil || w.chainConfig.Clique.Period > 0) {
+			if w.isRunning() && (w.chainConfig.Clique == nil || w.chainConfig.Clique.PeriodAt(w.chain.CurrentBlock().NumberU64()+1) > 0) {
 				
 				if atomic.LoadInt32(&w.newTxs) == 0 {
 					timer.Reset(recommit)
@@ -433,6 +452,9 @@ func (w *worker) mainLoop() {
 		case req := <-w.newWorkCh:
 			w.commitNewWork(req.interrupt, req.noempty, req.timestamp)
 
+		case req := <-w.buildCh:
+			req.result <- w.buildBlock(req)
+
 		case ev := <-w.chainSideCh:
 			
 			if _, exist := w.localUncles[ev.Block.Hash()]; exist {
@@ -494,7 +516,7 @@ func (w *worker) mainLoop() {
 				}
 				txset := types.NewTransactionsByPriceAndNonce(w.current.signer, txs)
 				tcount := w.current.tcount
-				w.commitTransactions(txset, coinbase, nil)
+				w.commitTransactions(w.current, txset, coinbase, nil)
 				
 				
 				if tcount != w.current.tcount {
@@ -504,8 +526,8 @@ func (w *worker) mainLoop() {
 				
 				
 				
-				if w.chainConfig.Clique != nil && w.chainConfig.Clique.Period == 0 {
-					w.commitNewWork(nil, true, time.Now().Unix())
+				if w.chainConfig.Clique != nil && w.chainConfig.Clique.PeriodAt(w.chain.CurrentBlock().NumberU64()+1) == 0 {
+					w.commitNewWork(nil, true, w.now())
 				}
 			}
 			atomic.AddInt32(&w.newTxs, int32(len(ev.Txs)))
@@ -595,39 +617,15 @@ func (w *worker) resultLoop() {
 				log.Error("Block found but no relative pending task", "number", block.Number(), "sealhash", sealhash, "hash", hash)
 				continue
 			}
-			
-			var (
-				receipts = make([]*types.Receipt, len(task.receipts))
-				logs     []*types.Log
-			)
-			for i, receipt := range task.receipts {
-				
-				receipt.BlockHash = hash
-				receipt.BlockNumber = block.Number()
-				receipt.TransactionIndex = uint(i)
 
-				receipts[i] = new(types.Receipt)
-				*receipts[i] = *receipt
-				
-				
-				for _, log := range receipt.Logs {
-					log.BlockHash = hash
-				}
-				logs = append(logs, receipt.Logs...)
-			}
-			
-			_, err := w.chain.WriteBlockWithState(block, receipts, logs, task.state, true)
-			if err != nil {
+			if err := w.writeBlock(block, task.receipts, task.state); err != nil {
 				log.Error("Failed writing block to chain", "err", err)
 				continue
 			}
 			log.Info("Successfully sealed new block", "number", block.Number(), "sealhash", sealhash, "hash", hash,
 				"elapsed", common.PrettyDuration(time.Since(task.createdAt)))
 
-			
-			w.mux.Post(core.NewMinedBlockEvent{Block: block})
 
-			
 			w.unconfirmed.Insert(block.NumberU64(), block.Hash())
 
 		case <-w.exitCh:
@@ -637,11 +635,56 @@ func (w *worker) resultLoop() {
 }
 
 
-func (w *worker) makeCurrent(parent *types.Block, header *types.Header) error {
-	state, err := w.chain.StateAt(parent.Root())
-	if err != nil {
+func (w *worker) writeBlock(block *types.Block, taskReceipts []*types.Receipt, state *state.StateDB) error {
+	var (
+		hash     = block.Hash()
+		receipts = make([]*types.Receipt, len(taskReceipts))
+		logs     []*types.Log
+	)
+	for i, receipt := range taskReceipts {
+
+		receipt.BlockHash = hash
+		receipt.BlockNumber = block.Number()
+		receipt.TransactionIndex = uint(i)
+
+		receipts[i] = new(types.Receipt)
+		*receipts[i] = *receipt
+
+
+		for _, log := range receipt.Logs {
+			log.BlockHash = hash
+		}
+		logs = append(logs, receipt.Logs...)
+	}
+
+	if _, err := w.chain.WriteBlockWithState(block, receipts, logs, state, true); err != nil {
 		return err
 	}
+
+	w.mux.Post(core.NewMinedBlockEvent{Block: block})
+	return nil
+}
+
+
+func (w *worker) makeEnv(parent *types.Block, header *types.Header) (*environment, error) {
+	var (
+		state *state.StateDB
+		err   error
+	)
+	if w.chain.BlockWitnessesEnabled() {
+		state, err = w.chain.WitnessStateAt(parent.Root())
+	} else {
+		state, err = w.chain.StateAt(parent.Root())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if witness := state.Witness(); witness != nil {
+		witness.AddHeader(parent.Header())
+	}
+	if w.chain.StateDiffsEnabled() {
+		state.EnableStateDiff()
+	}
 	env := &environment{
 		signer:    types.NewEIP155Signer(w.chainConfig.ChainID),
 		state:     state,
@@ -662,8 +705,7 @@ func (w *worker) makeCurrent(parent *types.Block, header *types.Header) error {
 
 	
 	env.tcount = 0
-	w.current = env
-	return nil
+	return env, nil
 }
 
 
@@ -719,28 +761,32 @@ func (w *worker) updateSnapshot() {
 	w.snapshotState = w.current.state.Copy()
 }
 
-func (w *worker) commitTransaction(tx *types.Transaction, coinbase common.Address) ([]*types.Log, error) {
-	snap := w.current.state.Snapshot()
+func (w *worker) commitTransaction(env *environment, tx *types.Transaction, coinbase common.Address) ([]*types.Log, error) {
+	snap := env.state.Snapshot()
 
-	receipt, err := core.ApplyTransaction(w.chainConfig, w.chain, &coinbase, w.current.gasPool, w.current.state, w.current.header, tx, &w.current.header.GasUsed, *w.chain.GetVMConfig())
+	signer := env.applySigner
+	if signer == nil {
+		signer = types.MakeSigner(w.chainConfig, env.header.Number)
+	}
+	receipt, err := core.ApplyTransactionWithSigner(w.chainConfig, signer, w.chain, &coinbase, env.gasPool, env.state, env.header, tx, &env.header.GasUsed, *w.chain.GetVMConfig())
 	if err != nil {
-		w.current.state.RevertToSnapshot(snap)
+		env.state.RevertToSnapshot(snap)
 		return nil, err
 	}
-	w.current.txs = append(w.current.txs, tx)
-	w.current.receipts = append(w.current.receipts, receipt)
+	env.txs = append(env.txs, tx)
+	env.receipts = append(env.receipts, receipt)
 
 	return receipt.Logs, nil
 }
 
-func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coinbase common.Address, interrupt *int32) bool {
+func (w *worker) commitTransactions(env *environment, txs *types.TransactionsByPriceAndNonce, coinbase common.Address, interrupt *int32) bool {
 	
-	if w.current == nil {
+	if env == nil {
 		return true
 	}
 
-	if w.current.gasPool == nil {
-		w.current.gasPool = new(core.GasPool).AddGas(w.current.header.GasLimit)
+	if env.gasPool == nil {
+		env.gasPool = new(core.GasPool).AddGas(env.header.GasLimit)
 	}
 
 	var coalescedLogs []*types.Log
@@ -755,7 +801,7 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 		if interrupt != nil && atomic.LoadInt32(interrupt) != commitInterruptNone {
 			
 			if atomic.LoadInt32(interrupt) == commitInterruptResubmit {
-				ratio := float64(w.current.header.GasLimit-w.current.gasPool.Gas()) / float64(w.current.header.GasLimit)
+				ratio := float64(env.header.GasLimit-env.gasPool.Gas()) / float64(env.header.GasLimit)
 				if ratio < 0.1 {
 					ratio = 0.1
 				}
@@ -767,8 +813,8 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 			return atomic.LoadInt32(interrupt) == commitInterruptNewHead
 		}
 		
-		if w.current.gasPool.Gas() < params.TxGas {
-			log.Trace("Not enough gas for further transactions", "have", w.current.gasPool, "want", params.TxGas)
+		if env.gasPool.Gas() < params.TxGas {
+			log.Trace("Not enough gas for further transactions", "have", env.gasPool, "want", params.TxGas)
 			break
 		}
 		
@@ -780,19 +826,19 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 		
 		
 		
-		from, _ := types.Sender(w.current.signer, tx)
+		from, _ := types.Sender(env.signer, tx)
 		
 		
-		if tx.Protected() && !w.chainConfig.IsEIP155(w.current.header.Number) {
+		if tx.Protected() && !w.chainConfig.IsEIP155(env.header.Number) {
 			log.Trace("Ignoring reply protected transaction", "hash", tx.Hash(), "eip155", w.chainConfig.EIP155Block)
 
 			txs.Pop()
 			continue
 		}
 		
-		w.current.state.Prepare(tx.Hash(), common.Hash{}, w.current.tcount)
+		env.state.Prepare(tx.Hash(), common.Hash{}, env.tcount)
 
-		logs, err := w.commitTransaction(tx, coinbase)
+		logs, err := w.commitTransaction(env, tx, coinbase)
 		switch err {
 		case core.ErrGasLimitReached:
 			
@@ -812,7 +858,7 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 		case nil:
 			
 			coalescedLogs = append(coalescedLogs, logs...)
-			w.current.tcount++
+			env.tcount++
 			txs.Shift()
 
 		default:
@@ -823,7 +869,7 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 		}
 	}
 
-	if !w.isRunning() && len(coalescedLogs) > 0 {
+	if !w.isRunning() && !env.payload && len(coalescedLogs) > 0 {
 		
 		
 		
@@ -847,42 +893,139 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 }
 
 
-func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64) {
-	w.mu.RLock()
-	defer w.mu.RUnlock()
+var (
+	errBundleReverted = errors.New("non-revertible bundle transaction failed")
 
-	tstart := time.Now()
-	parent := w.chain.CurrentBlock()
+	errWorkerClosed = errors.New("worker closed")
 
-	if parent.Time() >= uint64(timestamp) {
-		timestamp = int64(parent.Time() + 1)
+	errUnknownParent    = errors.New("unknown parent block")
+	errInvalidTimestamp = errors.New("timestamp not after parent")
+)
+
+type simulatedBundle struct {
+	bundle  *types.Bundle
+	profit  *big.Int
+	gasUsed uint64
+	price   *big.Int
+}
+
+func (w *worker) simulateBundle(env *environment, bundle *types.Bundle, coinbase common.Address) (*simulatedBundle, error) {
+	var (
+		statedb = env.state.Copy()
+		gasPool = new(core.GasPool).AddGas(env.gasPool.Gas())
+		gasUsed uint64
+		before  = statedb.GetBalance(coinbase)
+	)
+	for i, tx := range bundle.Txs {
+		statedb.Prepare(tx.Hash(), common.Hash{}, env.tcount+i)
+
+		receipt, err := core.ApplyTransaction(w.chainConfig, w.chain, &coinbase, gasPool, statedb, env.header, tx, &gasUsed, *w.chain.GetVMConfig())
+		if err != nil {
+			return nil, err
+		}
+		if receipt.Status == types.ReceiptStatusFailed && !bundle.Revertible(tx.Hash()) {
+			return nil, errBundleReverted
+		}
 	}
-	
-	if now := time.Now().Unix(); timestamp > now+1 {
-		wait := time.Duration(timestamp-now) * time.Second
-		log.Info("Mining too far in the future", "wait", common.PrettyDuration(wait))
-		time.Sleep(wait)
+	sim := &simulatedBundle{
+		bundle:  bundle,
+		profit:  new(big.Int).Sub(statedb.GetBalance(coinbase), before),
+		gasUsed: gasUsed,
+		price:   new(big.Int),
 	}
+	if gasUsed > 0 {
+		sim.price.Div(sim.profit, new(big.Int).SetUint64(gasUsed))
+	}
+	return sim, nil
+}
 
+func (w *worker) commitBundle(env *environment, bundle *types.Bundle, coinbase common.Address) error {
+	var (
+		snap     = env.state.Copy()
+		gas      = env.gasPool.Gas()
+		gasUsed  = env.header.GasUsed
+		tcount   = env.tcount
+		txs      = len(env.txs)
+		receipts = len(env.receipts)
+	)
+	revert := func() {
+		env.state = snap
+		*env.gasPool = core.GasPool(gas)
+		env.header.GasUsed = gasUsed
+		env.tcount = tcount
+		env.txs = env.txs[:txs]
+		env.receipts = env.receipts[:receipts]
+	}
+	for _, tx := range bundle.Txs {
+		env.state.Prepare(tx.Hash(), common.Hash{}, env.tcount)
+
+		if _, err := w.commitTransaction(env, tx, coinbase); err != nil {
+			revert()
+			return err
+		}
+		if receipt := env.receipts[len(env.receipts)-1]; receipt.Status == types.ReceiptStatusFailed && !bundle.Revertible(tx.Hash()) {
+			revert()
+			return errBundleReverted
+		}
+		env.tcount++
+	}
+	return nil
+}
+
+func (w *worker) commitBundles(env *environment, bundles []*types.Bundle, coinbase common.Address) {
+	if env.gasPool == nil {
+		env.gasPool = new(core.GasPool).AddGas(env.header.GasLimit)
+	}
+	var simulated []*simulatedBundle
+	for _, bundle := range bundles {
+		sim, err := w.simulateBundle(env, bundle, coinbase)
+		if err != nil {
+			log.Debug("Bundle simulation failed", "hash", bundle.Hash(), "err", err)
+			continue
+		}
+		if sim.profit.Sign() <= 0 {
+			log.Debug("Discarding unprofitable bundle", "hash", bundle.Hash(), "profit", sim.profit)
+			continue
+		}
+		simulated = append(simulated, sim)
+	}
+	sort.SliceStable(simulated, func(i, j int) bool {
+		return simulated[i].price.Cmp(simulated[j].price) > 0
+	})
+	for _, sim := range simulated {
+		if env.gasPool.Gas() < sim.gasUsed {
+			log.Trace("Not enough gas for bundle", "hash", sim.bundle.Hash(), "have", env.gasPool, "want", sim.gasUsed)
+			continue
+		}
+		if err := w.commitBundle(env, sim.bundle, coinbase); err != nil {
+			log.Debug("Bundle discarded", "hash", sim.bundle.Hash(), "err", err)
+			continue
+		}
+		log.Debug("Committed bundle", "hash", sim.bundle.Hash(), "txs", len(sim.bundle.Txs), "profit", sim.profit, "price", sim.price)
+	}
+}
+
+func (w *worker) prepareWork(parent *types.Block, timestamp int64, coinbase common.Address) (*types.Header, error) {
+	env, err := w.prepareEnv(parent, timestamp, coinbase, w.extra)
+	if err != nil {
+		return nil, err
+	}
+	w.current = env
+	return env.header, nil
+}
+
+func (w *worker) prepareEnv(parent *types.Block, timestamp int64, coinbase common.Address, extra []byte) (*environment, error) {
 	num := parent.Number()
 	header := &types.Header{
 		ParentHash: parent.Hash(),
 		Number:     num.Add(num, common.Big1),
 		GasLimit:   core.CalcGasLimit(parent, w.config.GasFloor, w.config.GasCeil),
-		Extra:      w.extra,
+		Extra:      extra,
 		Time:       uint64(timestamp),
-	}
-	
-	if w.isRunning() {
-		if w.coinbase == (common.Address{}) {
-			log.Error("Refusing to mine without etherbase")
-			return
-		}
-		header.Coinbase = w.coinbase
+		Coinbase:   coinbase,
 	}
 	if err := w.engine.Prepare(w.chain, header); err != nil {
-		log.Error("Failed to prepare header for mining", "err", err)
-		return
+		return nil, err
 	}
 	
 	if daoBlock := w.chainConfig.DAOForkBlock; daoBlock != nil {
@@ -898,16 +1041,47 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 		}
 	}
 	
-	err := w.makeCurrent(parent, header)
+	env, err := w.makeEnv(parent, header)
 	if err != nil {
-		log.Error("Failed to create mining context", "err", err)
-		return
+		return nil, err
 	}
-	
-	env := w.current
 	if w.chainConfig.DAOForkSupport && w.chainConfig.DAOForkBlock != nil && w.chainConfig.DAOForkBlock.Cmp(header.Number) == 0 {
 		misc.ApplyDAOHardFork(env.state)
 	}
+	return env, nil
+}
+
+func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	tstart := time.Now()
+	parent := w.chain.CurrentBlock()
+
+	if parent.Time() >= uint64(timestamp) {
+		timestamp = int64(parent.Time() + 1)
+	}
+	
+	if now := w.now(); timestamp > now+1 {
+		wait := time.Duration(timestamp-now) * time.Second
+		log.Info("Mining too far in the future", "wait", common.PrettyDuration(wait))
+		time.Sleep(wait)
+	}
+
+	var coinbase common.Address
+	if w.isRunning() {
+		if w.coinbase == (common.Address{}) {
+			log.Error("Refusing to mine without etherbase")
+			return
+		}
+		coinbase = w.coinbase
+	}
+	header, err := w.prepareWork(parent, timestamp, coinbase)
+	if err != nil {
+		log.Error("Failed to prepare mining work", "err", err)
+		return
+	}
+	env := w.current
 	
 	uncles := make([]*types.Header, 0, 2)
 	commitUncles := func(blocks map[common.Hash]*types.Block) {
@@ -938,6 +1112,9 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 	if !noempty && atomic.LoadUint32(&w.noempty) == 0 {
 		w.commit(uncles, nil, false, tstart)
 	}
+	if bundles := w.eth.TxPool().Bundles(header.Number, header.Time); len(bundles) > 0 {
+		w.commitBundles(w.current, bundles, w.coinbase)
+	}
 
 	
 	pending, err := w.eth.TxPool().Pending()
@@ -948,11 +1125,19 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 	
 	
 	
-	if len(pending) == 0 && atomic.LoadUint32(&w.noempty) == 0 {
+	if len(pending) == 0 && env.tcount == 0 && atomic.LoadUint32(&w.noempty) == 0 {
 		w.updateSnapshot()
 		return
 	}
 	
+	if w.fillTransactions(w.current, pending, w.coinbase, interrupt) {
+		return
+	}
+	w.commit(uncles, w.fullTaskHook, true, tstart)
+}
+
+
+func (w *worker) fillTransactions(env *environment, pending map[common.Address]types.Transactions, coinbase common.Address, interrupt *int32) bool {
 	localTxs, remoteTxs := make(map[common.Address]types.Transactions), pending
 	for _, account := range w.eth.TxPool().Locals() {
 		if txs := remoteTxs[account]; len(txs) > 0 {
@@ -961,18 +1146,138 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 		}
 	}
 	if len(localTxs) > 0 {
-		txs := types.NewTransactionsByPriceAndNonce(w.current.signer, localTxs)
-		if w.commitTransactions(txs, w.coinbase, interrupt) {
-			return
+		txs := types.NewTransactionsByPriceAndNonce(env.signer, localTxs)
+		if w.commitTransactions(env, txs, coinbase, interrupt) {
+			return true
 		}
 	}
 	if len(remoteTxs) > 0 {
-		txs := types.NewTransactionsByPriceAndNonce(w.current.signer, remoteTxs)
-		if w.commitTransactions(txs, w.coinbase, interrupt) {
-			return
+		txs := types.NewTransactionsByPriceAndNonce(env.signer, remoteTxs)
+		if w.commitTransactions(env, txs, coinbase, interrupt) {
+			return true
 		}
 	}
-	w.commit(uncles, w.fullTaskHook, true, tstart)
+	return false
+}
+
+type buildReq struct {
+	mutate func(*types.Header, *state.StateDB) error
+	txs    []*types.Transaction
+	signer types.Signer
+	result chan *buildResult
+}
+
+type buildResult struct {
+	block    *types.Block
+	receipts []*types.Receipt
+	state    *state.StateDB
+	err      error
+}
+
+func (w *worker) now() int64 {
+	return time.Now().Unix() + atomic.LoadInt64(&w.timeOffset)
+}
+
+func (w *worker) buildBlock(req *buildReq) *buildResult {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	parent := w.chain.CurrentBlock()
+	timestamp := w.now()
+	if parent.Time() >= uint64(timestamp) {
+		timestamp = int64(parent.Time() + 1)
+	}
+	header, err := w.prepareWork(parent, timestamp, w.coinbase)
+	if err != nil {
+		return &buildResult{err: err}
+	}
+	switch {
+	case req.mutate != nil:
+		if err := req.mutate(w.current.header, w.current.state); err != nil {
+			return &buildResult{err: err}
+		}
+	case len(req.txs) > 0:
+		env := w.current
+		if env.gasPool == nil {
+			env.gasPool = new(core.GasPool).AddGas(env.header.GasLimit)
+		}
+		env.applySigner = req.signer
+		for _, tx := range req.txs {
+			env.state.Prepare(tx.Hash(), common.Hash{}, env.tcount)
+
+			if _, err := w.commitTransaction(env, tx, w.coinbase); err != nil {
+				env.applySigner = nil
+				return &buildResult{err: err}
+			}
+			env.tcount++
+		}
+		env.applySigner = nil
+	default:
+		if bundles := w.eth.TxPool().Bundles(header.Number, header.Time); len(bundles) > 0 {
+			w.commitBundles(w.current, bundles, w.coinbase)
+		}
+		pending, err := w.eth.TxPool().Pending()
+		if err != nil {
+			return &buildResult{err: err}
+		}
+		w.fillTransactions(w.current, pending, w.coinbase, nil)
+	}
+
+	receipts := copyReceipts(w.current.receipts)
+	s := w.current.state.Copy()
+	block, err := w.engine.FinalizeAndAssemble(w.chain, types.CopyHeader(w.current.header), s, w.current.txs, nil, receipts)
+	if err != nil {
+		return &buildResult{err: err}
+	}
+	return &buildResult{block: block, receipts: receipts, state: s}
+}
+
+func (w *worker) requestBlock(req *buildReq) (*types.Block, []*types.Receipt, *state.StateDB, error) {
+	req.result = make(chan *buildResult, 1)
+	select {
+	case w.buildCh <- req:
+	case <-w.exitCh:
+		return nil, nil, nil, errWorkerClosed
+	}
+	res := <-req.result
+	return res.block, res.receipts, res.state, res.err
+}
+
+func (w *worker) buildPayload(parentHash common.Hash, timestamp uint64, coinbase common.Address, extra []byte) *buildResult {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	parent := w.chain.GetBlockByHash(parentHash)
+	if parent == nil {
+		return &buildResult{err: errUnknownParent}
+	}
+	if timestamp <= parent.Time() {
+		return &buildResult{err: errInvalidTimestamp}
+	}
+	if extra == nil {
+		extra = w.extra
+	}
+	env, err := w.prepareEnv(parent, int64(timestamp), coinbase, extra)
+	if err != nil {
+		return &buildResult{err: err}
+	}
+	env.payload = true
+
+	if bundles := w.eth.TxPool().Bundles(env.header.Number, env.header.Time); len(bundles) > 0 {
+		w.commitBundles(env, bundles, coinbase)
+	}
+	pending, err := w.eth.TxPool().Pending()
+	if err != nil {
+		return &buildResult{err: err}
+	}
+	w.fillTransactions(env, pending, coinbase, nil)
+
+	receipts := copyReceipts(env.receipts)
+	block, err := w.engine.FinalizeAndAssemble(w.chain, types.CopyHeader(env.header), env.state, env.txs, nil, receipts)
+	if err != nil {
+		return &buildResult{err: err}
+	}
+	return &buildResult{block: block, receipts: receipts, state: env.state}
 }
 
 
@@ -19,7 +19,9 @@ package node
 import (
 	"context"
 	"fmt"
+	"net"
 	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -94,6 +96,127 @@ func (api *privateAdminAPI) RemovePeer(url string) (bool, error) {
 }
 
 
+
+
+func (api *privateAdminAPI) BanPeer(target string, duration *uint64) (bool, error) {
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	id, network, err := parseBanTarget(target)
+	if err != nil {
+		return false, err
+	}
+	timeout := p2p.DefaultBanDuration
+	if duration != nil {
+		timeout = time.Duration(*duration) * time.Second
+	}
+	if network != nil {
+		err = server.BanNetwork(network, timeout)
+	} else {
+		err = server.BanNode(id, timeout)
+	}
+	return err == nil, err
+}
+
+
+func (api *privateAdminAPI) UnbanPeer(target string) (bool, error) {
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	id, network, err := parseBanTarget(target)
+	if err != nil {
+		return false, err
+	}
+	if network != nil {
+		return server.UnbanNetwork(network)
+	}
+	return server.UnbanNode(id)
+}
+
+
+func (api *privateAdminAPI) ListBans() ([]p2p.BanInfo, error) {
+	server := api.node.Server()
+	if server == nil {
+		return nil, ErrNodeStopped
+	}
+	return server.Bans()
+}
+
+
+func (api *privateAdminAPI) PeerScores() (map[enode.ID]int64, error) {
+	server := api.node.Server()
+	if server == nil {
+		return nil, ErrNodeStopped
+	}
+	return server.PeerScores()
+}
+
+
+
+
+func (api *privateAdminAPI) StartCapture(file string, peers *[]string) (bool, error) {
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	var ids []enode.ID
+	if peers != nil {
+		for _, peer := range *peers {
+			id, err := enode.ParseID(peer)
+			if err != nil {
+				node, perr := enode.Parse(enode.ValidSchemes, peer)
+				if perr != nil {
+					return false, fmt.Errorf("invalid capture peer %q: must be enode URL or node ID", peer)
+				}
+				id = node.ID()
+			}
+			ids = append(ids, id)
+		}
+	}
+	if err := server.StartCapture(file, ids); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+
+func (api *privateAdminAPI) StopCapture() (bool, error) {
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	if err := server.StopCapture(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+
+
+func parseBanTarget(target string) (enode.ID, *net.IPNet, error) {
+	if _, network, err := net.ParseCIDR(target); err == nil {
+		return enode.ID{}, network, nil
+	}
+	if ip := net.ParseIP(target); ip != nil {
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		return enode.ID{}, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	if id, err := enode.ParseID(target); err == nil {
+		return id, nil, nil
+	}
+	node, err := enode.Parse(enode.ValidSchemes, target)
+	if err != nil {
+		return enode.ID{}, nil, fmt.Errorf("invalid ban target %q: must be enode URL, node ID, IP or CIDR", target)
+	}
+	return node.ID(), nil, nil
+}
+
+
 func (api *privateAdminAPI) AddTrustedPeer(url string) (bool, error) {
 	
 	server := api.node.Server()
@@ -298,6 +421,17 @@ func (api *publicAdminAPI) Peers() ([]*p2p.PeerInfo, error) {
 
 
 
+
+func (api *publicAdminAPI) PeerStats() ([]*p2p.PeerStats, error) {
+	server := api.node.Server()
+	if server == nil {
+		return nil, ErrNodeStopped
+	}
+	return server.PeersStats(), nil
+}
+
+
+
 func (api *publicAdminAPI) NodeInfo() (*p2p.NodeInfo, error) {
 	server := api.node.Server()
 	if server == nil {
@@ -0,0 +1,170 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package p2p
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/rlpx"
+)
+
+var errNoCapture = errors.New("no message capture running")
+
+
+var baseProtocolCap = Cap{Name: "p2p", Version: baseProtocolVersion}
+
+
+type msgCapture struct {
+	file  *os.File
+	w     *rlpx.CaptureWriter
+	peers map[enode.ID]struct{}
+
+	writers sync.WaitGroup 
+}
+
+func (c *msgCapture) wants(id enode.ID) bool {
+	if len(c.peers) == 0 {
+		return true
+	}
+	_, ok := c.peers[id]
+	return ok
+}
+
+
+
+func (c *msgCapture) record(id enode.ID, egress bool, cap Cap, code uint64, msg *Msg) {
+	payload, err := ioutil.ReadAll(msg.Payload)
+	msg.Payload = bytes.NewReader(payload)
+	if err != nil {
+		return
+	}
+	at := msg.ReceivedAt
+	if egress || at.IsZero() {
+		at = time.Now()
+	}
+	rec := &rlpx.CaptureRecord{
+		Time:     uint64(at.UnixNano()),
+		Egress:   egress,
+		Peer:     id[:],
+		Protocol: cap.Name,
+		Version:  cap.Version,
+		Code:     code,
+		Payload:  payload,
+	}
+	if err := c.w.Write(rec); err != nil {
+		log.Debug("Failed to write captured message", "file", c.file.Name(), "err", err)
+	}
+}
+
+
+
+func (c *msgCapture) close() error {
+	c.writers.Wait()
+	return c.file.Close()
+}
+
+
+type captureSwitch struct {
+	active *msgCapture
+	lock   sync.RWMutex
+}
+
+func (s *captureSwitch) get(id enode.ID) *msgCapture {
+	if s == nil {
+		return nil
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.active == nil || !s.active.wants(id) {
+		return nil
+	}
+	s.active.writers.Add(1)
+	return s.active
+}
+
+func (s *captureSwitch) start(file string, peers []enode.ID) error {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	c := &msgCapture{file: f, w: rlpx.NewCaptureWriter(f), peers: make(map[enode.ID]struct{}, len(peers))}
+	for _, id := range peers {
+		c.peers[id] = struct{}{}
+	}
+	s.lock.Lock()
+	prev := s.active
+	s.active = c
+	s.lock.Unlock()
+
+	if prev != nil {
+		prev.close()
+	}
+	return nil
+}
+
+func (s *captureSwitch) stop() error {
+	s.lock.Lock()
+	prev := s.active
+	s.active = nil
+	s.lock.Unlock()
+
+	if prev == nil {
+		return errNoCapture
+	}
+	return prev.close()
+}
+
+
+
+
+func (p *Peer) captureMsg(egress bool, cap Cap, code uint64, msg *Msg) {
+	if p == nil {
+		return
+	}
+	if c := p.capture.get(p.ID()); c != nil {
+		c.record(p.ID(), egress, cap, code, msg)
+		c.writers.Done()
+	}
+}
+
+
+
+
+func (srv *Server) StartCapture(file string, peers []enode.ID) error {
+	if err := srv.capture.start(file, peers); err != nil {
+		return err
+	}
+	srv.log.Info("Started devp2p message capture", "file", file, "peers", len(peers))
+	return nil
+}
+
+
+func (srv *Server) StopCapture() error {
+	if err := srv.capture.stop(); err != nil {
+		return err
+	}
+	srv.log.Info("Stopped devp2p message capture")
+	return nil
+}
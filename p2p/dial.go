@@ -63,8 +63,13 @@ type tcpDialer struct {
 	d *net.Dialer
 }
 
-func (t tcpDialer) Dial(ctx context.Context, dest *enode.Node) (net.Conn, error) {
-	return t.d.DialContext(ctx, "tcp", nodeAddr(dest).String())
+func (t tcpDialer) Dial(ctx context.Context, dest *enode.Node) (fd net.Conn, err error) {
+	for _, addr := range reachableAddrs(dest) {
+		if fd, err = t.d.DialContext(ctx, "tcp", addr.String()); err == nil {
+			break
+		}
+	}
+	return fd, err
 }
 
 func nodeAddr(n *enode.Node) net.Addr {
@@ -72,11 +77,58 @@ func nodeAddr(n *enode.Node) net.Addr {
 }
 
 
+
+func nodeAddrs(n *enode.Node) []*net.TCPAddr {
+	var addrs []*net.TCPAddr
+	if ip := n.IPv4(); ip != nil {
+		addrs = append(addrs, &net.TCPAddr{IP: ip, Port: n.TCP()})
+	}
+	if ip := n.IPv6(); ip != nil {
+		addrs = append(addrs, &net.TCPAddr{IP: ip, Port: n.TCP6()})
+	}
+	if len(addrs) == 0 {
+		addrs = append(addrs, &net.TCPAddr{IP: n.IP(), Port: n.TCP()})
+	}
+	return addrs
+}
+
+
+
+
+func reachableAddrs(n *enode.Node) []*net.TCPAddr {
+	addrs := nodeAddrs(n)
+	if len(addrs) < 2 {
+		return addrs
+	}
+	var reachable, unreachable []*net.TCPAddr
+	for _, addr := range addrs {
+		if routable(addr.IP) {
+			reachable = append(reachable, addr)
+		} else {
+			unreachable = append(unreachable, addr)
+		}
+	}
+	return append(reachable, unreachable...)
+}
+
+
+
+var routable = func(ip net.IP) bool {
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: ip, Port: 9})
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+
 var (
 	errSelf             = errors.New("is self")
 	errAlreadyDialing   = errors.New("already dialing")
 	errAlreadyConnected = errors.New("already connected")
 	errRecentlyDialed   = errors.New("recently dialed")
+	errBanned           = errors.New("banned")
 	errNotWhitelisted   = errors.New("not contained in netrestrict whitelist")
 	errNoPort           = errors.New("node does not provide TCP port")
 )
@@ -139,6 +191,7 @@ type dialConfig struct {
 	log            log.Logger
 	clock          mclock.Clock
 	rand           *mrand.Rand
+	banned         func(*enode.Node) bool
 }
 
 func (cfg dialConfig) withDefaults() dialConfig {
@@ -407,6 +460,9 @@ func (d *dialScheduler) checkDial(n *enode.Node) error {
 	if d.history.contains(string(n.ID().Bytes())) {
 		return errRecentlyDialed
 	}
+	if _, static := d.static[n.ID()]; !static && d.banned != nil && d.banned(n) {
+		return errBanned
+	}
 	return nil
 }
 
@@ -0,0 +1,160 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package p2p
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/internal/testlog"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+)
+
+func dualTestNode(entries ...enr.Entry) *enode.Node {
+	var r enr.Record
+	for _, e := range entries {
+		r.Set(e)
+	}
+	return enode.SignNull(&r, enode.ID{0x01})
+}
+
+func TestReachableAddrs(t *testing.T) {
+	var (
+		ip4 = net.IP{10, 0, 0, 1}
+		ip6 = net.ParseIP("2001:db8::1")
+	)
+	defer func(f func(net.IP) bool) { routable = f }(routable)
+
+	tests := []struct {
+		node        *enode.Node
+		unreachable []net.IP
+		want        []string
+	}{
+		{dualTestNode(enr.IPv4(ip4), enr.IPv6(ip6), enr.TCP(30303), enr.TCP6(30304)), nil, []string{"10.0.0.1:30303", "[2001:db8::1]:30304"}},
+		{dualTestNode(enr.IPv4(ip4), enr.IPv6(ip6), enr.TCP(30303), enr.TCP6(30304)), []net.IP{ip4}, []string{"[2001:db8::1]:30304", "10.0.0.1:30303"}},
+		{dualTestNode(enr.IPv4(ip4), enr.IPv6(ip6), enr.TCP(30303), enr.TCP6(30304)), []net.IP{ip6}, []string{"10.0.0.1:30303", "[2001:db8::1]:30304"}},
+		{dualTestNode(enr.IPv4(ip4), enr.IPv6(ip6), enr.TCP(30303), enr.TCP6(30304)), []net.IP{ip4, ip6}, []string{"10.0.0.1:30303", "[2001:db8::1]:30304"}},
+		{dualTestNode(enr.IPv4(ip4), enr.IPv6(ip6), enr.TCP(30303)), nil, []string{"10.0.0.1:30303", "[2001:db8::1]:30303"}},
+		{dualTestNode(enr.IPv6(ip6), enr.TCP(30303)), []net.IP{ip6}, []string{"[2001:db8::1]:30303"}},
+		{dualTestNode(enr.IPv4(ip4), enr.TCP(30303)), nil, []string{"10.0.0.1:30303"}},
+	}
+	for i, test := range tests {
+		routable = func(ip net.IP) bool {
+			for _, unreachable := range test.unreachable {
+				if ip.Equal(unreachable) {
+					return false
+				}
+			}
+			return true
+		}
+		addrs := reachableAddrs(test.node)
+		if len(addrs) != len(test.want) {
+			t.Errorf("test %d: wrong addresses: have %v, want %v", i, addrs, test.want)
+			continue
+		}
+		for j, addr := range addrs {
+			if addr.String() != test.want[j] {
+				t.Errorf("test %d: address %d mismatch: have %v, want %v", i, j, addr, test.want[j])
+			}
+		}
+	}
+}
+
+func TestTCPDialerFallback(t *testing.T) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+	defer func(f func(net.IP) bool) { routable = f }(routable)
+	routable = func(ip net.IP) bool { return ip.To4() == nil }
+
+
+	var (
+		port   = listener.Addr().(*net.TCPAddr).Port
+		closed = dualTestNode(enr.IPv4(net.IP{127, 0, 0, 1}), enr.IPv6(net.IPv6loopback), enr.TCP(port), enr.TCP6(1))
+		dialer = tcpDialer{&net.Dialer{Timeout: time.Second}}
+	)
+	if addrs := reachableAddrs(closed); addrs[0].IP.To4() != nil {
+		t.Fatalf("IPv6 address not preferred: %v", addrs)
+	}
+	conn, err := dialer.Dial(context.Background(), closed)
+	if err != nil {
+		t.Fatalf("dial did not fall back to IPv4: %v", err)
+	}
+	defer conn.Close()
+	if addr := conn.RemoteAddr().(*net.TCPAddr); addr.Port != port || addr.IP.To4() == nil {
+		t.Fatalf("dialed wrong address: %v", addr)
+	}
+}
+
+func TestServerDualStackRecord(t *testing.T) {
+	if conn, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback}); err != nil {
+		t.Skip("IPv6 loopback unavailable:", err)
+	} else {
+		conn.Close()
+	}
+	key, _ := crypto.GenerateKey()
+	srv := &Server{
+		Config: Config{
+			PrivateKey:  key,
+			MaxPeers:    10,
+			ListenAddr:  "127.0.0.1:0",
+			ListenAddr6: "[::1]:0",
+			NoDial:      true,
+			Logger:      testlog.Logger(t, log.LvlError),
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer srv.Stop()
+
+	var (
+		self = srv.Self()
+		tcp4 = srv.listener.Addr().(*net.TCPAddr).Port
+		tcp6 = srv.listener6.Addr().(*net.TCPAddr).Port
+	)
+	if srv.ntab == nil {
+		t.Fatal("discovery not running")
+	}
+	if !self.IPv4().Equal(net.IP{127, 0, 0, 1}) || !self.IPv6().Equal(net.IPv6loopback) {
+		t.Fatalf("wrong advertised IPs: ip %v, ip6 %v", self.IPv4(), self.IPv6())
+	}
+	if self.TCP() != tcp4 || self.TCP6() != tcp6 {
+		t.Fatalf("wrong advertised TCP ports: tcp %d, tcp6 %d, want %d, %d", self.TCP(), self.TCP6(), tcp4, tcp6)
+	}
+	if self.UDP() == 0 || self.UDP6() == 0 {
+		t.Fatalf("wrong advertised UDP ports: udp %d, udp6 %d", self.UDP(), self.UDP6())
+	}
+	if self.UDP() != self.UDP6() {
+		var udp6 enr.UDP6
+		if err := self.Load(&udp6); err != nil {
+			t.Fatalf("udp6 entry missing: %v", err)
+		}
+	}
+}
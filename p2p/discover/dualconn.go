@@ -0,0 +1,119 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package discover
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/p2p/netutil"
+)
+
+var (
+	errDualConnClosed = errors.New("use of closed network connection")
+	errNoSocket       = errors.New("no socket for address family")
+)
+
+
+type dualPacket struct {
+	data []byte
+	addr *net.UDPAddr
+	err  error
+}
+
+
+
+
+type DualConn struct {
+	conn4, conn6 UDPConn
+	packets      chan dualPacket
+	closing      chan struct{}
+	closeOnce    sync.Once
+}
+
+
+
+func NewDualConn(conn4, conn6 UDPConn) *DualConn {
+	c := &DualConn{
+		conn4:   conn4,
+		conn6:   conn6,
+		packets: make(chan dualPacket),
+		closing: make(chan struct{}),
+	}
+	go c.readLoop(conn4)
+	go c.readLoop(conn6)
+	return c
+}
+
+func (c *DualConn) readLoop(conn UDPConn) {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		p := dualPacket{addr: from, err: err}
+		if err == nil {
+			p.data = append([]byte(nil), buf[:n]...)
+		}
+		select {
+		case c.packets <- p:
+		case <-c.closing:
+			return
+		}
+		if err != nil && !netutil.IsTemporaryError(err) {
+			return
+		}
+	}
+}
+
+
+func (c *DualConn) ReadFromUDP(b []byte) (n int, addr *net.UDPAddr, err error) {
+	select {
+	case p := <-c.packets:
+		if p.err != nil {
+			return 0, p.addr, p.err
+		}
+		return copy(b, p.data), p.addr, nil
+	case <-c.closing:
+		return 0, nil, errDualConnClosed
+	}
+}
+
+
+func (c *DualConn) WriteToUDP(b []byte, addr *net.UDPAddr) (n int, err error) {
+	if addr.IP.To4() != nil {
+		return c.conn4.WriteToUDP(b, addr)
+	}
+	return c.conn6.WriteToUDP(b, addr)
+}
+
+
+func (c *DualConn) Close() error {
+	err := errDualConnClosed
+	c.closeOnce.Do(func() {
+		close(c.closing)
+		err4, err6 := c.conn4.Close(), c.conn6.Close()
+		if err = err4; err == nil {
+			err = err6
+		}
+	})
+	return err
+}
+
+
+func (c *DualConn) LocalAddr() net.Addr {
+	return c.conn4.LocalAddr()
+}
@@ -0,0 +1,181 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package discover
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type dualTestPacket struct {
+	data []byte
+	addr *net.UDPAddr
+}
+
+type dualTestConn struct {
+	local   *net.UDPAddr
+	in      chan dualTestPacket
+	closing chan struct{}
+
+	mu     sync.Mutex
+	sent   []dualTestPacket
+	closed bool
+}
+
+func newDualTestConn(local string) *dualTestConn {
+	addr, _ := net.ResolveUDPAddr("udp", local)
+	return &dualTestConn{local: addr, in: make(chan dualTestPacket, 8), closing: make(chan struct{})}
+}
+
+func (c *dualTestConn) ReadFromUDP(b []byte) (int, *net.UDPAddr, error) {
+	select {
+	case p := <-c.in:
+		return copy(b, p.data), p.addr, nil
+	case <-c.closing:
+		return 0, nil, errors.New("closed")
+	}
+}
+
+func (c *dualTestConn) WriteToUDP(b []byte, addr *net.UDPAddr) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, dualTestPacket{append([]byte(nil), b...), addr})
+	return len(b), nil
+}
+
+func (c *dualTestConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.closing)
+	}
+	return nil
+}
+
+func (c *dualTestConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *dualTestConn) packets() []dualTestPacket {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]dualTestPacket(nil), c.sent...)
+}
+
+func TestDualConnWrite(t *testing.T) {
+	var (
+		conn4 = newDualTestConn("127.0.0.1:30303")
+		conn6 = newDualTestConn("[::1]:30304")
+		conn  = NewDualConn(conn4, conn6)
+	)
+	defer conn.Close()
+
+	tests := []struct {
+		addr *net.UDPAddr
+		want *dualTestConn
+	}{
+		{&net.UDPAddr{IP: net.IP{10, 0, 0, 1}, Port: 1}, conn4},
+		{&net.UDPAddr{IP: net.ParseIP("::ffff:10.0.0.2"), Port: 2}, conn4},
+		{&net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 3}, conn6},
+		{&net.UDPAddr{IP: net.IPv6loopback, Port: 4}, conn6},
+	}
+	for i, test := range tests {
+		if _, err := conn.WriteToUDP([]byte{byte(i)}, test.addr); err != nil {
+			t.Fatalf("write to %v failed: %v", test.addr, err)
+		}
+		sent := test.want.packets()
+		if len(sent) == 0 || !sent[len(sent)-1].addr.IP.Equal(test.addr.IP) || sent[len(sent)-1].data[0] != byte(i) {
+			t.Errorf("write to %v not routed to %v", test.addr, test.want.local)
+		}
+	}
+	if n4, n6 := len(conn4.packets()), len(conn6.packets()); n4 != 2 || n6 != 2 {
+		t.Errorf("wrong packet split: %d over IPv4, %d over IPv6", n4, n6)
+	}
+	if addr := conn.LocalAddr(); addr != conn4.local {
+		t.Errorf("wrong local address: have %v, want %v", addr, conn4.local)
+	}
+}
+
+func TestDualConnRead(t *testing.T) {
+	var (
+		conn4 = newDualTestConn("127.0.0.1:30303")
+		conn6 = newDualTestConn("[::1]:30304")
+		conn  = NewDualConn(conn4, conn6)
+		from4 = &net.UDPAddr{IP: net.IP{10, 0, 0, 1}, Port: 1}
+		from6 = &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 2}
+	)
+	conn4.in <- dualTestPacket{[]byte("ping4"), from4}
+	conn6.in <- dualTestPacket{[]byte("ping6"), from6}
+
+	seen := make(map[string]*net.UDPAddr)
+	buf := make([]byte, maxPacketSize)
+	for i := 0; i < 2; i++ {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		seen[string(buf[:n])] = from
+	}
+	if seen["ping4"] != from4 || seen["ping6"] != from6 {
+		t.Fatalf("wrong packets read: %v", seen)
+	}
+
+
+	conn4.in <- dualTestPacket{bytes.Repeat([]byte{0x01}, 64), from4}
+	conn6.in <- dualTestPacket{bytes.Repeat([]byte{0x02}, 64), from6}
+	for i := 0; i < 2; i++ {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		want := byte(0x01)
+		if from == from6 {
+			want = 0x02
+		}
+		if !bytes.Equal(buf[:n], bytes.Repeat([]byte{want}, 64)) {
+			t.Fatalf("packet from %v corrupted", from)
+		}
+	}
+
+	if err := conn.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if !conn4.closed || !conn6.closed {
+		t.Fatal("underlying sockets not closed")
+	}
+	if err := conn.Close(); err != errDualConnClosed {
+		t.Fatalf("second close: have %v, want %v", err, errDualConnClosed)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := conn.ReadFromUDP(buf)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("read after close succeeded")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("read after close blocked")
+	}
+}
@@ -0,0 +1,175 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package discover
+
+import (
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/mclock"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	adLifetime           = 15 * time.Minute
+	maxTopicQueueLength  = 100
+	maxTopicTableEntries = 10000
+	ticketWindow         = 10 * time.Second
+)
+
+var (
+	errInvalidTicket = errors.New("invalid ticket")
+	errTicketEarly   = errors.New("ticket used before waiting time")
+	errTicketExpired = errors.New("ticket expired")
+)
+
+type Topic string
+
+func (t Topic) id() enode.ID {
+	return enode.ID(sha256.Sum256([]byte(t)))
+}
+
+type topicAd struct {
+	topic   Topic
+	node    *enode.Node
+	expires mclock.AbsTime
+}
+
+type ticket struct {
+	Node   enode.ID
+	IP     net.IP
+	Topic  Topic
+	Issued uint64
+	Wait   uint64
+}
+
+type topicTable struct {
+	key    []byte
+	queues map[Topic][]*topicAd
+	all    []*topicAd
+}
+
+func newTopicTable() *topicTable {
+	key := make([]byte, sha256.Size)
+	crand.Read(key)
+	return &topicTable{key: key, queues: make(map[Topic][]*topicAd)}
+}
+
+func (tab *topicTable) expire(now mclock.AbsTime) {
+	for len(tab.all) > 0 && tab.all[0].expires <= now {
+		ad := tab.all[0]
+		tab.all = tab.all[1:]
+		queue := tab.queues[ad.topic]
+		for i := range queue {
+			if queue[i] == ad {
+				queue = append(queue[:i], queue[i+1:]...)
+				break
+			}
+		}
+		if len(queue) == 0 {
+			delete(tab.queues, ad.topic)
+		} else {
+			tab.queues[ad.topic] = queue
+		}
+	}
+}
+
+func (tab *topicTable) waitTime(topic Topic, id enode.ID, now mclock.AbsTime) time.Duration {
+	tab.expire(now)
+
+	var wait time.Duration
+	queue := tab.queues[topic]
+	for _, ad := range queue {
+		if ad.node.ID() == id {
+			wait = ad.expires.Sub(now)
+		}
+	}
+	if len(queue) >= maxTopicQueueLength {
+		if d := queue[0].expires.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	if len(tab.all) >= maxTopicTableEntries {
+		if d := tab.all[0].expires.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+func (tab *topicTable) register(topic Topic, n *enode.Node, now mclock.AbsTime) bool {
+	if tab.waitTime(topic, n.ID(), now) > 0 {
+		return false
+	}
+	ad := &topicAd{topic: topic, node: n, expires: now.Add(adLifetime)}
+	tab.queues[topic] = append(tab.queues[topic], ad)
+	tab.all = append(tab.all, ad)
+	return true
+}
+
+func (tab *topicTable) nodes(topic Topic, now mclock.AbsTime) []*enode.Node {
+	tab.expire(now)
+
+	queue := tab.queues[topic]
+	nodes := make([]*enode.Node, 0, len(queue))
+	for i := len(queue) - 1; i >= 0; i-- {
+		nodes = append(nodes, queue[i].node)
+	}
+	return nodes
+}
+
+func (tab *topicTable) issueTicket(topic Topic, id enode.ID, ip net.IP, now mclock.AbsTime) ([]byte, time.Duration) {
+	wait := tab.waitTime(topic, id, now)
+	enc, _ := rlp.EncodeToBytes(&ticket{Node: id, IP: ip, Topic: topic, Issued: uint64(now), Wait: uint64(wait)})
+	return append(enc, tab.mac(enc)...), wait
+}
+
+func (tab *topicTable) checkTicket(data []byte, id enode.ID, ip net.IP, now mclock.AbsTime) (Topic, error) {
+	if len(data) < sha256.Size {
+		return "", errInvalidTicket
+	}
+	enc, mac := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+	if !hmac.Equal(mac, tab.mac(enc)) {
+		return "", errInvalidTicket
+	}
+	var t ticket
+	if err := rlp.DecodeBytes(enc, &t); err != nil {
+		return "", errInvalidTicket
+	}
+	if t.Node != id || !t.IP.Equal(ip) {
+		return "", errInvalidTicket
+	}
+	start := mclock.AbsTime(t.Issued).Add(time.Duration(t.Wait))
+	switch {
+	case now < start:
+		return "", errTicketEarly
+	case now > start.Add(ticketWindow):
+		return "", errTicketExpired
+	}
+	return t.Topic, nil
+}
+
+func (tab *topicTable) mac(data []byte) []byte {
+	h := hmac.New(sha256.New, tab.key)
+	h.Write(data)
+	return h.Sum(nil)
+}
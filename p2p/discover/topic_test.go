@@ -0,0 +1,169 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package discover
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/mclock"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+)
+
+func topicTestNode(i int) *enode.Node {
+	var id enode.ID
+	id[0], id[1] = byte(i>>8), byte(i)
+	return enode.SignNull(new(enr.Record), id)
+}
+
+func TestTopicTableRegister(t *testing.T) {
+	var (
+		tab = newTopicTable()
+		now mclock.AbsTime
+	)
+	for i := 0; i < maxTopicQueueLength; i++ {
+		if wait := tab.waitTime("a", topicTestNode(i).ID(), now); wait != 0 {
+			t.Fatalf("node %d: wait time %v in non-full queue", i, wait)
+		}
+		if !tab.register("a", topicTestNode(i), now) {
+			t.Fatalf("node %d: registration rejected in non-full queue", i)
+		}
+		now = now.Add(time.Second)
+	}
+
+
+	wantOwn := adLifetime - time.Duration(maxTopicQueueLength-5)*time.Second
+	if wait := tab.waitTime("a", topicTestNode(5).ID(), now); wait != wantOwn {
+		t.Errorf("wrong wait time for registered node: have %v, want %v", wait, wantOwn)
+	}
+	if tab.register("a", topicTestNode(5), now) {
+		t.Error("node registered twice")
+	}
+
+
+	wantFull := adLifetime - time.Duration(maxTopicQueueLength)*time.Second
+	if wait := tab.waitTime("a", topicTestNode(1000).ID(), now); wait != wantFull {
+		t.Errorf("wrong wait time for full queue: have %v, want %v", wait, wantFull)
+	}
+	if tab.register("a", topicTestNode(1000), now) {
+		t.Error("registration accepted in full queue")
+	}
+	if !tab.register("b", topicTestNode(1000), now) {
+		t.Error("full queue blocked registration for another topic")
+	}
+
+
+	now = now.Add(wantFull)
+	if !tab.register("a", topicTestNode(1000), now) {
+		t.Fatal("registration rejected after waiting")
+	}
+	nodes := tab.nodes("a", now)
+	if len(nodes) != maxTopicQueueLength {
+		t.Fatalf("wrong queue length: have %d, want %d", len(nodes), maxTopicQueueLength)
+	}
+	if nodes[0].ID() != topicTestNode(1000).ID() {
+		t.Errorf("newest ad not returned first: have %v", nodes[0].ID())
+	}
+
+
+	now = now.Add(adLifetime)
+	if nodes := tab.nodes("a", now); len(nodes) != 0 {
+		t.Errorf("%d ads not expired", len(nodes))
+	}
+	if len(tab.all) != 0 || len(tab.queues) != 0 {
+		t.Errorf("expired ads left in table: %d ads, %d queues", len(tab.all), len(tab.queues))
+	}
+}
+
+func TestTopicTableFull(t *testing.T) {
+	var (
+		tab = newTopicTable()
+		now mclock.AbsTime
+	)
+	for i := 0; i < maxTopicTableEntries; i++ {
+		topic := Topic(string(rune('a' + i%100)))
+		if !tab.register(topic, topicTestNode(i), now) {
+			t.Fatalf("ad %d rejected in non-full table", i)
+		}
+	}
+	now = now.Add(time.Minute)
+	if wait := tab.waitTime("new", topicTestNode(1).ID(), now); wait != adLifetime-time.Minute {
+		t.Errorf("wrong wait time for full table: have %v, want %v", wait, adLifetime-time.Minute)
+	}
+	if tab.register("new", topicTestNode(1), now) {
+		t.Error("registration accepted in full table")
+	}
+	now = now.Add(adLifetime - time.Minute)
+	if !tab.register("new", topicTestNode(1), now) {
+		t.Error("registration rejected after table expiry")
+	}
+}
+
+func TestTopicTableTicket(t *testing.T) {
+	var (
+		tab   = newTopicTable()
+		id    = topicTestNode(1).ID()
+		ip    = net.IP{1, 2, 3, 4}
+		issue = mclock.AbsTime(time.Minute)
+	)
+	for i := 0; i < maxTopicQueueLength; i++ {
+		tab.register("a", topicTestNode(i+10), 0)
+	}
+	ticket, wait := tab.issueTicket("a", id, ip, issue)
+	if wait != adLifetime-time.Minute {
+		t.Fatalf("wrong ticket wait time: have %v, want %v", wait, adLifetime-time.Minute)
+	}
+	start := issue.Add(wait)
+
+	tampered := append([]byte(nil), ticket...)
+	tampered[3]++
+
+	tests := []struct {
+		name   string
+		ticket []byte
+		id     enode.ID
+		ip     net.IP
+		now    mclock.AbsTime
+		err    error
+	}{
+		{name: "valid", ticket: ticket, id: id, ip: net.ParseIP("1.2.3.4"), now: start},
+		{name: "window end", ticket: ticket, id: id, ip: ip, now: start.Add(ticketWindow)},
+		{name: "early", ticket: ticket, id: id, ip: ip, now: start - 1, err: errTicketEarly},
+		{name: "expired", ticket: ticket, id: id, ip: ip, now: start.Add(ticketWindow + 1), err: errTicketExpired},
+		{name: "wrong ip", ticket: ticket, id: id, ip: net.IP{1, 2, 3, 5}, now: start, err: errInvalidTicket},
+		{name: "wrong node", ticket: ticket, id: topicTestNode(2).ID(), ip: ip, now: start, err: errInvalidTicket},
+		{name: "tampered", ticket: tampered, id: id, ip: ip, now: start, err: errInvalidTicket},
+		{name: "truncated", ticket: ticket[:10], id: id, ip: ip, now: start, err: errInvalidTicket},
+	}
+	for _, test := range tests {
+		topic, err := tab.checkTicket(test.ticket, test.id, test.ip, test.now)
+		if err != test.err {
+			t.Errorf("%s: wrong error: have %v, want %v", test.name, err, test.err)
+			continue
+		}
+		if err == nil && topic != "a" {
+			t.Errorf("%s: wrong topic %q", test.name, topic)
+		}
+	}
+
+
+	if _, err := newTopicTable().checkTicket(ticket, id, ip, start); err != errInvalidTicket {
+		t.Errorf("ticket accepted by another table: %v", err)
+	}
+}
@@ -535,7 +535,7 @@ func (t *UDPv4) readLoop(unhandled chan<- ReadPacket) {
 		}
 		if t.handlePacket(from, buf[:nbytes]) != nil && unhandled != nil {
 			select {
-			case unhandled <- ReadPacket{buf[:nbytes], from}:
+			case unhandled <- ReadPacket{append([]byte(nil), buf[:nbytes]...), from}:
 			default:
 			}
 		}
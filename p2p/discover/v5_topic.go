@@ -0,0 +1,287 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package discover
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/discover/v5wire"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+	"github.com/ethereum/go-ethereum/p2p/netutil"
+)
+
+const (
+	maxTopicRegistrars  = 8
+	maxTicketFailures   = 3
+	topicLookupInterval = time.Minute
+	topicSearchInterval = time.Minute
+)
+
+var errAdMismatch = errors.New("advertised record does not match sender")
+
+func (t *UDPv5) RegisterTopic(topic Topic, stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(t.closeCtx)
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var (
+		wg     sync.WaitGroup
+		active = make(map[enode.ID]bool)
+		done   = make(chan enode.ID)
+	)
+	defer wg.Wait()
+	for {
+		for _, n := range t.topicRegistrars(ctx, topic) {
+			if active[n.ID()] {
+				continue
+			}
+			active[n.ID()] = true
+			wg.Add(1)
+			go func(n *enode.Node) {
+				defer wg.Done()
+				t.registerAt(ctx, n, topic)
+				select {
+				case done <- n.ID():
+				case <-ctx.Done():
+				}
+			}(n)
+		}
+
+		timer := t.clock.NewTimer(topicLookupInterval)
+	wait:
+		for {
+			select {
+			case id := <-done:
+				delete(active, id)
+			case <-timer.C():
+				break wait
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+		}
+	}
+}
+
+func (t *UDPv5) registerAt(ctx context.Context, n *enode.Node, topic Topic) {
+	for failures := 0; failures < maxTicketFailures; {
+		ticket, wait, err := t.requestTicket(n, topic)
+		if err != nil {
+			t.log.Debug("Topic ticket request failed", "topic", topic, "id", n.ID(), "err", err)
+			return
+		}
+		if !t.sleep(ctx, wait) {
+			return
+		}
+		registered, err := t.regtopic(n, ticket)
+		switch {
+		case err != nil:
+			t.log.Debug("Topic registration failed", "topic", topic, "id", n.ID(), "err", err)
+			return
+		case registered:
+			failures = 0
+			t.log.Trace("Registered topic", "topic", topic, "id", n.ID())
+			if !t.sleep(ctx, adLifetime) {
+				return
+			}
+		default:
+			failures++
+		}
+	}
+}
+
+func (t *UDPv5) topicRegistrars(ctx context.Context, topic Topic) []*enode.Node {
+	nodes := t.newLookup(ctx, topic.id()).run()
+	if len(nodes) > maxTopicRegistrars {
+		nodes = nodes[:maxTopicRegistrars]
+	}
+	return nodes
+}
+
+func (t *UDPv5) sleep(ctx context.Context, d time.Duration) bool {
+	timer := t.clock.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (t *UDPv5) TopicSearch(topic Topic) enode.Iterator {
+	ctx, cancel := context.WithCancel(t.closeCtx)
+	return &topicIterator{t: t, topic: topic, ctx: ctx, cancel: cancel}
+}
+
+type topicIterator struct {
+	t        *UDPv5
+	topic    Topic
+	ctx      context.Context
+	cancel   func()
+	buffer   []*enode.Node
+	searched bool
+}
+
+func (it *topicIterator) Node() *enode.Node {
+	if len(it.buffer) == 0 {
+		return nil
+	}
+	return it.buffer[0]
+}
+
+func (it *topicIterator) Next() bool {
+	if len(it.buffer) > 0 {
+		it.buffer = it.buffer[1:]
+	}
+	for len(it.buffer) == 0 {
+		if it.ctx.Err() != nil {
+			it.buffer = nil
+			return false
+		}
+		if it.searched && !it.t.sleep(it.ctx, topicSearchInterval) {
+			continue
+		}
+		it.searched = true
+		it.buffer = it.search()
+	}
+	return true
+}
+
+func (it *topicIterator) Close() {
+	it.cancel()
+}
+
+func (it *topicIterator) search() []*enode.Node {
+	var (
+		result []*enode.Node
+		seen   = make(map[enode.ID]bool)
+	)
+	for _, n := range it.t.topicRegistrars(it.ctx, it.topic) {
+		if it.ctx.Err() != nil {
+			break
+		}
+		nodes, err := it.t.topicQuery(n, it.topic)
+		if err != nil {
+			it.t.log.Debug("Topic query failed", "topic", it.topic, "id", n.ID(), "err", err)
+		}
+		for _, rn := range nodes {
+			if rn.ID() != it.t.Self().ID() && !seen[rn.ID()] {
+				seen[rn.ID()] = true
+				result = append(result, rn)
+			}
+		}
+	}
+	return result
+}
+
+func (t *UDPv5) requestTicket(n *enode.Node, topic Topic) ([]byte, time.Duration, error) {
+	resp := t.call(n, v5wire.TicketMsg, &v5wire.RequestTicket{Topic: []byte(topic)})
+	defer t.callDone(resp)
+
+	select {
+	case p := <-resp.ch:
+		ticket := p.(*v5wire.Ticket)
+		return ticket.Ticket, time.Duration(ticket.WaitTime) * time.Second, nil
+	case err := <-resp.err:
+		return nil, 0, err
+	}
+}
+
+func (t *UDPv5) regtopic(n *enode.Node, ticket []byte) (bool, error) {
+	resp := t.call(n, v5wire.RegconfirmationMsg, &v5wire.Regtopic{Ticket: ticket, ENR: t.Self().Record()})
+	defer t.callDone(resp)
+
+	select {
+	case p := <-resp.ch:
+		return p.(*v5wire.Regconfirmation).Registered, nil
+	case err := <-resp.err:
+		return false, err
+	}
+}
+
+func (t *UDPv5) topicQuery(n *enode.Node, topic Topic) ([]*enode.Node, error) {
+	resp := t.call(n, v5wire.NodesMsg, &v5wire.TopicQuery{Topic: []byte(topic)})
+	return t.waitForNodes(resp, nil)
+}
+
+func (t *UDPv5) handleRequestTicket(p *v5wire.RequestTicket, fromID enode.ID, fromAddr *net.UDPAddr) {
+	ticket, wait := t.topics.issueTicket(Topic(p.Topic), fromID, fromAddr.IP, t.clock.Now())
+	t.sendResponse(fromID, fromAddr, &v5wire.Ticket{
+		ReqID:    p.ReqID,
+		Ticket:   ticket,
+		WaitTime: uint((wait + time.Second - 1) / time.Second),
+	})
+}
+
+func (t *UDPv5) handleRegtopic(p *v5wire.Regtopic, fromID enode.ID, fromAddr *net.UDPAddr) {
+	resp := &v5wire.Regconfirmation{ReqID: p.ReqID}
+	now := t.clock.Now()
+	topic, err := t.topics.checkTicket(p.Ticket, fromID, fromAddr.IP, now)
+	if err == nil {
+		var n *enode.Node
+		if n, err = t.verifyAd(p.ENR, fromID); err == nil {
+			resp.Registered = t.topics.register(topic, n, now)
+		}
+	}
+	if err != nil {
+		t.log.Debug("Rejected "+p.Name(), "id", fromID, "addr", fromAddr, "err", err)
+	}
+	t.sendResponse(fromID, fromAddr, resp)
+}
+
+func (t *UDPv5) verifyAd(r *enr.Record, fromID enode.ID) (*enode.Node, error) {
+	if r == nil {
+		return nil, errAdMismatch
+	}
+	n, err := enode.New(t.validSchemes, r)
+	if err != nil {
+		return nil, err
+	}
+	if n.ID() != fromID {
+		return nil, errAdMismatch
+	}
+	return n, nil
+}
+
+func (t *UDPv5) handleTopicQuery(p *v5wire.TopicQuery, fromID enode.ID, fromAddr *net.UDPAddr) {
+	var nodes []*enode.Node
+	for _, n := range t.topics.nodes(Topic(p.Topic), t.clock.Now()) {
+		if netutil.CheckRelayIP(fromAddr.IP, n.IP()) != nil {
+			continue
+		}
+		nodes = append(nodes, n)
+		if len(nodes) >= findnodeResultLimit {
+			break
+		}
+	}
+	for _, resp := range packNodes(p.ReqID, nodes) {
+		t.sendResponse(fromID, fromAddr, resp)
+	}
+}
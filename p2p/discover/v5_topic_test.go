@@ -0,0 +1,113 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package discover
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/internal/testlog"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+)
+
+
+func startLocalhostV5(t *testing.T, cfg Config) *UDPv5 {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.PrivateKey = key
+	cfg.Log = testlog.Logger(t, log.LvlTrace)
+	db, _ := enode.OpenDB("")
+	ln := enode.NewLocalNode(db, key)
+
+	socket, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IP{127, 0, 0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := socket.LocalAddr().(*net.UDPAddr)
+	ln.SetStaticIP(addr.IP)
+	ln.Set(enr.UDP(addr.Port))
+	udp, err := ListenV5(socket, ln, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return udp
+}
+
+
+func TestUDPv5_topicE2E(t *testing.T) {
+	t.Parallel()
+
+	const topic = Topic("LES2@test")
+	var (
+		registrar  = startLocalhostV5(t, Config{})
+		advertiser = startLocalhostV5(t, Config{Bootnodes: []*enode.Node{registrar.Self()}})
+		searcher   = startLocalhostV5(t, Config{Bootnodes: []*enode.Node{registrar.Self()}})
+	)
+	defer registrar.Close()
+	defer advertiser.Close()
+	defer searcher.Close()
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		advertiser.RegisterTopic(topic, stop)
+		close(done)
+	}()
+
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		nodes, err := searcher.topicQuery(registrar.Self(), topic)
+		if err == nil && len(nodes) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ad not registered (last error: %v)", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	it := searcher.TopicSearch(topic)
+	defer it.Close()
+	found := make(chan *enode.Node, 1)
+	go func() {
+		if it.Next() {
+			found <- it.Node()
+		}
+	}()
+	select {
+	case n := <-found:
+		if n.ID() != advertiser.Self().ID() {
+			t.Fatalf("search returned wrong node %v, want %v", n.ID(), advertiser.Self().ID())
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("topic search returned no results")
+	}
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("RegisterTopic did not return after stop")
+	}
+}
@@ -121,8 +121,9 @@ type (
 
 	
 	Ticket struct {
-		ReqID  []byte
-		Ticket []byte
+		ReqID    []byte
+		Ticket   []byte
+		WaitTime uint 
 	}
 
 	
@@ -185,6 +185,16 @@ func (ln *LocalNode) SetFallbackUDP(port int) {
 
 
 
+func (ln *LocalNode) SetFallbackUDP6(port int) {
+	ln.mu.Lock()
+	defer ln.mu.Unlock()
+
+	ln.endpoint6.fallbackUDP = port
+	ln.updateEndpoints()
+}
+
+
+
 func (ln *LocalNode) UDPEndpointStatement(fromaddr, endpoint *net.UDPAddr) {
 	ln.mu.Lock()
 	defer ln.mu.Unlock()
@@ -0,0 +1,71 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package enode
+
+import (
+	"net"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+)
+
+func TestLocalNodeDualStack(t *testing.T) {
+	db, _ := OpenDB("")
+	defer db.Close()
+	key, _ := crypto.GenerateKey()
+	ln := NewLocalNode(db, key)
+
+	var (
+		ip4 = net.IP{10, 0, 0, 1}
+		ip6 = net.ParseIP("2001:db8::1")
+	)
+	ln.SetFallbackIP(ip4)
+	ln.SetFallbackIP(ip6)
+	ln.SetFallbackUDP(30303)
+
+	n := ln.Node()
+	if !n.IPv4().Equal(ip4) || !n.IPv6().Equal(ip6) {
+		t.Fatalf("wrong advertised IPs: ip %v, ip6 %v", n.IPv4(), n.IPv6())
+	}
+	if n.UDP() != 30303 || n.UDP6() != 30303 {
+		t.Fatalf("wrong advertised UDP ports: udp %d, udp6 %d", n.UDP(), n.UDP6())
+	}
+	if err := n.Load(new(enr.UDP6)); err == nil {
+		t.Fatal("redundant udp6 entry advertised")
+	}
+
+
+	ln.SetFallbackUDP6(30304)
+	n = ln.Node()
+	if n.UDP() != 30303 || n.UDP6() != 30304 {
+		t.Fatalf("wrong advertised UDP ports: udp %d, udp6 %d", n.UDP(), n.UDP6())
+	}
+	var udp6 enr.UDP6
+	if err := n.Load(&udp6); err != nil || udp6 != 30304 {
+		t.Fatalf("udp6 entry missing: %v", err)
+	}
+	if n.IP().To4() == nil {
+		t.Fatalf("IPv4 address not preferred: %v", n.IP())
+	}
+
+
+	ln.SetStaticIP(net.IPv6unspecified)
+	if n = ln.Node(); n.IPv6() != nil {
+		t.Fatalf("unspecified IPv6 advertised: %v", n.IPv6())
+	}
+}
@@ -115,6 +115,24 @@ func (n *Node) IP() net.IP {
 }
 
 
+func (n *Node) IPv4() net.IP {
+	var ip enr.IPv4
+	if n.Load(&ip) == nil {
+		return net.IP(ip)
+	}
+	return nil
+}
+
+
+func (n *Node) IPv6() net.IP {
+	var ip enr.IPv6
+	if n.Load(&ip) == nil {
+		return net.IP(ip)
+	}
+	return nil
+}
+
+
 func (n *Node) UDP() int {
 	var port enr.UDP
 	n.Load(&port)
@@ -122,6 +140,16 @@ func (n *Node) UDP() int {
 }
 
 
+
+func (n *Node) UDP6() int {
+	var port enr.UDP6
+	if n.Load(&port) == nil {
+		return int(port)
+	}
+	return n.UDP()
+}
+
+
 func (n *Node) TCP() int {
 	var port enr.TCP
 	n.Load(&port)
@@ -129,6 +157,16 @@ func (n *Node) TCP() int {
 }
 
 
+
+func (n *Node) TCP6() int {
+	var port enr.TCP6
+	if n.Load(&port) == nil {
+		return int(port)
+	}
+	return n.TCP()
+}
+
+
 func (n *Node) Pubkey() *ecdsa.PublicKey {
 	var key ecdsa.PublicKey
 	if n.Load((*Secp256k1)(&key)) != nil {
@@ -40,6 +40,8 @@ const (
 	dbVersionKey   = "version" 
 	dbNodePrefix   = "n:"      
 	dbLocalPrefix  = "local:"
+	dbBanPrefix    = "ban:"
+	dbScorePrefix  = "score:"
 	dbDiscoverRoot = "v4"
 	dbDiscv5Root   = "v5"
 
@@ -400,6 +402,61 @@ func (db *DB) UpdateFindFailsV5(id ID, ip net.IP, fails int) error {
 }
 
 
+func (db *DB) NodeScore(id ID) int64 {
+	return db.fetchInt64(append([]byte(dbScorePrefix), id[:]...))
+}
+
+
+
+func (db *DB) UpdateNodeScore(id ID, score int64) error {
+	key := append([]byte(dbScorePrefix), id[:]...)
+	if score == 0 {
+		return db.lvl.Delete(key, nil)
+	}
+	return db.storeInt64(key, score)
+}
+
+
+func (db *DB) NodeScores() map[ID]int64 {
+	it := db.lvl.NewIterator(util.BytesPrefix([]byte(dbScorePrefix)), nil)
+	defer it.Release()
+
+	scores := make(map[ID]int64)
+	for it.Next() {
+		var id ID
+		if key := it.Key()[len(dbScorePrefix):]; len(key) == len(id) {
+			copy(id[:], key)
+			scores[id], _ = binary.Varint(it.Value())
+		}
+	}
+	return scores
+}
+
+
+
+func (db *DB) Bans() map[string]time.Time {
+	it := db.lvl.NewIterator(util.BytesPrefix([]byte(dbBanPrefix)), nil)
+	defer it.Release()
+
+	bans := make(map[string]time.Time)
+	for it.Next() {
+		until, _ := binary.Varint(it.Value())
+		bans[string(it.Key()[len(dbBanPrefix):])] = time.Unix(until, 0)
+	}
+	return bans
+}
+
+
+func (db *DB) UpdateBan(target string, until time.Time) error {
+	return db.storeInt64([]byte(dbBanPrefix+target), until.Unix())
+}
+
+
+func (db *DB) DeleteBan(target string) error {
+	return db.lvl.Delete([]byte(dbBanPrefix+target), nil)
+}
+
+
 func (db *DB) localSeq(id ID) uint64 {
 	return db.fetchUint64(localItemKey(id, dbLocalSeq))
 }
@@ -43,9 +43,10 @@ type Msg struct {
 	Payload    io.Reader
 	ReceivedAt time.Time
 
-	meterCap  Cap    
-	meterCode uint64 
-	meterSize uint32 
+	meterCap     Cap    
+	meterCode    uint64 
+	meterSize    uint32 
+	meterTraffic *peerTraffic
 }
 
 
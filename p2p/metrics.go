@@ -19,7 +19,11 @@
 package p2p
 
 import (
+	"fmt"
 	"net"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/metrics"
 )
@@ -27,8 +31,31 @@ import (
 const (
 	ingressMeterName = "p2p/ingress"
 	egressMeterName  = "p2p/egress"
+
+	clientIngressMeterPrefix = "p2p/clients/ingress"
+	clientEgressMeterPrefix  = "p2p/clients/egress"
+
+	otherClient = "other"
 )
 
+
+
+var knownClients = map[string]string{
+	"geth":            "geth",
+	"openethereum":    "openethereum",
+	"parity-ethereum": "openethereum",
+	"parity":          "openethereum",
+	"nethermind":      "nethermind",
+	"besu":            "besu",
+	"turbogeth":       "turbogeth",
+	"turbo-geth":      "turbogeth",
+	"erigon":          "erigon",
+	"trinity":         "trinity",
+	"ethereumjs":      "ethereumjs",
+	"aleth":           "aleth",
+	"nimbus":          "nimbus",
+}
+
 var (
 	ingressConnectMeter = metrics.NewRegisteredMeter("p2p/serves", nil)
 	ingressTrafficMeter = metrics.NewRegisteredMeter(ingressMeterName, nil)
@@ -86,3 +113,184 @@ func (c *meteredConn) Close() error {
 	}
 	return err
 }
+
+
+
+type MsgStats struct {
+	Packets uint64 `json:"packets"`
+	Bytes   uint64 `json:"bytes"`
+}
+
+
+type LatencyStats struct {
+	Count  uint64  `json:"count"`
+	MinMs  float64 `json:"minMs"`
+	MaxMs  float64 `json:"maxMs"`
+	MeanMs float64 `json:"meanMs"`
+}
+
+
+type PeerStats struct {
+	ID       string                   `json:"id"`
+	Name     string                   `json:"name"`
+	Ingress  MsgStats                 `json:"ingress"`
+	Egress   MsgStats                 `json:"egress"`
+	Messages map[string]*MessageStats `json:"messages"`
+	Latency  map[string]*LatencyStats `json:"latency"`
+}
+
+
+type MessageStats struct {
+	Ingress MsgStats `json:"ingress"`
+	Egress  MsgStats `json:"egress"`
+}
+
+type latencyCounter struct {
+	count    uint64
+	min, max time.Duration
+	total    time.Duration
+}
+
+
+
+type peerTraffic struct {
+	ingress  MsgStats
+	egress   MsgStats
+	messages map[string]*MessageStats
+	latency  map[string]*latencyCounter
+
+	clientIngress metrics.Meter 
+	clientEgress  metrics.Meter 
+
+	lock sync.Mutex
+}
+
+func newPeerTraffic() *peerTraffic {
+	return &peerTraffic{
+		messages: make(map[string]*MessageStats),
+		latency:  make(map[string]*latencyCounter),
+	}
+}
+
+
+
+
+func (t *peerTraffic) trackClient(name string) {
+	client := clientName(name)
+	t.clientIngress = metrics.GetOrRegisterMeter(fmt.Sprintf("%s/%s", clientIngressMeterPrefix, client), nil)
+	t.clientEgress = metrics.GetOrRegisterMeter(fmt.Sprintf("%s/%s", clientEgressMeterPrefix, client), nil)
+}
+
+func (t *peerTraffic) markIngress(cap Cap, code uint64, size uint32) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.ingress.Packets++
+	t.ingress.Bytes += uint64(size)
+	if cap.Name != "" {
+		stats := t.message(cap, code)
+		stats.Ingress.Packets++
+		stats.Ingress.Bytes += uint64(size)
+	}
+	if t.clientIngress != nil {
+		t.clientIngress.Mark(int64(size))
+	}
+}
+
+func (t *peerTraffic) markEgress(cap Cap, code uint64, size uint32) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.egress.Packets++
+	t.egress.Bytes += uint64(size)
+	if cap.Name != "" {
+		stats := t.message(cap, code)
+		stats.Egress.Packets++
+		stats.Egress.Bytes += uint64(size)
+	}
+	if t.clientEgress != nil {
+		t.clientEgress.Mark(int64(size))
+	}
+}
+
+func (t *peerTraffic) markLatency(cap Cap, code uint64, elapsed time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	key := messageKey(cap, code)
+	counter := t.latency[key]
+	if counter == nil {
+		counter = &latencyCounter{min: elapsed, max: elapsed}
+		t.latency[key] = counter
+	}
+	counter.count++
+	counter.total += elapsed
+	if elapsed < counter.min {
+		counter.min = elapsed
+	}
+	if elapsed > counter.max {
+		counter.max = elapsed
+	}
+}
+
+func (t *peerTraffic) message(cap Cap, code uint64) *MessageStats {
+	key := messageKey(cap, code)
+	stats := t.messages[key]
+	if stats == nil {
+		stats = new(MessageStats)
+		t.messages[key] = stats
+	}
+	return stats
+}
+
+func (t *peerTraffic) totals() (ingress MsgStats, egress MsgStats) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.ingress, t.egress
+}
+
+func (t *peerTraffic) stats() *PeerStats {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	stats := &PeerStats{
+		Ingress:  t.ingress,
+		Egress:   t.egress,
+		Messages: make(map[string]*MessageStats, len(t.messages)),
+		Latency:  make(map[string]*LatencyStats, len(t.latency)),
+	}
+	for key, msg := range t.messages {
+		cpy := *msg
+		stats.Messages[key] = &cpy
+	}
+	for key, counter := range t.latency {
+		stats.Latency[key] = &LatencyStats{
+			Count:  counter.count,
+			MinMs:  durationMs(counter.min),
+			MaxMs:  durationMs(counter.max),
+			MeanMs: durationMs(counter.total / time.Duration(counter.count)),
+		}
+	}
+	return stats
+}
+
+func messageKey(cap Cap, code uint64) string {
+	return fmt.Sprintf("%s/%d/%#02x", cap.Name, cap.Version, code)
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+
+
+func clientName(name string) string {
+	if i := strings.IndexByte(name, '/'); i >= 0 {
+		name = name[:i]
+	}
+	if client, ok := knownClients[strings.ToLower(name)]; ok {
+		return client
+	}
+	return otherClient
+}
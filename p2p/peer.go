@@ -116,6 +116,17 @@ type Peer struct {
 
 	
 	events *event.Feed
+
+	
+	report func(delta int, reason string)
+
+	
+	traffic *peerTraffic
+
+	
+	capture *captureSwitch
+
+	clock mclock.Clock
 }
 
 
@@ -178,6 +189,29 @@ func (p *Peer) Disconnect(reason DiscReason) {
 }
 
 
+
+
+func (p *Peer) MarkLatency(cap Cap, code uint64, elapsed time.Duration) {
+	p.traffic.markLatency(cap, code, elapsed)
+}
+
+
+func (p *Peer) Stats() *PeerStats {
+	stats := p.traffic.stats()
+	stats.ID = p.ID().String()
+	stats.Name = p.Fullname()
+	return stats
+}
+
+
+
+func (p *Peer) Report(delta int, reason string) {
+	if p.report != nil {
+		p.report(delta, reason)
+	}
+}
+
+
 func (p *Peer) String() string {
 	id := p.ID()
 	return fmt.Sprintf("Peer %x %v", id[:8], p.RemoteAddr())
@@ -198,10 +232,25 @@ func newPeer(log log.Logger, conn *conn, protocols []Protocol) *Peer {
 		protoErr: make(chan error, len(protomap)+1), 
 		closed:   make(chan struct{}),
 		log:      log.New("id", conn.node.ID(), "conn", conn.flags),
+		traffic:  newPeerTraffic(),
+		clock:    mclock.System{},
+	}
+	if metrics.EnabledExpensive {
+		p.traffic.trackClient(conn.name)
+	}
+	for _, rw := range protomap {
+		rw.traffic = p.traffic
+		rw.peer = p
 	}
 	return p
 }
 
+
+
+func (p *Peer) Clock() mclock.Clock {
+	return p.clock
+}
+
 func (p *Peer) Log() log.Logger {
 	return p.log
 }
@@ -257,12 +306,12 @@ loop:
 }
 
 func (p *Peer) pingLoop() {
-	ping := time.NewTimer(pingInterval)
+	ping := p.clock.NewTimer(pingInterval)
 	defer p.wg.Done()
 	defer ping.Stop()
 	for {
 		select {
-		case <-ping.C:
+		case <-ping.C():
 			if err := SendItems(p.rw, pingMsg); err != nil {
 				p.protoErr <- err
 				return
@@ -291,6 +340,10 @@ func (p *Peer) readLoop(errc chan<- error) {
 }
 
 func (p *Peer) handle(msg Msg) error {
+	if msg.Code < baseProtocolLength {
+		p.traffic.markIngress(Cap{}, msg.Code, msg.meterSize)
+		p.captureMsg(false, baseProtocolCap, msg.Code, &msg)
+	}
 	switch {
 	case msg.Code == pingMsg:
 		msg.Discard()
@@ -310,6 +363,8 @@ func (p *Peer) handle(msg Msg) error {
 		if err != nil {
 			return fmt.Errorf("msg code out of range: %v", msg.Code)
 		}
+		p.traffic.markIngress(proto.cap(), msg.Code-proto.offset, msg.meterSize)
+		p.captureMsg(false, proto.cap(), msg.Code-proto.offset, &msg)
 		if metrics.Enabled {
 			m := fmt.Sprintf("%s/%s/%d/%#02x", ingressMeterName, proto.Name, proto.Version, msg.Code-proto.offset)
 			metrics.GetOrRegisterMeter(m, nil).Mark(int64(msg.meterSize))
@@ -405,8 +460,10 @@ type protoRW struct {
 	closed <-chan struct{} 
 	wstart <-chan struct{} 
 	werr   chan<- error    
-	offset uint64
-	w      MsgWriter
+	offset  uint64
+	w       MsgWriter
+	traffic *peerTraffic
+	peer    *Peer
 }
 
 func (rw *protoRW) WriteMsg(msg Msg) (err error) {
@@ -415,6 +472,8 @@ func (rw *protoRW) WriteMsg(msg Msg) (err error) {
 	}
 	msg.meterCap = rw.cap()
 	msg.meterCode = msg.Code
+	msg.meterTraffic = rw.traffic
+	rw.peer.captureMsg(true, rw.cap(), msg.Code, &msg)
 
 	msg.Code += rw.offset
 
@@ -459,6 +518,10 @@ type PeerInfo struct {
 		Static        bool   `json:"static"`
 	} `json:"network"`
 	Protocols map[string]interface{} `json:"protocols"` 
+	Traffic   struct {
+		Ingress MsgStats `json:"ingress"`
+		Egress  MsgStats `json:"egress"`
+	} `json:"traffic"`
 }
 
 
@@ -484,6 +547,7 @@ func (p *Peer) Info() *PeerInfo {
 	info.Network.Inbound = p.rw.is(inboundConn)
 	info.Network.Trusted = p.rw.is(trustedConn)
 	info.Network.Static = p.rw.is(staticDialedConn)
+	info.Traffic.Ingress, info.Traffic.Egress = p.traffic.totals()
 
 	
 	for _, proto := range p.running {
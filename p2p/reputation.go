@@ -0,0 +1,359 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package p2p
+
+import (
+	"errors"
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+const (
+	maxPeerScore = 1000
+	minPeerScore = -1000
+
+	banPeerScore = -100
+
+	peerScoreHalfLife = time.Hour
+
+	DefaultBanDuration = 24 * time.Hour
+)
+
+var errReputationDisabled = errors.New("peer reputation is disabled")
+
+
+type BanInfo struct {
+	Target  string    `json:"target"`
+	Expires time.Time `json:"expires"`
+}
+
+type netBan struct {
+	network *net.IPNet
+	until   time.Time
+}
+
+type reputation struct {
+	db      *enode.DB
+	scores  map[enode.ID]int64
+	updated map[enode.ID]time.Time
+	nodes   map[enode.ID]time.Time
+	nets    map[string]netBan
+	lock    sync.Mutex
+}
+
+func newReputation(db *enode.DB) *reputation {
+	r := &reputation{
+		db:      db,
+		scores:  db.NodeScores(),
+		updated: make(map[enode.ID]time.Time),
+		nodes:   make(map[enode.ID]time.Time),
+		nets:    make(map[string]netBan),
+	}
+	now := time.Now()
+	for id := range r.scores {
+		r.updated[id] = now
+	}
+	for target, until := range db.Bans() {
+		if !until.After(now) {
+			db.DeleteBan(target)
+			continue
+		}
+		if id, err := enode.ParseID(target); err == nil {
+			r.nodes[id] = until
+		} else if _, network, err := net.ParseCIDR(target); err == nil {
+			r.nets[network.String()] = netBan{network: network, until: until}
+		} else {
+			log.Warn("Dropping invalid peer ban", "target", target)
+			db.DeleteBan(target)
+		}
+	}
+	return r
+}
+
+
+
+func (r *reputation) report(id enode.ID, delta int) (int64, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	score := r.decayed(id, now) + int64(delta)
+	if score > maxPeerScore {
+		score = maxPeerScore
+	}
+	if score < minPeerScore {
+		score = minPeerScore
+	}
+	ban := score <= banPeerScore
+	if ban {
+		score = 0
+	}
+	r.store(id, score, now)
+	return score, ban
+}
+
+
+
+
+func (r *reputation) decayed(id enode.ID, now time.Time) int64 {
+	score, ok := r.scores[id]
+	if !ok {
+		return 0
+	}
+	elapsed := now.Sub(r.updated[id])
+	if elapsed <= 0 {
+		return score
+	}
+	return int64(math.Round(float64(score) * math.Exp2(-float64(elapsed)/float64(peerScoreHalfLife))))
+}
+
+func (r *reputation) store(id enode.ID, score int64, now time.Time) {
+	if score == 0 {
+		delete(r.scores, id)
+		delete(r.updated, id)
+	} else {
+		r.scores[id] = score
+		r.updated[id] = now
+	}
+	r.db.UpdateNodeScore(id, score)
+}
+
+func (r *reputation) peerScores() map[enode.ID]int64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	scores := make(map[enode.ID]int64, len(r.scores))
+	for id := range r.scores {
+		score := r.decayed(id, now)
+		if score == 0 {
+			r.store(id, 0, now)
+			continue
+		}
+		scores[id] = score
+	}
+	return scores
+}
+
+func (r *reputation) banNode(id enode.ID, until time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.nodes[id] = until
+	r.db.UpdateBan(id.String(), until)
+}
+
+func (r *reputation) banNetwork(network *net.IPNet, until time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.nets[network.String()] = netBan{network: network, until: until}
+	r.db.UpdateBan(network.String(), until)
+}
+
+func (r *reputation) unbanNode(id enode.ID) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.nodes[id]; !ok {
+		return false
+	}
+	delete(r.nodes, id)
+	r.db.DeleteBan(id.String())
+	return true
+}
+
+func (r *reputation) unbanNetwork(network *net.IPNet) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.nets[network.String()]; !ok {
+		return false
+	}
+	delete(r.nets, network.String())
+	r.db.DeleteBan(network.String())
+	return true
+}
+
+func (r *reputation) bans() []BanInfo {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.expire(time.Now())
+	bans := make([]BanInfo, 0, len(r.nodes)+len(r.nets))
+	for id, until := range r.nodes {
+		bans = append(bans, BanInfo{Target: id.String(), Expires: until})
+	}
+	for target, ban := range r.nets {
+		bans = append(bans, BanInfo{Target: target, Expires: ban.until})
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Target < bans[j].Target
+	})
+	return bans
+}
+
+func (r *reputation) expire(now time.Time) {
+	for id, until := range r.nodes {
+		if !until.After(now) {
+			delete(r.nodes, id)
+			r.db.DeleteBan(id.String())
+		}
+	}
+	for target, ban := range r.nets {
+		if !ban.until.After(now) {
+			delete(r.nets, target)
+			r.db.DeleteBan(target)
+		}
+	}
+}
+
+
+func (r *reputation) banned(id enode.ID, ip net.IP) bool {
+	if r == nil {
+		return false
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	if until, ok := r.nodes[id]; ok {
+		if until.After(now) {
+			return true
+		}
+		delete(r.nodes, id)
+		r.db.DeleteBan(id.String())
+	}
+	return r.bannedNet(ip, now)
+}
+
+func (r *reputation) bannedIP(ip net.IP) bool {
+	if r == nil {
+		return false
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.bannedNet(ip, time.Now())
+}
+
+func (r *reputation) bannedNet(ip net.IP, now time.Time) bool {
+	if ip == nil {
+		return false
+	}
+	for target, ban := range r.nets {
+		if !ban.network.Contains(ip) {
+			continue
+		}
+		if ban.until.After(now) {
+			return true
+		}
+		delete(r.nets, target)
+		r.db.DeleteBan(target)
+	}
+	return false
+}
+
+func (r *reputation) bannedNode(n *enode.Node) bool {
+	return r.banned(n.ID(), n.IP())
+}
+
+
+
+
+func (srv *Server) reportPeer(p *Peer, delta int, reason string) {
+	if srv.reputation == nil || p.rw.is(trustedConn|staticDialedConn) {
+		return
+	}
+	score, ban := srv.reputation.report(p.ID(), delta)
+	p.log.Trace("Updated peer reputation", "delta", delta, "score", score, "reason", reason)
+	if ban {
+		p.log.Info("Banning misbehaving peer", "reason", reason, "duration", DefaultBanDuration)
+		srv.reputation.banNode(p.ID(), time.Now().Add(DefaultBanDuration))
+		p.Disconnect(DiscUselessPeer)
+	}
+}
+
+
+func (srv *Server) BanNode(id enode.ID, duration time.Duration) error {
+	if srv.reputation == nil {
+		return errReputationDisabled
+	}
+	srv.reputation.banNode(id, time.Now().Add(duration))
+	srv.dropBanned()
+	return nil
+}
+
+
+
+func (srv *Server) BanNetwork(network *net.IPNet, duration time.Duration) error {
+	if srv.reputation == nil {
+		return errReputationDisabled
+	}
+	srv.reputation.banNetwork(network, time.Now().Add(duration))
+	srv.dropBanned()
+	return nil
+}
+
+
+func (srv *Server) UnbanNode(id enode.ID) (bool, error) {
+	if srv.reputation == nil {
+		return false, errReputationDisabled
+	}
+	return srv.reputation.unbanNode(id), nil
+}
+
+
+func (srv *Server) UnbanNetwork(network *net.IPNet) (bool, error) {
+	if srv.reputation == nil {
+		return false, errReputationDisabled
+	}
+	return srv.reputation.unbanNetwork(network), nil
+}
+
+
+func (srv *Server) Bans() ([]BanInfo, error) {
+	if srv.reputation == nil {
+		return nil, errReputationDisabled
+	}
+	return srv.reputation.bans(), nil
+}
+
+
+func (srv *Server) PeerScores() (map[enode.ID]int64, error) {
+	if srv.reputation == nil {
+		return nil, errReputationDisabled
+	}
+	return srv.reputation.peerScores(), nil
+}
+
+func (srv *Server) dropBanned() {
+	srv.doPeerOp(func(peers map[enode.ID]*Peer) {
+		for _, p := range peers {
+			if !p.rw.is(trustedConn|staticDialedConn) && srv.reputation.bannedNode(p.Node()) {
+				p.log.Debug("Disconnecting banned peer")
+				p.Disconnect(DiscUselessPeer)
+			}
+		}
+	})
+}
@@ -0,0 +1,206 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package p2p
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+)
+
+func newTestReputation(t *testing.T) (*reputation, *enode.DB) {
+	db, err := enode.OpenDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newReputation(db), db
+}
+
+func reputationTestID(i byte) enode.ID {
+	return enode.ID{i}
+}
+
+func TestReputationDecay(t *testing.T) {
+	r, db := newTestReputation(t)
+	defer db.Close()
+
+	id := reputationTestID(1)
+	if score, ban := r.report(id, -40); score != -40 || ban {
+		t.Fatalf("wrong initial score %d (ban %t)", score, ban)
+	}
+
+
+	r.updated[id] = r.updated[id].Add(-peerScoreHalfLife)
+	if score, _ := r.report(id, 0); score != -20 {
+		t.Fatalf("wrong score after one half-life: have %d, want -20", score)
+	}
+	if scores := db.NodeScores(); scores[id] != -20 {
+		t.Fatalf("wrong persisted score: have %d, want -20", scores[id])
+	}
+
+
+	r.updated[id] = r.updated[id].Add(-10 * peerScoreHalfLife)
+	if scores := r.peerScores(); len(scores) != 0 {
+		t.Fatalf("decayed score not dropped: %v", scores)
+	}
+	if scores := db.NodeScores(); len(scores) != 0 {
+		t.Fatalf("decayed score still persisted: %v", scores)
+	}
+}
+
+func TestReputationBanThreshold(t *testing.T) {
+	r, db := newTestReputation(t)
+	defer db.Close()
+
+	id := reputationTestID(1)
+	if _, ban := r.report(id, banPeerScore+1); ban {
+		t.Fatal("peer banned above threshold")
+	}
+	score, ban := r.report(id, -1)
+	if !ban {
+		t.Fatalf("peer not banned at threshold (score %d)", score)
+	}
+	if score != 0 {
+		t.Fatalf("score not reset after ban: %d", score)
+	}
+
+
+	other := reputationTestID(2)
+	if score, _ := r.report(other, 10*maxPeerScore); score != maxPeerScore {
+		t.Fatalf("score not capped: have %d, want %d", score, maxPeerScore)
+	}
+	if _, ban := r.report(other, banPeerScore); ban {
+		t.Fatal("well-behaved peer banned by a single offence")
+	}
+}
+
+func TestReputationNetworkBan(t *testing.T) {
+	r, db := newTestReputation(t)
+	defer db.Close()
+
+	_, network, _ := net.ParseCIDR("10.1.0.0/16")
+	r.banNetwork(network, time.Now().Add(time.Hour))
+
+	tests := []struct {
+		ip     net.IP
+		banned bool
+	}{
+		{net.IP{10, 1, 2, 3}, true},
+		{net.IP{10, 1, 255, 255}, true},
+		{net.IP{10, 2, 0, 1}, false},
+		{net.ParseIP("::1"), false},
+		{nil, false},
+	}
+	for _, test := range tests {
+		if banned := r.banned(reputationTestID(1), test.ip); banned != test.banned {
+			t.Errorf("%v: banned %t, want %t", test.ip, banned, test.banned)
+		}
+		if banned := r.bannedIP(test.ip); banned != test.banned {
+			t.Errorf("%v: IP banned %t, want %t", test.ip, banned, test.banned)
+		}
+	}
+
+
+	if !newReputation(db).bannedIP(net.IP{10, 1, 2, 3}) {
+		t.Fatal("network ban not restored from database")
+	}
+	if !r.unbanNetwork(network) {
+		t.Fatal("network ban not removed")
+	}
+	if r.unbanNetwork(network) {
+		t.Fatal("network ban removed twice")
+	}
+	if r.bannedIP(net.IP{10, 1, 2, 3}) || len(db.Bans()) != 0 {
+		t.Fatal("network still banned after unban")
+	}
+}
+
+func TestReputationBanExpiry(t *testing.T) {
+	r, db := newTestReputation(t)
+	defer db.Close()
+
+	var (
+		live    = reputationTestID(1)
+		expired = reputationTestID(2)
+		now     = time.Now()
+	)
+	_, network, _ := net.ParseCIDR("192.168.0.0/24")
+	r.banNode(live, now.Add(time.Hour))
+	r.banNode(expired, now.Add(-time.Second))
+	r.banNetwork(network, now.Add(-time.Second))
+
+	if !r.banned(live, nil) {
+		t.Error("live ban not enforced")
+	}
+	if r.banned(expired, nil) {
+		t.Error("expired node ban enforced")
+	}
+	if r.bannedIP(net.IP{192, 168, 0, 1}) {
+		t.Error("expired network ban enforced")
+	}
+	bans := r.bans()
+	if len(bans) != 1 || bans[0].Target != live.String() {
+		t.Fatalf("wrong ban list: %v", bans)
+	}
+	if stored := db.Bans(); len(stored) != 1 {
+		t.Fatalf("expired bans not removed from database: %v", stored)
+	}
+
+
+	db.UpdateBan(expired.String(), now.Add(-time.Hour))
+	restored := newReputation(db)
+	if restored.banned(expired, nil) || !restored.banned(live, nil) {
+		t.Fatal("wrong bans restored from database")
+	}
+	if stored := db.Bans(); len(stored) != 1 {
+		t.Fatalf("expired ban not dropped on load: %v", stored)
+	}
+}
+
+func TestReputationTrustedExempt(t *testing.T) {
+	r, db := newTestReputation(t)
+	defer db.Close()
+
+	srv := &Server{reputation: r}
+	makePeer := func(i byte, flags connFlag) *Peer {
+		node := enode.SignNull(new(enr.Record), reputationTestID(i))
+		p := newPeer(log.Root(), &conn{node: node, flags: flags}, nil)
+		close(p.closed)
+		return p
+	}
+	var (
+		trusted = makePeer(1, trustedConn|inboundConn)
+		static  = makePeer(2, staticDialedConn)
+		dynamic = makePeer(3, dynDialedConn)
+	)
+	for _, p := range []*Peer{trusted, static, dynamic} {
+		srv.reportPeer(p, 2*banPeerScore, "test offence")
+	}
+	if r.banned(trusted.ID(), nil) || r.banned(static.ID(), nil) {
+		t.Error("trusted or static peer banned")
+	}
+	if scores := r.peerScores(); len(scores) != 0 {
+		t.Errorf("exempt peers scored: %v", scores)
+	}
+	if !r.banned(dynamic.ID(), nil) {
+		t.Error("dynamic peer not banned")
+	}
+}
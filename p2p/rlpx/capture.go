@@ -0,0 +1,83 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package rlpx
+
+import (
+	"bufio"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+
+type CaptureRecord struct {
+	Time     uint64
+	Egress   bool
+	Peer     []byte
+	Protocol string
+	Version  uint
+	Code     uint64
+	Payload  []byte
+}
+
+
+func (rec *CaptureRecord) Timestamp() time.Time {
+	return time.Unix(0, int64(rec.Time))
+}
+
+
+type CaptureWriter struct {
+	w    *bufio.Writer
+	lock sync.Mutex
+}
+
+func NewCaptureWriter(w io.Writer) *CaptureWriter {
+	return &CaptureWriter{w: bufio.NewWriter(w)}
+}
+
+
+
+func (cw *CaptureWriter) Write(rec *CaptureRecord) error {
+	cw.lock.Lock()
+	defer cw.lock.Unlock()
+
+	if err := rlp.Encode(cw.w, rec); err != nil {
+		return err
+	}
+	return cw.w.Flush()
+}
+
+
+type CaptureReader struct {
+	s *rlp.Stream
+}
+
+func NewCaptureReader(r io.Reader) *CaptureReader {
+	return &CaptureReader{s: rlp.NewStream(bufio.NewReader(r), 0)}
+}
+
+
+
+func (cr *CaptureReader) Read() (*CaptureRecord, error) {
+	rec := new(CaptureRecord)
+	if err := cr.s.Decode(rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
@@ -35,7 +35,6 @@ import (
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p/discover"
-	"github.com/ethereum/go-ethereum/p2p/discv5"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/p2p/enr"
 	"github.com/ethereum/go-ethereum/p2p/nat"
@@ -105,7 +104,7 @@ type Config struct {
 	
 	
 	
-	BootstrapNodesV5 []*discv5.Node `toml:",omitempty"`
+	BootstrapNodesV5 []*enode.Node `toml:",omitempty"`
 
 	
 	
@@ -140,6 +139,12 @@ type Config struct {
 	
 	
 	
+	
+	ListenAddr6 string `toml:",omitempty"`
+
+	
+	
+	
 	NAT nat.Interface `toml:",omitempty"`
 
 	
@@ -156,7 +161,9 @@ type Config struct {
 	
 	Logger log.Logger `toml:",omitempty"`
 
-	clock mclock.Clock
+	
+	
+	Clock mclock.Clock `toml:"-"`
 }
 
 
@@ -174,17 +181,20 @@ type Server struct {
 	running bool
 
 	listener     net.Listener
+	listener6    net.Listener
 	ourHandshake *protoHandshake
 	loopWG       sync.WaitGroup 
 	peerFeed     event.Feed
 	log          log.Logger
 
-	nodedb    *enode.DB
-	localnode *enode.LocalNode
-	ntab      *discover.UDPv4
-	DiscV5    *discv5.Network
-	discmix   *enode.FairMix
-	dialsched *dialScheduler
+	nodedb     *enode.DB
+	reputation *reputation
+	capture    captureSwitch
+	localnode  *enode.LocalNode
+	ntab       *discover.UDPv4
+	DiscV5     *discover.UDPv5
+	discmix    *enode.FairMix
+	dialsched  *dialScheduler
 
 	
 	quit                    chan struct{}
@@ -401,15 +411,19 @@ func (srv *Server) Stop() {
 		
 		srv.listener.Close()
 	}
+	if srv.listener6 != nil {
+		srv.listener6.Close()
+	}
 	close(srv.quit)
 	srv.lock.Unlock()
 	srv.loopWG.Wait()
+	srv.capture.stop()
 }
 
 
 
 type sharedUDPConn struct {
-	*net.UDPConn
+	discover.UDPConn
 	unhandled chan discover.ReadPacket
 }
 
@@ -445,10 +459,10 @@ func (srv *Server) Start() (err error) {
 	if srv.log == nil {
 		srv.log = log.Root()
 	}
-	if srv.clock == nil {
-		srv.clock = mclock.System{}
+	if srv.Clock == nil {
+		srv.Clock = mclock.System{}
 	}
-	if srv.NoDial && srv.ListenAddr == "" {
+	if srv.NoDial && srv.ListenAddr == "" && srv.ListenAddr6 == "" {
 		srv.log.Warn("P2P server will be useless, neither dialing nor listening")
 	}
 
@@ -457,7 +471,7 @@ func (srv *Server) Start() (err error) {
 		return errors.New("Server.PrivateKey must be set to a non-nil key")
 	}
 	if srv.newTransport == nil {
-		srv.newTransport = newRLPX
+		srv.newTransport = newClockedRLPX(srv.Clock)
 	}
 	if srv.listenFunc == nil {
 		srv.listenFunc = net.Listen
@@ -474,7 +488,7 @@ func (srv *Server) Start() (err error) {
 	if err := srv.setupLocalNode(); err != nil {
 		return err
 	}
-	if srv.ListenAddr != "" {
+	if srv.ListenAddr != "" || srv.ListenAddr6 != "" {
 		if err := srv.setupListening(); err != nil {
 			return err
 		}
@@ -504,8 +518,14 @@ func (srv *Server) setupLocalNode() error {
 		return err
 	}
 	srv.nodedb = db
+	srv.reputation = newReputation(db)
 	srv.localnode = enode.NewLocalNode(db, srv.PrivateKey)
-	srv.localnode.SetFallbackIP(net.IP{127, 0, 0, 1})
+	if srv.ListenAddr != "" || srv.ListenAddr6 == "" {
+		srv.localnode.SetFallbackIP(net.IP{127, 0, 0, 1})
+	}
+	if srv.ListenAddr6 != "" {
+		srv.localnode.SetFallbackIP(net.IPv6loopback)
+	}
 	
 	for _, p := range srv.Protocols {
 		for _, e := range p.Attributes {
@@ -550,26 +570,10 @@ func (srv *Server) setupDiscovery() error {
 		return nil
 	}
 
-	addr, err := net.ResolveUDPAddr("udp", srv.ListenAddr)
+	conn, err := srv.listenDiscovery()
 	if err != nil {
 		return err
 	}
-	conn, err := net.ListenUDP("udp", addr)
-	if err != nil {
-		return err
-	}
-	realaddr := conn.LocalAddr().(*net.UDPAddr)
-	srv.log.Debug("UDP listener up", "addr", realaddr)
-	if srv.NAT != nil {
-		if !realaddr.IP.IsLoopback() {
-			srv.loopWG.Add(1)
-			go func() {
-				nat.Map(srv.NAT, srv.quit, "udp", realaddr.Port, realaddr.Port, "ethereum discovery")
-				srv.loopWG.Done()
-			}()
-		}
-	}
-	srv.localnode.SetFallbackUDP(realaddr.Port)
 
 	
 	var unhandled chan discover.ReadPacket
@@ -596,24 +600,79 @@ func (srv *Server) setupDiscovery() error {
 
 	
 	if srv.DiscoveryV5 {
-		var ntab *discv5.Network
+		cfg := discover.Config{
+			PrivateKey:  srv.PrivateKey,
+			NetRestrict: srv.NetRestrict,
+			Bootnodes:   srv.BootstrapNodesV5,
+			Log:         srv.log,
+		}
 		var err error
 		if sconn != nil {
-			ntab, err = discv5.ListenUDP(srv.PrivateKey, sconn, "", srv.NetRestrict)
+			srv.DiscV5, err = discover.ListenV5(sconn, srv.localnode, cfg)
 		} else {
-			ntab, err = discv5.ListenUDP(srv.PrivateKey, conn, "", srv.NetRestrict)
+			srv.DiscV5, err = discover.ListenV5(conn, srv.localnode, cfg)
 		}
 		if err != nil {
 			return err
 		}
-		if err := ntab.SetFallbackNodes(srv.BootstrapNodesV5); err != nil {
-			return err
-		}
-		srv.DiscV5 = ntab
 	}
 	return nil
 }
 
+
+
+
+func (srv *Server) listenDiscovery() (discover.UDPConn, error) {
+	if srv.ListenAddr6 == "" {
+		conn, err := srv.listenUDP("udp", srv.ListenAddr)
+		if err != nil {
+			return nil, err
+		}
+		srv.localnode.SetFallbackUDP(conn.LocalAddr().(*net.UDPAddr).Port)
+		return conn, nil
+	}
+	conn6, err := srv.listenUDP("udp6", srv.ListenAddr6)
+	if err != nil {
+		return nil, err
+	}
+	port6 := conn6.LocalAddr().(*net.UDPAddr).Port
+	if srv.ListenAddr == "" {
+		srv.localnode.SetFallbackUDP(port6)
+		return conn6, nil
+	}
+	conn4, err := srv.listenUDP("udp4", srv.ListenAddr)
+	if err != nil {
+		conn6.Close()
+		return nil, err
+	}
+	srv.localnode.SetFallbackUDP(conn4.LocalAddr().(*net.UDPAddr).Port)
+	srv.localnode.SetFallbackUDP6(port6)
+	return discover.NewDualConn(conn4, conn6), nil
+}
+
+func (srv *Server) listenUDP(network, addr string) (*net.UDPConn, error) {
+	uaddr, err := net.ResolveUDPAddr(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP(network, uaddr)
+	if err != nil {
+		return nil, err
+	}
+	realaddr := conn.LocalAddr().(*net.UDPAddr)
+	srv.log.Debug("UDP listener up", "addr", realaddr)
+	if srv.NAT != nil && network != "udp6" {
+		if !realaddr.IP.IsLoopback() {
+			srv.loopWG.Add(1)
+			go func() {
+				nat.Map(srv.NAT, srv.quit, "udp", realaddr.Port, realaddr.Port, "ethereum discovery")
+				srv.loopWG.Done()
+			}()
+		}
+	}
+	return conn, nil
+}
+
 func (srv *Server) setupDialScheduler() {
 	config := dialConfig{
 		self:           srv.localnode.ID(),
@@ -622,7 +681,8 @@ func (srv *Server) setupDialScheduler() {
 		log:            srv.Logger,
 		netRestrict:    srv.NetRestrict,
 		dialer:         srv.Dialer,
-		clock:          srv.clock,
+		clock:          srv.Clock,
+		banned:         srv.reputation.bannedNode,
 	}
 	if srv.ntab != nil {
 		config.resolver = srv.ntab
@@ -656,17 +716,52 @@ func (srv *Server) maxDialedConns() (limit int) {
 }
 
 func (srv *Server) setupListening() error {
+	network := "tcp"
+	if srv.ListenAddr6 != "" {
+		network = "tcp4"
+	}
+	var port4 int
+	if srv.ListenAddr != "" {
+		listener, err := srv.listenTCP(network, srv.ListenAddr)
+		if err != nil {
+			return err
+		}
+		srv.listener = listener
+		srv.ListenAddr = listener.Addr().String()
+		if tcp, ok := listener.Addr().(*net.TCPAddr); ok {
+			port4 = tcp.Port
+			srv.localnode.Set(enr.TCP(tcp.Port))
+		}
+	}
+	if srv.ListenAddr6 != "" {
+		listener, err := srv.listenTCP("tcp6", srv.ListenAddr6)
+		if err != nil {
+			return err
+		}
+		srv.listener6 = listener
+		srv.ListenAddr6 = listener.Addr().String()
+
+		
+		if tcp, ok := listener.Addr().(*net.TCPAddr); ok {
+			if port4 == 0 {
+				srv.localnode.Set(enr.TCP(tcp.Port))
+			} else if tcp.Port != port4 {
+				srv.localnode.Set(enr.TCP6(tcp.Port))
+			}
+		}
+	}
+	return nil
+}
+
+func (srv *Server) listenTCP(network, addr string) (net.Listener, error) {
 	
-	listener, err := srv.listenFunc("tcp", srv.ListenAddr)
+	listener, err := srv.listenFunc(network, addr)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	srv.listener = listener
-	srv.ListenAddr = listener.Addr().String()
 
 	
-	if tcp, ok := listener.Addr().(*net.TCPAddr); ok {
-		srv.localnode.Set(enr.TCP(tcp.Port))
+	if tcp, ok := listener.Addr().(*net.TCPAddr); ok && network != "tcp6" {
 		if !tcp.IP.IsLoopback() && srv.NAT != nil {
 			srv.loopWG.Add(1)
 			go func() {
@@ -677,8 +772,8 @@ func (srv *Server) setupListening() error {
 	}
 
 	srv.loopWG.Add(1)
-	go srv.listenLoop()
-	return nil
+	go srv.listenLoop(listener)
+	return listener, nil
 }
 
 
@@ -810,6 +905,8 @@ func (srv *Server) postHandshakeChecks(peers map[enode.ID]*Peer, inboundCount in
 		return DiscAlreadyConnected
 	case c.node.ID() == srv.localnode.ID():
 		return DiscSelf
+	case !c.is(trustedConn|staticDialedConn) && srv.reputation.bannedNode(c.node):
+		return errBanned
 	default:
 		return nil
 	}
@@ -827,8 +924,8 @@ func (srv *Server) addPeerChecks(peers map[enode.ID]*Peer, inboundCount int, c *
 
 
 
-func (srv *Server) listenLoop() {
-	srv.log.Debug("TCP listener up", "addr", srv.listener.Addr())
+func (srv *Server) listenLoop(listener net.Listener) {
+	srv.log.Debug("TCP listener up", "addr", listener.Addr())
 
 	
 	tokens := defaultMaxPendingPeers
@@ -858,7 +955,7 @@ func (srv *Server) listenLoop() {
 			err error
 		)
 		for {
-			fd, err = srv.listener.Accept()
+			fd, err = listener.Accept()
 			if netutil.IsTemporaryError(err) {
 				srv.log.Debug("Temporary read error", "err", err)
 				continue
@@ -900,8 +997,11 @@ func (srv *Server) checkInboundConn(fd net.Conn, remoteIP net.IP) error {
 	if srv.NetRestrict != nil && !srv.NetRestrict.Contains(remoteIP) {
 		return fmt.Errorf("not whitelisted in NetRestrict")
 	}
+	if srv.reputation.bannedIP(remoteIP) {
+		return errBanned
+	}
 	
-	now := srv.clock.Now()
+	now := srv.Clock.Now()
 	srv.inboundHistory.expire(now, nil)
 	if !netutil.IsLAN(remoteIP) && srv.inboundHistory.contains(remoteIP.String()) {
 		return fmt.Errorf("too many attempts")
@@ -1014,6 +1114,9 @@ func (srv *Server) launchPeer(c *conn) *Peer {
 		
 		p.events = &srv.peerFeed
 	}
+	p.report = func(delta int, reason string) { srv.reportPeer(p, delta, reason) }
+	p.capture = &srv.capture
+	p.clock, p.created = srv.Clock, srv.Clock.Now()
 	go srv.runPeer(p)
 	return p
 }
@@ -1058,12 +1161,14 @@ type NodeInfo struct {
 	Enode string `json:"enode"` 
 	ENR   string `json:"enr"`   
 	IP    string `json:"ip"`    
+	IP6   string `json:"ip6,omitempty"`
 	Ports struct {
 		Discovery int `json:"discovery"` 
 		Listener  int `json:"listener"`  
 	} `json:"ports"`
-	ListenAddr string                 `json:"listenAddr"`
-	Protocols  map[string]interface{} `json:"protocols"`
+	ListenAddr  string                 `json:"listenAddr"`
+	ListenAddr6 string                 `json:"listenAddr6,omitempty"`
+	Protocols   map[string]interface{} `json:"protocols"`
 }
 
 
@@ -1071,12 +1176,16 @@ func (srv *Server) NodeInfo() *NodeInfo {
 	
 	node := srv.Self()
 	info := &NodeInfo{
-		Name:       srv.Name,
-		Enode:      node.URLv4(),
-		ID:         node.ID().String(),
-		IP:         node.IP().String(),
-		ListenAddr: srv.ListenAddr,
-		Protocols:  make(map[string]interface{}),
+		Name:        srv.Name,
+		Enode:       node.URLv4(),
+		ID:          node.ID().String(),
+		IP:          node.IP().String(),
+		ListenAddr:  srv.ListenAddr,
+		ListenAddr6: srv.ListenAddr6,
+		Protocols:   make(map[string]interface{}),
+	}
+	if ip6 := node.IPv6(); ip6 != nil {
+		info.IP6 = ip6.String()
 	}
 	info.Ports.Discovery = node.UDP()
 	info.Ports.Listener = node.TCP()
@@ -1114,3 +1223,17 @@ func (srv *Server) PeersInfo() []*PeerInfo {
 	}
 	return infos
 }
+
+
+func (srv *Server) PeersStats() []*PeerStats {
+	stats := make([]*PeerStats, 0, srv.PeerCount())
+	for _, peer := range srv.Peers() {
+		if peer != nil {
+			stats = append(stats, peer.Stats())
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].ID < stats[j].ID
+	})
+	return stats
+}
@@ -24,6 +24,7 @@ import (
 	"net"
 	"sync"
 
+	"github.com/ethereum/go-ethereum/common/mclock"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/node"
@@ -37,7 +38,9 @@ import (
 
 
 type SimAdapter struct {
-	pipe       func() (net.Conn, net.Conn, error)
+	pipe       func(from, to enode.ID) (net.Conn, net.Conn, error)
+	clock      mclock.Clock
+	vnet       *pipes.VirtualNetwork
 	mtx        sync.RWMutex
 	nodes      map[enode.ID]*SimNode
 	lifecycles LifecycleConstructors
@@ -49,7 +52,22 @@ type SimAdapter struct {
 
 func NewSimAdapter(services LifecycleConstructors) *SimAdapter {
 	return &SimAdapter{
-		pipe:       pipes.NetPipe,
+		pipe:       func(enode.ID, enode.ID) (net.Conn, net.Conn, error) { return pipes.NetPipe() },
+		clock:      mclock.System{},
+		nodes:      make(map[enode.ID]*SimNode),
+		lifecycles: services,
+	}
+}
+
+
+
+
+
+func NewVirtualSimAdapter(services LifecycleConstructors, vnet *pipes.VirtualNetwork) *SimAdapter {
+	return &SimAdapter{
+		pipe:       vnet.Pipe,
+		clock:      vnet.Clock(),
+		vnet:       vnet,
 		nodes:      make(map[enode.ID]*SimNode),
 		lifecycles: services,
 	}
@@ -57,10 +75,18 @@ func NewSimAdapter(services LifecycleConstructors) *SimAdapter {
 
 
 func (s *SimAdapter) Name() string {
+	if s.vnet != nil {
+		return "virtual-sim-adapter"
+	}
 	return "sim-adapter"
 }
 
 
+func (s *SimAdapter) Network() *pipes.VirtualNetwork {
+	return s.vnet
+}
+
+
 func (s *SimAdapter) NewNode(config *NodeConfig) (Node, error) {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
@@ -96,7 +122,8 @@ func (s *SimAdapter) NewNode(config *NodeConfig) (Node, error) {
 			PrivateKey:      config.PrivateKey,
 			MaxPeers:        math.MaxInt32,
 			NoDiscovery:     true,
-			Dialer:          s,
+			Dialer:          &simDialer{adapter: s, id: id},
+			Clock:           s.clock,
 			EnableMsgEvents: config.EnableMsgEvents,
 		},
 		NoUSB:  true,
@@ -120,6 +147,10 @@ func (s *SimAdapter) NewNode(config *NodeConfig) (Node, error) {
 
 
 func (s *SimAdapter) Dial(ctx context.Context, dest *enode.Node) (conn net.Conn, err error) {
+	return s.dial(enode.ID{}, dest)
+}
+
+func (s *SimAdapter) dial(from enode.ID, dest *enode.Node) (net.Conn, error) {
 	node, ok := s.GetNode(dest.ID())
 	if !ok {
 		return nil, fmt.Errorf("unknown node: %s", dest.ID())
@@ -129,7 +160,7 @@ func (s *SimAdapter) Dial(ctx context.Context, dest *enode.Node) (conn net.Conn,
 		return nil, fmt.Errorf("node not running: %s", dest.ID())
 	}
 	
-	pipe1, pipe2, err := s.pipe()
+	pipe2, pipe1, err := s.pipe(from, dest.ID())
 	if err != nil {
 		return nil, err
 	}
@@ -142,6 +173,17 @@ func (s *SimAdapter) Dial(ctx context.Context, dest *enode.Node) (conn net.Conn,
 
 
 
+type simDialer struct {
+	adapter *SimAdapter
+	id      enode.ID
+}
+
+func (d *simDialer) Dial(ctx context.Context, dest *enode.Node) (net.Conn, error) {
+	return d.adapter.dial(d.id, dest)
+}
+
+
+
 func (s *SimAdapter) DialRPC(id enode.ID) (*rpc.Client, error) {
 	node, ok := s.GetNode(id)
 	if !ok {
@@ -248,6 +290,7 @@ func (sn *SimNode) Start(snapshots map[string][]byte) error {
 			ctx := &ServiceContext{
 				RPCDialer: sn.adapter,
 				Config:    sn.config,
+				Clock:     sn.adapter.clock,
 			}
 			if snapshots != nil {
 				ctx.Snapshot = snapshots[name]
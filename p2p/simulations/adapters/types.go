@@ -21,11 +21,13 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"math/rand"
 	"net"
 	"os"
 	"strconv"
 
 	"github.com/docker/docker/pkg/reexec"
+	"github.com/ethereum/go-ethereum/common/mclock"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/node"
@@ -211,6 +213,25 @@ func RandomNodeConfig() *NodeConfig {
 	}
 }
 
+
+
+
+func SeededNodeConfig(rng *rand.Rand) *NodeConfig {
+	var prvkey *ecdsa.PrivateKey
+	for key := make([]byte, 32); prvkey == nil; {
+		rng.Read(key)
+		prvkey, _ = crypto.ToECDSA(key)
+	}
+	enodId := enode.PubkeyToIDV4(&prvkey.PublicKey)
+	return &NodeConfig{
+		PrivateKey:      prvkey,
+		ID:              enodId,
+		Name:            fmt.Sprintf("node_%s", enodId.String()),
+		Port:            30303,
+		EnableMsgEvents: true,
+	}
+}
+
 func assignTCPPort() (uint16, error) {
 	l, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
@@ -235,6 +256,7 @@ type ServiceContext struct {
 
 	Config   *NodeConfig
 	Snapshot []byte
+	Clock    mclock.Clock
 }
 
 
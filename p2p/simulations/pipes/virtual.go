@@ -0,0 +1,429 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package pipes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"net"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/mclock"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+const (
+	minRetransmitTimeout = 200 * time.Millisecond
+	maxRetransmits       = 8
+
+	initialStackBuffer = 64 * 1024
+)
+
+
+type LinkConfig struct {
+	Latency   time.Duration
+	Bandwidth uint64
+	Loss      float64
+}
+
+func (cfg LinkConfig) retransmitTimeout() time.Duration {
+	if rto := 2 * cfg.Latency; rto > minRetransmitTimeout {
+		return rto
+	}
+	return minRetransmitTimeout
+}
+
+
+
+
+
+type VirtualNetwork struct {
+	clock  *mclock.Simulated
+	stacks []byte
+	seed   int64
+	rand   *rand.Rand
+
+	lock  sync.Mutex
+	link  LinkConfig
+	links map[[2]enode.ID]LinkConfig
+	pipes map[[2]enode.ID]uint64
+}
+
+
+func NewVirtualNetwork(seed int64, link LinkConfig) *VirtualNetwork {
+	return &VirtualNetwork{
+		clock:  new(mclock.Simulated),
+		stacks: make([]byte, initialStackBuffer),
+		seed:   seed,
+		rand:   rand.New(rand.NewSource(seed)),
+		link:   link,
+		links:  make(map[[2]enode.ID]LinkConfig),
+		pipes:  make(map[[2]enode.ID]uint64),
+	}
+}
+
+
+func (n *VirtualNetwork) Clock() *mclock.Simulated {
+	return n.clock
+}
+
+
+
+func (n *VirtualNetwork) Rand() *rand.Rand {
+	return n.rand
+}
+
+
+
+func (n *VirtualNetwork) SetLink(a, b enode.ID, cfg LinkConfig) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.links[linkKey(a, b)] = cfg
+}
+
+
+func (n *VirtualNetwork) Link(a, b enode.ID) LinkConfig {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	return n.linkConfig(a, b)
+}
+
+func (n *VirtualNetwork) linkConfig(a, b enode.ID) LinkConfig {
+	if cfg, ok := n.links[linkKey(a, b)]; ok {
+		return cfg
+	}
+	return n.link
+}
+
+func linkKey(a, b enode.ID) [2]enode.ID {
+	if bytes.Compare(a[:], b[:]) > 0 {
+		a, b = b, a
+	}
+	return [2]enode.ID{a, b}
+}
+
+
+
+
+func (n *VirtualNetwork) Pipe(from, to enode.ID) (net.Conn, net.Conn, error) {
+	n.lock.Lock()
+	key := [2]enode.ID{from, to}
+	index := n.pipes[key]
+	n.pipes[key]++
+	cfg := n.linkConfig(from, to)
+	n.lock.Unlock()
+
+	out := newVirtualStream(n, cfg, n.streamRand(from, to, index))
+	in := newVirtualStream(n, cfg, n.streamRand(to, from, index))
+	c1 := &virtualConn{in: in, out: out, local: virtualAddr(from), remote: virtualAddr(to)}
+	c2 := &virtualConn{in: out, out: in, local: virtualAddr(to), remote: virtualAddr(from)}
+	return c1, c2, nil
+}
+
+func (n *VirtualNetwork) streamRand(from, to enode.ID, index uint64) *rand.Rand {
+	var seed, idx [8]byte
+	binary.BigEndian.PutUint64(seed[:], uint64(n.seed))
+	binary.BigEndian.PutUint64(idx[:], index)
+	h := crypto.Keccak256(seed[:], from[:], to[:], idx[:])
+	return rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(h))))
+}
+
+
+
+
+
+
+func (n *VirtualNetwork) Run(d time.Duration) {
+	end := n.clock.Now().Add(d)
+	for {
+		n.settle()
+		next, ok := n.clock.NextTimer()
+		if !ok || next > end {
+			break
+		}
+		n.clock.Run(next.Sub(n.clock.Now()))
+	}
+	n.clock.Run(end.Sub(n.clock.Now()))
+	n.settle()
+}
+
+
+
+func (n *VirtualNetwork) settle() {
+	for !n.quiescent() {
+		for i := runtime.NumGoroutine(); i > 0; i-- {
+			runtime.Gosched()
+		}
+	}
+}
+
+
+
+func (n *VirtualNetwork) quiescent() bool {
+	size := runtime.Stack(n.stacks, true)
+	for size == len(n.stacks) {
+		n.stacks = make([]byte, 2*len(n.stacks))
+		size = runtime.Stack(n.stacks, true)
+	}
+	for i, g := range bytes.Split(n.stacks[:size], []byte("\n\n")) {
+		if i == 0 {
+			continue
+		}
+		header := g
+		if j := bytes.IndexByte(g, '\n'); j >= 0 {
+			header = g[:j]
+		}
+		start, end := bytes.IndexByte(header, '['), bytes.IndexByte(header, ']')
+		if start < 0 || end < start {
+			continue
+		}
+		status := header[start+1 : end]
+		if j := bytes.IndexByte(status, ','); j >= 0 {
+			status = status[:j]
+		}
+		switch string(status) {
+		case "running", "runnable":
+			return false
+		case "syscall":
+			if bytes.Contains(g, []byte("_Cfunc_")) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+type segment struct {
+	at   mclock.AbsTime
+	data []byte
+	eof  bool
+}
+
+
+type virtualStream struct {
+	net  *VirtualNetwork
+	cfg  LinkConfig
+	rand *rand.Rand
+
+	lock     sync.Mutex
+	cond     *sync.Cond
+	txEnd    mclock.AbsTime
+	arrival  mclock.AbsTime
+	inflight []segment
+	buf      []byte
+	eof      bool
+	wclosed  bool
+	rclosed  bool
+
+	deadline uint64
+	expired  bool
+	timer    mclock.Timer
+}
+
+func newVirtualStream(n *VirtualNetwork, cfg LinkConfig, rand *rand.Rand) *virtualStream {
+	s := &virtualStream{net: n, cfg: cfg, rand: rand}
+	s.cond = sync.NewCond(&s.lock)
+	return s
+}
+
+func (s *virtualStream) write(b []byte) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.wclosed || s.rclosed {
+		return 0, io.ErrClosedPipe
+	}
+	now := s.net.clock.Now()
+	start := now
+	if s.txEnd > start {
+		start = s.txEnd
+	}
+	if s.cfg.Bandwidth > 0 {
+		start = start.Add(time.Duration(uint64(len(b)) * uint64(time.Second) / s.cfg.Bandwidth))
+	}
+	s.txEnd = start
+	at := start.Add(s.cfg.Latency)
+	for i := 0; i < maxRetransmits && s.cfg.Loss > 0 && s.rand.Float64() < s.cfg.Loss; i++ {
+		at = at.Add(s.cfg.retransmitTimeout())
+	}
+	s.push(now, segment{at: at, data: append([]byte(nil), b...)})
+	return len(b), nil
+}
+
+func (s *virtualStream) push(now mclock.AbsTime, seg segment) {
+	if seg.at < s.arrival {
+		seg.at = s.arrival
+	}
+	s.arrival = seg.at
+	s.inflight = append(s.inflight, seg)
+	s.net.clock.AfterFunc(seg.at.Sub(now), s.deliver)
+}
+
+func (s *virtualStream) deliver() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.net.clock.Now()
+	for len(s.inflight) > 0 && s.inflight[0].at <= now {
+		seg := s.inflight[0]
+		s.inflight = s.inflight[1:]
+		if seg.eof {
+			s.eof = true
+		} else if !s.rclosed {
+			s.buf = append(s.buf, seg.data...)
+		}
+	}
+	s.cond.Broadcast()
+}
+
+func (s *virtualStream) read(b []byte) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for len(s.buf) == 0 && !s.eof && !s.rclosed && !s.expired {
+		s.cond.Wait()
+	}
+	switch {
+	case s.rclosed:
+		return 0, io.ErrClosedPipe
+	case len(s.buf) > 0:
+		n := copy(b, s.buf)
+		s.buf = s.buf[n:]
+		return n, nil
+	case s.eof:
+		return 0, io.EOF
+	default:
+		return 0, timeoutError{}
+	}
+}
+
+func (s *virtualStream) closeWrite() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.wclosed {
+		return
+	}
+	s.wclosed = true
+	now := s.net.clock.Now()
+	s.push(now, segment{at: now, eof: true})
+}
+
+func (s *virtualStream) closeRead() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.rclosed = true
+	s.buf = nil
+	s.cond.Broadcast()
+}
+
+
+
+func (s *virtualStream) setDeadline(t time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.deadline++
+	s.expired = false
+	if !t.IsZero() {
+		if d := mclock.AbsTime(t.UnixNano()).Sub(s.net.clock.Now()); d <= 0 {
+			s.expired = true
+		} else {
+			gen := s.deadline
+			s.timer = s.net.clock.AfterFunc(d, func() {
+				s.lock.Lock()
+				defer s.lock.Unlock()
+
+				if s.deadline == gen {
+					s.expired = true
+					s.cond.Broadcast()
+				}
+			})
+		}
+	}
+	s.cond.Broadcast()
+}
+
+
+type virtualConn struct {
+	in, out       *virtualStream
+	local, remote virtualAddr
+}
+
+func (c *virtualConn) Read(b []byte) (int, error) {
+	return c.in.read(b)
+}
+
+func (c *virtualConn) Write(b []byte) (int, error) {
+	return c.out.write(b)
+}
+
+func (c *virtualConn) Close() error {
+	c.out.closeWrite()
+	c.in.closeRead()
+	return nil
+}
+
+func (c *virtualConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *virtualConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *virtualConn) SetDeadline(t time.Time) error {
+	c.in.setDeadline(t)
+	return nil
+}
+
+func (c *virtualConn) SetReadDeadline(t time.Time) error {
+	c.in.setDeadline(t)
+	return nil
+}
+
+func (c *virtualConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+type virtualAddr enode.ID
+
+func (a virtualAddr) Network() string {
+	return "virtual"
+}
+
+func (a virtualAddr) String() string {
+	return enode.ID(a).String()
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
@@ -0,0 +1,166 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package simulations
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/mclock"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/simulations/adapters"
+	"github.com/ethereum/go-ethereum/p2p/simulations/pipes"
+)
+
+
+type traceService struct {
+	clock mclock.Clock
+	trace *messageTrace
+}
+
+type messageTrace struct {
+	lock   sync.Mutex
+	events []string
+}
+
+func (tr *messageTrace) add(at mclock.AbsTime, self, from fmt.Stringer, n uint64) {
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+
+	tr.events = append(tr.events, fmt.Sprintf("%016d %v <- %v #%d", at, self, from, n))
+}
+
+func (tr *messageTrace) sorted() []string {
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+
+	events := append([]string(nil), tr.events...)
+	sort.Strings(events)
+	return events
+}
+
+func (s *traceService) Start() error { return nil }
+func (s *traceService) Stop() error  { return nil }
+
+func (s *traceService) protocols(stack *node.Node) []p2p.Protocol {
+	return []p2p.Protocol{{
+		Name:    "trace",
+		Version: 1,
+		Length:  1,
+		Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+			errc := make(chan error, 1)
+			go func() {
+				for {
+					var n uint64
+					msg, err := rw.ReadMsg()
+					if err == nil {
+						err = msg.Decode(&n)
+					}
+					if err != nil {
+						errc <- err
+						return
+					}
+					s.trace.add(s.clock.Now(), stack.Server().Self().ID(), p.ID(), n)
+				}
+			}()
+			for n := uint64(0); ; n++ {
+				select {
+				case <-s.clock.After(7 * time.Second):
+					if err := p2p.Send(rw, 0, n); err != nil {
+						return err
+					}
+				case err := <-errc:
+					return err
+				}
+			}
+		},
+	}}
+}
+
+
+
+func runVirtualTrace(t *testing.T, seed int64) []string {
+	const nodes = 10
+
+	trace := new(messageTrace)
+	vnet := pipes.NewVirtualNetwork(seed, pipes.LinkConfig{Latency: 50 * time.Millisecond, Loss: 0.05})
+	adapter := adapters.NewVirtualSimAdapter(adapters.LifecycleConstructors{
+		"trace": func(ctx *adapters.ServiceContext, stack *node.Node) (node.Lifecycle, error) {
+			svc := &traceService{clock: ctx.Clock, trace: trace}
+			stack.RegisterProtocols(svc.protocols(stack))
+			return svc, nil
+		},
+	}, vnet)
+	network := NewNetwork(adapter, &NetworkConfig{DefaultService: "trace"})
+	defer func() {
+		done := make(chan struct{})
+		go func() {
+			network.Shutdown()
+			close(done)
+		}()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				vnet.Run(time.Second)
+			}
+		}
+	}()
+
+	var ids []enode.ID
+	for i := 0; i < nodes; i++ {
+		conf := adapters.SeededNodeConfig(vnet.Rand())
+		conf.Lifecycles = []string{"trace"}
+		node, err := network.NewNodeWithConfig(conf)
+		if err != nil {
+			t.Fatalf("failed to create node %d: %v", i, err)
+		}
+		ids = append(ids, node.ID())
+	}
+	if err := network.StartAll(); err != nil {
+		t.Fatalf("failed to start nodes: %v", err)
+	}
+	for i := range ids {
+		if err := network.Connect(ids[i], ids[(i+1)%nodes]); err != nil {
+			t.Fatalf("failed to connect nodes: %v", err)
+		}
+	}
+	vnet.Run(time.Minute)
+
+	events := trace.sorted()
+	if len(events) == 0 {
+		t.Fatalf("no messages delivered with seed %d", seed)
+	}
+	return events
+}
+
+func TestVirtualNetworkReproducible(t *testing.T) {
+	first := runVirtualTrace(t, 1)
+	if second := runVirtualTrace(t, 1); !reflect.DeepEqual(first, second) {
+		t.Fatalf("runs with the same seed diverged:\nfirst:  %v\nsecond: %v", first, second)
+	}
+	if other := runVirtualTrace(t, 2); reflect.DeepEqual(first, other) {
+		t.Fatal("runs with different seeds produced the same trace")
+	}
+}
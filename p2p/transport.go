@@ -26,6 +26,7 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common/bitutil"
+	"github.com/ethereum/go-ethereum/common/mclock"
 	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/p2p/rlpx"
 	"github.com/ethereum/go-ethereum/rlp"
@@ -48,10 +49,26 @@ type rlpxTransport struct {
 	rmu, wmu sync.Mutex
 	wbuf     bytes.Buffer
 	conn     *rlpx.Conn
+	clock    mclock.Clock
 }
 
 func newRLPX(conn net.Conn, dialDest *ecdsa.PublicKey) transport {
-	return &rlpxTransport{conn: rlpx.NewConn(conn, dialDest)}
+	return newClockedRLPX(mclock.System{})(conn, dialDest)
+}
+
+func newClockedRLPX(clock mclock.Clock) func(net.Conn, *ecdsa.PublicKey) transport {
+	return func(conn net.Conn, dialDest *ecdsa.PublicKey) transport {
+		return &rlpxTransport{conn: rlpx.NewConn(conn, dialDest), clock: clock}
+	}
+}
+
+
+
+func (t *rlpxTransport) deadline(d time.Duration) time.Time {
+	if sim, ok := t.clock.(*mclock.Simulated); ok {
+		return time.Unix(0, int64(sim.Now().Add(d)))
+	}
+	return time.Now().Add(d)
 }
 
 func (t *rlpxTransport) ReadMsg() (Msg, error) {
@@ -59,11 +76,11 @@ func (t *rlpxTransport) ReadMsg() (Msg, error) {
 	defer t.rmu.Unlock()
 
 	var msg Msg
-	t.conn.SetReadDeadline(time.Now().Add(frameReadTimeout))
+	t.conn.SetReadDeadline(t.deadline(frameReadTimeout))
 	code, data, wireSize, err := t.conn.Read()
 	if err == nil {
 		msg = Msg{
-			ReceivedAt: time.Now(),
+			ReceivedAt: t.deadline(0),
 			Code:       code,
 			Size:       uint32(len(data)),
 			meterSize:  uint32(wireSize),
@@ -84,7 +101,7 @@ func (t *rlpxTransport) WriteMsg(msg Msg) error {
 	}
 
 	
-	t.conn.SetWriteDeadline(time.Now().Add(frameWriteTimeout))
+	t.conn.SetWriteDeadline(t.deadline(frameWriteTimeout))
 	size, err := t.conn.Write(msg.Code, t.wbuf.Bytes())
 	if err != nil {
 		return err
@@ -97,6 +114,9 @@ func (t *rlpxTransport) WriteMsg(msg Msg) error {
 		metrics.GetOrRegisterMeter(m, nil).Mark(int64(msg.meterSize))
 		metrics.GetOrRegisterMeter(m+"/packets", nil).Mark(1)
 	}
+	if msg.meterTraffic != nil {
+		msg.meterTraffic.markEgress(msg.meterCap, msg.meterCode, msg.meterSize)
+	}
 	return nil
 }
 
@@ -109,7 +129,7 @@ func (t *rlpxTransport) close(err error) {
 	
 	if t.conn != nil {
 		if r, ok := err.(DiscReason); ok && r != DiscNetworkError {
-			deadline := time.Now().Add(discWriteTimeout)
+			deadline := t.deadline(discWriteTimeout)
 			if err := t.conn.SetWriteDeadline(deadline); err == nil {
 				
 				t.wbuf.Reset()
@@ -122,7 +142,7 @@ func (t *rlpxTransport) close(err error) {
 }
 
 func (t *rlpxTransport) doEncHandshake(prv *ecdsa.PrivateKey) (*ecdsa.PublicKey, error) {
-	t.conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	t.conn.SetDeadline(t.deadline(handshakeTimeout))
 	return t.conn.Handshake(prv)
 }
 
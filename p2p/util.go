@@ -53,7 +53,7 @@ func (h expHeap) contains(item string) bool {
 
 
 func (h *expHeap) expire(now mclock.AbsTime, onExp func(string)) {
-	for h.Len() > 0 && h.nextExpiry() < now {
+	for h.Len() > 0 && h.nextExpiry() <= now {
 		item := heap.Pop(h)
 		if onExp != nil {
 			onExp(item.(expItem).item)
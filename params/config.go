@@ -239,16 +239,16 @@ var (
 	
 	
 	
-	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, new(EthashConfig), nil}
+	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, new(EthashConfig), nil, nil}
 
 	
 	
 	
 	
 	
-	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, &CliqueConfig{Period: 0, Epoch: 30000}}
+	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, &CliqueConfig{Period: 0, Epoch: 30000}, nil}
 
-	TestChainConfig = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, new(EthashConfig), nil}
+	TestChainConfig = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, new(EthashConfig), nil, nil}
 	TestRules       = TestChainConfig.Rules(new(big.Int))
 )
 
@@ -326,6 +326,7 @@ type ChainConfig struct {
 	
 	Ethash *EthashConfig `json:"ethash,omitempty"`
 	Clique *CliqueConfig `json:"clique,omitempty"`
+	BFT    *BFTConfig    `json:"bft,omitempty"`
 }
 
 
@@ -338,8 +339,9 @@ func (c *EthashConfig) String() string {
 
 
 type CliqueConfig struct {
-	Period uint64 `json:"period"` 
-	Epoch  uint64 `json:"epoch"`  
+	Period      uint64              `json:"period"`                
+	Epoch       uint64              `json:"epoch"`                 
+	Transitions []*CliqueTransition `json:"transitions,omitempty"` 
 }
 
 
@@ -348,6 +350,134 @@ func (c *CliqueConfig) String() string {
 }
 
 
+
+
+
+type CliqueTransition struct {
+	Block   *big.Int         `json:"block"`
+	Period  *uint64          `json:"period,omitempty"`
+	Epoch   *uint64          `json:"epoch,omitempty"`
+	Signers []common.Address `json:"signers,omitempty"`
+}
+
+
+func (c *CliqueConfig) PeriodAt(number uint64) uint64 {
+	period := c.Period
+	for _, t := range c.Transitions {
+		if t.Block.Uint64() > number {
+			break
+		}
+		if t.Period != nil {
+			period = *t.Period
+		}
+	}
+	return period
+}
+
+
+func (c *CliqueConfig) EpochAt(number uint64) uint64 {
+	epoch := c.Epoch
+	for _, t := range c.Transitions {
+		if t.Block.Uint64() > number {
+			break
+		}
+		if t.Epoch != nil {
+			epoch = *t.Epoch
+		}
+	}
+	return epoch
+}
+
+
+
+func (c *CliqueConfig) SignersAt(number uint64) ([]common.Address, bool) {
+	for _, t := range c.Transitions {
+		if t.Block.Uint64() == number && len(t.Signers) > 0 {
+			return t.Signers, true
+		}
+	}
+	return nil, false
+}
+
+func (c *CliqueConfig) checkTransitions() error {
+	var last *big.Int
+	for i, t := range c.Transitions {
+		if t.Block == nil {
+			return fmt.Errorf("clique transition %d has no block number", i)
+		}
+		if last != nil && last.Cmp(t.Block) >= 0 {
+			return fmt.Errorf("unsupported clique transition ordering: transition at %v follows transition at %v", t.Block, last)
+		}
+		if t.Epoch != nil && *t.Epoch == 0 {
+			return fmt.Errorf("clique transition at %v has zero epoch", t.Block)
+		}
+		last = t.Block
+	}
+	return nil
+}
+
+func (c *CliqueConfig) checkCompatible(newcfg *CliqueConfig, head *big.Int) *ConfigCompatError {
+	stored, updated := make(map[uint64]*CliqueTransition), make(map[uint64]*CliqueTransition)
+	for _, t := range c.Transitions {
+		stored[t.Block.Uint64()] = t
+	}
+	for _, t := range newcfg.Transitions {
+		updated[t.Block.Uint64()] = t
+	}
+	for _, t := range c.Transitions {
+		if isForked(t.Block, head) && !updated[t.Block.Uint64()].equal(t) {
+			if other := updated[t.Block.Uint64()]; other != nil {
+				return newCompatError("clique transition", t.Block, other.Block)
+			}
+			return newCompatError("clique transition", t.Block, nil)
+		}
+	}
+	for _, t := range newcfg.Transitions {
+		if isForked(t.Block, head) && stored[t.Block.Uint64()] == nil {
+			return newCompatError("clique transition", nil, t.Block)
+		}
+	}
+	return nil
+}
+
+func (t *CliqueTransition) equal(other *CliqueTransition) bool {
+	if t == nil || other == nil {
+		return t == other
+	}
+	if !configNumEqual(t.Block, other.Block) || !uint64PtrEqual(t.Period, other.Period) || !uint64PtrEqual(t.Epoch, other.Epoch) {
+		return false
+	}
+	if len(t.Signers) != len(other.Signers) {
+		return false
+	}
+	for i := range t.Signers {
+		if t.Signers[i] != other.Signers[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func uint64PtrEqual(x, y *uint64) bool {
+	if x == nil || y == nil {
+		return x == y
+	}
+	return *x == *y
+}
+
+
+type BFTConfig struct {
+	Period         uint64 `json:"period"`
+	Epoch          uint64 `json:"epoch"`
+	RequestTimeout uint64 `json:"requestTimeout"`
+}
+
+
+func (c *BFTConfig) String() string {
+	return "bft"
+}
+
+
 func (c *ChainConfig) String() string {
 	var engine interface{}
 	switch {
@@ -355,6 +485,8 @@ func (c *ChainConfig) String() string {
 		engine = c.Ethash
 	case c.Clique != nil:
 		engine = c.Clique
+	case c.BFT != nil:
+		engine = c.BFT
 	default:
 		engine = "unknown"
 	}
@@ -496,6 +628,9 @@ func (c *ChainConfig) CheckConfigForkOrder() error {
 			lastFork = cur
 		}
 	}
+	if c.Clique != nil {
+		return c.Clique.checkTransitions()
+	}
 	return nil
 }
 
@@ -546,6 +681,11 @@ func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *Confi
 	if isForkIncompatible(c.EWASMBlock, newcfg.EWASMBlock, head) {
 		return newCompatError("ewasm fork block", c.EWASMBlock, newcfg.EWASMBlock)
 	}
+	if c.Clique != nil && newcfg.Clique != nil {
+		if err := c.Clique.checkCompatible(newcfg.Clique, head); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
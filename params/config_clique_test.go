@@ -0,0 +1,165 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package params
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func cliqueUint64(n uint64) *uint64 {
+	return &n
+}
+
+func TestCliqueTransitionsAt(t *testing.T) {
+	var (
+		first  = []common.Address{{0x01}, {0x02}}
+		second = []common.Address{{0x03}}
+	)
+	config := &CliqueConfig{
+		Period: 15,
+		Epoch:  30000,
+		Transitions: []*CliqueTransition{
+			{Block: big.NewInt(10), Period: cliqueUint64(5), Signers: first},
+			{Block: big.NewInt(20), Epoch: cliqueUint64(100)},
+			{Block: big.NewInt(30), Period: cliqueUint64(0), Signers: second},
+		},
+	}
+	tests := []struct {
+		number  uint64
+		period  uint64
+		epoch   uint64
+		signers []common.Address
+	}{
+		{0, 15, 30000, nil},
+		{9, 15, 30000, nil},
+		{10, 5, 30000, first},
+		{11, 5, 30000, nil},
+		{20, 5, 100, nil},
+		{29, 5, 100, nil},
+		{30, 0, 100, second},
+		{1000000, 0, 100, nil},
+	}
+	for _, test := range tests {
+		if period := config.PeriodAt(test.number); period != test.period {
+			t.Errorf("block %d: period mismatch: have %d, want %d", test.number, period, test.period)
+		}
+		if epoch := config.EpochAt(test.number); epoch != test.epoch {
+			t.Errorf("block %d: epoch mismatch: have %d, want %d", test.number, epoch, test.epoch)
+		}
+		signers, ok := config.SignersAt(test.number)
+		if ok != (test.signers != nil) || !reflect.DeepEqual(signers, test.signers) {
+			t.Errorf("block %d: signers mismatch: have %v (%t), want %v", test.number, signers, ok, test.signers)
+		}
+	}
+}
+
+func TestCliqueTransitionsOrder(t *testing.T) {
+	tests := []struct {
+		transitions []*CliqueTransition
+		valid       bool
+	}{
+		{[]*CliqueTransition{{Block: big.NewInt(5)}, {Block: big.NewInt(10)}}, true},
+		{[]*CliqueTransition{{Block: big.NewInt(10)}, {Block: big.NewInt(5)}}, false},
+		{[]*CliqueTransition{{Block: big.NewInt(5)}, {Block: big.NewInt(5)}}, false},
+		{[]*CliqueTransition{{Block: nil}}, false},
+		{[]*CliqueTransition{{Block: big.NewInt(5), Epoch: cliqueUint64(0)}}, false},
+	}
+	for i, test := range tests {
+		config := *AllCliqueProtocolChanges
+		config.Clique = &CliqueConfig{Period: 1, Epoch: 30000, Transitions: test.transitions}
+		if err := config.CheckConfigForkOrder(); (err == nil) != test.valid {
+			t.Errorf("test %d: validity mismatch: have %v, want valid %t", i, err, test.valid)
+		}
+	}
+}
+
+func TestCliqueTransitionsCompatible(t *testing.T) {
+	withTransitions := func(transitions ...*CliqueTransition) *ChainConfig {
+		config := *AllCliqueProtocolChanges
+		config.Clique = &CliqueConfig{Period: 1, Epoch: 30000, Transitions: transitions}
+		return &config
+	}
+	var (
+		signers = []common.Address{{0x01}}
+		stored  = withTransitions(&CliqueTransition{Block: big.NewInt(10), Period: cliqueUint64(5), Signers: signers})
+	)
+	tests := []struct {
+		newcfg  *ChainConfig
+		head    uint64
+		wantErr *ConfigCompatError
+	}{
+		{stored, 100, nil},
+		{withTransitions(&CliqueTransition{Block: big.NewInt(10), Period: cliqueUint64(5), Signers: []common.Address{{0x01}}}), 100, nil},
+
+
+		{withTransitions(&CliqueTransition{Block: big.NewInt(10), Period: cliqueUint64(6), Signers: signers}), 9, nil},
+		{withTransitions(), 9, nil},
+		{withTransitions(&CliqueTransition{Block: big.NewInt(10), Period: cliqueUint64(5), Signers: signers}, &CliqueTransition{Block: big.NewInt(50)}), 20, nil},
+
+
+		{
+			newcfg: withTransitions(&CliqueTransition{Block: big.NewInt(10), Period: cliqueUint64(6), Signers: signers}),
+			head:   10,
+			wantErr: &ConfigCompatError{
+				What:         "clique transition",
+				StoredConfig: big.NewInt(10),
+				NewConfig:    big.NewInt(10),
+				RewindTo:     9,
+			},
+		},
+		{
+			newcfg: withTransitions(&CliqueTransition{Block: big.NewInt(10), Period: cliqueUint64(5), Signers: []common.Address{{0x02}}}),
+			head:   100,
+			wantErr: &ConfigCompatError{
+				What:         "clique transition",
+				StoredConfig: big.NewInt(10),
+				NewConfig:    big.NewInt(10),
+				RewindTo:     9,
+			},
+		},
+		{
+			newcfg: withTransitions(),
+			head:   100,
+			wantErr: &ConfigCompatError{
+				What:         "clique transition",
+				StoredConfig: big.NewInt(10),
+				NewConfig:    nil,
+				RewindTo:     9,
+			},
+		},
+		{
+			newcfg: withTransitions(&CliqueTransition{Block: big.NewInt(5), Epoch: cliqueUint64(10)}, &CliqueTransition{Block: big.NewInt(10), Period: cliqueUint64(5), Signers: signers}),
+			head:   100,
+			wantErr: &ConfigCompatError{
+				What:         "clique transition",
+				StoredConfig: nil,
+				NewConfig:    big.NewInt(5),
+				RewindTo:     4,
+			},
+		},
+	}
+	for i, test := range tests {
+		err := stored.CheckCompatible(test.newcfg, test.head)
+		if !reflect.DeepEqual(err, test.wantErr) {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, test.wantErr)
+		}
+	}
+}
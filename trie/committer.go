@@ -22,6 +22,7 @@ import (
 	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/crypto"
 	"golang.org/x/crypto/sha3"
 )
@@ -35,6 +36,7 @@ type leaf struct {
 	size int         
 	hash common.Hash 
 	node node        
+	path []byte
 }
 
 
@@ -49,6 +51,7 @@ type committer struct {
 
 	onleaf LeafCallback
 	leafCh chan *leaf
+	owner  common.Hash
 }
 
 
@@ -69,6 +72,7 @@ func newCommitter() *committer {
 func returnCommitterToPool(h *committer) {
 	h.onleaf = nil
 	h.leafCh = nil
+	h.owner = common.Hash{}
 	committerPool.Put(h)
 }
 
@@ -77,7 +81,7 @@ func (c *committer) Commit(n node, db *Database) (hashNode, error) {
 	if db == nil {
 		return nil, errors.New("no db provided")
 	}
-	h, err := c.commit(n, db)
+	h, err := c.commit(nil, n, db)
 	if err != nil {
 		return nil, err
 	}
@@ -85,7 +89,7 @@ func (c *committer) Commit(n node, db *Database) (hashNode, error) {
 }
 
 
-func (c *committer) commit(n node, db *Database) (node, error) {
+func (c *committer) commit(path []byte, n node, db *Database) (node, error) {
 	
 	hash, dirty := n.cache()
 	if hash != nil && !dirty {
@@ -100,7 +104,7 @@ func (c *committer) commit(n node, db *Database) (node, error) {
 		
 		
 		if _, ok := cn.Val.(*fullNode); ok {
-			childV, err := c.commit(cn.Val, db)
+			childV, err := c.commit(concat(path, cn.Key...), cn.Val, db)
 			if err != nil {
 				return nil, err
 			}
@@ -108,20 +112,20 @@ func (c *committer) commit(n node, db *Database) (node, error) {
 		}
 		
 		collapsed.Key = hexToCompact(cn.Key)
-		hashedNode := c.store(collapsed, db)
+		hashedNode := c.store(path, collapsed, db)
 		if hn, ok := hashedNode.(hashNode); ok {
 			return hn, nil
 		}
 		return collapsed, nil
 	case *fullNode:
-		hashedKids, err := c.commitChildren(cn, db)
+		hashedKids, err := c.commitChildren(path, cn, db)
 		if err != nil {
 			return nil, err
 		}
 		collapsed := cn.copy()
 		collapsed.Children = hashedKids
 
-		hashedNode := c.store(collapsed, db)
+		hashedNode := c.store(path, collapsed, db)
 		if hn, ok := hashedNode.(hashNode); ok {
 			return hn, nil
 		}
@@ -135,7 +139,7 @@ func (c *committer) commit(n node, db *Database) (node, error) {
 }
 
 
-func (c *committer) commitChildren(n *fullNode, db *Database) ([17]node, error) {
+func (c *committer) commitChildren(path []byte, n *fullNode, db *Database) ([17]node, error) {
 	var children [17]node
 	for i := 0; i < 16; i++ {
 		child := n.Children[i]
@@ -152,7 +156,7 @@ func (c *committer) commitChildren(n *fullNode, db *Database) ([17]node, error)
 		
 		
 		
-		hashed, err := c.commit(child, db)
+		hashed, err := c.commit(concat(path, byte(i)), child, db)
 		if err != nil {
 			return children, err
 		}
@@ -168,7 +172,7 @@ func (c *committer) commitChildren(n *fullNode, db *Database) ([17]node, error)
 
 
 
-func (c *committer) store(n node, db *Database) node {
+func (c *committer) store(path []byte, n node, db *Database) node {
 	
 	var (
 		hash, _ = n.cache()
@@ -192,12 +196,13 @@ func (c *committer) store(n node, db *Database) node {
 			size: size,
 			hash: common.BytesToHash(hash),
 			node: n,
+			path: path,
 		}
 	} else if db != nil {
 		
 		
 		db.lock.Lock()
-		db.insert(common.BytesToHash(hash), size, n)
+		c.insert(db, path, common.BytesToHash(hash), size, n)
 		db.lock.Unlock()
 	}
 	return hash
@@ -213,7 +218,7 @@ func (c *committer) commitLoop(db *Database) {
 		)
 		
 		db.lock.Lock()
-		db.insert(hash, size, n)
+		c.insert(db, item.path, hash, size, n)
 		db.lock.Unlock()
 
 		if c.onleaf != nil {
@@ -233,6 +238,14 @@ func (c *committer) commitLoop(db *Database) {
 	}
 }
 
+func (c *committer) insert(db *Database, path []byte, hash common.Hash, size int, n node) {
+	if db.scheme == rawdb.PathScheme {
+		db.insertPath(c.owner, path, hash, n)
+		return
+	}
+	db.insert(hash, size, n)
+}
+
 func (c *committer) makeHashNode(data []byte) hashNode {
 	n := make(hashNode, c.sha.Size())
 	c.sha.Reset()
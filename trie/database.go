@@ -88,6 +88,21 @@ type Database struct {
 	childrenSize  common.StorageSize 
 	preimagesSize common.StorageSize 
 
+	scheme          string
+	pathDirties     map[string]*pathNode
+	pathDirtiesSize common.StorageSize
+	pathWipes       map[common.Hash]struct{}
+	layer           *pathLayer
+	persist         bool
+
+	refcount    bool
+	capped      map[common.Hash]uint32
+	gcQueue     []gcTask
+	gcRunning   bool
+	gcQueueLock sync.Mutex
+	gcLock      sync.Mutex
+	gcWait      sync.WaitGroup
+
 	lock sync.RWMutex
 }
 
@@ -283,21 +298,56 @@ func NewDatabase(diskdb ethdb.KeyValueStore) *Database {
 
 
 func NewDatabaseWithCache(diskdb ethdb.KeyValueStore, cache int, journal string) *Database {
+	return NewDatabaseWithConfig(diskdb, &Config{Cache: cache, Journal: journal})
+}
+
+type Config struct {
+	Cache    int
+	Journal  string
+	Scheme   string
+	History  int
+	RefCount bool
+	Persist  bool
+}
+
+func NewDatabaseWithConfig(diskdb ethdb.KeyValueStore, config *Config) *Database {
 	var cleans *fastcache.Cache
-	if cache > 0 {
-		if journal == "" {
-			cleans = fastcache.New(cache * 1024 * 1024)
+	if config.Cache > 0 {
+		if config.Journal == "" {
+			cleans = fastcache.New(config.Cache * 1024 * 1024)
 		} else {
-			cleans = fastcache.LoadFromFileOrNew(journal, cache*1024*1024)
+			cleans = fastcache.LoadFromFileOrNew(config.Journal, config.Cache*1024*1024)
 		}
 	}
+	scheme := config.Scheme
+	if scheme == "" {
+		scheme = rawdb.ReadStateScheme(diskdb)
+	}
+	if scheme != rawdb.PathScheme {
+		scheme = rawdb.HashScheme
+	}
+	var layer *pathLayer
+	if scheme == rawdb.PathScheme {
+		history := config.History
+		if history <= 0 {
+			history = defaultPathHistory
+		}
+		layer = newPathLayer(diskdb, history)
+	}
 	return &Database{
 		diskdb: diskdb,
 		cleans: cleans,
 		dirties: map[common.Hash]*cachedNode{{}: {
 			children: make(map[common.Hash]uint16),
 		}},
-		preimages: make(map[common.Hash][]byte),
+		preimages:    make(map[common.Hash][]byte),
+		scheme:       scheme,
+		pathDirties:  make(map[string]*pathNode),
+		pathWipes:    make(map[common.Hash]struct{}),
+		layer:        layer,
+		persist:      config.Persist,
+		refcount:     config.RefCount && scheme == rawdb.HashScheme,
+		capped:       make(map[common.Hash]uint32),
 	}
 }
 
@@ -306,6 +356,10 @@ func (db *Database) DiskDB() ethdb.KeyValueStore {
 	return db.diskdb
 }
 
+func (db *Database) Scheme() string {
+	return db.scheme
+}
+
 
 
 
@@ -326,6 +380,8 @@ func (db *Database) insert(hash common.Hash, size int, node node) {
 	entry.forChilds(func(child common.Hash) {
 		if c := db.dirties[child]; c != nil {
 			c.parents++
+		} else if _, ok := db.capped[child]; ok {
+			db.capped[child]++
 		}
 	})
 	db.dirties[hash] = entry
@@ -463,6 +519,9 @@ func (db *Database) Nodes() []common.Hash {
 
 
 func (db *Database) Reference(child common.Hash, parent common.Hash) {
+	if db.scheme == rawdb.PathScheme {
+		return
+	}
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
@@ -474,7 +533,9 @@ func (db *Database) reference(child common.Hash, parent common.Hash) {
 	
 	node, ok := db.dirties[child]
 	if !ok {
-		return
+		if _, ok := db.capped[child]; !ok {
+			return
+		}
 	}
 	
 	if db.dirties[parent].children == nil {
@@ -483,7 +544,11 @@ func (db *Database) reference(child common.Hash, parent common.Hash) {
 	} else if _, ok = db.dirties[parent].children[child]; ok && parent != (common.Hash{}) {
 		return
 	}
-	node.parents++
+	if node != nil {
+		node.parents++
+	} else {
+		db.capped[child]++
+	}
 	db.dirties[parent].children[child]++
 	if db.dirties[parent].children[child] == 1 {
 		db.childrenSize += common.HashLength + 2 
@@ -497,6 +562,9 @@ func (db *Database) Dereference(root common.Hash) {
 		log.Error("Attempted to dereference the trie cache meta root")
 		return
 	}
+	if db.scheme == rawdb.PathScheme {
+		return
+	}
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
@@ -530,6 +598,7 @@ func (db *Database) dereference(child common.Hash, parent common.Hash) {
 	
 	node, ok := db.dirties[child]
 	if !ok {
+		db.unpin(child, true)
 		return
 	}
 	
@@ -571,12 +640,19 @@ func (db *Database) dereference(child common.Hash, parent common.Hash) {
 
 
 func (db *Database) Cap(limit common.StorageSize) error {
+	if db.scheme == rawdb.PathScheme {
+		return errPathCap
+	}
 	
 	
 	
 	
+	db.gcLock.Lock()
+	defer db.gcLock.Unlock()
+
 	nodes, storage, start := len(db.dirties), db.dirtiesSize, time.Now()
 	batch := db.diskdb.NewBatch()
+	refs := db.newRefCounter()
 
 	
 	
@@ -602,9 +678,11 @@ func (db *Database) Cap(limit common.StorageSize) error {
 		
 		node := db.dirties[oldest]
 		rawdb.WriteTrieNode(batch, oldest, node.rlp())
+		db.track(refs, oldest, node)
 
 		
 		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			refs.write(batch)
 			if err := batch.Write(); err != nil {
 				log.Error("Failed to write flush list to disk", "err", err)
 				return err
@@ -621,6 +699,7 @@ func (db *Database) Cap(limit common.StorageSize) error {
 		oldest = node.flushNext
 	}
 	
+	refs.write(batch)
 	if err := batch.Write(); err != nil {
 		log.Error("Failed to write flush list to disk", "err", err)
 		return err
@@ -635,6 +714,7 @@ func (db *Database) Cap(limit common.StorageSize) error {
 	for db.oldest != oldest {
 		node := db.dirties[db.oldest]
 		delete(db.dirties, db.oldest)
+		db.persisted(db.oldest, node)
 		db.oldest = node.flushNext
 
 		db.dirtiesSize -= common.StorageSize(common.HashLength + int(node.size))
@@ -666,10 +746,16 @@ func (db *Database) Cap(limit common.StorageSize) error {
 
 
 func (db *Database) Commit(node common.Hash, report bool, callback func(common.Hash)) error {
+	if db.scheme == rawdb.PathScheme {
+		return db.commitPaths(node)
+	}
 	
 	
 	
 	
+	db.gcLock.Lock()
+	defer db.gcLock.Unlock()
+
 	start := time.Now()
 	batch := db.diskdb.NewBatch()
 
@@ -692,11 +778,14 @@ func (db *Database) Commit(node common.Hash, report bool, callback func(common.H
 	nodes, storage := len(db.dirties), db.dirtiesSize
 
 	uncacher := &cleaner{db}
-	if err := db.commit(node, batch, uncacher, callback); err != nil {
+	refs := db.newRefCounter()
+	if err := db.commit(node, batch, uncacher, callback, refs); err != nil {
 		log.Error("Failed to commit trie from trie database", "err", err)
 		return err
 	}
 	
+	db.trackRoot(refs, batch, node)
+	refs.write(batch)
 	if err := batch.Write(); err != nil {
 		log.Error("Failed to write trie to disk", "err", err)
 		return err
@@ -730,7 +819,7 @@ func (db *Database) Commit(node common.Hash, report bool, callback func(common.H
 }
 
 
-func (db *Database) commit(hash common.Hash, batch ethdb.Batch, uncacher *cleaner, callback func(common.Hash)) error {
+func (db *Database) commit(hash common.Hash, batch ethdb.Batch, uncacher *cleaner, callback func(common.Hash), refs *refCounter) error {
 	
 	node, ok := db.dirties[hash]
 	if !ok {
@@ -739,7 +828,7 @@ func (db *Database) commit(hash common.Hash, batch ethdb.Batch, uncacher *cleane
 	var err error
 	node.forChilds(func(child common.Hash) {
 		if err == nil {
-			err = db.commit(child, batch, uncacher, callback)
+			err = db.commit(child, batch, uncacher, callback, refs)
 		}
 	})
 	if err != nil {
@@ -747,10 +836,12 @@ func (db *Database) commit(hash common.Hash, batch ethdb.Batch, uncacher *cleane
 	}
 	
 	rawdb.WriteTrieNode(batch, hash, node.rlp())
+	db.track(refs, hash, node)
 	if callback != nil {
 		callback(hash)
 	}
 	if batch.ValueSize() >= ethdb.IdealBatchSize {
+		refs.write(batch)
 		if err := batch.Write(); err != nil {
 			return err
 		}
@@ -774,6 +865,9 @@ type cleaner struct {
 
 
 func (c *cleaner) Put(key []byte, rlp []byte) error {
+	if len(key) != common.HashLength {
+		return nil
+	}
 	hash := common.BytesToHash(key)
 
 	
@@ -795,6 +889,9 @@ func (c *cleaner) Put(key []byte, rlp []byte) error {
 	}
 	
 	delete(c.db.dirties, hash)
+	node.forChilds(func(child common.Hash) {
+		c.db.unpin(child, false)
+	})
 	c.db.dirtiesSize -= common.StorageSize(common.HashLength + int(node.size))
 	if node.children != nil {
 		c.db.dirtiesSize -= common.StorageSize(cachedNodeChildrenSize + len(node.children)*(common.HashLength+2))
@@ -808,7 +905,7 @@ func (c *cleaner) Put(key []byte, rlp []byte) error {
 }
 
 func (c *cleaner) Delete(key []byte) error {
-	panic("not implemented")
+	return nil
 }
 
 
@@ -817,6 +914,9 @@ func (db *Database) Size() (common.StorageSize, common.StorageSize) {
 	db.lock.RLock()
 	defer db.lock.RUnlock()
 
+	if db.scheme == rawdb.PathScheme {
+		return db.pathDirtiesSize, db.preimagesSize
+	}
 	
 	
 	
@@ -0,0 +1,249 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const defaultPathHistory = 128
+
+var (
+	errPathReadOnly = errors.New("path scheme database is not persisted")
+
+	errPathCap = errors.New("path scheme database cannot be capped")
+)
+
+type pathNode struct {
+	owner common.Hash
+	path  []byte
+	hash  common.Hash
+	blob  []byte
+}
+
+type pathDiff struct {
+	root  common.Hash
+	nodes map[string][]byte
+	size  common.StorageSize
+}
+
+type pathLayer struct {
+	diskdb ethdb.KeyValueStore
+	diffs  []*pathDiff
+	size   common.StorageSize
+	limit  int
+	lock   sync.RWMutex
+}
+
+func newPathLayer(diskdb ethdb.KeyValueStore, limit int) *pathLayer {
+	return &pathLayer{diskdb: diskdb, limit: limit}
+}
+
+func (l *pathLayer) node(owner common.Hash, path []byte, hash common.Hash) []byte {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	if blob := rawdb.ReadTrieNodeByPath(l.diskdb, owner, path); len(blob) > 0 && crypto.Keccak256Hash(blob) == hash {
+		return blob
+	}
+	key := pathKey(owner, path)
+	for i := len(l.diffs) - 1; i >= 0; i-- {
+		if blob := l.diffs[i].nodes[key]; len(blob) > 0 && crypto.Keccak256Hash(blob) == hash {
+			return blob
+		}
+	}
+	return nil
+}
+
+func pathKey(owner common.Hash, path []byte) string {
+	return string(owner[:]) + string(path)
+}
+
+func (db *Database) insertPath(owner common.Hash, path []byte, hash common.Hash, n node) {
+	blob, err := rlp.EncodeToBytes(n)
+	if err != nil {
+		panic("encode error: " + err.Error())
+	}
+	key := pathKey(owner, path)
+	if prev, ok := db.pathDirties[key]; ok {
+		db.pathDirtiesSize -= common.StorageSize(len(key) + len(prev.blob))
+	}
+	db.pathDirties[key] = &pathNode{owner: owner, path: common.CopyBytes(path), hash: hash, blob: blob}
+	db.pathDirtiesSize += common.StorageSize(len(key) + len(blob))
+
+	memcacheDirtyWriteMeter.Mark(int64(len(blob)))
+}
+
+func (db *Database) deletePath(owner common.Hash, path []byte) {
+	key := pathKey(owner, path)
+	if prev, ok := db.pathDirties[key]; ok {
+		db.pathDirtiesSize -= common.StorageSize(len(key) + len(prev.blob))
+	}
+	db.pathDirties[key] = &pathNode{owner: owner, path: common.CopyBytes(path)}
+	db.pathDirtiesSize += common.StorageSize(len(key))
+}
+
+
+
+
+func (db *Database) WipeOwner(owner common.Hash) {
+	if db.scheme != rawdb.PathScheme || owner == (common.Hash{}) {
+		return
+	}
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	for key, n := range db.pathDirties {
+		if n.owner == owner {
+			db.pathDirtiesSize -= common.StorageSize(len(key) + len(n.blob))
+			delete(db.pathDirties, key)
+		}
+	}
+	db.pathWipes[owner] = struct{}{}
+}
+
+func (db *Database) pathBlob(owner common.Hash, path []byte, hash common.Hash) []byte {
+	if db.cleans != nil {
+		if enc := db.cleans.Get(nil, hash[:]); enc != nil {
+			memcacheCleanHitMeter.Mark(1)
+			memcacheCleanReadMeter.Mark(int64(len(enc)))
+			return enc
+		}
+	}
+	key := pathKey(owner, path)
+
+	db.lock.RLock()
+	dirty := db.pathDirties[key]
+	db.lock.RUnlock()
+
+	if dirty != nil && dirty.blob != nil && dirty.hash == hash {
+		memcacheDirtyHitMeter.Mark(1)
+		memcacheDirtyReadMeter.Mark(int64(len(dirty.blob)))
+		return dirty.blob
+	}
+	memcacheDirtyMissMeter.Mark(1)
+
+	blob := db.layer.node(owner, path, hash)
+	if blob != nil && db.cleans != nil {
+		db.cleans.Set(hash[:], blob)
+		memcacheCleanMissMeter.Mark(1)
+		memcacheCleanWriteMeter.Mark(int64(len(blob)))
+	}
+	return blob
+}
+
+func (db *Database) Derive(cache int) *Database {
+	derived := NewDatabaseWithConfig(db.diskdb, &Config{Cache: cache, Scheme: db.scheme})
+	if db.scheme == rawdb.PathScheme {
+		derived.layer = db.layer
+	}
+	return derived
+}
+
+func (db *Database) commitPaths(root common.Hash) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if len(db.pathDirties) == 0 && len(db.pathWipes) == 0 && len(db.preimages) == 0 {
+		return nil
+	}
+	if !db.persist {
+		return errPathReadOnly
+	}
+	layer := db.layer
+	layer.lock.Lock()
+	defer layer.lock.Unlock()
+
+	var (
+		start = time.Now()
+		batch = db.diskdb.NewBatch()
+		diff  = &pathDiff{root: root, nodes: make(map[string][]byte, len(db.pathDirties))}
+	)
+	rawdb.WritePreimages(batch, db.preimages)
+
+	for owner := range db.pathWipes {
+		it := rawdb.IterateStorageTrieNodes(db.diskdb, owner)
+		for it.Next() {
+			path := it.Key()[len(rawdb.TrieNodeStoragePrefix)+common.HashLength:]
+			key := pathKey(owner, path)
+			if _, ok := db.pathDirties[key]; ok {
+				continue
+			}
+			rawdb.DeleteTrieNodeByPath(batch, owner, path)
+
+			prev := common.CopyBytes(it.Value())
+			diff.nodes[key] = prev
+			diff.size += common.StorageSize(len(key) + len(prev))
+		}
+		it.Release()
+	}
+	for key, n := range db.pathDirties {
+		prev := rawdb.ReadTrieNodeByPath(db.diskdb, n.owner, n.path)
+		if n.blob == nil {
+			if len(prev) == 0 {
+				continue
+			}
+			rawdb.DeleteTrieNodeByPath(batch, n.owner, n.path)
+		} else {
+			if bytes.Equal(prev, n.blob) {
+				continue
+			}
+			rawdb.WriteTrieNodeByPath(batch, n.owner, n.path, n.blob)
+			if db.cleans != nil {
+				db.cleans.Set(n.hash[:], n.blob)
+			}
+		}
+		diff.nodes[key] = prev
+		diff.size += common.StorageSize(len(key) + len(prev))
+	}
+	if err := batch.Write(); err != nil {
+		log.Error("Failed to write trie nodes to disk", "err", err)
+		return err
+	}
+	nodes, size := len(db.pathDirties), db.pathDirtiesSize
+
+	db.pathDirties, db.pathDirtiesSize = make(map[string]*pathNode), 0
+	db.pathWipes = make(map[common.Hash]struct{})
+	db.preimages, db.preimagesSize = make(map[common.Hash][]byte), 0
+
+	if len(diff.nodes) > 0 {
+		layer.diffs = append(layer.diffs, diff)
+		layer.size += diff.size
+	}
+	for len(layer.diffs) > layer.limit {
+		layer.size -= layer.diffs[0].size
+		layer.diffs[0] = nil
+		layer.diffs = layer.diffs[1:]
+	}
+	memcacheCommitTimeTimer.Update(time.Since(start))
+	memcacheCommitSizeMeter.Mark(int64(size))
+	memcacheCommitNodesMeter.Mark(int64(nodes))
+
+	log.Debug("Persisted trie nodes by path", "root", root, "nodes", nodes, "size", size, "changed", len(diff.nodes),
+		"time", time.Since(start), "history", len(layer.diffs), "historysize", layer.size)
+	return nil
+}
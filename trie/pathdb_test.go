@@ -0,0 +1,366 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package trie
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+)
+
+func newPathTestDatabase(diskdb ethdb.KeyValueStore, persist bool) *Database {
+	return NewDatabaseWithConfig(diskdb, &Config{Scheme: rawdb.PathScheme, Persist: persist})
+}
+
+func pathTestEntries(n int) map[string]string {
+	entries := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		entries[fmt.Sprintf("key-%04d", i)] = fmt.Sprintf("value-%04d-%s", i, bytes.Repeat([]byte{'x'}, i%40))
+	}
+	return entries
+}
+
+func commitPathTrie(t *testing.T, db *Database, trie *Trie) common.Hash {
+	root, err := trie.Commit(nil)
+	if err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	if err := db.Commit(root, false, nil); err != nil {
+		t.Fatalf("failed to commit database: %v", err)
+	}
+	return root
+}
+
+func checkPathTrie(t *testing.T, db *Database, owner, root common.Hash, entries map[string]string) {
+	t.Helper()
+
+	trie, err := NewWithOwner(owner, root, db)
+	if err != nil {
+		t.Fatalf("failed to open trie %x: %v", root, err)
+	}
+	for key, val := range entries {
+		have, err := trie.TryGet([]byte(key))
+		if err != nil {
+			t.Fatalf("failed to read %q from %x: %v", key, root, err)
+		}
+		if string(have) != val {
+			t.Fatalf("wrong value for %q in %x: have %q, want %q", key, root, have, val)
+		}
+	}
+	if hash := trie.Hash(); hash != root {
+		t.Fatalf("wrong trie hash: have %x, want %x", hash, root)
+	}
+}
+
+func TestPathSchemeTrie(t *testing.T) {
+	diskdb := memorydb.New()
+	db := newPathTestDatabase(diskdb, true)
+
+	trie, _ := New(common.Hash{}, db)
+	entries := pathTestEntries(500)
+	for key, val := range entries {
+		trie.Update([]byte(key), []byte(val))
+	}
+	root := commitPathTrie(t, db, trie)
+
+	if blob := rawdb.ReadTrieNodeByPath(diskdb, common.Hash{}, nil); crypto.Keccak256Hash(blob) != root {
+		t.Fatalf("root node not stored by path")
+	}
+	if blob := rawdb.ReadTrieNode(diskdb, root); len(blob) != 0 {
+		t.Fatalf("root node stored by hash")
+	}
+	checkPathTrie(t, newPathTestDatabase(diskdb, false), common.Hash{}, root, entries)
+
+	updated := make(map[string]string)
+	for i := 0; i < len(entries); i++ {
+		key := fmt.Sprintf("key-%04d", i)
+		if i%2 == 0 {
+			trie.Delete([]byte(key))
+			continue
+		}
+		updated[key] = entries[key] + "-updated"
+		trie.Update([]byte(key), []byte(updated[key]))
+	}
+	next := commitPathTrie(t, db, trie)
+	checkPathTrie(t, db, common.Hash{}, next, updated)
+
+	checkPathTrie(t, db, common.Hash{}, root, entries)
+	if _, err := New(root, newPathTestDatabase(diskdb, false)); err == nil {
+		t.Fatalf("old root readable without reverse diffs")
+	}
+
+	live := make(map[string]common.Hash)
+	for it := trie.NodeIterator(nil); it.Next(true); {
+		if it.Hash() != (common.Hash{}) {
+			live[string(it.Path())] = it.Hash()
+		}
+	}
+	it := diskdb.NewIterator(rawdb.TrieNodeAccountPrefix, nil)
+	defer it.Release()
+
+	var stored int
+	for it.Next() {
+		path := it.Key()[len(rawdb.TrieNodeAccountPrefix):]
+		if hash, ok := live[string(path)]; !ok || hash != crypto.Keccak256Hash(it.Value()) {
+			t.Fatalf("stale node at path %x", path)
+		}
+		stored++
+	}
+	if stored != len(live) {
+		t.Fatalf("wrong number of stored nodes: have %d, want %d", stored, len(live))
+	}
+}
+
+func TestPathSchemeHistory(t *testing.T) {
+	diskdb := memorydb.New()
+	db := NewDatabaseWithConfig(diskdb, &Config{Scheme: rawdb.PathScheme, Persist: true, History: 2})
+
+	var (
+		trie, _ = New(common.Hash{}, db)
+		roots   []common.Hash
+		states  []map[string]string
+		entries = make(map[string]string)
+	)
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 20; j++ {
+			key, val := fmt.Sprintf("key-%02d", j), fmt.Sprintf("value-%d-%d", i, j)
+			trie.Update([]byte(key), []byte(val))
+			entries[key] = val
+		}
+		state := make(map[string]string, len(entries))
+		for key, val := range entries {
+			state[key] = val
+		}
+		roots, states = append(roots, commitPathTrie(t, db, trie)), append(states, state)
+	}
+	for i := 1; i < len(roots); i++ {
+		checkPathTrie(t, db, common.Hash{}, roots[i], states[i])
+	}
+	if _, err := New(roots[0], db); err == nil {
+		t.Fatalf("root beyond history limit still readable")
+	}
+}
+
+func TestPathSchemeSecureTrie(t *testing.T) {
+	diskdb := memorydb.New()
+	db := newPathTestDatabase(diskdb, true)
+
+	var (
+		owners  = []common.Hash{{0x01}, {0x02}}
+		roots   = make([]common.Hash, len(owners))
+		entries = pathTestEntries(100)
+	)
+	for i, owner := range owners {
+		trie, _ := NewSecureWithOwner(owner, common.Hash{}, db)
+		for key, val := range entries {
+			trie.Update([]byte(key), []byte(val+owner.Hex()))
+		}
+		roots[i], _ = trie.Commit(nil)
+	}
+	if roots[0] == roots[1] {
+		t.Fatalf("storage tries share a root")
+	}
+	if err := db.Commit(common.Hash{0xff}, false, nil); err != nil {
+		t.Fatalf("failed to commit database: %v", err)
+	}
+	if blob := rawdb.ReadTrieNodeByPath(diskdb, common.Hash{}, nil); len(blob) != 0 {
+		t.Fatalf("storage nodes written to the account trie")
+	}
+	for i, owner := range owners {
+		if blob := rawdb.ReadTrieNodeByPath(diskdb, owner, nil); crypto.Keccak256Hash(blob) != roots[i] {
+			t.Fatalf("storage root of %x not stored under its owner", owner)
+		}
+		trie, err := NewSecureWithOwner(owner, roots[i], newPathTestDatabase(diskdb, false))
+		if err != nil {
+			t.Fatalf("failed to open storage trie: %v", err)
+		}
+		for key, val := range entries {
+			if have := trie.Get([]byte(key)); string(have) != val+owner.Hex() {
+				t.Fatalf("wrong value for %q: have %q", key, have)
+			}
+		}
+	}
+}
+
+func TestPathSchemeWipeOwner(t *testing.T) {
+	diskdb := memorydb.New()
+	db := newPathTestDatabase(diskdb, true)
+
+	var (
+		wiped   = common.Hash{0x01}
+		kept    = common.Hash{0x02}
+		entries = pathTestEntries(100)
+		roots   = make(map[common.Hash]common.Hash)
+	)
+	for _, owner := range []common.Hash{wiped, kept} {
+		trie, _ := NewWithOwner(owner, common.Hash{}, db)
+		for key, val := range entries {
+			trie.Update([]byte(key), []byte(val))
+		}
+		roots[owner], _ = trie.Commit(nil)
+	}
+	if err := db.Commit(common.Hash{0x10}, false, nil); err != nil {
+		t.Fatalf("failed to commit database: %v", err)
+	}
+
+	db.WipeOwner(wiped)
+	if err := db.Commit(common.Hash{0x11}, false, nil); err != nil {
+		t.Fatalf("failed to commit wipe: %v", err)
+	}
+	it := rawdb.IterateStorageTrieNodes(diskdb, wiped)
+	if it.Next() {
+		t.Fatalf("storage node %x left behind after wipe", it.Key())
+	}
+	it.Release()
+
+	checkPathTrie(t, db, kept, roots[kept], entries)
+	checkPathTrie(t, db, wiped, roots[wiped], entries)
+
+	db.WipeOwner(kept)
+	trie, _ := NewWithOwner(kept, common.Hash{}, db)
+	trie.Update([]byte("fresh"), []byte("value"))
+	root, _ := trie.Commit(nil)
+	if err := db.Commit(common.Hash{0x12}, false, nil); err != nil {
+		t.Fatalf("failed to commit recreated storage: %v", err)
+	}
+	checkPathTrie(t, newPathTestDatabase(diskdb, false), kept, root, map[string]string{"fresh": "value"})
+
+	it = rawdb.IterateStorageTrieNodes(diskdb, kept)
+	defer it.Release()
+	for it.Next() {
+		if path := it.Key()[len(rawdb.TrieNodeStoragePrefix)+common.HashLength:]; len(path) != 0 {
+			t.Fatalf("stale storage node at path %x", path)
+		}
+	}
+}
+
+func TestPathSchemeReadOnly(t *testing.T) {
+	diskdb := memorydb.New()
+	db := newPathTestDatabase(diskdb, false)
+
+	trie, _ := New(common.Hash{}, db)
+	trie.Update([]byte("key"), bytes.Repeat([]byte{'v'}, 64))
+	root, err := trie.Commit(nil)
+	if err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	if err := db.Commit(root, false, nil); err != errPathReadOnly {
+		t.Fatalf("wrong commit error: have %v, want %v", err, errPathReadOnly)
+	}
+	if err := db.Cap(0); err != errPathCap {
+		t.Fatalf("wrong cap error: have %v, want %v", err, errPathCap)
+	}
+	if blob := rawdb.ReadTrieNodeByPath(diskdb, common.Hash{}, nil); len(blob) != 0 {
+		t.Fatalf("read-only database wrote to disk")
+	}
+	if dirty, _ := db.Size(); dirty == 0 {
+		t.Fatalf("dirty nodes dropped by failed commit")
+	}
+	checkPathTrie(t, db, common.Hash{}, root, map[string]string{"key": string(bytes.Repeat([]byte{'v'}, 64))})
+
+	empty := newPathTestDatabase(diskdb, false)
+	if err := empty.Commit(emptyRoot, false, nil); err != nil {
+		t.Fatalf("empty commit failed: %v", err)
+	}
+}
+
+func TestPathSchemeStackTrie(t *testing.T) {
+	diskdb := memorydb.New()
+	rawdb.WriteStateScheme(diskdb, rawdb.PathScheme)
+
+	var (
+		owner   = common.Hash{0xaa}
+		stack   = NewStackTrieWithOwner(diskdb, owner)
+		trie, _ = New(common.Hash{}, NewDatabase(memorydb.New()))
+		entries = make(map[string]string)
+	)
+	for i := 0; i < 300; i++ {
+		key := fmt.Sprintf("%08d", i*7)
+		val := fmt.Sprintf("value-%d-%s", i, bytes.Repeat([]byte{'y'}, i%50))
+		stack.TryUpdate([]byte(key), []byte(val))
+		trie.Update([]byte(key), []byte(val))
+		entries[key] = val
+	}
+	root, err := stack.Commit()
+	if err != nil {
+		t.Fatalf("failed to commit stack trie: %v", err)
+	}
+	if want := trie.Hash(); root != want {
+		t.Fatalf("wrong stack trie root: have %x, want %x", root, want)
+	}
+	if blob := rawdb.ReadTrieNode(diskdb, root); len(blob) != 0 {
+		t.Fatalf("stack trie node stored by hash")
+	}
+	checkPathTrie(t, NewDatabaseWithConfig(diskdb, &Config{}), owner, root, entries)
+}
+
+func TestPathSchemeSync(t *testing.T) {
+	srcDisk := memorydb.New()
+	srcDb := newPathTestDatabase(srcDisk, true)
+
+	src, _ := New(common.Hash{}, srcDb)
+	entries := pathTestEntries(300)
+	for key, val := range entries {
+		src.Update([]byte(key), []byte(val))
+	}
+	root := commitPathTrie(t, srcDb, src)
+
+	blobs := make(map[common.Hash][]byte)
+	it := srcDisk.NewIterator(rawdb.TrieNodeAccountPrefix, nil)
+	for it.Next() {
+		blobs[crypto.Keccak256Hash(it.Value())] = common.CopyBytes(it.Value())
+	}
+	it.Release()
+
+	diskdb := memorydb.New()
+	rawdb.WriteStateScheme(diskdb, rawdb.PathScheme)
+	sched := NewSync(root, diskdb, nil, NewSyncBloom(1, diskdb))
+
+	nodes, _, _ := sched.Missing(0)
+	for len(nodes) > 0 {
+		for _, hash := range nodes {
+			blob, ok := blobs[hash]
+			if !ok {
+				t.Fatalf("unknown node requested: %x", hash)
+			}
+			if err := sched.Process(SyncResult{Hash: hash, Data: blob}); err != nil {
+				t.Fatalf("failed to process result: %v", err)
+			}
+		}
+		batch := diskdb.NewBatch()
+		if err := sched.Commit(batch); err != nil {
+			t.Fatalf("failed to commit data: %v", err)
+		}
+		batch.Write()
+		nodes, _, _ = sched.Missing(0)
+	}
+	if blob := rawdb.ReadTrieNode(diskdb, root); len(blob) != 0 {
+		t.Fatalf("synced node stored by hash")
+	}
+	checkPathTrie(t, NewDatabaseWithConfig(diskdb, &Config{}), common.Hash{}, root, entries)
+
+	again := NewSync(root, diskdb, nil, NewSyncBloom(1, diskdb))
+	if nodes, _, _ := again.Missing(0); len(nodes) != 0 {
+		t.Fatalf("sync of stored trie requested %d nodes", len(nodes))
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/ethdb/memorydb"
 	"github.com/ethereum/go-ethereum/log"
@@ -37,9 +38,12 @@ import (
 
 func (t *Trie) Prove(key []byte, fromLevel uint, proofDb ethdb.KeyValueWriter) error {
 	
-	key = keybytesToHex(key)
-	var nodes []node
-	tn := t.root
+	var (
+		hexkey = keybytesToHex(key)
+		nodes  []node
+		tn     = t.root
+	)
+	key = hexkey
 	for len(key) > 0 && tn != nil {
 		switch n := tn.(type) {
 		case *shortNode:
@@ -57,7 +61,7 @@ func (t *Trie) Prove(key []byte, fromLevel uint, proofDb ethdb.KeyValueWriter) e
 			nodes = append(nodes, n)
 		case hashNode:
 			var err error
-			tn, err = t.resolveHash(n, nil)
+			tn, err = t.resolveHash(n, hexkey[:len(hexkey)-len(key)])
 			if err != nil {
 				log.Error(fmt.Sprintf("Unhandled trie error: %v", err))
 				return err
@@ -102,6 +106,66 @@ func (t *SecureTrie) Prove(key []byte, fromLevel uint, proofDb ethdb.KeyValueWri
 
 
 
+type proofDedup struct {
+	writer ethdb.KeyValueWriter
+	seen   map[string]struct{}
+}
+
+func (p *proofDedup) Put(key []byte, value []byte) error {
+	if _, ok := p.seen[string(key)]; ok {
+		return nil
+	}
+	p.seen[string(key)] = struct{}{}
+	return p.writer.Put(key, value)
+}
+
+func (p *proofDedup) Delete(key []byte) error {
+	delete(p.seen, string(key))
+	return p.writer.Delete(key)
+}
+
+type proofChecker struct {
+	reader ethdb.KeyValueReader
+}
+
+func (p *proofChecker) Has(key []byte) (bool, error) {
+	return p.reader.Has(key)
+}
+
+func (p *proofChecker) Get(key []byte) ([]byte, error) {
+	blob, err := p.reader.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(crypto.Keccak256(blob), key) {
+		return nil, fmt.Errorf("proof node %x hash mismatch", key)
+	}
+	return blob, nil
+}
+
+
+
+
+
+
+func (t *Trie) ProveMulti(keys [][]byte, fromLevel uint, proofDb ethdb.KeyValueWriter) error {
+	dedup := &proofDedup{writer: proofDb, seen: make(map[string]struct{})}
+	for _, key := range keys {
+		if err := t.Prove(key, fromLevel, dedup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+
+
+func (t *SecureTrie) ProveMulti(keys [][]byte, fromLevel uint, proofDb ethdb.KeyValueWriter) error {
+	return t.trie.ProveMulti(keys, fromLevel, proofDb)
+}
+
+
+
 
 func VerifyProof(rootHash common.Hash, key []byte, proofDb ethdb.KeyValueReader) (value []byte, err error) {
 	key = keybytesToHex(key)
@@ -133,6 +197,25 @@ func VerifyProof(rootHash common.Hash, key []byte, proofDb ethdb.KeyValueReader)
 
 
 
+func VerifyMultiProof(rootHash common.Hash, keys [][]byte, proofDb ethdb.KeyValueReader) ([][]byte, error) {
+	var (
+		checker = &proofChecker{reader: proofDb}
+		values  = make([][]byte, len(keys))
+	)
+	for i, key := range keys {
+		value, err := VerifyProof(rootHash, key, checker)
+		if err != nil {
+			return nil, fmt.Errorf("key %x: %v", key, err)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+
+
+
+
 
 func proofToPath(rootHash common.Hash, root node, key []byte, proofDb ethdb.KeyValueReader, allowNonExistent bool) (node, []byte, error) {
 	
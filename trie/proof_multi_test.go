@@ -0,0 +1,240 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package trie
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+)
+
+type countingProofWriter struct {
+	puts  map[string]int
+	nodes *memorydb.Database
+}
+
+func newCountingProofWriter() *countingProofWriter {
+	return &countingProofWriter{puts: make(map[string]int), nodes: memorydb.New()}
+}
+
+func (w *countingProofWriter) Put(key []byte, value []byte) error {
+	w.puts[string(key)]++
+	return w.nodes.Put(key, value)
+}
+
+func (w *countingProofWriter) Delete(key []byte) error {
+	delete(w.puts, string(key))
+	return w.nodes.Delete(key)
+}
+
+func multiProofTrie(n int) (*Trie, map[string][]byte) {
+	trie := new(Trie)
+	vals := make(map[string][]byte)
+	for i := 0; i < n; i++ {
+		key := common.LeftPadBytes([]byte{byte(i >> 8), byte(i)}, 32)
+		val := []byte(fmt.Sprintf("value-%d", i))
+		trie.Update(key, val)
+		vals[string(key)] = val
+	}
+	return trie, vals
+}
+
+func TestProveMultiDedup(t *testing.T) {
+	trie, vals := multiProofTrie(500)
+	root := trie.Hash()
+
+	var keys [][]byte
+	for key := range vals {
+		keys = append(keys, []byte(key))
+		if len(keys) == 32 {
+			break
+		}
+	}
+	multi := newCountingProofWriter()
+	if err := trie.ProveMulti(keys, 0, multi); err != nil {
+		t.Fatalf("failed to create multiproof: %v", err)
+	}
+	for key, puts := range multi.puts {
+		if puts != 1 {
+			t.Errorf("node %x written %d times", key, puts)
+		}
+	}
+	if puts := multi.puts[string(root[:])]; puts != 1 {
+		t.Fatalf("root node written %d times", puts)
+	}
+
+
+	union, total := memorydb.New(), 0
+	for _, key := range keys {
+		single := memorydb.New()
+		if err := trie.Prove(key, 0, single); err != nil {
+			t.Fatalf("failed to create proof for %x: %v", key, err)
+		}
+		total += single.Len()
+		it := single.NewIterator(nil, nil)
+		for it.Next() {
+			union.Put(it.Key(), it.Value())
+		}
+		it.Release()
+	}
+	if multi.nodes.Len() != union.Len() {
+		t.Fatalf("multiproof node count mismatch: have %d, want %d", multi.nodes.Len(), union.Len())
+	}
+	if multi.nodes.Len() >= total {
+		t.Fatalf("shared nodes not deduplicated: %d nodes, %d in single proofs", multi.nodes.Len(), total)
+	}
+	it := union.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		if blob, _ := multi.nodes.Get(it.Key()); !bytes.Equal(blob, it.Value()) {
+			t.Fatalf("multiproof node %x mismatch", it.Key())
+		}
+	}
+}
+
+func TestVerifyMultiProofMixed(t *testing.T) {
+	trie, vals := multiProofTrie(500)
+	root := trie.Hash()
+
+	var keys [][]byte
+	for key := range vals {
+		keys = append(keys, []byte(key))
+		if len(keys) == 8 {
+			break
+		}
+	}
+	for i := 0; i < 8; i++ {
+		keys = append(keys, common.LeftPadBytes([]byte{0xff, byte(i)}, 32))
+	}
+	keys = append(keys, []byte{0x01})
+
+	proof := memorydb.New()
+	if err := trie.ProveMulti(keys, 0, proof); err != nil {
+		t.Fatalf("failed to create multiproof: %v", err)
+	}
+	values, err := VerifyMultiProof(root, keys, proof)
+	if err != nil {
+		t.Fatalf("failed to verify multiproof: %v", err)
+	}
+	for i, key := range keys {
+		if want := vals[string(key)]; !bytes.Equal(values[i], want) {
+			t.Errorf("key %x: value mismatch: have %x, want %x", key, values[i], want)
+		}
+	}
+	if _, err := VerifyMultiProof(common.Hash{0x01}, keys, proof); err == nil {
+		t.Fatal("multiproof verified against wrong root")
+	}
+}
+
+func TestVerifyMultiProofTampered(t *testing.T) {
+	trie, vals := multiProofTrie(500)
+	root := trie.Hash()
+
+	var keys [][]byte
+	for key := range vals {
+		keys = append(keys, []byte(key))
+		if len(keys) == 8 {
+			break
+		}
+	}
+	proof := memorydb.New()
+	if err := trie.ProveMulti(keys, 0, proof); err != nil {
+		t.Fatalf("failed to create multiproof: %v", err)
+	}
+	var nodes [][]byte
+	it := proof.NewIterator(nil, nil)
+	for it.Next() {
+		nodes = append(nodes, common.CopyBytes(it.Key()))
+	}
+	it.Release()
+
+	for _, key := range nodes {
+		blob, _ := proof.Get(key)
+
+
+		tampered := common.CopyBytes(blob)
+		tampered[len(tampered)-1] ^= 0x01
+		proof.Put(key, tampered)
+		if _, err := VerifyMultiProof(root, keys, proof); err == nil {
+			t.Fatalf("tampered node %x accepted", key)
+		}
+
+
+		proof.Delete(key)
+		if _, err := VerifyMultiProof(root, keys, proof); err == nil {
+			t.Fatalf("missing node %x accepted", key)
+		}
+		proof.Put(key, blob)
+	}
+	if _, err := VerifyMultiProof(root, keys, proof); err != nil {
+		t.Fatalf("restored multiproof rejected: %v", err)
+	}
+
+
+	forged := 0
+	for _, key := range nodes {
+		blob, _ := proof.Get(key)
+		for _, k := range keys {
+			if val := vals[string(k)]; bytes.Contains(blob, val) {
+				proof.Put(key, bytes.Replace(blob, val, bytes.Repeat([]byte{'x'}, len(val)), 1))
+				if _, err := VerifyMultiProof(root, keys, proof); err == nil {
+					t.Fatalf("forged value for key %x accepted", k)
+				}
+				proof.Put(key, blob)
+				forged++
+				break
+			}
+		}
+	}
+	if forged == 0 {
+		t.Fatal("no leaf values found in multiproof")
+	}
+}
+
+func TestSecureTrieProveMulti(t *testing.T) {
+	trie, _ := NewSecure(common.Hash{}, NewDatabase(memorydb.New()))
+	for i := 0; i < 100; i++ {
+		trie.Update([]byte{byte(i)}, []byte{byte(i), 0xff})
+	}
+	root := trie.Hash()
+
+	var keys [][]byte
+	for i := 0; i < 120; i += 10 {
+		keys = append(keys, crypto.Keccak256([]byte{byte(i)}))
+	}
+	proof := memorydb.New()
+	if err := trie.ProveMulti(keys, 0, proof); err != nil {
+		t.Fatalf("failed to create multiproof: %v", err)
+	}
+	values, err := VerifyMultiProof(root, keys, proof)
+	if err != nil {
+		t.Fatalf("failed to verify multiproof: %v", err)
+	}
+	for i := range keys {
+		var want []byte
+		if i*10 < 100 {
+			want = []byte{byte(i * 10), 0xff}
+		}
+		if !bytes.Equal(values[i], want) {
+			t.Errorf("key %d: value mismatch: have %x, want %x", i*10, values[i], want)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+
+package trie
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	diskGCTimeTimer  = metrics.NewRegisteredResettingTimer("trie/disk/gc/time", nil)
+	diskGCNodesMeter = metrics.NewRegisteredMeter("trie/disk/gc/nodes", nil)
+	diskGCSizeMeter  = metrics.NewRegisteredMeter("trie/disk/gc/size", nil)
+)
+
+
+
+const gcBatchNodes = 1024
+
+type refEntry struct {
+	refs   uint32
+	extern []common.Hash
+}
+
+type refCounter struct {
+	reader  ethdb.KeyValueReader
+	entries map[common.Hash]*refEntry
+	missing map[common.Hash]struct{}
+	dirty   map[common.Hash]struct{}
+}
+
+func (db *Database) newRefCounter() *refCounter {
+	if !db.refcount {
+		return nil
+	}
+	return newRefCounter(db.diskdb)
+}
+
+func newRefCounter(reader ethdb.KeyValueReader) *refCounter {
+	return &refCounter{
+		reader:  reader,
+		entries: make(map[common.Hash]*refEntry),
+		missing: make(map[common.Hash]struct{}),
+		dirty:   make(map[common.Hash]struct{}),
+	}
+}
+
+func (r *refCounter) get(hash common.Hash) *refEntry {
+	if entry, ok := r.entries[hash]; ok {
+		return entry
+	}
+	if _, ok := r.missing[hash]; ok {
+		return nil
+	}
+	refs, extern, ok := rawdb.ReadTrieNodeRefs(r.reader, hash)
+	if !ok {
+		r.missing[hash] = struct{}{}
+		return nil
+	}
+	entry := &refEntry{refs: refs, extern: extern}
+	r.entries[hash] = entry
+	return entry
+}
+
+func (r *refCounter) create(hash common.Hash, extern []common.Hash) {
+	r.entries[hash] = &refEntry{extern: extern}
+	delete(r.missing, hash)
+	r.dirty[hash] = struct{}{}
+}
+
+func (r *refCounter) inc(hash common.Hash) {
+	if entry := r.get(hash); entry != nil {
+		entry.refs++
+		r.dirty[hash] = struct{}{}
+	}
+}
+
+func (r *refCounter) dec(hash common.Hash) bool {
+	entry := r.get(hash)
+	if entry == nil || entry.refs == 0 {
+		return false
+	}
+	entry.refs--
+	r.dirty[hash] = struct{}{}
+	return entry.refs == 0
+}
+
+func (r *refCounter) remove(hash common.Hash) {
+	delete(r.entries, hash)
+	r.missing[hash] = struct{}{}
+	r.dirty[hash] = struct{}{}
+}
+
+func (r *refCounter) write(batch ethdb.KeyValueWriter) {
+	if r == nil {
+		return
+	}
+	for hash := range r.dirty {
+		if entry, ok := r.entries[hash]; ok {
+			rawdb.WriteTrieNodeRefs(batch, hash, entry.refs, entry.extern)
+		} else {
+			rawdb.DeleteTrieNodeRefs(batch, hash)
+		}
+	}
+	r.dirty = make(map[common.Hash]struct{})
+}
+
+type gcTask struct {
+	hash common.Hash
+	root bool
+}
+
+func (db *Database) track(refs *refCounter, hash common.Hash, node *cachedNode) {
+	if refs == nil || refs.get(hash) != nil {
+		return
+	}
+	var extern []common.Hash
+	for child := range node.children {
+		extern = append(extern, child)
+	}
+	refs.create(hash, extern)
+	node.forChilds(refs.inc)
+}
+
+func (db *Database) trackRoot(refs *refCounter, batch ethdb.KeyValueWriter, root common.Hash) {
+	if refs == nil {
+		return
+	}
+	roots := rawdb.ReadTrieRoots(db.diskdb)
+	for _, have := range roots {
+		if have == root {
+			return
+		}
+	}
+	if refs.get(root) == nil {
+		return
+	}
+	refs.inc(root)
+	rawdb.WriteTrieRoots(batch, append(roots, root))
+}
+
+func (db *Database) persisted(hash common.Hash, node *cachedNode) {
+	if !db.refcount {
+		return
+	}
+	if refs := node.parents; refs > 0 {
+		db.capped[hash] += refs
+	} else {
+		db.schedule(gcTask{hash: hash})
+	}
+	node.forChilds(func(child common.Hash) {
+		db.unpin(child, false)
+	})
+}
+
+func (db *Database) unpin(hash common.Hash, collect bool) {
+	refs, ok := db.capped[hash]
+	if !ok {
+		return
+	}
+	if refs > 1 {
+		db.capped[hash] = refs - 1
+		return
+	}
+	delete(db.capped, hash)
+	if collect {
+		db.schedule(gcTask{hash: hash})
+	}
+}
+
+func (db *Database) Roots() []common.Hash {
+	db.gcLock.Lock()
+	defer db.gcLock.Unlock()
+
+	return rawdb.ReadTrieRoots(db.diskdb)
+}
+
+func (db *Database) Release(roots ...common.Hash) {
+	if !db.refcount {
+		return
+	}
+	for _, root := range roots {
+		db.schedule(gcTask{hash: root, root: true})
+	}
+}
+
+func (db *Database) Sweep() {
+	if !db.refcount {
+		return
+	}
+	hashes := rawdb.ReadUnreferencedTrieNodes(db.diskdb)
+	if len(hashes) == 0 {
+		return
+	}
+	log.Info("Collecting unreferenced trie nodes", "nodes", len(hashes))
+	for _, hash := range hashes {
+		db.schedule(gcTask{hash: hash})
+	}
+}
+
+func (db *Database) WaitCollection() {
+	db.gcWait.Wait()
+}
+
+func (db *Database) schedule(task gcTask) {
+	db.gcQueueLock.Lock()
+	defer db.gcQueueLock.Unlock()
+
+	db.gcQueue = append(db.gcQueue, task)
+	if !db.gcRunning {
+		db.gcRunning = true
+		db.gcWait.Add(1)
+		go db.collectLoop()
+	}
+}
+
+func (db *Database) collectLoop() {
+	defer db.gcWait.Done()
+
+	for {
+		db.gcQueueLock.Lock()
+		if len(db.gcQueue) == 0 {
+			db.gcRunning = false
+			db.gcQueueLock.Unlock()
+			return
+		}
+		task := db.gcQueue[0]
+		db.gcQueue = db.gcQueue[1:]
+		db.gcQueueLock.Unlock()
+
+		if err := db.collect(task); err != nil {
+			log.Error("Failed to collect trie nodes", "hash", task.hash, "err", err)
+		}
+	}
+}
+
+func (db *Database) collect(task gcTask) error {
+	var (
+		start = time.Now()
+		nodes int
+		size  common.StorageSize
+	)
+	queue, err := db.collectTask(task)
+	for err == nil && len(queue) > 0 {
+		var (
+			n int
+			s common.StorageSize
+		)
+		queue, n, s, err = db.collectBatch(queue)
+		nodes, size = nodes+n, size+s
+	}
+	if err != nil {
+		return err
+	}
+	diskGCTimeTimer.Update(time.Since(start))
+	diskGCNodesMeter.Mark(int64(nodes))
+	diskGCSizeMeter.Mark(int64(size))
+
+	if nodes > 0 {
+		log.Debug("Deleted unreferenced trie nodes", "hash", task.hash, "root", task.root, "nodes", nodes, "size", size, "time", time.Since(start))
+	}
+	return nil
+}
+
+
+
+func (db *Database) collectTask(task gcTask) ([]common.Hash, error) {
+	db.gcLock.Lock()
+	defer db.gcLock.Unlock()
+
+	if !task.root {
+		if entry := newRefCounter(db.diskdb).get(task.hash); entry != nil && entry.refs == 0 {
+			return []common.Hash{task.hash}, nil
+		}
+		return nil, nil
+	}
+	var (
+		batch = db.diskdb.NewBatch()
+		refs  = newRefCounter(db.diskdb)
+		queue []common.Hash
+	)
+	roots := rawdb.ReadTrieRoots(db.diskdb)
+	for i, root := range roots {
+		if root != task.hash {
+			continue
+		}
+		rawdb.WriteTrieRoots(batch, append(roots[:i:i], roots[i+1:]...))
+		if refs.dec(root) {
+			queue = append(queue, root)
+		}
+		break
+	}
+	refs.write(batch)
+	return queue, batch.Write()
+}
+
+
+
+
+
+func (db *Database) collectBatch(queue []common.Hash) ([]common.Hash, int, common.StorageSize, error) {
+	db.gcLock.Lock()
+	defer db.gcLock.Unlock()
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	var (
+		batch = db.diskdb.NewBatch()
+		refs  = newRefCounter(db.diskdb)
+		nodes int
+		size  common.StorageSize
+	)
+	for visited := 0; len(queue) > 0 && visited < gcBatchNodes; visited++ {
+		hash := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+
+		if _, ok := db.capped[hash]; ok {
+			continue
+		}
+		entry := refs.get(hash)
+		if entry == nil || entry.refs > 0 {
+			continue
+		}
+		refs.remove(hash)
+		for _, child := range entry.extern {
+			if refs.dec(child) {
+				queue = append(queue, child)
+			}
+		}
+		blob := rawdb.ReadTrieNode(db.diskdb, hash)
+		if len(blob) == 0 {
+			continue
+		}
+		rawdb.DeleteTrieNode(batch, hash)
+		if db.cleans != nil {
+			db.cleans.Del(hash[:])
+		}
+		nodes, size = nodes+1, size+common.StorageSize(common.HashLength+len(blob))
+
+		forGatherChildren(simplifyNode(mustDecodeNode(hash[:], blob)), func(child common.Hash) {
+			if refs.dec(child) {
+				queue = append(queue, child)
+			}
+		})
+	}
+	refs.write(batch)
+	return queue, nodes, size, batch.Write()
+}
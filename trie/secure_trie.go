@@ -52,10 +52,16 @@ type SecureTrie struct {
 
 
 func NewSecure(root common.Hash, db *Database) (*SecureTrie, error) {
+	return NewSecureWithOwner(common.Hash{}, root, db)
+}
+
+
+
+func NewSecureWithOwner(owner common.Hash, root common.Hash, db *Database) (*SecureTrie, error) {
 	if db == nil {
 		panic("trie.NewSecure called without a database")
 	}
-	trie, err := New(root, db)
+	trie, err := NewWithOwner(owner, root, db)
 	if err != nil {
 		return nil, err
 	}
@@ -166,8 +172,19 @@ func (t *SecureTrie) Hash() common.Hash {
 }
 
 
+func (t *SecureTrie) SetAccessRecorder(recorder AccessRecorder) {
+	t.trie.SetAccessRecorder(recorder)
+}
+
+
 func (t *SecureTrie) Copy() *SecureTrie {
 	cpy := *t
+	if t.trie.deleted != nil {
+		cpy.trie.deleted = make(map[string]struct{}, len(t.trie.deleted))
+		for path := range t.trie.deleted {
+			cpy.trie.deleted[path] = struct{}{}
+		}
+	}
 	return &cpy
 }
 
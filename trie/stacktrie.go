@@ -22,6 +22,7 @@ import (
 	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rlp"
@@ -35,9 +36,11 @@ var stPool = sync.Pool{
 	},
 }
 
-func stackTrieFromPool(db ethdb.KeyValueStore) *StackTrie {
+func stackTrieFromPool(db ethdb.KeyValueStore, owner common.Hash, scheme string) *StackTrie {
 	st := stPool.Get().(*StackTrie)
 	st.db = db
+	st.owner = owner
+	st.scheme = scheme
 	return st
 }
 
@@ -56,19 +59,32 @@ type StackTrie struct {
 	keyOffset int            
 	children  [16]*StackTrie 
 
-	db ethdb.KeyValueStore 
+	db     ethdb.KeyValueStore 
+	owner  common.Hash         
+	scheme string              
 }
 
 
 func NewStackTrie(db ethdb.KeyValueStore) *StackTrie {
-	return &StackTrie{
+	return NewStackTrieWithOwner(db, common.Hash{})
+}
+
+
+
+func NewStackTrieWithOwner(db ethdb.KeyValueStore, owner common.Hash) *StackTrie {
+	st := &StackTrie{
 		nodeType: emptyNode,
 		db:       db,
+		owner:    owner,
 	}
+	if db != nil {
+		st.scheme = rawdb.ReadStateScheme(db)
+	}
+	return st
 }
 
-func newLeaf(ko int, key, val []byte, db ethdb.KeyValueStore) *StackTrie {
-	st := stackTrieFromPool(db)
+func (st *StackTrie) newLeaf(ko int, key, val []byte) *StackTrie {
+	st = stackTrieFromPool(st.db, st.owner, st.scheme)
 	st.nodeType = leafNode
 	st.keyOffset = ko
 	st.key = append(st.key, key[ko:]...)
@@ -76,8 +92,8 @@ func newLeaf(ko int, key, val []byte, db ethdb.KeyValueStore) *StackTrie {
 	return st
 }
 
-func newExt(ko int, key []byte, child *StackTrie, db ethdb.KeyValueStore) *StackTrie {
-	st := stackTrieFromPool(db)
+func (st *StackTrie) newExt(ko int, key []byte, child *StackTrie) *StackTrie {
+	st = stackTrieFromPool(st.db, st.owner, st.scheme)
 	st.nodeType = extNode
 	st.keyOffset = ko
 	st.key = append(st.key, key[ko:]...)
@@ -112,6 +128,8 @@ func (st *StackTrie) Update(key, value []byte) {
 
 func (st *StackTrie) Reset() {
 	st.db = nil
+	st.owner = common.Hash{}
+	st.scheme = ""
 	st.key = st.key[:0]
 	st.val = nil
 	for i := range st.children {
@@ -141,14 +159,14 @@ func (st *StackTrie) insert(key, value []byte) {
 		for i := idx - 1; i >= 0; i-- {
 			if st.children[i] != nil {
 				if st.children[i].nodeType != hashedNode {
-					st.children[i].hash()
+					st.children[i].hash(concat(key[:st.keyOffset], byte(i)))
 				}
 				break
 			}
 		}
 		
 		if st.children[idx] == nil {
-			st.children[idx] = stackTrieFromPool(st.db)
+			st.children[idx] = stackTrieFromPool(st.db, st.owner, st.scheme)
 			st.children[idx].keyOffset = st.keyOffset + 1
 		}
 		st.children[idx].insert(key, value)
@@ -173,14 +191,14 @@ func (st *StackTrie) insert(key, value []byte) {
 		
 		var n *StackTrie
 		if diffidx < len(st.key)-1 {
-			n = newExt(diffidx+1, st.key, st.children[0], st.db)
+			n = st.newExt(diffidx+1, st.key, st.children[0])
 		} else {
 			
 			
 			n = st.children[0]
 		}
 		
-		n.hash()
+		n.hash(concat(key[:st.keyOffset+diffidx], st.key[diffidx]))
 		var p *StackTrie
 		if diffidx == 0 {
 			
@@ -193,13 +211,13 @@ func (st *StackTrie) insert(key, value []byte) {
 			
 			
 			
-			st.children[0] = stackTrieFromPool(st.db)
+			st.children[0] = stackTrieFromPool(st.db, st.owner, st.scheme)
 			st.children[0].nodeType = branchNode
 			st.children[0].keyOffset = st.keyOffset + diffidx
 			p = st.children[0]
 		}
 		
-		o := newLeaf(st.keyOffset+diffidx+1, key, value, st.db)
+		o := st.newLeaf(st.keyOffset+diffidx+1, key, value)
 
 		
 		origIdx := st.key[diffidx]
@@ -235,7 +253,7 @@ func (st *StackTrie) insert(key, value []byte) {
 			
 			
 			st.nodeType = extNode
-			st.children[0] = NewStackTrie(st.db)
+			st.children[0] = stackTrieFromPool(st.db, st.owner, st.scheme)
 			st.children[0].nodeType = branchNode
 			st.children[0].keyOffset = st.keyOffset + diffidx
 			p = st.children[0]
@@ -246,11 +264,11 @@ func (st *StackTrie) insert(key, value []byte) {
 		
 		
 		origIdx := st.key[diffidx]
-		p.children[origIdx] = newLeaf(diffidx+1, st.key, st.val, st.db)
-		p.children[origIdx].hash()
+		p.children[origIdx] = st.newLeaf(diffidx+1, st.key, st.val)
+		p.children[origIdx].hash(concat(key[:st.keyOffset+diffidx], origIdx))
 
 		newIdx := key[diffidx+st.keyOffset]
-		p.children[newIdx] = newLeaf(p.keyOffset+1, key, value, st.db)
+		p.children[newIdx] = st.newLeaf(p.keyOffset+1, key, value)
 
 		
 		
@@ -279,7 +297,7 @@ func (st *StackTrie) insert(key, value []byte) {
 
 
 
-func (st *StackTrie) hash() {
+func (st *StackTrie) hash(path []byte) {
 	/* Shortcut if node is already hashed */
 	if st.nodeType == hashedNode {
 		return
@@ -297,7 +315,7 @@ func (st *StackTrie) hash() {
 				nodes[i] = nilValueNode
 				continue
 			}
-			child.hash()
+			child.hash(concat(path, byte(i)))
 			if len(child.val) < 32 {
 				nodes[i] = rawNode(child.val)
 			} else {
@@ -317,7 +335,7 @@ func (st *StackTrie) hash() {
 		h = newHasher(false)
 		defer returnHasherToPool(h)
 		h.tmp.Reset()
-		st.children[0].hash()
+		st.children[0].hash(concat(path, st.key...))
 		
 		
 		
@@ -372,13 +390,17 @@ func (st *StackTrie) hash() {
 	if st.db != nil {
 		
 		
-		st.db.Put(st.val, h.tmp)
+		if st.scheme == rawdb.PathScheme {
+			rawdb.WriteTrieNodeByPath(st.db, st.owner, path, h.tmp)
+		} else {
+			st.db.Put(st.val, h.tmp)
+		}
 	}
 }
 
 
 func (st *StackTrie) Hash() (h common.Hash) {
-	st.hash()
+	st.hash(nil)
 	if len(st.val) != 32 {
 		
 		
@@ -405,7 +427,7 @@ func (st *StackTrie) Commit() (common.Hash, error) {
 	if st.db == nil {
 		return common.Hash{}, ErrCommitDisabled
 	}
-	st.hash()
+	st.hash(nil)
 	h := common.BytesToHash(st.val)
 	return h, nil
 }
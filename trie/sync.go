@@ -17,12 +17,14 @@
 package trie
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/prque"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 )
 
@@ -94,21 +96,21 @@ type SyncResult struct {
 
 
 type syncMemBatch struct {
-	nodes map[common.Hash][]byte 
+	nodes map[string]*request    
 	codes map[common.Hash][]byte 
 }
 
 
 func newSyncMemBatch() *syncMemBatch {
 	return &syncMemBatch{
-		nodes: make(map[common.Hash][]byte),
+		nodes: make(map[string]*request),
 		codes: make(map[common.Hash][]byte),
 	}
 }
 
 
-func (batch *syncMemBatch) hasNode(hash common.Hash) bool {
-	_, ok := batch.nodes[hash]
+func (batch *syncMemBatch) hasNode(key string) bool {
+	_, ok := batch.nodes[key]
 	return ok
 }
 
@@ -122,21 +124,25 @@ func (batch *syncMemBatch) hasCode(hash common.Hash) bool {
 
 
 type Sync struct {
-	database ethdb.KeyValueReader     
-	membatch *syncMemBatch            
-	nodeReqs map[common.Hash]*request 
-	codeReqs map[common.Hash]*request 
-	queue    *prque.Prque             
-	fetches  map[int]int              
-	bloom    *SyncBloom               
+	database ethdb.KeyValueReader                
+	scheme   string                              
+	membatch *syncMemBatch                       
+	nodeReqs map[string]*request                 
+	nodeKeys map[common.Hash]map[string]struct{} 
+	codeReqs map[common.Hash]*request            
+	queue    *prque.Prque                        
+	fetches  map[int]int                         
+	bloom    *SyncBloom                          
 }
 
 
 func NewSync(root common.Hash, database ethdb.KeyValueReader, callback LeafCallback, bloom *SyncBloom) *Sync {
 	ts := &Sync{
 		database: database,
+		scheme:   rawdb.ReadStateScheme(database),
 		membatch: newSyncMemBatch(),
-		nodeReqs: make(map[common.Hash]*request),
+		nodeReqs: make(map[string]*request),
+		nodeKeys: make(map[common.Hash]map[string]struct{}),
 		codeReqs: make(map[common.Hash]*request),
 		queue:    prque.New(nil),
 		fetches:  make(map[int]int),
@@ -152,20 +158,9 @@ func (s *Sync) AddSubTrie(root common.Hash, path []byte, parent common.Hash, cal
 	if root == emptyRoot {
 		return
 	}
-	if s.membatch.hasNode(root) {
+	if s.hasNode(root, path) {
 		return
 	}
-	if s.bloom == nil || s.bloom.Contains(root[:]) {
-		
-		
-		
-		blob := rawdb.ReadTrieNode(s.database, root)
-		if len(blob) > 0 {
-			return
-		}
-		
-		bloomFaultMeter.Mark(1)
-	}
 	
 	req := &request{
 		path:     path,
@@ -174,7 +169,7 @@ func (s *Sync) AddSubTrie(root common.Hash, path []byte, parent common.Hash, cal
 	}
 	
 	if parent != (common.Hash{}) {
-		ancestor := s.nodeReqs[parent]
+		ancestor := s.ancestor(parent, path)
 		if ancestor == nil {
 			panic(fmt.Sprintf("sub-trie ancestor not found: %x", parent))
 		}
@@ -216,7 +211,7 @@ func (s *Sync) AddCodeEntry(hash common.Hash, path []byte, parent common.Hash) {
 	}
 	
 	if parent != (common.Hash{}) {
-		ancestor := s.nodeReqs[parent] 
+		ancestor := s.ancestor(parent, path)
 		if ancestor == nil {
 			panic(fmt.Sprintf("raw-entry ancestor not found: %x", parent))
 		}
@@ -248,12 +243,14 @@ func (s *Sync) Missing(max int) (nodes []common.Hash, paths []SyncPath, codes []
 		s.queue.Pop()
 		s.fetches[depth]++
 
-		hash := item.(common.Hash)
-		if req, ok := s.nodeReqs[hash]; ok {
-			nodeHashes = append(nodeHashes, hash)
-			nodePaths = append(nodePaths, newSyncPath(req.path))
-		} else {
-			codeHashes = append(codeHashes, hash)
+		switch item := item.(type) {
+		case string:
+			if req, ok := s.nodeReqs[item]; ok {
+				nodeHashes = append(nodeHashes, req.hash)
+				nodePaths = append(nodePaths, newSyncPath(req.path))
+			}
+		case common.Hash:
+			codeHashes = append(codeHashes, item)
 		}
 	}
 	return nodeHashes, nodePaths, codeHashes
@@ -266,8 +263,8 @@ func (s *Sync) Missing(max int) (nodes []common.Hash, paths []SyncPath, codes []
 
 
 func (s *Sync) Process(result SyncResult) error {
-	
-	if s.nodeReqs[result.Hash] == nil && s.codeReqs[result.Hash] == nil {
+	reqs := s.nodeRequests(result.Hash)
+	if len(reqs) == 0 && s.codeReqs[result.Hash] == nil {
 		return ErrNotRequested
 	}
 	
@@ -278,7 +275,10 @@ func (s *Sync) Process(result SyncResult) error {
 		s.commit(req)
 	}
 	
-	if req := s.nodeReqs[result.Hash]; req != nil && req.data == nil {
+	for _, req := range reqs {
+		if req.data != nil {
+			continue
+		}
 		filled = true
 		
 		node, err := decodeNode(result.Hash[:], result.Data)
@@ -311,9 +311,14 @@ func (s *Sync) Process(result SyncResult) error {
 
 func (s *Sync) Commit(dbw ethdb.Batch) error {
 	
-	for key, value := range s.membatch.nodes {
-		rawdb.WriteTrieNode(dbw, key, value)
-		s.bloom.Add(key[:])
+	for _, req := range s.membatch.nodes {
+		if s.scheme == rawdb.PathScheme {
+			owner, path := splitSyncPath(req.path)
+			rawdb.WriteTrieNodeByPath(dbw, owner, path, req.data)
+		} else {
+			rawdb.WriteTrieNode(dbw, req.hash, req.data)
+		}
+		s.bloom.Add(req.hash[:])
 	}
 	for key, value := range s.membatch.codes {
 		rawdb.WriteCode(dbw, key, value)
@@ -333,17 +338,6 @@ func (s *Sync) Pending() int {
 
 
 func (s *Sync) schedule(req *request) {
-	var reqset = s.nodeReqs
-	if req.code {
-		reqset = s.codeReqs
-	}
-	
-	if old, ok := reqset[req.hash]; ok {
-		old.parents = append(old.parents, req.parents...)
-		return
-	}
-	reqset[req.hash] = req
-
 	
 	
 	
@@ -353,7 +347,28 @@ func (s *Sync) schedule(req *request) {
 	for i := 0; i < 14 && i < len(req.path); i++ {
 		prio |= int64(15-req.path[i]) << (52 - i*4) 
 	}
-	s.queue.Push(req.hash, prio)
+	if req.code {
+		if old, ok := s.codeReqs[req.hash]; ok {
+			old.parents = append(old.parents, req.parents...)
+			return
+		}
+		s.codeReqs[req.hash] = req
+		s.queue.Push(req.hash, prio)
+		return
+	}
+	key := s.nodeKey(req.hash, req.path)
+	if old, ok := s.nodeReqs[key]; ok {
+		old.parents = append(old.parents, req.parents...)
+		return
+	}
+	s.nodeReqs[key] = req
+	if s.scheme == rawdb.PathScheme {
+		if s.nodeKeys[req.hash] == nil {
+			s.nodeKeys[req.hash] = make(map[string]struct{})
+		}
+		s.nodeKeys[req.hash][key] = struct{}{}
+	}
+	s.queue.Push(key, prio)
 }
 
 
@@ -403,19 +418,9 @@ func (s *Sync) children(req *request, object node) ([]*request, error) {
 		if node, ok := (child.node).(hashNode); ok {
 			
 			hash := common.BytesToHash(node)
-			if s.membatch.hasNode(hash) {
+			if s.hasNode(hash, child.path) {
 				continue
 			}
-			if s.bloom == nil || s.bloom.Contains(node) {
-				
-				
-				
-				if blob := rawdb.ReadTrieNode(s.database, common.BytesToHash(node)); len(blob) > 0 {
-					continue
-				}
-				
-				bloomFaultMeter.Mark(1)
-			}
 			
 			requests = append(requests, &request{
 				path:     child.path,
@@ -438,8 +443,15 @@ func (s *Sync) commit(req *request) (err error) {
 		delete(s.codeReqs, req.hash)
 		s.fetches[len(req.path)]--
 	} else {
-		s.membatch.nodes[req.hash] = req.data
-		delete(s.nodeReqs, req.hash)
+		key := s.nodeKey(req.hash, req.path)
+		s.membatch.nodes[key] = req
+		delete(s.nodeReqs, key)
+		if keys := s.nodeKeys[req.hash]; keys != nil {
+			delete(keys, key)
+			if len(keys) == 0 {
+				delete(s.nodeKeys, req.hash)
+			}
+		}
 		s.fetches[len(req.path)]--
 	}
 	
@@ -453,3 +465,72 @@ func (s *Sync) commit(req *request) (err error) {
 	}
 	return nil
 }
+
+
+
+func (s *Sync) nodeKey(hash common.Hash, path []byte) string {
+	if s.scheme == rawdb.PathScheme {
+		return string(path)
+	}
+	return string(hash[:])
+}
+
+
+
+func (s *Sync) nodeRequests(hash common.Hash) []*request {
+	if s.scheme != rawdb.PathScheme {
+		if req := s.nodeReqs[string(hash[:])]; req != nil {
+			return []*request{req}
+		}
+		return nil
+	}
+	var reqs []*request
+	for key := range s.nodeKeys[hash] {
+		reqs = append(reqs, s.nodeReqs[key])
+	}
+	return reqs
+}
+
+
+
+func (s *Sync) ancestor(parent common.Hash, path []byte) *request {
+	for _, req := range s.nodeRequests(parent) {
+		if bytes.HasPrefix(path, req.path) {
+			return req
+		}
+	}
+	return nil
+}
+
+
+
+func (s *Sync) hasNode(hash common.Hash, path []byte) bool {
+	if s.membatch.hasNode(s.nodeKey(hash, path)) {
+		return true
+	}
+	if s.bloom == nil || s.bloom.Contains(hash[:]) {
+		
+		
+		
+		if s.scheme == rawdb.PathScheme {
+			owner, inner := splitSyncPath(path)
+			if blob := rawdb.ReadTrieNodeByPath(s.database, owner, inner); len(blob) > 0 && crypto.Keccak256Hash(blob) == hash {
+				return true
+			}
+		} else if blob := rawdb.ReadTrieNode(s.database, hash); len(blob) > 0 {
+			return true
+		}
+		
+		bloomFaultMeter.Mark(1)
+	}
+	return false
+}
+
+
+
+func splitSyncPath(path []byte) (common.Hash, []byte) {
+	if len(path) < 64 {
+		return common.Hash{}, path
+	}
+	return common.BytesToHash(hexToKeybytes(path[:64])), path[64:]
+}
@@ -23,6 +23,7 @@ import (
 	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rlp"
@@ -42,13 +43,21 @@ var (
 type LeafCallback func(path []byte, leaf []byte, parent common.Hash) error
 
 
+type AccessRecorder interface {
+	RecordNode(hash common.Hash, blob []byte)
+}
+
+
 
 
 
 
 type Trie struct {
-	db   *Database
-	root node
+	db       *Database
+	root     node
+	recorder AccessRecorder
+	owner    common.Hash
+	deleted  map[string]struct{}
 	
 	
 	
@@ -67,11 +76,18 @@ func (t *Trie) newFlag() nodeFlag {
 
 
 func New(root common.Hash, db *Database) (*Trie, error) {
+	return NewWithOwner(common.Hash{}, root, db)
+}
+
+
+
+func NewWithOwner(owner common.Hash, root common.Hash, db *Database) (*Trie, error) {
 	if db == nil {
 		panic("trie.New called without a database")
 	}
 	trie := &Trie{
-		db: db,
+		db:    db,
+		owner: owner,
 	}
 	if root != (common.Hash{}) && root != emptyRoot {
 		rootnode, err := trie.resolveHash(root[:], nil)
@@ -365,6 +381,7 @@ func (t *Trie) delete(n node, prefix, key []byte) (bool, node, error) {
 			return false, n, nil 
 		}
 		if matchlen == len(key) {
+			t.onDelete(prefix)
 			return true, nil, nil 
 		}
 		
@@ -383,6 +400,7 @@ func (t *Trie) delete(n node, prefix, key []byte) (bool, node, error) {
 			
 			
 			
+			t.onDelete(append(prefix, n.Key...))
 			return true, &shortNode{concat(n.Key, child.Key...), child.Val, t.newFlag()}, nil
 		default:
 			return true, &shortNode{n.Key, child, t.newFlag()}, nil
@@ -425,11 +443,12 @@ func (t *Trie) delete(n node, prefix, key []byte) (bool, node, error) {
 				
 				
 				
-				cnode, err := t.resolve(n.Children[pos], prefix)
+				cnode, err := t.resolve(n.Children[pos], append(prefix, byte(pos)))
 				if err != nil {
 					return false, nil, err
 				}
 				if cnode, ok := cnode.(*shortNode); ok {
+					t.onDelete(append(prefix, byte(pos)))
 					k := append([]byte{byte(pos)}, cnode.Key...)
 					return true, &shortNode{k, cnode.Val, t.newFlag()}, nil
 				}
@@ -473,6 +492,20 @@ func concat(s1 []byte, s2 ...byte) []byte {
 	return r
 }
 
+func (t *Trie) onDelete(path []byte) {
+	if t.db.scheme != rawdb.PathScheme {
+		return
+	}
+	if t.deleted == nil {
+		t.deleted = make(map[string]struct{})
+	}
+	t.deleted[string(path)] = struct{}{}
+}
+
+func (t *Trie) SetAccessRecorder(recorder AccessRecorder) {
+	t.recorder = recorder
+}
+
 func (t *Trie) resolve(n node, prefix []byte) (node, error) {
 	if n, ok := n.(hashNode); ok {
 		return t.resolveHash(n, prefix)
@@ -482,7 +515,21 @@ func (t *Trie) resolve(n node, prefix []byte) (node, error) {
 
 func (t *Trie) resolveHash(n hashNode, prefix []byte) (node, error) {
 	hash := common.BytesToHash(n)
+	if t.db.scheme == rawdb.PathScheme {
+		if blob := t.db.pathBlob(t.owner, prefix, hash); blob != nil {
+			if t.recorder != nil {
+				t.recorder.RecordNode(hash, blob)
+			}
+			return mustDecodeNode(hash[:], blob), nil
+		}
+		return nil, &MissingNodeError{NodeHash: hash, Path: prefix}
+	}
 	if node := t.db.node(hash); node != nil {
+		if t.recorder != nil {
+			if blob, err := t.db.Node(hash); err == nil {
+				t.recorder.RecordNode(hash, blob)
+			}
+		}
 		return node, nil
 	}
 	return nil, &MissingNodeError{NodeHash: hash, Path: prefix}
@@ -502,6 +549,14 @@ func (t *Trie) Commit(onleaf LeafCallback) (root common.Hash, err error) {
 	if t.db == nil {
 		panic("commit called on trie with nil database")
 	}
+	if len(t.deleted) > 0 {
+		t.db.lock.Lock()
+		for path := range t.deleted {
+			t.db.deletePath(t.owner, []byte(path))
+		}
+		t.db.lock.Unlock()
+		t.deleted = nil
+	}
 	if t.root == nil {
 		return emptyRoot, nil
 	}
@@ -509,6 +564,7 @@ func (t *Trie) Commit(onleaf LeafCallback) (root common.Hash, err error) {
 	
 	rootHash := t.Hash()
 	h := newCommitter()
+	h.owner = t.owner
 	defer returnCommitterToPool(h)
 
 	
@@ -561,4 +617,5 @@ func (t *Trie) hashRoot(db *Database) (node, node, error) {
 func (t *Trie) Reset() {
 	t.root = nil
 	t.unhashed = 0
+	t.deleted = nil
 }